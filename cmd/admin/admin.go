@@ -0,0 +1,152 @@
+// Package admin implements the maintenance subcommands, which drive a running
+// server through its admin endpoints.
+package admin
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const tokenEnv = "SAMPLE_BACKEND_TOKEN"
+
+var commands = map[string]func(args []string) error{
+	"backup":  backup,
+	"restore": restore,
+}
+
+// Run executes the subcommand name with args.
+func Run(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q, want one of: backup, restore", name)
+	}
+	return cmd(args)
+}
+
+type client struct {
+	addr  string
+	token string
+}
+
+func (cl *client) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cl.addr, "addr", "http://localhost:8080", "server address")
+	fs.StringVar(&cl.token, "token", os.Getenv(tokenEnv), "bearer token, defaults to $"+tokenEnv)
+}
+
+func (cl *client) do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	if cl.token == "" {
+		return nil, errors.New("missing token, use -token or $" + tokenEnv)
+	}
+
+	r, err := http.NewRequest(method, strings.TrimSuffix(cl.addr, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "Bearer "+cl.token)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func backup(args []string) error {
+	var (
+		cl  client
+		out string
+	)
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	cl.flags(fs)
+	fs.StringVar(&out, "o", "", "archive file to write, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	resp, err := cl.do(http.MethodGet, "/api/admin/backup", "", nil)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if out != "" {
+		// Write next to the target and rename, so a failed download never
+		// leaves a truncated archive behind.
+		tmp := out + ".partial"
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		defer os.Remove(tmp)
+		defer f.Close()
+
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			return fmt.Errorf("backup: download: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		if err := os.Rename(tmp, out); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "backup written to", out)
+		return nil
+	}
+
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return fmt.Errorf("backup: download: %w", err)
+	}
+	return nil
+}
+
+func restore(args []string) error {
+	var (
+		cl     client
+		in     string
+		dryRun bool
+	)
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	cl.flags(fs)
+	fs.StringVar(&in, "i", "", "archive file to restore, defaults to stdin")
+	fs.BoolVar(&dryRun, "dry-run", false, "only validate the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if in != "" {
+		f, err := os.Open(in)
+		if err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	path := "/api/admin/restore"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	resp, err := cl.do(http.MethodPost, path, "application/gzip", r)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+	return err
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sampleBackend/internal/idempotency"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/user"
+)
+
+const (
+	productStorageMemory      = "memory"
+	productStorageEventSource = "eventsourced"
+)
+
+type config struct {
+	// Addr is the HTTP listen address, $HTTP_ADDR.
+	Addr string
+	// ProductStorage selects the product backend, $PRODUCT_STORAGE: memory
+	// or eventsourced.
+	ProductStorage string
+	// JobDir keeps the background job records, $JOB_DIR. They are kept in
+	// memory when empty.
+	JobDir string
+	// JobWorkers is how many jobs run at the same time, $JOB_WORKERS.
+	JobWorkers int
+	// JobRetention is how long finished jobs and their files are kept,
+	// $JOB_RETENTION.
+	JobRetention time.Duration
+	// IdempotencyTTL is how long responses are replayed for retries with
+	// the same Idempotency-Key, $IDEMPOTENCY_TTL.
+	IdempotencyTTL time.Duration
+	// IdempotencyMaxKeys is how many keys are kept per user,
+	// $IDEMPOTENCY_MAX_KEYS, and IdempotencyMaxBody the size of the
+	// largest response kept, $IDEMPOTENCY_MAX_BODY.
+	IdempotencyMaxKeys int
+	IdempotencyMaxBody int
+	// PurgeRetention is how long deleted products are kept before being
+	// purged, $PURGE_RETENTION. PurgeInterval is how often they and the
+	// finished jobs are looked for, $PURGE_INTERVAL.
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// ReservationExpiryInterval is how often expired reservations are
+	// released, $RESERVATION_EXPIRY_INTERVAL.
+	ReservationExpiryInterval time.Duration
+	// ReservationRetention is how long finished reservations are kept,
+	// $RESERVATION_RETENTION.
+	ReservationRetention time.Duration
+	// StatusTransitions is the table of the allowed status changes,
+	// $STATUS_TRANSITIONS, as read by product.ParseTransitions.
+	StatusTransitions product.Transitions
+	// DefaultCurrency is the currency of prices sent without one, like the
+	// integers of the legacy API, $DEFAULT_CURRENCY.
+	DefaultCurrency string
+	// Admins are the emails of the users allowed to use /api/admin,
+	// $ADMIN_EMAILS separated by commas. Their accounts are created at
+	// startup with AdminPassword, $ADMIN_PASSWORD.
+	Admins        []string
+	AdminPassword string
+	// TokenTTL is how long login tokens are valid, $TOKEN_TTL.
+	TokenTTL time.Duration
+}
+
+func loadConfig() config {
+	return config{
+		Addr:           getEnv("HTTP_ADDR", ":8080"),
+		ProductStorage: getEnv("PRODUCT_STORAGE", productStorageMemory),
+		JobDir:         getEnv("JOB_DIR", ""),
+		JobWorkers:     getEnvInt("JOB_WORKERS", 2),
+		JobRetention:   getEnvDuration("JOB_RETENTION", 7*24*time.Hour),
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		IdempotencyMaxKeys: getEnvInt("IDEMPOTENCY_MAX_KEYS", idempotency.DefaultMaxKeys),
+		IdempotencyMaxBody: getEnvInt("IDEMPOTENCY_MAX_BODY", idempotency.DefaultMaxBodySize),
+
+		PurgeRetention: getEnvDuration("PURGE_RETENTION", 30*24*time.Hour),
+		PurgeInterval:  getEnvDuration("PURGE_INTERVAL", time.Hour),
+
+		ReservationExpiryInterval: getEnvDuration("RESERVATION_EXPIRY_INTERVAL", 30*time.Second),
+		ReservationRetention:      getEnvDuration("RESERVATION_RETENTION", reservation.DefaultRetention),
+
+		StatusTransitions: getEnvTransitions("STATUS_TRANSITIONS", product.DefaultTransitions),
+		DefaultCurrency:   getEnvCurrency("DEFAULT_CURRENCY", product.DefaultCurrency),
+		Admins:            getEnvList("ADMIN_EMAILS"),
+		AdminPassword:     getEnv("ADMIN_PASSWORD", ""),
+		TokenTTL:          getEnvDuration("TOKEN_TTL", user.DefaultTokenTTL),
+	}
+}
+
+func getEnv(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func getEnvInt(key string, def int) int {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		fmt.Printf("invalid %s %q, using %d\n", key, v, def)
+		return def
+	}
+	return n
+}
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		fmt.Printf("invalid %s %q, using %s\n", key, v, def)
+		return def
+	}
+	return d
+}
+
+func getEnvList(key string) []string {
+	var ret []string
+	for _, v := range strings.Split(getEnv(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func getEnvCurrency(key, def string) string {
+	v := strings.ToUpper(getEnv(key, def))
+	if !money.ValidCurrency(v) {
+		fmt.Printf("invalid %s %q, using %s\n", key, v, def)
+		return def
+	}
+	return v
+}
+
+func getEnvTransitions(key string, def product.Transitions) product.Transitions {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	t, err := product.ParseTransitions(v)
+	if err != nil {
+		fmt.Printf("invalid %s %q: %v, using %q\n", key, v, err, def)
+		return def
+	}
+	return t
+}
@@ -1,26 +1,82 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
 	"sampleBackend/internal/api"
+	"sampleBackend/internal/audit"
+	"sampleBackend/internal/idempotency"
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/pricing"
 	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/search"
+	"sampleBackend/internal/storage/file"
 	"sampleBackend/internal/storage/memory"
 	"sampleBackend/internal/user"
+	"sampleBackend/internal/warehouse"
 )
 
 func (s *Server) init() {
 	s.once.Do(func() {
+		cfg := loadConfig()
+		s.cfg = cfg
+
 		// Init API server
 		userStorage := memory.NewUserStorage()
-		userSvc := user.NewService(userStorage)
+		userSvc := user.NewService(userStorage, user.WithAdmins(cfg.Admins...), user.WithTokenTTL(cfg.TokenTTL))
+		if len(cfg.Admins) > 0 {
+			if err := userSvc.ProvisionAdmins(context.Background(), cfg.AdminPassword); err != nil {
+				fmt.Printf("admins: %v, /api/admin is unusable\n", err)
+			}
+		}
+
+		var prdStorage product.Storage
+		switch cfg.ProductStorage {
+		case productStorageEventSource:
+			prdStorage = memory.NewProductEventStorage(memory.DefaultMaxProductEvents)
+		case productStorageMemory:
+			prdStorage = memory.NewProductStorage()
+		default:
+			fmt.Printf("unknown product storage %q, using %q\n", cfg.ProductStorage, productStorageMemory)
+			prdStorage = memory.NewProductStorage()
+		}
+		s.audit = audit.NewRecorder(memory.NewAuditStorage())
+		s.ledger = inventory.NewLedger(memory.NewLedgerStorage())
+		prdSvc := product.NewService(prdStorage,
+			product.WithTransitions(cfg.StatusTransitions),
+			product.WithCurrency(cfg.DefaultCurrency),
+			product.WithChangeHooks(s.audit.Record, s.ledger.Record),
+		)
+		s.products = prdSvc
+		s.indexer = search.NewIndexer(prdSvc)
+		s.reservations = reservation.NewService(memory.NewReservationStorage(), prdSvc)
+
+		var jobStorage job.Storage = memory.NewJobStorage()
+		if cfg.JobDir != "" {
+			fs, err := file.NewJobStorage(cfg.JobDir)
+			if err != nil {
+				fmt.Printf("job storage %q: %v, keeping jobs in memory\n", cfg.JobDir, err)
+			} else {
+				jobStorage = fs
+			}
+		}
+		s.jobs = job.NewService(jobStorage, job.WithWorkers(cfg.JobWorkers))
 
-		prdStorage := memory.NewProductStorage()
-		prdSvc := product.NewService(prdStorage)
-		a := api.NewAPI(userSvc, prdSvc)
+		a := api.NewAPI(userSvc, prdSvc,
+			api.WithSearchIndexer(s.indexer), api.WithJobService(s.jobs),
+			api.WithAuditRecorder(s.audit), api.WithStockLedger(s.ledger),
+			api.WithPricing(pricing.NewService(memory.NewPriceStorage(), prdSvc)),
+			api.WithReservations(s.reservations),
+			api.WithWarehouses(warehouse.NewService(memory.NewWarehouseStorage(), prdSvc)),
+			api.WithIdempotencyStore(idempotency.NewStore(cfg.IdempotencyTTL,
+				idempotency.WithMaxKeys(cfg.IdempotencyMaxKeys),
+				idempotency.WithMaxBodySize(cfg.IdempotencyMaxBody))))
 
 		gin.SetMode(gin.ReleaseMode)
 
@@ -28,16 +84,15 @@ func (s *Server) init() {
 		e.Use(func(c *gin.Context) {
 			c.Next()
 			if len(c.Errors) > 0 {
-				fmt.Println(c.Errors.String())
+				fmt.Printf("request %s: %s", api.RequestID(c), c.Errors.String())
 			}
 		})
 		e.Use(gin.Recovery())
 
 		a.Route(e)
 
-		addr := ":8080"
 		s.http = &http.Server{
-			Addr:    addr,
+			Addr:    cfg.Addr,
 			Handler: e,
 		}
 	})
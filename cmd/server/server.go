@@ -9,14 +9,29 @@ import (
 	"os/signal"
 	"sync"
 	"time"
+
+	"sampleBackend/internal/audit"
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/search"
 )
 
 type Server struct {
 	stop     chan struct{}
 	waitStop *sync.WaitGroup
 	once     sync.Once
+	cfg      config
+
+	http     *http.Server
+	products *product.Service
+	indexer  *search.Indexer
+	audit    *audit.Recorder
+	ledger   *inventory.Ledger
+	jobs     *job.Service
 
-	http *http.Server
+	reservations *reservation.Service
 }
 
 func New() *Server {
@@ -36,6 +51,11 @@ func (s *Server) Start() {
 		close(s.stop)
 	}()
 
+	s.startSearchIndexer()
+	s.startJobs()
+	s.startJobPurger()
+	s.startPurger()
+	s.startReservationExpiry()
 	s.startHTTP()
 
 	s.waitStop.Wait()
@@ -68,3 +88,114 @@ func (s *Server) startHTTP() {
 		fmt.Println("http server: closed successfully")
 	}()
 }
+
+func (s *Server) startSearchIndexer() {
+	fmt.Println("search indexer: start")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.waitStop.Add(1)
+
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	go func() {
+		defer s.waitStop.Done()
+		if err := s.indexer.Run(ctx); !errors.Is(err, context.Canceled) {
+			fmt.Println("search indexer: Run failed:", err)
+			return
+		}
+		fmt.Println("search indexer: stopped")
+	}()
+}
+
+// startJobs runs the background jobs. On stop, running jobs are given the
+// drain timeout of the service to finish.
+func (s *Server) startJobs() {
+	fmt.Println("jobs: start")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.waitStop.Add(1)
+
+	go func() {
+		<-s.stop
+		fmt.Println("jobs: draining")
+		cancel()
+	}()
+
+	go func() {
+		defer s.waitStop.Done()
+		if err := s.jobs.Run(ctx); !errors.Is(err, context.Canceled) {
+			fmt.Println("jobs: Run failed:", err)
+			return
+		}
+		fmt.Println("jobs: stopped")
+	}()
+}
+
+// startJobPurger deletes the jobs finished for longer than the retention.
+func (s *Server) startJobPurger() {
+	fmt.Printf("job purger: start, retention %s every %s\n", s.cfg.JobRetention, s.cfg.PurgeInterval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.waitStop.Add(1)
+
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	go func() {
+		defer s.waitStop.Done()
+		if err := s.jobs.RunPurge(ctx, s.cfg.JobRetention, s.cfg.PurgeInterval); !errors.Is(err, context.Canceled) {
+			fmt.Println("job purger: Run failed:", err)
+			return
+		}
+		fmt.Println("job purger: stopped")
+	}()
+}
+
+// startPurger purges the products deleted for longer than the retention.
+func (s *Server) startPurger() {
+	fmt.Printf("product purger: start, retention %s every %s\n", s.cfg.PurgeRetention, s.cfg.PurgeInterval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.waitStop.Add(1)
+
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	go func() {
+		defer s.waitStop.Done()
+		if err := s.products.RunPurge(ctx, s.cfg.PurgeRetention, s.cfg.PurgeInterval); !errors.Is(err, context.Canceled) {
+			fmt.Println("product purger: Run failed:", err)
+			return
+		}
+		fmt.Println("product purger: stopped")
+	}()
+}
+
+// startReservationExpiry releases the reservations past their expiry.
+func (s *Server) startReservationExpiry() {
+	fmt.Printf("reservation expiry: start, every %s, retention %s\n", s.cfg.ReservationExpiryInterval, s.cfg.ReservationRetention)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.waitStop.Add(1)
+
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	go func() {
+		defer s.waitStop.Done()
+		if err := s.reservations.RunExpiry(ctx, s.cfg.ReservationExpiryInterval, s.cfg.ReservationRetention); !errors.Is(err, context.Canceled) {
+			fmt.Println("reservation expiry: Run failed:", err)
+			return
+		}
+		fmt.Println("reservation expiry: stopped")
+	}()
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/backup"
+)
+
+func (api *API) handleBackup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fmt.Println("backup: start")
+
+		name := fmt.Sprintf("backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+		c.Header("Content-Type", "application/gzip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+		m, err := api.backupSvc.Backup(c.Request.Context(), c.Writer)
+		if err != nil {
+			// Once streaming started the archive is cut short instead.
+			if c.Writer.Written() {
+				_ = c.Error(err)
+				return
+			}
+			c.Header("Content-Disposition", "")
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("backup: done %#v\n", m.Files)
+	}
+}
+
+func (api *API) handleRestore() gin.HandlerFunc {
+	type (
+		request struct {
+			DryRun bool `form:"dry_run"`
+		}
+		response struct {
+			DryRun   bool             `json:"dry_run"`
+			Manifest *backup.Manifest `json:"manifest"`
+			// DroppedReservations and DroppedTransfers are ended by the
+			// restore, as the archive does not have them pending.
+			DroppedReservations []string `json:"dropped_reservations"`
+			DroppedTransfers    []string `json:"dropped_transfers"`
+		}
+	)
+
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+		fmt.Printf("restore: dry run %v\n", r.DryRun)
+
+		// The archive is either the raw body or the "file" part of a
+		// multipart form.
+		var body io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			fh, err := c.FormFile("file")
+			if err != nil {
+				abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+				return
+			}
+			f, err := fh.Open()
+			if err != nil {
+				abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+
+		res, err := api.backupSvc.Restore(ctx, body, r.DryRun)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if len(res.DroppedReservations) > 0 || len(res.DroppedTransfers) > 0 {
+			fmt.Printf("restore: dropped reservations %v, transfers %v\n", res.DroppedReservations, res.DroppedTransfers)
+		}
+
+		c.JSON(http.StatusOK, response{
+			DryRun:              r.DryRun,
+			Manifest:            res.Manifest,
+			DroppedReservations: res.DroppedReservations,
+			DroppedTransfers:    res.DroppedTransfers,
+		})
+	}
+}
+
+// handleProductRestore brings back a deleted product. An If-Match header
+// must match the version of its tombstone.
+func (api *API) handleProductRestore() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+		fmt.Printf("product restore: %v\n", sku)
+
+		version, err := api.matchVersion(c, sku, true)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		prd, err := api.prdSvc.RestoreProduct(ctx, sku, version)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		renderProduct(c, http.StatusOK, prd)
+	}
+}
@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+)
+
+func TestAPIBackupRestore(t *testing.T) {
+	pathBackup := "/api/admin/backup"
+	pathRestore := "/api/admin/restore"
+	pathAdd := "/api/item/add"
+	pathSearch := "/api/item/search"
+
+	addProduct := func(t *testing.T, api http.Handler, sku string) {
+		data := url.Values{}
+		data.Add("sku", sku)
+		data.Add("name", sku+"-name")
+		data.Add("price", "100")
+		data.Add("unit", "Carton")
+		w := postForm(t, api, pathAdd, data, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+	search := func(t *testing.T, api http.Handler, sku string) int {
+		data := url.Values{}
+		data.Set("sku", sku)
+		return postForm(t, api, pathSearch, data, bearer).Code
+	}
+
+	t.Run("requires authorization", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := get(t, api, pathBackup, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// Any user can register, only administrators back up and restore.
+		w = get(t, api, pathBackup, bearer)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, CodeForbidden, decodeProblem(t, w).Code)
+		w = post(t, api, pathRestore, "application/gzip", []byte("hello"), bearer)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = post(t, api, "/api/admin/products/SKU-1/restore", "application/json", nil, bearer)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Administrators are provisioned, their emails cannot be registered.
+		data := url.Values{}
+		data.Add("email", adminUser)
+		data.Add("password", "123456")
+		w = postForm(t, api, "/api/register", data, "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("backup and restore", func(t *testing.T) {
+		t.Parallel()
+
+		src := makeAPI(t)
+		addProduct(t, src, "BKP-001")
+		addProduct(t, src, "BKP-002")
+
+		w := get(t, src, pathBackup, adminBearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+		archive := w.Body.Bytes()
+
+		dst := makeAPI(t)
+		addProduct(t, dst, "OLD-001")
+
+		w = post(t, dst, pathRestore+"?dry_run=true", "application/gzip", archive, adminBearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"records":2`)
+		assert.Equal(t, http.StatusOK, search(t, dst, "OLD-001"))
+		assert.Equal(t, http.StatusNotFound, search(t, dst, "BKP-001"))
+
+		w = post(t, dst, pathRestore, "application/gzip", archive, adminBearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		// The archive has password hashes, which still log the users in.
+		assert.NotContains(t, string(gunzip(t, archive)), `"password":`)
+		w = postForm(t, dst, "/api/auth/login", url.Values{"email": {registeredUser}, "password": {password}}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusNotFound, search(t, dst, "OLD-001"))
+		assert.Equal(t, http.StatusOK, search(t, dst, "BKP-001"))
+		assert.Equal(t, http.StatusOK, search(t, dst, "BKP-002"))
+	})
+
+	t.Run("reject invalid archive", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		addProduct(t, api, "KEEP-001")
+
+		w := get(t, api, pathBackup, adminBearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		archive := w.Body.Bytes()
+
+		// Flip a byte inside the compressed payload.
+		corrupted := append([]byte(nil), archive...)
+		corrupted[len(corrupted)/2] ^= 0xff
+
+		var notTar bytes.Buffer
+		gz := gzip.NewWriter(&notTar)
+		_, _ = gz.Write([]byte("hello"))
+		require.NoError(t, gz.Close())
+
+		newVersion := makeArchive(t, map[string]string{
+			"manifest.json": `{"format":"sample-backend-backup","version":99,"files":[]}`,
+		})
+		otherFormat := makeArchive(t, map[string]string{
+			"manifest.json": `{"format":"other","version":1,"files":[]}`,
+		})
+
+		for name, body := range map[string][]byte{
+			"not gzip":     []byte("hello"),
+			"not tar":      notTar.Bytes(),
+			"corrupted":    corrupted,
+			"new version":  newVersion,
+			"other format": otherFormat,
+		} {
+			w = post(t, api, pathRestore, "application/gzip", body, adminBearer)
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		}
+		assert.Equal(t, http.StatusOK, search(t, api, "KEEP-001"))
+	})
+}
+
+func makeArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	out, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return out
+}
@@ -3,43 +3,118 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"sampleBackend/internal/audit"
+	"sampleBackend/internal/backup"
+	"sampleBackend/internal/idempotency"
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/pricing"
 	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/search"
 	"sampleBackend/internal/user"
+	"sampleBackend/internal/warehouse"
 )
 
 type API struct {
-	userSvc *user.Service
-	prdSvc  *product.Service
+	userSvc      *user.Service
+	prdSvc       *product.Service
+	backupSvc    *backup.Service
+	searcher     *search.Indexer
+	jobs         *job.Service
+	audit        *audit.Recorder
+	pricing      *pricing.Service
+	ledger       *inventory.Ledger
+	reservations *reservation.Service
+	warehouses   *warehouse.Service
+
+	idempotency *idempotency.Store
 }
 
-func NewAPI(userSvc *user.Service, prdSvc *product.Service) *API {
-	return &API{
+type Option func(api *API)
+
+// WithSearchIndexer shares an indexer with the caller, e.g. to keep it warm
+// with Run. By default the API builds its own.
+func WithSearchIndexer(ix *search.Indexer) Option {
+	return func(api *API) {
+		api.searcher = ix
+	}
+}
+
+func NewAPI(userSvc *user.Service, prdSvc *product.Service, opts ...Option) *API {
+	api := &API{
 		userSvc: userSvc,
 		prdSvc:  prdSvc,
 	}
+	for _, opt := range opts {
+		opt(api)
+	}
+	var backupOpts []backup.Option
+	if api.warehouses != nil {
+		backupOpts = append(backupOpts, backup.WithWarehouses(api.warehouses))
+	}
+	if api.reservations != nil {
+		backupOpts = append(backupOpts, backup.WithReservations(api.reservations))
+	}
+	api.backupSvc = backup.NewService(userSvc, prdSvc, backupOpts...)
+	if api.searcher == nil {
+		api.searcher = search.NewIndexer(prdSvc)
+	}
+	if api.idempotency == nil {
+		api.idempotency = idempotency.NewStore(idempotency.DefaultTTL)
+	}
+	if api.jobs != nil {
+		api.registerJobs()
+	}
+	return api
 }
 
 func (api *API) Route(route gin.IRouter) {
+	route.Use(requestID(), recovery())
+	if e, ok := route.(*gin.Engine); ok {
+		e.NoRoute(handleNoRoute)
+	}
+
 	g := route.Group("/api")
+	g.GET("/problems/:code", api.handleProblemType())
 	g.POST("/register", api.handleUserRegister())
 	g.POST("/auth/login", api.handleUserLogin())
 
-	g.GET("/items", api.authorizationMiddleware(), api.handleProductList())
-	prdGroup := g.Group("/item", api.authorizationMiddleware())
-	prdGroup.POST("/add", api.handleProductAdd())
-	prdGroup.POST("/update", api.handleProductUpdate())
-	prdGroup.POST("/delete", api.handleProductDelete())
+	// The product routes below are superseded by /api/v2/products.
+	legacy := g.Group("", deprecated(v2ProductsPath))
+	legacy.GET("/items", api.authorizationMiddleware(), api.handleProductList(false))
+	legacy.GET("/items/search", api.authorizationMiddleware(), api.handleProductFullTextSearch(false))
+	prdGroup := legacy.Group("/item", api.authorizationMiddleware())
+	prdGroup.POST("/add", api.idempotent(), api.handleProductAdd())
+	prdGroup.POST("/update", api.idempotent(), api.handleProductUpdate())
+	prdGroup.POST("/delete", api.idempotent(), api.handleProductDelete())
 	prdGroup.POST("/search", api.handleProductSearch())
+	prdGroup.POST("/events", api.handleProductEvents())
+	prdGroup.POST("/asof", api.handleProductAsOf())
+
+	adminGroup := g.Group("/admin", api.authorizationMiddleware(), api.adminRequired())
+	adminGroup.GET("/backup", api.handleBackup())
+	adminGroup.POST("/restore", api.handleRestore())
+	adminGroup.POST("/products/:sku/restore", api.handleProductRestore())
+
+	jobGroup := g.Group("/jobs", api.authorizationMiddleware(), api.jobsRequired())
+	jobGroup.GET("/:id", api.handleJobGet())
+	jobGroup.GET("/:id/output", api.handleJobOutput())
+	jobGroup.POST("/:id/cancel", api.handleJobCancel())
+
+	api.routeV2(route)
 }
 
 func (api *API) handleUserRegister() gin.HandlerFunc {
 	type (
 		request struct {
-			Email    string `form:"email" binding:"required"`
-			Password string `form:"password" binding:"required"`
+			Email    string `json:"email" form:"email" binding:"required"`
+			Password string `json:"password" form:"password" binding:"required"`
 		}
 	)
 
@@ -49,10 +124,9 @@ func (api *API) handleUserRegister() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("register user: %v\n", r.Email)
@@ -63,13 +137,7 @@ func (api *API) handleUserRegister() gin.HandlerFunc {
 			Password: r.Password,
 		})
 		if err != nil {
-			_ = c.Error(err)
-			if user.IsErrUserExist(err) {
-				c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("user already exist")))
-				return
-			}
-
-			c.JSON(http.StatusInternalServerError, NewError(fmt.Sprintf("%v", err)))
+			abortWithError(c, err)
 			return
 		}
 
@@ -80,8 +148,8 @@ func (api *API) handleUserRegister() gin.HandlerFunc {
 func (api *API) handleUserLogin() gin.HandlerFunc {
 	type (
 		request struct {
-			Email    string `form:"email" binding:"required"`
-			Password string `form:"password" binding:"required"`
+			Email    string `json:"email" form:"email" binding:"required"`
+			Password string `json:"password" form:"password" binding:"required"`
 		}
 		response struct {
 			Token string `json:"token"`
@@ -94,10 +162,9 @@ func (api *API) handleUserLogin() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("user login: %v\n", r.Email)
@@ -108,13 +175,7 @@ func (api *API) handleUserLogin() gin.HandlerFunc {
 			Password: r.Password,
 		})
 		if err != nil {
-			_ = c.Error(err)
-			if user.IsErrUserInvalid(err) {
-				c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("user invalid")))
-				return
-			}
-
-			c.JSON(http.StatusInternalServerError, NewError(fmt.Sprintf("%v", err)))
+			abortWithError(c, err)
 			return
 		}
 
@@ -125,12 +186,12 @@ func (api *API) handleUserLogin() gin.HandlerFunc {
 func (api *API) handleProductAdd() gin.HandlerFunc {
 	type (
 		request struct {
-			SKU      string `form:"sku" binding:"required"`
-			Name     string `form:"name" binding:"required"`
-			Quantity uint32 `form:"qty"`
-			Price    uint64 `form:"price" binding:"required"`
-			Unit     string `form:"unit" binding:"required"`
-			Status   uint8  `form:"status"`
+			SKU      string `json:"sku" form:"sku"`
+			Name     string `json:"name" form:"name"`
+			Quantity uint32 `json:"qty" form:"qty"`
+			Price    int64  `json:"price" form:"price"`
+			Unit     string `json:"unit" form:"unit"`
+			Status   uint8  `json:"status" form:"status"`
 		}
 	)
 	return func(c *gin.Context) {
@@ -139,45 +200,42 @@ func (api *API) handleProductAdd() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("product add: %#v\n", r)
 
-		err = api.prdSvc.AddProduct(ctx, product.Product{
+		prd, err := api.prdSvc.AddProduct(ctx, product.Product{
 			SKU:      r.SKU,
 			Name:     r.Name,
 			Quantity: r.Quantity,
-			Price:    r.Price,
+			Price:    money.Money{Amount: r.Price},
 			Unit:     r.Unit,
-			Status:   r.Status,
+			Status:   product.Status(r.Status),
 		})
 		if err != nil {
-			_ = c.Error(err)
-			if product.IsErrExist(err) {
-				c.JSON(http.StatusBadRequest, NewError(err.Error()))
-				return
-			}
-			c.JSON(http.StatusInternalServerError, NewError(err.Error()))
+			abortWithError(c, err)
 			return
 		}
 
+		c.Header("ETag", etag(prd.Version))
 		c.Status(http.StatusCreated)
 	}
 }
 
+// handleProductUpdate replaces a product but its status, which may be
+// omitted or has to be the current one.
 func (api *API) handleProductUpdate() gin.HandlerFunc {
 	type (
 		request struct {
-			SKU      string `form:"sku" binding:"required"`
-			Name     string `form:"name" binding:"required"`
-			Quantity uint32 `form:"qty"`
-			Price    uint64 `form:"price" binding:"required"`
-			Unit     string `form:"unit" binding:"required"`
-			Status   uint8  `form:"status"`
+			SKU      string `json:"sku" form:"sku"`
+			Name     string `json:"name" form:"name"`
+			Quantity uint32 `json:"qty" form:"qty"`
+			Price    int64  `json:"price" form:"price"`
+			Unit     string `json:"unit" form:"unit"`
+			Status   *uint8 `json:"status" form:"status"`
 		}
 	)
 
@@ -187,32 +245,46 @@ func (api *API) handleProductUpdate() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("product update: %#v\n", r)
 
-		err = api.prdSvc.UpdateProduct(ctx, product.Product{
+		version, err := api.expectedVersion(c, r.SKU)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if r.Status != nil {
+			current, err := api.prdSvc.SearchProduct(ctx, r.SKU)
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+			if product.Status(*r.Status) != current.Status {
+				verr := &validationError{}
+				statusReadOnly(verr)
+				abortWithError(c, verr)
+				return
+			}
+		}
+		// The legacy body has no category or tags, they are kept.
+		prd, err := api.prdSvc.UpdateProductKeepingGroups(ctx, product.Product{
 			SKU:      r.SKU,
 			Name:     r.Name,
 			Quantity: r.Quantity,
-			Price:    r.Price,
+			Price:    money.Money{Amount: r.Price},
 			Unit:     r.Unit,
-			Status:   r.Status,
+			Version:  version,
 		})
 		if err != nil {
-			_ = c.Error(err)
-			if product.IsErrNotFound(err) {
-				c.Status(http.StatusNotFound)
-				return
-			}
-			c.JSON(http.StatusInternalServerError, NewError(err.Error()))
+			abortWithError(c, err)
 			return
 		}
 
+		c.Header("ETag", etag(prd.Version))
 		c.Status(http.StatusOK)
 	}
 }
@@ -220,7 +292,7 @@ func (api *API) handleProductUpdate() gin.HandlerFunc {
 func (api *API) handleProductDelete() gin.HandlerFunc {
 	type (
 		request struct {
-			SKU string `form:"sku" binding:"required"`
+			SKU string `json:"sku" form:"sku" binding:"required"`
 		}
 	)
 
@@ -230,22 +302,21 @@ func (api *API) handleProductDelete() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("product delete: %#v\n", r)
 
-		err = api.prdSvc.DeleteProduct(ctx, r.SKU)
+		version, err := api.expectedVersion(c, r.SKU)
 		if err != nil {
-			_ = c.Error(err)
-			if product.IsErrNotFound(err) {
-				c.Status(http.StatusNotFound)
-				return
-			}
-			c.JSON(http.StatusInternalServerError, NewError(err.Error()))
+			abortWithError(c, err)
+			return
+		}
+		err = api.prdSvc.DeleteProduct(ctx, r.SKU, version, caller(c))
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
 
@@ -253,15 +324,190 @@ func (api *API) handleProductDelete() gin.HandlerFunc {
 	}
 }
 
-func (api *API) handleProductList() gin.HandlerFunc {
+const defaultListLimit = 100
+
+// listRequest holds the query parameters shared by the product listings.
+type listRequest struct {
+	Limit       int     `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor      string  `form:"cursor"`
+	Sort        string  `form:"sort" binding:"omitempty,oneof=sku name price qty"`
+	Order       string  `form:"order" binding:"omitempty,oneof=asc desc"`
+	Status      string  `form:"status"`
+	Unit        string  `form:"unit"`
+	Name        string  `form:"name"`
+	MinPrice    *uint64 `form:"min_price"`
+	MaxPrice    *uint64 `form:"max_price"`
+	Currency    string  `form:"currency"`
+	MinQuantity *uint32 `form:"min_qty"`
+	MaxQuantity *uint32 `form:"max_qty"`
+	Location    string  `form:"location"`
+
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+func (r listRequest) options() (product.ListOptions, error) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	var status *product.Status
+	if r.Status != "" {
+		s, err := product.ParseStatus(r.Status)
+		if err != nil {
+			return product.ListOptions{}, fmt.Errorf("status: %v - %w", err, product.ErrInvalidListOptions)
+		}
+		status = &s
+	}
+	if r.Location != "" && !product.ValidLocation(r.Location) {
+		return product.ListOptions{}, fmt.Errorf("location %q - %w", r.Location, product.ErrInvalidListOptions)
+	}
+	return product.ListOptions{
+		Filter: product.Filter{
+			Status:      status,
+			Unit:        r.Unit,
+			NamePrefix:  r.Name,
+			MinPrice:    r.MinPrice,
+			MaxPrice:    r.MaxPrice,
+			Currency:    r.Currency,
+			MinQuantity: r.MinQuantity,
+			MaxQuantity: r.MaxQuantity,
+			Location:    r.Location,
+
+			IncludeDeleted: r.IncludeDeleted,
+		},
+		Sort:   product.SortField(r.Sort),
+		Desc:   r.Order == "desc",
+		Cursor: r.Cursor,
+		Limit:  limit,
+	}, nil
+}
+
+// statusValue renders s by name in the v2 API and by number in the legacy
+// one.
+func statusValue(s product.Status, v2 bool) interface{} {
+	if v2 {
+		return s
+	}
+	return uint8(s)
+}
+
+// priceValue renders p as a money object in the v2 API and as a bare amount
+// of minor units in the legacy one.
+func priceValue(p money.Money, v2 bool) interface{} {
+	if v2 {
+		return p
+	}
+	return p.Amount
+}
+
+// handleProductList lists products, in their v2 representation when v2 is
+// set.
+func (api *API) handleProductList(v2 bool) gin.HandlerFunc {
 	type (
 		item struct {
-			SKU      string `json:"sku"`
-			Name     string `json:"name"`
-			Quantity uint32 `json:"qty"`
-			Price    uint64 `json:"price"`
-			Unit     string `json:"unit"`
-			Status   uint8  `json:"status"`
+			SKU      string      `json:"sku"`
+			Name     string      `json:"name"`
+			Quantity uint32      `json:"qty"`
+			Price    interface{} `json:"price"`
+			Unit     string      `json:"unit"`
+			Status   interface{} `json:"status"`
+			Version  uint64      `json:"version"`
+
+			// Locations and InTransit are only in the v2 representation.
+			Locations []stockLevel `json:"locations,omitempty"`
+			InTransit *uint32      `json:"in_transit,omitempty"`
+
+			DeletedAt *time.Time `json:"deleted_at,omitempty"`
+			DeletedBy string     `json:"deleted_by,omitempty"`
+		}
+		response struct {
+			Data       []*item `json:"data"`
+			Total      int     `json:"total"`
+			NextCursor string  `json:"next_cursor,omitempty"`
+			PrevCursor string  `json:"prev_cursor,omitempty"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r    listRequest
+			ctx  = c.Request.Context()
+			data = []*item{}
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		opts, err := r.options()
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		// Legacy clients predate paging and expect every product.
+		if !v2 && r.Limit == 0 && r.Cursor == "" {
+			opts.Limit = 0
+		}
+		page, err := api.prdSvc.ListProduct(ctx, opts)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		for _, i := range page.Items {
+			it := &item{
+				SKU:       i.SKU,
+				Name:      i.Name,
+				Quantity:  i.Quantity,
+				Price:     priceValue(i.Price, v2),
+				Unit:      i.Unit,
+				Status:    statusValue(i.Status, v2),
+				Version:   i.Version,
+				DeletedAt: deletedAt(i),
+				DeletedBy: i.DeletedBy,
+			}
+			if v2 {
+				inTransit := i.InTransit
+				it.Locations = newStockLevels(i)
+				it.InTransit = &inTransit
+			}
+			data = append(data, it)
+		}
+
+		c.JSON(http.StatusOK, response{
+			Data:       data,
+			Total:      page.Total,
+			NextCursor: page.Next,
+			PrevCursor: page.Prev,
+		})
+	}
+}
+
+// handleProductFullTextSearch searches products, in their v2 representation
+// when v2 is set.
+func (api *API) handleProductFullTextSearch(v2 bool) gin.HandlerFunc {
+	type (
+		request struct {
+			Query  string `form:"q" binding:"required"`
+			Prefix *bool  `form:"prefix"`
+			Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+
+			IncludeDeleted bool `form:"include_deleted"`
+		}
+		item struct {
+			SKU       string      `json:"sku"`
+			Name      string      `json:"name"`
+			Quantity  uint32      `json:"qty"`
+			Price     interface{} `json:"price"`
+			Unit      string      `json:"unit"`
+			Status    interface{} `json:"status"`
+			Score     float64     `json:"score"`
+			Highlight string      `json:"highlight"`
+			Matches   [][2]int    `json:"matches"`
+
+			DeletedAt *time.Time `json:"deleted_at,omitempty"`
+			DeletedBy string     `json:"deleted_by,omitempty"`
 		}
 		response struct {
 			Data []*item `json:"data"`
@@ -269,24 +515,47 @@ func (api *API) handleProductList() gin.HandlerFunc {
 	)
 	return func(c *gin.Context) {
 		var (
+			r    request
 			ctx  = c.Request.Context()
-			data []*item
+			data = []*item{}
 		)
 
-		resp, err := api.prdSvc.ListProduct(ctx)
+		err := c.ShouldBindQuery(&r)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, NewError(err.Error()))
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
 			return
 		}
+		fmt.Printf("product full text search: %#v\n", r)
 
-		for _, i := range resp {
+		q := search.Query{
+			Text:   r.Query,
+			Prefix: r.Prefix == nil || *r.Prefix,
+			Limit:  r.Limit,
+
+			IncludeDeleted: r.IncludeDeleted,
+		}
+		if q.Limit == 0 {
+			q.Limit = 20
+		}
+		hits, err := api.searcher.Search(ctx, q)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		for _, h := range hits {
 			data = append(data, &item{
-				SKU:      i.SKU,
-				Name:     i.Name,
-				Quantity: i.Quantity,
-				Price:    i.Price,
-				Unit:     i.Unit,
-				Status:   i.Status,
+				SKU:       h.Product.SKU,
+				Name:      h.Product.Name,
+				Quantity:  h.Product.Quantity,
+				Price:     priceValue(h.Product.Price, v2),
+				Unit:      h.Product.Unit,
+				Status:    statusValue(h.Product.Status, v2),
+				Score:     h.Score,
+				Highlight: h.Highlight,
+				Matches:   h.Matches,
+				DeletedAt: deletedAt(&h.Product),
+				DeletedBy: h.Product.DeletedBy,
 			})
 		}
 
@@ -297,15 +566,16 @@ func (api *API) handleProductList() gin.HandlerFunc {
 func (api *API) handleProductSearch() gin.HandlerFunc {
 	type (
 		request struct {
-			SKU string `form:"sku" binding:"required"`
+			SKU string `json:"sku" form:"sku" binding:"required"`
 		}
 		item struct {
 			SKU      string `json:"sku"`
 			Name     string `json:"name"`
 			Quantity uint32 `json:"qty"`
-			Price    uint64 `json:"price"`
+			Price    int64  `json:"price"`
 			Unit     string `json:"unit"`
 			Status   uint8  `json:"status"`
+			Version  uint64 `json:"version"`
 		}
 	)
 	return func(c *gin.Context) {
@@ -314,22 +584,138 @@ func (api *API) handleProductSearch() gin.HandlerFunc {
 			ctx = c.Request.Context()
 		)
 
-		err := c.ShouldBind(&r)
+		err := bindLegacy(c, &r)
 		if err != nil {
-			_ = c.Error(err)
-			c.JSON(http.StatusBadRequest, NewError(fmt.Sprintf("parse request: %v", err)))
+			abortWithError(c, err)
 			return
 		}
 		fmt.Printf("product search: %#v\n", r)
 
 		prd, err := api.prdSvc.SearchProduct(ctx, r.SKU)
 		if err != nil {
-			_ = c.Error(err)
-			if product.IsErrNotFound(err) {
-				c.Status(http.StatusNotFound)
-				return
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("ETag", etag(prd.Version))
+		c.JSON(http.StatusOK, item{
+			SKU:      prd.SKU,
+			Name:     prd.Name,
+			Quantity: prd.Quantity,
+			Price:    prd.Price.Amount,
+			Unit:     prd.Unit,
+			Status:   uint8(prd.Status),
+			Version:  prd.Version,
+		})
+	}
+}
+
+func (api *API) handleProductEvents() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU string `json:"sku" form:"sku" binding:"required"`
+		}
+		event struct {
+			Seq      uint64    `json:"seq"`
+			Version  uint64    `json:"version"`
+			SKU      string    `json:"sku"`
+			Type     string    `json:"type"`
+			Time     time.Time `json:"time"`
+			Name     *string   `json:"name,omitempty"`
+			Unit     *string   `json:"unit,omitempty"`
+			Price    *int64    `json:"price,omitempty"`
+			Quantity *uint32   `json:"qty,omitempty"`
+			Delta    *int64    `json:"delta,omitempty"`
+			Status   *uint8    `json:"status,omitempty"`
+
+			DeletedBy string `json:"deleted_by,omitempty"`
+		}
+		response struct {
+			Data []*event `json:"data"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bindLegacy(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product events: %#v\n", r)
+
+		events, err := api.prdSvc.ProductEvents(ctx, r.SKU)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		data := make([]*event, 0, len(events))
+		for _, e := range events {
+			e := e
+			item := &event{
+				Seq:     e.Seq,
+				Version: e.Version,
+				SKU:     e.SKU,
+				Type:    string(e.Type),
+				Time:    e.Time,
+			}
+			status := uint8(e.Status)
+			switch e.Type {
+			case product.EventProductCreated:
+				item.Name, item.Unit, item.Price, item.Quantity, item.Status = &e.Name, &e.Unit, &e.Price.Amount, &e.Quantity, &status
+			case product.EventDetailsChanged:
+				item.Name, item.Unit = &e.Name, &e.Unit
+			case product.EventPriceChanged:
+				item.Price = &e.Price.Amount
+			case product.EventQuantityAdjusted:
+				item.Delta = &e.Delta
+			case product.EventStatusChanged:
+				item.Status = &status
+			case product.EventProductDeleted:
+				item.DeletedBy = e.DeletedBy
 			}
-			c.JSON(http.StatusInternalServerError, NewError(err.Error()))
+			data = append(data, item)
+		}
+
+		c.JSON(http.StatusOK, response{Data: data})
+	}
+}
+
+func (api *API) handleProductAsOf() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU string    `json:"sku" form:"sku" binding:"required"`
+			At  time.Time `json:"at" form:"at" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+		}
+		item struct {
+			SKU      string `json:"sku"`
+			Name     string `json:"name"`
+			Quantity uint32 `json:"qty"`
+			Price    int64  `json:"price"`
+			Unit     string `json:"unit"`
+			Status   uint8  `json:"status"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bindLegacy(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product as of: %#v\n", r)
+
+		prd, err := api.prdSvc.ProductAt(ctx, r.SKU, r.At)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
 
@@ -337,9 +723,9 @@ func (api *API) handleProductSearch() gin.HandlerFunc {
 			SKU:      prd.SKU,
 			Name:     prd.Name,
 			Quantity: prd.Quantity,
-			Price:    prd.Price,
+			Price:    prd.Price.Amount,
 			Unit:     prd.Unit,
-			Status:   prd.Status,
+			Status:   uint8(prd.Status),
 		})
 	}
 }
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"sampleBackend/internal/product"
+)
+
+// maxBodySize bounds the request bodies decoded by bind.
+const maxBodySize = 1 << 20
+
+// Machine-readable codes of a FieldError, on top of the ones of the product
+// package.
+const (
+	codeUnknownField = "unknown_field"
+	codeInvalidType  = "invalid_type"
+	codeOutOfRange   = "out_of_range"
+)
+
+var (
+	errMalformed          = errors.New("malformed request")
+	errUnsupportedContent = errors.New("unsupported content type")
+)
+
+// validationError lists every invalid field of a request.
+type validationError struct {
+	fields []FieldError
+}
+
+func (e *validationError) Error() string {
+	msgs := make([]string, len(e.fields))
+	for i, f := range e.fields {
+		msgs[i] = f.Message
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *validationError) add(field, code, format string, args ...interface{}) {
+	for _, f := range e.fields {
+		if f.Field == field {
+			return
+		}
+	}
+	e.fields = append(e.fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// bind decodes the body of c into obj, as JSON or as a form depending on its
+// content type, and checks the binding tags of obj. Fields are named after
+// their json tag in JSON bodies and their form tag in forms; fields unknown
+// to obj are rejected.
+func bind(c *gin.Context, obj interface{}) error {
+	body, err := readBody(c, maxBodySize)
+	if err != nil {
+		return err
+	}
+
+	var (
+		verr = &validationError{}
+		tag  string
+	)
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		tag = "json"
+		if err := decodeJSON(body, obj, verr); err != nil {
+			return err
+		}
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		tag = "form"
+		if err := c.Request.ParseMultipartForm(maxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return fmt.Errorf("parse form: %v - %w", err, errMalformed)
+		}
+		decodeForm(c.Request.PostForm, obj, verr)
+	default:
+		return fmt.Errorf("content type %q - %w", c.ContentType(), errUnsupportedContent)
+	}
+	return validate(obj, tag, verr)
+}
+
+// bindLegacy is bind for the routes under /api predating it, whose clients
+// send forms, possibly without a content type, and fields in the query
+// string. Such requests are bound from the query and the body as before,
+// JSON bodies as by bind.
+func bindLegacy(c *gin.Context, obj interface{}) error {
+	switch c.ContentType() {
+	case "", binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+	default:
+		return bind(c, obj)
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+	if err := c.Request.ParseMultipartForm(maxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return fmt.Errorf("parse form: %v - %w", err, errMalformed)
+	}
+	if len(c.Request.Form) == 0 {
+		return fmt.Errorf("empty request - %w", errMalformed)
+	}
+	verr := &validationError{}
+	decodeForm(c.Request.Form, obj, verr)
+	return validate(obj, "form", verr)
+}
+
+// validate checks the binding tags of obj, adding the invalid fields, named
+// after their tag, to verr. It returns verr when it has any.
+func validate(obj interface{}, tag string, verr *validationError) error {
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		var errs validator.ValidationErrors
+		if !errors.As(err, &errs) {
+			return err
+		}
+		t := reflect.TypeOf(obj).Elem()
+		for _, fe := range errs {
+			name := fe.Field()
+			if sf, ok := t.FieldByName(fe.StructField()); ok {
+				name = fieldName(sf, tag)
+			}
+			switch fe.Tag() {
+			case "required":
+				verr.add(name, product.CodeRequired, "%s is required", name)
+			case "min", "max", "gt", "gte", "lt", "lte":
+				verr.add(name, codeOutOfRange, "%s must be %s %s", name, fe.Tag(), fe.Param())
+			case "oneof":
+				verr.add(name, product.CodeNotAllowed, "%s must be one of %s", name, fe.Param())
+			default:
+				verr.add(name, product.CodeInvalidFormat, "%s is invalid", name)
+			}
+		}
+	}
+
+	if len(verr.fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// readBody reads the whole body of c, up to limit bytes, and leaves a copy in
+// place for later readers.
+func readBody(c *gin.Context, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %v - %w", err, errMalformed)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("empty request body - %w", errMalformed)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// decodeJSON decodes the JSON object body into the struct obj points to.
+// Every unknown field and every field of the wrong type is added to verr,
+// the other fields are still set.
+func decodeJSON(body []byte, obj interface{}, verr *validationError) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+
+	var raw map[string]json.RawMessage
+	err := dec.Decode(&raw)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("decode json: expected an object, got %s - %w", typeErr.Value, errMalformed)
+	default:
+		return fmt.Errorf("decode json: %v - %w", err, errMalformed)
+	}
+	if dec.More() {
+		return fmt.Errorf("decode json: unexpected data after the object - %w", errMalformed)
+	}
+
+	var (
+		v     = reflect.ValueOf(obj).Elem()
+		t     = v.Type()
+		names = make([]string, 0, len(raw))
+	)
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i, ok := jsonField(t, name)
+		if !ok {
+			verr.add(name, codeUnknownField, "%s is not a known field", name)
+			continue
+		}
+		decodeField(name, raw[name], v.Field(i), verr)
+	}
+	parseFields(obj, verr)
+	return nil
+}
+
+// jsonField returns the index of the field of t named name in JSON, matched
+// ignoring case as by encoding/json.
+func jsonField(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		if strings.EqualFold(fieldName(sf, "json"), name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// decodeField decodes data into the field v named name. The fields of
+// nested objects have to be known as well.
+func decodeField(name string, data json.RawMessage, v reflect.Value, verr *validationError) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v.Addr().Interface())
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.As(err, &typeErr):
+		field := name
+		if typeErr.Field != "" {
+			field += "." + typeErr.Field
+		}
+		verr.add(field, codeInvalidType, "%s must be %s", field, typeName(typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		field = name + "." + field
+		verr.add(field, codeUnknownField, "%s is not a known field", field)
+	default:
+		verr.add(name, codeInvalidType, "%s must be %s", name, typeName(v.Type()))
+	}
+}
+
+// fieldParser is implemented by the fields of a request kept raw while the
+// body decodes and parsed afterwards. The error ends the field message.
+type fieldParser interface {
+	parse() error
+}
+
+// parseFields parses the fields of obj implementing fieldParser.
+func parseFields(obj interface{}, verr *validationError) {
+	v := reflect.ValueOf(obj).Elem()
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f, ok := v.Field(i).Addr().Interface().(fieldParser)
+		if !ok {
+			continue
+		}
+		if err := f.parse(); err != nil {
+			name := fieldName(v.Type().Field(i), "json")
+			verr.add(name, product.CodeInvalidFormat, "%s %v", name, err)
+		}
+	}
+}
+
+// decodeForm sets the fields of obj from their form tag.
+func decodeForm(form map[string][]string, obj interface{}, verr *validationError) {
+	var (
+		v     = reflect.ValueOf(obj).Elem()
+		t     = v.Type()
+		known = make(map[string]bool)
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := fieldName(sf, "form")
+		known[name] = true
+
+		values, ok := form[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), sf, values[0]); err != nil {
+			verr.add(name, codeInvalidType, "%s must be %s", name, typeName(sf.Type))
+		}
+	}
+	for name := range form {
+		if !known[name] {
+			verr.add(name, codeUnknownField, "%s is not a known field", name)
+		}
+	}
+}
+
+func setField(v reflect.Value, sf reflect.StructField, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setField(p.Elem(), sf, s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		layout := sf.Tag.Get("time_format")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported field type %v", v.Type())
+	}
+	return nil
+}
+
+func fieldName(sf reflect.StructField, tag string) string {
+	name := strings.Split(sf.Tag.Get(tag), ",")[0]
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "an RFC 3339 time"
+	case t == reflect.TypeOf(price{}):
+		return "an integer of minor units"
+	case t == reflect.TypeOf(product.Status(0)):
+		names := make([]string, len(product.Statuses))
+		for i, s := range product.Statuses {
+			names[i] = s.String()
+		}
+		return "one of " + strings.Join(names, ", ")
+	case t.Kind() == reflect.String:
+		return "a string"
+	case t.Kind() == reflect.Bool:
+		return "a boolean"
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return fmt.Sprintf("an integer between 0 and %d", uint64(1)<<t.Bits()-1)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return "an integer"
+	}
+	return t.String()
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// etag is the entity tag of a product at version. Versions never repeat for
+// a SKU, so it is a strong validator.
+func etag(version uint64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// matchETag reports whether header, the value of If-Match or If-None-Match,
+// lists the ETag of version. Weak comparison, used for If-None-Match, also
+// accepts weak tags.
+func matchETag(header string, version uint64, weak bool) bool {
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[len("W/"):]
+		}
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion returns the version of sku a write must apply to: the
+// current one when the request has an If-Match header matching it, 0 for an
+// unconditional write.
+func (api *API) expectedVersion(c *gin.Context, sku string) (uint64, error) {
+	return api.matchVersion(c, sku, false)
+}
+
+// matchVersion is expectedVersion, also matching the tombstone of a deleted
+// sku with includeDeleted.
+func (api *API) matchVersion(c *gin.Context, sku string, includeDeleted bool) (uint64, error) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return 0, nil
+	}
+
+	prd, err := api.prdSvc.GetProduct(c.Request.Context(), sku, includeDeleted)
+	if err != nil {
+		return 0, err
+	}
+	if !matchETag(ifMatch, prd.Version, false) {
+		return 0, fmt.Errorf("If-Match %s, current %s - %w", ifMatch, etag(prd.Version), errPreconditionFailed)
+	}
+	return prd.Version, nil
+}
@@ -2,11 +2,16 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/api"
 )
 
 func postForm(t *testing.T, h http.Handler, target string, data url.Values, bearer string) *httptest.ResponseRecorder {
@@ -35,3 +40,64 @@ func get(t *testing.T, h http.Handler, target string, bearer string) *httptest.R
 	t.Logf("response: %s", w.Body.String())
 	return w
 }
+
+func post(t *testing.T, h http.Handler, target string, contentType string, body []byte, bearer string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	r.Header.Add("Content-Type", contentType)
+	if len(bearer) > 0 {
+		r.Header.Add("Authorization", fmt.Sprintf("Bearer %s", bearer))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	t.Logf("response: %s", w.Body.String())
+	return w
+}
+
+func doJSON(t *testing.T, h http.Handler, method, target string, body interface{}, bearer string) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONWithHeader(t, h, method, target, body, bearer, nil)
+}
+
+func doJSONWithHeader(t *testing.T, h http.Handler, method, target string, body interface{}, bearer string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if s, ok := body.(string); ok {
+			buf.WriteString(s)
+		} else {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Add("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	if len(bearer) > 0 {
+		r.Header.Add("Authorization", fmt.Sprintf("Bearer %s", bearer))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	t.Logf("response: %s", w.Body.String())
+	return w
+}
+
+func withoutMessages(errs []api.FieldError) []api.FieldError {
+	out := make([]api.FieldError, len(errs))
+	for i, e := range errs {
+		out[i] = api.FieldError{Field: e.Field, Code: e.Code}
+	}
+	return out
+}
+
+func validProductForm(sku string) url.Values {
+	data := url.Values{}
+	data.Add("sku", sku)
+	data.Add("name", sku+" name")
+	data.Add("price", "100")
+	data.Add("unit", "Carton")
+	return data
+}
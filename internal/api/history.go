@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/audit"
+)
+
+var errAuditUnsupported = errors.New("audit log not configured")
+
+// WithAuditRecorder serves the product histories from r. Without it they
+// are not available.
+func WithAuditRecorder(r *audit.Recorder) Option {
+	return func(api *API) {
+		api.audit = r
+	}
+}
+
+func (api *API) handleV2ProductHistory() gin.HandlerFunc {
+	type (
+		request struct {
+			Cursor string `form:"cursor"`
+			Limit  int    `form:"limit" binding:"omitempty,min=1,max=500"`
+		}
+		change struct {
+			Field string      `json:"field"`
+			Old   interface{} `json:"old"`
+			New   interface{} `json:"new"`
+		}
+		entry struct {
+			Seq     uint64    `json:"seq"`
+			Op      string    `json:"op"`
+			Version uint64    `json:"version,omitempty"`
+			User    string    `json:"user,omitempty"`
+			IP      string    `json:"ip,omitempty"`
+			Time    time.Time `json:"time"`
+			Changes []change  `json:"changes"`
+		}
+		response struct {
+			Data       []*entry `json:"data"`
+			NextCursor string   `json:"next_cursor,omitempty"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r    request
+			ctx  = c.Request.Context()
+			sku  = c.Param("sku")
+			data = []*entry{}
+		)
+
+		if api.audit == nil {
+			abortWithError(c, errAuditUnsupported)
+			return
+		}
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		page, err := api.audit.History(ctx, sku, audit.HistoryOptions{Cursor: r.Cursor, Limit: r.Limit})
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		// A product recorded nowhere may still exist, e.g. restored from a
+		// backup, with an empty history.
+		if len(page.Entries) == 0 && r.Cursor == "" {
+			if _, err := api.prdSvc.GetProduct(ctx, sku, true); err != nil {
+				abortWithError(c, err)
+				return
+			}
+		}
+
+		for _, e := range page.Entries {
+			item := &entry{
+				Seq:     e.Seq,
+				Op:      string(e.Op),
+				Version: e.Version,
+				User:    e.User,
+				IP:      e.IP,
+				Time:    e.Time,
+				Changes: make([]change, len(e.Changes)),
+			}
+			for i, fc := range e.Changes {
+				item.Changes[i] = change{Field: fc.Field, Old: fc.Old, New: fc.New}
+			}
+			data = append(data, item)
+		}
+
+		c.JSON(http.StatusOK, response{
+			Data:       data,
+			NextCursor: page.Next,
+		})
+	}
+}
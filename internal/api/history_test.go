@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/audit"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIV2ProductHistory(t *testing.T) {
+	type (
+		change struct {
+			Field string      `json:"field"`
+			Old   interface{} `json:"old"`
+			New   interface{} `json:"new"`
+		}
+		entry struct {
+			Op      string   `json:"op"`
+			Version uint64   `json:"version"`
+			User    string   `json:"user"`
+			IP      string   `json:"ip"`
+			Changes []change `json:"changes"`
+		}
+		response struct {
+			Data       []entry `json:"data"`
+			NextCursor string  `json:"next_cursor"`
+		}
+	)
+	path := "/api/v2/products/HIST-001/history"
+
+	t.Run("requires an audit recorder", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, path, nil, bearer)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, CodeAuditUnsupported, decodeProblem(t, w).Code)
+	})
+
+	t.Run("pages through the changes", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := audit.NewRecorder(memory.NewAuditStorage())
+		svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(recorder.Record))
+		api := makeAPIWithService(t, svc, WithAuditRecorder(recorder))
+
+		w := doJSON(t, api, http.MethodGet, path, nil, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "HIST-001", "name": "History", "qty": 5, "price": 10, "unit": "Box"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = doJSON(t, api, http.MethodPatch, "/api/v2/products/HIST-001", `{"qty": 0}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doJSON(t, api, http.MethodDelete, "/api/v2/products/HIST-001", nil, bearer)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = doJSON(t, api, http.MethodGet, path+"?limit=2", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var page response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Data, 2)
+		require.NotEmpty(t, page.NextCursor)
+
+		deleted, patched := page.Data[0], page.Data[1]
+		assert.Equal(t, "delete", deleted.Op)
+		assert.Equal(t, uint64(3), deleted.Version)
+		assert.Equal(t, "update", patched.Op)
+		assert.Equal(t, registeredUser, patched.User)
+		assert.NotEmpty(t, patched.IP)
+		assert.Equal(t, []change{{Field: "qty", Old: float64(5), New: float64(0)}}, patched.Changes)
+
+		w = doJSON(t, api, http.MethodGet, path+"?limit=2&cursor="+page.NextCursor, nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		page = response{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Data, 1)
+		assert.Empty(t, page.NextCursor)
+		assert.Equal(t, "create", page.Data[0].Op)
+		assert.Len(t, page.Data[0].Changes, 6)
+
+		w = doJSON(t, api, http.MethodGet, path+"?cursor=bogus", nil, bearer)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidHistory, decodeProblem(t, w).Code)
+	})
+}
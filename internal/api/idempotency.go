@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/idempotency"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// replayedHeader flags the responses replayed for a retry.
+	replayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds the keys accepted from clients.
+	maxIdempotencyKeyLength = 255
+)
+
+// WithIdempotencyStore shares the store of the responses replayed by
+// idempotency key. By default the API builds its own.
+func WithIdempotencyStore(s *idempotency.Store) Option {
+	return func(api *API) {
+		api.idempotency = s
+	}
+}
+
+// recordingWriter keeps a copy of the body written to the response, up to
+// limit bytes.
+type recordingWriter struct {
+	gin.ResponseWriter
+	limit    int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordingWriter) record(n int) bool {
+	if w.overflow || w.body.Len()+n > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return false
+	}
+	return true
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.record(len(b)) {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	if w.record(len(s)) {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// fingerprint digests what makes two requests the same.
+func fingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, c.ContentType())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent replays the response of the first request with the same
+// Idempotency-Key from the same caller. Requests without a key run as
+// usual. Server errors are not recorded, so their retries run again.
+// Responses too large for the store are not recorded either, their retries
+// fail instead of running twice.
+func (api *API) idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			return
+		}
+		if !validIdempotencyKey(key) {
+			abortWithError(c, fmt.Errorf("%s must have 1 to %d printable characters - %w", idempotencyKeyHeader, maxIdempotencyKeyLength, errMalformed))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("read body: %v - %w", err, errMalformed))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		resp, claim, err := api.idempotency.Begin(c.Request.Context(), caller(c), key, fingerprint(c, body))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if resp != nil {
+			for k, v := range resp.Header {
+				c.Writer.Header()[k] = v
+			}
+			c.Header(replayedHeader, "true")
+			c.Writer.WriteHeader(resp.Status)
+			_, _ = c.Writer.Write(resp.Body)
+			c.Abort()
+			return
+		}
+
+		// A panic in the handler frees the key as a server error would.
+		defer claim.Release()
+		w := &recordingWriter{ResponseWriter: c.Writer, limit: api.idempotency.MaxBodySize()}
+		c.Writer = w
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+		if w.overflow {
+			claim.Discard()
+			return
+		}
+		header := w.Header().Clone()
+		header.Del(requestIDHeader)
+		claim.Complete(idempotency.Response{Status: w.Status(), Header: header, Body: w.body.Bytes()})
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return key != ""
+}
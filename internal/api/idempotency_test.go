@@ -0,0 +1,105 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/idempotency"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIIdempotency(t *testing.T) {
+	api := makeAPI(t)
+	withKey := func(key, contentType string) http.Header {
+		return http.Header{"Idempotency-Key": {key}, "Content-Type": {contentType}}
+	}
+
+	t.Run("legacy add", func(t *testing.T) {
+		form := validProductForm("IDEM-1").Encode()
+		header := withKey("add-idem-1", "application/x-www-form-urlencoded")
+
+		first := doJSONWithHeader(t, api, http.MethodPost, "/api/item/add", form, bearer, header)
+		require.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+		retry := doJSONWithHeader(t, api, http.MethodPost, "/api/item/add", form, bearer, header)
+		assert.Equal(t, first.Code, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+		assert.NotEqual(t, first.Header().Get("X-Request-ID"), retry.Header().Get("X-Request-ID"))
+
+		w := doJSONWithHeader(t, api, http.MethodPost, "/api/item/add", form, bearer, withKey("add-idem-1b", "application/x-www-form-urlencoded"))
+		assert.Equal(t, CodeProductExists, decodeProblem(t, w).Code)
+
+		other := validProductForm("IDEM-2").Encode()
+		w = doJSONWithHeader(t, api, http.MethodPost, "/api/item/add", other, bearer, header)
+		assert.Equal(t, CodeIdempotencyKeyReused, decodeProblem(t, w).Code)
+	})
+
+	t.Run("patch applies once", func(t *testing.T) {
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", map[string]interface{}{"sku": "IDEM-3", "name": "Tea", "price": 100, "unit": "Box"}, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		header := withKey("patch-idem-3", "application/merge-patch+json")
+		for i := 0; i < 3; i++ {
+			w = doJSONWithHeader(t, api, http.MethodPatch, "/api/v2/products/IDEM-3", `{"name": "Green tea"}`, bearer, header)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		}
+		w = get(t, api, "/api/v2/products/IDEM-3", bearer)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("concurrent duplicates", func(t *testing.T) {
+		body := map[string]interface{}{"sku": "IDEM-4", "name": "Tea", "price": 100, "unit": "Box"}
+		header := withKey("create-idem-4", "application/json")
+
+		var (
+			wg        sync.WaitGroup
+			responses = make([]*httptest.ResponseRecorder, 10)
+		)
+		for i := range responses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				responses[i] = doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products", body, bearer, header)
+			}(i)
+		}
+		wg.Wait()
+
+		replayed := 0
+		for _, w := range responses {
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, responses[0].Body.String(), w.Body.String())
+			if w.Header().Get("Idempotent-Replayed") == "true" {
+				replayed++
+			}
+		}
+		assert.Equal(t, len(responses)-1, replayed)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		w := doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products", `{}`, bearer, withKey("not a key", "application/json"))
+		assert.Equal(t, CodeBadRequest, decodeProblem(t, w).Code)
+	})
+
+	t.Run("large responses are not kept", func(t *testing.T) {
+		api := makeAPIWithStorage(t, memory.NewProductStorage(), WithIdempotencyStore(idempotency.NewStore(time.Hour, idempotency.WithMaxBodySize(16))))
+		body := map[string]interface{}{"sku": "IDEM-5", "name": "Tea", "price": 100, "unit": "Box"}
+		header := withKey("create-idem-5", "application/json")
+
+		w := doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products", body, bearer, header)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products", body, bearer, header)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeIdempotencyNotKept, decodeProblem(t, w).Code)
+	})
+}
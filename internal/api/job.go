@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/job"
+)
+
+const jobsPath = "/api/jobs"
+
+// Kinds of the jobs run by the API.
+const (
+	jobProductExport = "product_export"
+	jobProductImport = "product_import"
+)
+
+var errJobsUnsupported = errors.New("background jobs are not configured")
+
+// WithJobService runs exports and imports requested with async=true as jobs
+// of svc. Without it, async requests are rejected.
+func WithJobService(svc *job.Service) Option {
+	return func(api *API) {
+		api.jobs = svc
+	}
+}
+
+func (api *API) registerJobs() {
+	api.jobs.Register(jobProductExport, job.Handler{Run: api.runExport, Resumable: true})
+	api.jobs.Register(jobProductImport, job.Handler{Run: api.runImport})
+}
+
+func jobLocation(id string) string {
+	return jobsPath + "/" + url.PathEscape(id)
+}
+
+func renderJob(c *gin.Context, status int, j *job.Job) {
+	type (
+		response struct {
+			*job.Job
+			OutputURL string `json:"output_url,omitempty"`
+		}
+	)
+	resp := response{Job: j}
+	if j.Status == job.StatusSucceeded && j.Output != nil {
+		resp.OutputURL = jobLocation(j.ID) + "/output"
+	}
+	c.JSON(status, resp)
+}
+
+// submitJob queues a job and answers 202 with its record.
+func (api *API) submitJob(c *gin.Context, kind string, params interface{}, input io.Reader) {
+	if api.jobs == nil {
+		abortWithError(c, errJobsUnsupported)
+		return
+	}
+	j, err := api.jobs.Submit(c.Request.Context(), kind, caller(c), params, input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Header("Location", jobLocation(j.ID))
+	renderJob(c, http.StatusAccepted, j)
+}
+
+// jobsRequired rejects the job routes when no job service is configured.
+func (api *API) jobsRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if api.jobs == nil {
+			abortWithError(c, errJobsUnsupported)
+		}
+	}
+}
+
+// callerJob returns the job of the request, when submitted by the caller or
+// the caller is an administrator. The jobs of other users are not found.
+func (api *API) callerJob(c *gin.Context) (*job.Job, error) {
+	j, err := api.jobs.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if j.CreatedBy != caller(c) && !api.userSvc.IsAdmin(caller(c)) {
+		return nil, fmt.Errorf("%s: %w", j.ID, job.ErrNotFound)
+	}
+	return j, nil
+}
+
+func (api *API) handleJobGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, err := api.callerJob(c)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		renderJob(c, http.StatusOK, j)
+	}
+}
+
+func (api *API) handleJobOutput() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, err := api.callerJob(c)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		j, out, err := api.jobs.OpenOutput(c.Request.Context(), j.ID)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		defer out.Close()
+
+		c.DataFromReader(http.StatusOK, out.Size(), j.Output.ContentType, out, map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", j.Output.Filename),
+		})
+	}
+}
+
+func (api *API) handleJobCancel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		j, err := api.callerJob(c)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		j, err = api.jobs.Cancel(ctx, j.ID)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		// A running job is canceled once its handler returns.
+		status := http.StatusOK
+		if !j.Status.Finished() {
+			status = http.StatusAccepted
+		}
+		renderJob(c, status, j)
+	}
+}
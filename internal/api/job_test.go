@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/storage/memory"
+)
+
+type jobResponse struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Status    job.Status      `json:"status"`
+	Progress  job.Progress    `json:"progress"`
+	Result    json.RawMessage `json:"result"`
+	Error     string          `json:"error"`
+	OutputURL string          `json:"output_url"`
+}
+
+func decodeJob(t *testing.T, w *httptest.ResponseRecorder) jobResponse {
+	t.Helper()
+
+	var j jobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &j))
+	return j
+}
+
+// waitJob polls the job at location until it finished.
+func waitJob(t *testing.T, api http.Handler, location, token string) jobResponse {
+	t.Helper()
+
+	var j jobResponse
+	require.Eventually(t, func() bool {
+		w := get(t, api, location, token)
+		require.Equal(t, http.StatusOK, w.Code)
+		j = decodeJob(t, w)
+		return j.Status.Finished()
+	}, 5*time.Second, 5*time.Millisecond)
+	return j
+}
+
+func TestAPIJobs(t *testing.T) {
+	svc := job.NewService(memory.NewJobStorage())
+	api := makeAPIWithStorage(t, memory.NewProductStorage(), WithJobService(svc))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.Run(ctx)
+
+	csvHeader := http.Header{"Content-Type": {"text/csv"}}
+	data := "sku,name,qty,price,unit,status\n" +
+		"JOB-1,Green tea,10,1000,Box,1\n" +
+		"JOB-2,Black tea,x,900,Box,1\n" +
+		"JOB-3,Oolong,5,1200,Box,1\n"
+
+	w := doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products/import?async=true", data, bearer, csvHeader)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+	submitted := decodeJob(t, w)
+	assert.Equal(t, "/api/jobs/"+submitted.ID, location)
+	assert.Equal(t, "product_import", submitted.Kind)
+
+	j := waitJob(t, api, location, bearer)
+	require.Equal(t, job.StatusSucceeded, j.Status, j.Error)
+	assert.Equal(t, job.Progress{Done: 3}, j.Progress)
+	var imported struct {
+		Summary map[string]int `json:"summary"`
+	}
+	require.NoError(t, json.Unmarshal(j.Result, &imported))
+	assert.Equal(t, map[string]int{"created": 2, "updated": 0, "failed": 1}, imported.Summary)
+	assert.Empty(t, j.OutputURL)
+
+	w = get(t, api, location+"/output", bearer)
+	assert.Equal(t, CodeJobNoOutput, decodeProblem(t, w).Code)
+	w = doJSON(t, api, http.MethodPost, location+"/cancel", nil, bearer)
+	assert.Equal(t, CodeJobFinished, decodeProblem(t, w).Code)
+
+	t.Run("export", func(t *testing.T) {
+		w := get(t, api, "/api/v2/products/export?async=true&min_price=1100", bearer)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		j := waitJob(t, api, w.Header().Get("Location"), bearer)
+		require.Equal(t, job.StatusSucceeded, j.Status, j.Error)
+		assert.Equal(t, job.Progress{Done: 1, Total: 1}, j.Progress)
+		assert.JSONEq(t, `{"rows": 1}`, string(j.Result))
+
+		w = get(t, api, j.OutputURL, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+		assert.Equal(t, "sku,name,qty,price,currency,unit,status,category,tags,version\nJOB-3,Oolong,5,1200,VND,Box,active,,,1\n", w.Body.String())
+	})
+
+	t.Run("invalid requests are rejected before queuing", func(t *testing.T) {
+		w := get(t, api, "/api/v2/products/export?async=true&cursor=bogus", bearer)
+		assert.Equal(t, CodeInvalidListOptions, decodeProblem(t, w).Code)
+		w = doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products/import?async=true", "name\nGreen tea\n", bearer, csvHeader)
+		assert.Equal(t, CodeInvalidImport, decodeProblem(t, w).Code)
+	})
+
+	t.Run("jobs of other users", func(t *testing.T) {
+		w := get(t, api, "/api/v2/products/export?async=true", adminBearer)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		location := w.Header().Get("Location")
+		j := waitJob(t, api, location, adminBearer)
+		require.Equal(t, job.StatusSucceeded, j.Status, j.Error)
+
+		for _, path := range []string{location, location + "/output"} {
+			w = get(t, api, path, bearer)
+			assert.Equal(t, CodeJobNotFound, decodeProblem(t, w).Code, path)
+		}
+		w = doJSON(t, api, http.MethodPost, location+"/cancel", nil, bearer)
+		assert.Equal(t, CodeJobNotFound, decodeProblem(t, w).Code)
+
+		// Administrators see every job.
+		w = get(t, api, "/api/jobs/"+submitted.ID, adminBearer)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		w := get(t, api, "/api/jobs/missing", bearer)
+		assert.Equal(t, CodeJobNotFound, decodeProblem(t, w).Code)
+		w = get(t, api, "/api/jobs/missing", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("without a job service", func(t *testing.T) {
+		api := makeAPI(t)
+		w := get(t, api, "/api/v2/products/export?async=true", bearer)
+		assert.Equal(t, CodeJobsUnsupported, decodeProblem(t, w).Code)
+		w = get(t, api, "/api/jobs/missing", bearer)
+		assert.Equal(t, CodeJobsUnsupported, decodeProblem(t, w).Code)
+	})
+}
@@ -1,11 +1,22 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"net/http"
 
 	"github.com/auth0/go-jwt-middleware/v2"
 	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/product"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	callerKey       = "caller"
+	// maxRequestIDLength bounds the request IDs accepted from clients.
+	maxRequestIDLength = 128
 )
 
 func (api *API) authorizationMiddleware() gin.HandlerFunc {
@@ -13,14 +24,73 @@ func (api *API) authorizationMiddleware() gin.HandlerFunc {
 		// Extract token
 		token, err := jwtmiddleware.AuthHeaderTokenExtractor(c.Request)
 		if err != nil || token == "" {
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			abortWithError(c, errUnauthorized)
+			return
 		}
-		fmt.Println("token:", token)
-		err = api.userSvc.ValidateToken(c.Request.Context(), token)
+		email, err := api.userSvc.Authenticate(c.Request.Context(), token)
 		if err != nil {
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			abortWithError(c, fmt.Errorf("%v - %w", err, errUnauthorized))
+			return
+		}
+		c.Set(callerKey, email)
+		c.Request = c.Request.WithContext(product.WithActor(c.Request.Context(), product.Actor{User: email, IP: c.ClientIP()}))
+	}
+}
+
+// adminRequired answers 403 unless the authenticated user is an
+// administrator. It follows authorizationMiddleware.
+func (api *API) adminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !api.userSvc.IsAdmin(caller(c)) {
+			abortWithError(c, fmt.Errorf("%s - %w", caller(c), errForbidden))
+		}
+	}
+}
+
+// caller returns the email of the authenticated user of c.
+func caller(c *gin.Context) string {
+	return c.GetString(callerKey)
+}
+
+// requestID tags every request with an ID, the one sent by the client if it
+// is usable. It is echoed in the response and in problems.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			var b [16]byte
+			_, _ = rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
 		}
 	}
+	return true
+}
+
+// RequestID returns the ID of the request of c, empty outside of the API
+// routes.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// deprecated flags responses of legacy routes and points clients to their
+// successor.
+func deprecated(successor string) gin.HandlerFunc {
+	link := fmt.Sprintf("<%s>; rel=\"successor-version\"", successor)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+	}
 }
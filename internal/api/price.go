@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sampleBackend/internal/money"
+)
+
+// price is the price of a product in a v2 body, a money object. Clients
+// still sending the integer of the legacy API get it read as minor units of
+// the default currency. It is parsed once the rest of the body decoded, so
+// that its errors name the field.
+type price struct {
+	money.Money
+	raw json.RawMessage
+}
+
+func (p *price) UnmarshalJSON(b []byte) error {
+	p.raw = append(p.raw[:0], b...)
+	return nil
+}
+
+// UnmarshalText reads a price sent in a form, which can only be minor units
+// of the default currency.
+func (p *price) UnmarshalText(b []byte) error {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return err
+	}
+	p.Money, p.raw = money.Money{Amount: n}, nil
+	return nil
+}
+
+func (p *price) parse() error {
+	raw := bytes.TrimSpace(p.raw)
+	p.raw = nil
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		p.Money = money.Money{}
+	case raw[0] == '{':
+		var m money.Money
+		if err := m.UnmarshalJSON(raw); err != nil {
+			return priceError(raw, err)
+		}
+		p.Money = m
+	default:
+		n, err := strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return errPriceFormat
+		}
+		p.Money = money.Money{Amount: n}
+	}
+	return nil
+}
+
+var errPriceFormat = errors.New(`must be an object such as {"amount": "12.50", "currency": "USD"}`)
+
+// priceError turns the error of decoding the money object raw into the end
+// of a field message.
+func priceError(raw []byte, err error) error {
+	switch {
+	case money.IsErrInvalidCurrency(err):
+		return errors.New("currency must be an ISO 4217 code")
+	case money.IsErrOverflow(err):
+		return errors.New("amount is out of range")
+	case money.IsErrTooPrecise(err):
+		var m struct {
+			Currency string `json:"currency"`
+		}
+		_ = json.Unmarshal(raw, &m)
+		currency := strings.ToUpper(m.Currency)
+		exp, _ := money.Exponent(currency)
+		return fmt.Errorf("amount must have at most %d decimals in %s", exp, currency)
+	}
+	return errPriceFormat
+}
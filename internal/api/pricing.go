@@ -0,0 +1,312 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/pricing"
+)
+
+const v2PriceListsPath = "/api/v2/price-lists"
+
+var errPricingUnsupported = errors.New("price lists not configured")
+
+// WithPricing serves the price lists of svc. Without it they are not
+// available.
+func WithPricing(svc *pricing.Service) Option {
+	return func(api *API) {
+		api.pricing = svc
+	}
+}
+
+type priceListResource struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newPriceListResource(l *pricing.List) *priceListResource {
+	return &priceListResource{
+		Code:      l.Code,
+		Name:      l.Name,
+		Currency:  l.Currency,
+		CreatedAt: l.CreatedAt,
+	}
+}
+
+type priceResource struct {
+	ID         uint64     `json:"id"`
+	List       string     `json:"list"`
+	SKU        string     `json:"sku"`
+	Price      price      `json:"price"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+}
+
+func newPriceResource(e *pricing.Entry) *priceResource {
+	r := &priceResource{
+		ID:        e.ID,
+		List:      e.List,
+		SKU:       e.SKU,
+		Price:     price{Money: e.Price},
+		ValidFrom: e.From,
+		CreatedAt: e.CreatedAt,
+		CreatedBy: e.CreatedBy,
+	}
+	if !e.Until.IsZero() {
+		until := e.Until
+		r.ValidUntil = &until
+	}
+	return r
+}
+
+func priceListLocation(code string) string {
+	return v2PriceListsPath + "/" + url.PathEscape(code)
+}
+
+// pricingRequired answers 501 when no pricing service is configured.
+func (api *API) pricingRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if api.pricing == nil {
+			abortWithError(c, errPricingUnsupported)
+		}
+	}
+}
+
+func (api *API) handleV2PriceListCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			Code     string `json:"code"`
+			Name     string `json:"name"`
+			Currency string `json:"currency"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("price list create: %#v\n", r)
+
+		l, err := api.pricing.CreateList(ctx, pricing.List{Code: r.Code, Name: r.Name, Currency: r.Currency})
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", priceListLocation(l.Code))
+		c.JSON(http.StatusCreated, newPriceListResource(l))
+	}
+}
+
+func (api *API) handleV2PriceLists() gin.HandlerFunc {
+	type (
+		response struct {
+			Data []*priceListResource `json:"data"`
+		}
+	)
+	return func(c *gin.Context) {
+		lists, err := api.pricing.Lists(c.Request.Context())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		data := make([]*priceListResource, len(lists))
+		for i := range lists {
+			data[i] = newPriceListResource(&lists[i])
+		}
+		c.JSON(http.StatusOK, response{Data: data})
+	}
+}
+
+func (api *API) handleV2PriceListGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l, err := api.pricing.GetList(c.Request.Context(), c.Param("list"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newPriceListResource(l))
+	}
+}
+
+func (api *API) handleV2PriceAdd() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU        string     `json:"sku" binding:"required"`
+			Price      price      `json:"price"`
+			ValidFrom  *time.Time `json:"valid_from"`
+			ValidUntil *time.Time `json:"valid_until"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r    request
+			ctx  = c.Request.Context()
+			list = c.Param("list")
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("price add: %v %#v\n", list, r)
+
+		e := pricing.Entry{List: list, SKU: r.SKU, Price: r.Price.Money}
+		if r.ValidFrom != nil {
+			e.From = *r.ValidFrom
+		}
+		if r.ValidUntil != nil {
+			e.Until = *r.ValidUntil
+		}
+		added, err := api.pricing.AddPrice(ctx, e)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, newPriceResource(added))
+	}
+}
+
+func (api *API) handleV2PriceListPrices() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU string `form:"sku"`
+		}
+	)
+	return func(c *gin.Context) {
+		var r request
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		entries, err := api.pricing.Prices(c.Request.Context(), c.Param("list"), r.SKU)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		renderPrices(c, entries)
+	}
+}
+
+func (api *API) handleV2PriceRemove() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := c.Param("list")
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("price %q - %w", c.Param("id"), pricing.ErrPriceNotFound))
+			return
+		}
+		fmt.Printf("price remove: %v %d\n", list, id)
+
+		err = api.pricing.RemovePrice(c.Request.Context(), list, id)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleV2ProductPrice resolves the price of a product in a list, at a time
+// or now.
+func (api *API) handleV2ProductPrice() gin.HandlerFunc {
+	type (
+		request struct {
+			List string    `form:"list" binding:"required"`
+			At   time.Time `form:"at" time_format:"2006-01-02T15:04:05Z07:00"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+		if r.At.IsZero() {
+			r.At = time.Now()
+		}
+
+		e, err := api.pricing.Resolve(ctx, r.List, c.Param("sku"), r.At)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newPriceResource(e))
+	}
+}
+
+// handleV2ProductPrices lists the prices of a product in every list, or in
+// one, oldest first.
+func (api *API) handleV2ProductPrices() gin.HandlerFunc {
+	type (
+		request struct {
+			List string `form:"list"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		entries, err := api.pricing.Prices(ctx, r.List, sku)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		// A product without prices has an empty history, an unknown one is
+		// not found.
+		if len(entries) == 0 {
+			if _, err := api.prdSvc.GetProduct(ctx, sku, true); err != nil {
+				abortWithError(c, err)
+				return
+			}
+		}
+		renderPrices(c, entries)
+	}
+}
+
+func renderPrices(c *gin.Context, entries []pricing.Entry) {
+	type response struct {
+		Data []*priceResource `json:"data"`
+	}
+	data := make([]*priceResource, len(entries))
+	for i := range entries {
+		data[i] = newPriceResource(&entries[i])
+	}
+	c.JSON(http.StatusOK, response{Data: data})
+}
@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/pricing"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIV2PriceLists(t *testing.T) {
+	type (
+		entry struct {
+			ID         uint64      `json:"id"`
+			List       string      `json:"list"`
+			SKU        string      `json:"sku"`
+			Price      money.Money `json:"price"`
+			ValidFrom  time.Time   `json:"valid_from"`
+			ValidUntil *time.Time  `json:"valid_until"`
+			CreatedBy  string      `json:"created_by"`
+		}
+		entries struct {
+			Data []entry `json:"data"`
+		}
+	)
+	decode := func(t *testing.T, body []byte, v interface{}) {
+		t.Helper()
+		require.NoError(t, json.Unmarshal(body, v))
+	}
+
+	t.Run("requires a pricing service", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, "/api/v2/price-lists", nil, bearer)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, CodePricingUnsupported, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/PL-001/price?list=retail", nil, bearer)
+		assert.Equal(t, CodePricingUnsupported, decodeProblem(t, w).Code)
+	})
+
+	t.Run("schedules and resolves prices", func(t *testing.T) {
+		t.Parallel()
+
+		svc := product.NewService(memory.NewProductStorage())
+		api := makeAPIWithService(t, svc, WithPricing(pricing.NewService(memory.NewPriceStorage(), svc)))
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PL-001", "name": "Priced", "price": {"amount": "10.00", "currency": "USD"}, "unit": "Box"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/price-lists", `{"code": "wholesale", "name": "Wholesale", "currency": "usd"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v2/price-lists/wholesale", w.Header().Get("Location"))
+		w = doJSON(t, api, http.MethodPost, "/api/v2/price-lists", `{"code": "wholesale", "name": "Again", "currency": "USD"}`, bearer)
+		assert.Equal(t, CodePriceListExists, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/price-lists", `{"code": "Bad Code", "name": "Bad", "currency": "USD"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "code", Code: "invalid_format"}}, withoutMessages(decodeProblem(t, w).Errors))
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/price-lists/wholesale", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Currency string `json:"currency"`
+		}
+		decode(t, w.Body.Bytes(), &list)
+		assert.Equal(t, "USD", list.Currency)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/price-lists/vip", nil, bearer)
+		assert.Equal(t, CodePriceListNotFound, decodeProblem(t, w).Code)
+
+		prices := "/api/v2/price-lists/wholesale/prices"
+		w = doJSON(t, api, http.MethodPost, prices, `{"sku": "PL-001", "price": {"amount": "8.00", "currency": "USD"}}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var current entry
+		decode(t, w.Body.Bytes(), &current)
+		assert.Equal(t, money.Money{Amount: 800, Currency: "USD"}, current.Price)
+		assert.Equal(t, "user@gmail.com", current.CreatedBy)
+		assert.Nil(t, current.ValidUntil)
+
+		from := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		w = doJSON(t, api, http.MethodPost, prices, fmt.Sprintf(`{"sku": "PL-001", "price": 750, "valid_from": %q}`, from.Format(time.RFC3339)), bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var scheduled entry
+		decode(t, w.Body.Bytes(), &scheduled)
+		assert.Equal(t, money.Money{Amount: 750, Currency: "USD"}, scheduled.Price)
+		assert.True(t, from.Equal(scheduled.ValidFrom))
+
+		w = doJSON(t, api, http.MethodPost, prices, `{"sku": "PL-001", "price": {"amount": "8.00", "currency": "EUR"}, "valid_from": "2001-01-01T00:00:00Z"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "price", Code: "not_allowed"}, {Field: "valid_from", Code: "not_allowed"}}, withoutMessages(decodeProblem(t, w).Errors))
+		w = doJSON(t, api, http.MethodPost, prices, `{"sku": "PL-404", "price": 1}`, bearer)
+		assert.Equal(t, CodeProductNotFound, decodeProblem(t, w).Code)
+
+		resolve := func(at time.Time) *entry {
+			w := doJSON(t, api, http.MethodGet, "/api/v2/products/PL-001/price?list=wholesale&at="+url.QueryEscape(at.Format(time.RFC3339)), nil, bearer)
+			if w.Code != http.StatusOK {
+				assert.Equal(t, CodePriceNotFound, decodeProblem(t, w).Code)
+				return nil
+			}
+			var e entry
+			decode(t, w.Body.Bytes(), &e)
+			return &e
+		}
+		assert.Nil(t, resolve(time.Now().Add(-time.Hour)))
+		assert.Equal(t, current.ID, resolve(time.Now().Add(time.Second)).ID)
+		assert.Equal(t, scheduled.ID, resolve(from).ID)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/PL-001/price", nil, bearer)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/PL-001/prices", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var history entries
+		decode(t, w.Body.Bytes(), &history)
+		require.Len(t, history.Data, 2)
+		assert.Equal(t, []uint64{current.ID, scheduled.ID}, []uint64{history.Data[0].ID, history.Data[1].ID})
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/PL-404/prices", nil, bearer)
+		assert.Equal(t, CodeProductNotFound, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodDelete, fmt.Sprintf("%s/%d", prices, current.ID), nil, bearer)
+		assert.Equal(t, CodePriceStarted, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodDelete, fmt.Sprintf("%s/%d", prices, scheduled.ID), nil, bearer)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		w = doJSON(t, api, http.MethodDelete, prices+"/x", nil, bearer)
+		assert.Equal(t, CodePriceNotFound, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodGet, prices+"?sku=PL-001", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		decode(t, w.Body.Bytes(), &history)
+		require.Len(t, history.Data, 1)
+		assert.Equal(t, current.ID, history.Data[0].ID)
+	})
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/audit"
+	"sampleBackend/internal/backup"
+	"sampleBackend/internal/idempotency"
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/patch"
+	"sampleBackend/internal/pricing"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/sheet"
+	"sampleBackend/internal/user"
+	"sampleBackend/internal/warehouse"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	// problemTypePath prefixes the type URI of every problem. The catalog is
+	// served under it.
+	problemTypePath = "/api/problems/"
+)
+
+// ErrorCode identifies a kind of problem. Codes are stable: clients may
+// match on them, so never rename one.
+type ErrorCode string
+
+const (
+	CodeBadRequest              ErrorCode = "bad_request"
+	CodeUnauthorized            ErrorCode = "unauthorized"
+	CodeForbidden               ErrorCode = "forbidden"
+	CodeInvalidCredentials      ErrorCode = "invalid_credentials"
+	CodeNotFound                ErrorCode = "not_found"
+	CodeProductNotFound         ErrorCode = "product_not_found"
+	CodeProductExists           ErrorCode = "product_exists"
+	CodeProductNotDeleted       ErrorCode = "product_not_deleted"
+	CodeInvalidTransition       ErrorCode = "invalid_status_transition"
+	CodeInsufficientStock       ErrorCode = "insufficient_stock"
+	CodeUserExists              ErrorCode = "user_exists"
+	CodePreconditionFailed      ErrorCode = "precondition_failed"
+	CodeUnsupportedMediaType    ErrorCode = "unsupported_media_type"
+	CodeValidationFailed        ErrorCode = "validation_failed"
+	CodeInvalidPatch            ErrorCode = "invalid_patch"
+	CodePatchTestFailed         ErrorCode = "patch_test_failed"
+	CodeInvalidListOptions      ErrorCode = "invalid_list_options"
+	CodeInvalidBulk             ErrorCode = "invalid_bulk"
+	CodeBulkTooLarge            ErrorCode = "bulk_too_large"
+	CodeDuplicateSKU            ErrorCode = "duplicate_sku"
+	CodeInvalidArchive          ErrorCode = "invalid_archive"
+	CodeStockPending            ErrorCode = "stock_pending"
+	CodeInvalidImport           ErrorCode = "invalid_import"
+	CodeImportTooLarge          ErrorCode = "import_too_large"
+	CodeTemporalUnsupported     ErrorCode = "temporal_unsupported"
+	CodeHistoryCompacted        ErrorCode = "history_compacted"
+	CodeJobNotFound             ErrorCode = "job_not_found"
+	CodeJobFinished             ErrorCode = "job_finished"
+	CodeJobNoOutput             ErrorCode = "job_no_output"
+	CodeJobsUnsupported         ErrorCode = "jobs_unsupported"
+	CodeIdempotencyKeyReused    ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyKeysInUse    ErrorCode = "idempotency_keys_in_use"
+	CodeIdempotencyNotKept      ErrorCode = "idempotency_response_not_kept"
+	CodeInvalidHistory          ErrorCode = "invalid_history_options"
+	CodeAuditUnsupported        ErrorCode = "audit_unsupported"
+	CodeInvalidMovements        ErrorCode = "invalid_movement_options"
+	CodeLedgerUnsupported       ErrorCode = "ledger_unsupported"
+	CodePriceListNotFound       ErrorCode = "price_list_not_found"
+	CodePriceListExists         ErrorCode = "price_list_exists"
+	CodePriceNotFound           ErrorCode = "price_not_found"
+	CodePriceStarted            ErrorCode = "price_started"
+	CodePromotionNotFound       ErrorCode = "promotion_not_found"
+	CodePromotionExists         ErrorCode = "promotion_exists"
+	CodePricingUnsupported      ErrorCode = "pricing_unsupported"
+	CodeReservationNotFound     ErrorCode = "reservation_not_found"
+	CodeReservationFinished     ErrorCode = "reservation_finished"
+	CodeReservationExpired      ErrorCode = "reservation_expired"
+	CodeReservationsUnsupported ErrorCode = "reservations_unsupported"
+	CodeWarehouseNotFound       ErrorCode = "warehouse_not_found"
+	CodeWarehouseExists         ErrorCode = "warehouse_exists"
+	CodeTransferNotFound        ErrorCode = "transfer_not_found"
+	CodeTransferState           ErrorCode = "invalid_transfer_state"
+	CodeWarehousesUnsupported   ErrorCode = "warehouses_unsupported"
+	CodeInternal                ErrorCode = "internal_error"
+)
+
+type problemKind struct {
+	Status int
+	Title  string
+}
+
+var problemCatalog = map[ErrorCode]problemKind{
+	CodeBadRequest:              {http.StatusBadRequest, "The request could not be parsed"},
+	CodeUnauthorized:            {http.StatusUnauthorized, "Authentication is required"},
+	CodeForbidden:               {http.StatusForbidden, "The user is not allowed to do this"},
+	CodeInvalidCredentials:      {http.StatusUnauthorized, "The email or password is wrong"},
+	CodeNotFound:                {http.StatusNotFound, "The resource does not exist"},
+	CodeProductNotFound:         {http.StatusNotFound, "The product does not exist"},
+	CodeProductExists:           {http.StatusConflict, "A product with this SKU already exists"},
+	CodeProductNotDeleted:       {http.StatusConflict, "The product is not deleted"},
+	CodeInvalidTransition:       {http.StatusConflict, "The product cannot change to this status"},
+	CodeInsufficientStock:       {http.StatusConflict, "The product does not have enough stock"},
+	CodeUserExists:              {http.StatusConflict, "A user with this email already exists"},
+	CodePreconditionFailed:      {http.StatusPreconditionFailed, "The resource was modified since it was read"},
+	CodeUnsupportedMediaType:    {http.StatusUnsupportedMediaType, "The content type is not supported"},
+	CodeValidationFailed:        {http.StatusUnprocessableEntity, "The request has invalid fields"},
+	CodeInvalidPatch:            {http.StatusUnprocessableEntity, "The patch cannot be applied"},
+	CodePatchTestFailed:         {http.StatusConflict, "A test operation of the patch failed"},
+	CodeInvalidListOptions:      {http.StatusBadRequest, "The listing parameters are invalid"},
+	CodeInvalidBulk:             {http.StatusBadRequest, "The bulk request is invalid"},
+	CodeBulkTooLarge:            {http.StatusRequestEntityTooLarge, "The bulk request has too many products"},
+	CodeDuplicateSKU:            {http.StatusUnprocessableEntity, "The SKU appears more than once in the request"},
+	CodeInvalidArchive:          {http.StatusBadRequest, "The backup archive is invalid"},
+	CodeStockPending:            {http.StatusConflict, "Stock is reserved or in transit"},
+	CodeInvalidImport:           {http.StatusBadRequest, "The imported sheet cannot be read"},
+	CodeImportTooLarge:          {http.StatusRequestEntityTooLarge, "The imported sheet has too many rows"},
+	CodeTemporalUnsupported:     {http.StatusNotImplemented, "The product storage does not keep history"},
+	CodeHistoryCompacted:        {http.StatusGone, "The product history at that time was compacted"},
+	CodeJobNotFound:             {http.StatusNotFound, "The job does not exist"},
+	CodeJobFinished:             {http.StatusConflict, "The job has already finished"},
+	CodeJobNoOutput:             {http.StatusConflict, "The job has no output to download"},
+	CodeJobsUnsupported:         {http.StatusNotImplemented, "Background jobs are not configured"},
+	CodeIdempotencyKeyReused:    {http.StatusUnprocessableEntity, "The idempotency key was used for another request"},
+	CodeIdempotencyKeysInUse:    {http.StatusTooManyRequests, "Too many requests with an idempotency key are running"},
+	CodeIdempotencyNotKept:      {http.StatusConflict, "The request with this idempotency key completed, its response was too large to keep"},
+	CodeInvalidHistory:          {http.StatusBadRequest, "The history parameters are invalid"},
+	CodeAuditUnsupported:        {http.StatusNotImplemented, "The audit log is not configured"},
+	CodeInvalidMovements:        {http.StatusBadRequest, "The movement listing parameters are invalid"},
+	CodeLedgerUnsupported:       {http.StatusNotImplemented, "The stock ledger is not configured"},
+	CodePriceListNotFound:       {http.StatusNotFound, "The price list does not exist"},
+	CodePriceListExists:         {http.StatusConflict, "A price list with this code already exists"},
+	CodePriceNotFound:           {http.StatusNotFound, "The product has no such price"},
+	CodePriceStarted:            {http.StatusConflict, "The price is already in effect"},
+	CodePromotionNotFound:       {http.StatusNotFound, "The promotion does not exist"},
+	CodePromotionExists:         {http.StatusConflict, "A promotion with this code already exists"},
+	CodePricingUnsupported:      {http.StatusNotImplemented, "Price lists are not configured"},
+	CodeReservationNotFound:     {http.StatusNotFound, "The reservation does not exist"},
+	CodeReservationFinished:     {http.StatusConflict, "The reservation is already confirmed, cancelled or expired"},
+	CodeReservationExpired:      {http.StatusConflict, "The reservation has expired"},
+	CodeReservationsUnsupported: {http.StatusNotImplemented, "Reservations are not configured"},
+	CodeWarehouseNotFound:       {http.StatusNotFound, "The warehouse does not exist"},
+	CodeWarehouseExists:         {http.StatusConflict, "A warehouse with this code already exists"},
+	CodeTransferNotFound:        {http.StatusNotFound, "The transfer does not exist"},
+	CodeTransferState:           {http.StatusConflict, "The transfer cannot change to this status"},
+	CodeWarehousesUnsupported:   {http.StatusNotImplemented, "Warehouses are not configured"},
+	CodeInternal:                {http.StatusInternalServerError, "An unexpected error occurred"},
+}
+
+// fixedDetails are the details of the codes whose errors may carry internal
+// causes, e.g. of a decoder, a storage or the password hashing, which
+// clients must not see. An empty detail is left out.
+var fixedDetails = map[ErrorCode]string{
+	CodeBadRequest:         "",
+	CodeUnauthorized:       "",
+	CodeInvalidCredentials: "The email and password do not match an account",
+	CodeUserExists:         "",
+	CodePreconditionFailed: "",
+	CodePriceListExists:    "",
+	CodePromotionExists:    "",
+	CodeInternal:           "",
+}
+
+// errorCodes maps domain errors to their code. The first match wins.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{errMalformed, CodeBadRequest},
+	{errUnsupportedContent, CodeUnsupportedMediaType},
+	{errUnauthorized, CodeUnauthorized},
+	{errForbidden, CodeForbidden},
+	{errNoRoute, CodeNotFound},
+	{product.ErrInvalid, CodeValidationFailed},
+	{product.ErrNotFound, CodeProductNotFound},
+	{product.ErrExist, CodeProductExists},
+	{product.ErrNotDeleted, CodeProductNotDeleted},
+	{product.ErrInvalidTransition, CodeInvalidTransition},
+	{product.ErrInsufficientStock, CodeInsufficientStock},
+	{product.ErrInvalidStatus, CodeValidationFailed},
+	{product.ErrConflict, CodePreconditionFailed},
+	{errPreconditionFailed, CodePreconditionFailed},
+	{patch.ErrInvalidPatch, CodeInvalidPatch},
+	{patch.ErrTestFailed, CodePatchTestFailed},
+	{product.ErrInvalidListOptions, CodeInvalidListOptions},
+	{product.ErrInvalidBulk, CodeInvalidBulk},
+	{product.ErrBulkTooLarge, CodeBulkTooLarge},
+	{product.ErrDuplicate, CodeDuplicateSKU},
+	{product.ErrTemporalUnsupported, CodeTemporalUnsupported},
+	{product.ErrHistoryCompacted, CodeHistoryCompacted},
+	{user.ErrUserExist, CodeUserExists},
+	{user.ErrUserInvalid, CodeInvalidCredentials},
+	{backup.ErrInvalidArchive, CodeInvalidArchive},
+	{backup.ErrPending, CodeStockPending},
+	{errInvalidImport, CodeInvalidImport},
+	{sheet.ErrInvalidSheet, CodeInvalidImport},
+	{errImportTooLarge, CodeImportTooLarge},
+	{job.ErrNotFound, CodeJobNotFound},
+	{job.ErrFinished, CodeJobFinished},
+	{job.ErrNoOutput, CodeJobNoOutput},
+	{errJobsUnsupported, CodeJobsUnsupported},
+	{idempotency.ErrKeyReused, CodeIdempotencyKeyReused},
+	{idempotency.ErrTooManyKeys, CodeIdempotencyKeysInUse},
+	{idempotency.ErrNotKept, CodeIdempotencyNotKept},
+	{audit.ErrInvalidOptions, CodeInvalidHistory},
+	{errAuditUnsupported, CodeAuditUnsupported},
+	{inventory.ErrInvalidOptions, CodeInvalidMovements},
+	{errLedgerUnsupported, CodeLedgerUnsupported},
+	{pricing.ErrInvalid, CodeValidationFailed},
+	{pricing.ErrListNotFound, CodePriceListNotFound},
+	{pricing.ErrListExist, CodePriceListExists},
+	{pricing.ErrPriceNotFound, CodePriceNotFound},
+	{pricing.ErrPriceStarted, CodePriceStarted},
+	{pricing.ErrPromotionNotFound, CodePromotionNotFound},
+	{pricing.ErrPromotionExist, CodePromotionExists},
+	{errPricingUnsupported, CodePricingUnsupported},
+	{reservation.ErrNotFound, CodeReservationNotFound},
+	{reservation.ErrFinished, CodeReservationFinished},
+	{reservation.ErrExpired, CodeReservationExpired},
+	{errReservationsUnsupported, CodeReservationsUnsupported},
+	{warehouse.ErrNotFound, CodeWarehouseNotFound},
+	{warehouse.ErrExist, CodeWarehouseExists},
+	{warehouse.ErrTransferNotFound, CodeTransferNotFound},
+	{warehouse.ErrTransferState, CodeTransferState},
+	{errWarehousesUnsupported, CodeWarehousesUnsupported},
+}
+
+var (
+	errUnauthorized = errors.New("missing or invalid bearer token")
+	errForbidden    = errors.New("administrator required")
+	errNoRoute      = errors.New("no such route")
+)
+
+// Problem is an RFC 7807 problem details object. Code, RequestID and
+// Errors are extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is an invalid field of a request. Code is machine-readable.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func codeOf(err error) ErrorCode {
+	var verr *validationError
+	if errors.As(err, &verr) {
+		return CodeValidationFailed
+	}
+	for _, m := range errorCodes {
+		if errors.Is(err, m.err) {
+			return m.code
+		}
+	}
+	return CodeInternal
+}
+
+func newProblem(c *gin.Context, err error) *Problem {
+	code := codeOf(err)
+	kind := problemCatalog[code]
+	p := &Problem{
+		Type:      problemTypePath + string(code),
+		Title:     kind.Title,
+		Status:    kind.Status,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: RequestID(c),
+	}
+	p.Detail = detailOf(err, code)
+
+	p.Errors = fieldErrorsOf(err)
+	return p
+}
+
+// detailOf returns the detail of err, of the code code, for clients: the
+// message of the innermost error of its chain matching the error of code,
+// without the prefixes added on its way up, or the fixed detail of code.
+// The whole text of err only goes to the logs, through c.Errors.
+func detailOf(err error, code ErrorCode) string {
+	if detail, ok := fixedDetails[code]; ok {
+		return detail
+	}
+	var target error
+	for _, m := range errorCodes {
+		if m.code == code && errors.Is(err, m.err) {
+			target = m.err
+			break
+		}
+	}
+	if target == nil {
+		return err.Error()
+	}
+	for {
+		next := errors.Unwrap(err)
+		if next == nil || next == target || !errors.Is(next, target) {
+			return err.Error()
+		}
+		err = next
+	}
+}
+
+// fieldErrorsOf returns the invalid fields reported by err, if any.
+func fieldErrorsOf(err error) []FieldError {
+	var (
+		verr  *validationError
+		pverr *product.ValidationError
+		prerr *pricing.ValidationError
+		ret   []FieldError
+	)
+	switch {
+	case errors.As(err, &verr):
+		ret = verr.fields
+	case errors.As(err, &pverr):
+		for _, f := range pverr.Fields {
+			ret = append(ret, FieldError{Field: f.Field, Code: f.Code, Message: f.Message})
+		}
+	case errors.As(err, &prerr):
+		for _, f := range prerr.Fields {
+			ret = append(ret, FieldError{Field: f.Field, Code: f.Code, Message: f.Message})
+		}
+	}
+	return ret
+}
+
+// abortWithError replies to the request with the problem matching err and
+// stops the handler chain.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+
+	p := newProblem(c, err)
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+func (api *API) handleProblemType() gin.HandlerFunc {
+	type response struct {
+		Type   string    `json:"type"`
+		Code   ErrorCode `json:"code"`
+		Title  string    `json:"title"`
+		Status int       `json:"status"`
+	}
+	return func(c *gin.Context) {
+		code := ErrorCode(c.Param("code"))
+		kind, ok := problemCatalog[code]
+		if !ok {
+			abortWithError(c, fmt.Errorf("unknown problem type %q - %w", code, errNoRoute))
+			return
+		}
+		c.JSON(http.StatusOK, response{Type: problemTypePath + string(code), Code: code, Title: kind.Title, Status: kind.Status})
+	}
+}
+
+// handleNoRoute answers unknown routes with a problem.
+func handleNoRoute(c *gin.Context) {
+	abortWithError(c, fmt.Errorf("%s %s - %w", c.Request.Method, c.Request.URL.Path, errNoRoute))
+}
+
+// recovery turns panics of the handlers into a problem.
+func recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		abortWithError(c, fmt.Errorf("panic: %v", recovered))
+	})
+}
@@ -0,0 +1,160 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+// failingStorage fails every read with an error clients must not see.
+type failingStorage struct {
+	*memory.ProductStorage
+}
+
+func (failingStorage) Get(context.Context, string) (*product.Product, error) {
+	return nil, errors.New("disk on fire at /var/lib/products")
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	t.Helper()
+
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, w.Code, p.Status)
+	assert.Equal(t, "/api/problems/"+string(p.Code), p.Type)
+	assert.NotEmpty(t, p.Title)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), p.RequestID)
+	return p
+}
+
+func TestAPIProblems(t *testing.T) {
+	t.Run("domain errors are mapped", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, "/api/v2/products/NOPE-001", nil, bearer)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		p := decodeProblem(t, w)
+		assert.Equal(t, CodeProductNotFound, p.Code)
+		assert.Equal(t, "/api/v2/products/NOPE-001", p.Instance)
+		assert.NotEmpty(t, p.RequestID)
+
+		// Legacy routes used to answer with an empty body.
+		w = postForm(t, api, "/api/item/update", validProductForm("NOPE-001"), bearer)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, CodeProductNotFound, decodeProblem(t, w).Code)
+	})
+
+	t.Run("validation errors are an extension", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "x"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		p := decodeProblem(t, w)
+		assert.Equal(t, CodeValidationFailed, p.Code)
+		assert.Contains(t, withoutMessages(p.Errors), FieldError{Field: "sku", Code: "invalid_format"})
+	})
+
+	t.Run("internal errors do not leak", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPIWithStorage(t, failingStorage{memory.NewProductStorage()})
+		w := doJSON(t, api, http.MethodGet, "/api/v2/products/ANY-001", nil, bearer)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		p := decodeProblem(t, w)
+		assert.Equal(t, CodeInternal, p.Code)
+		assert.Empty(t, p.Detail)
+		assert.NotContains(t, w.Body.String(), "disk on fire")
+	})
+
+	t.Run("unauthorized requests stop at the middleware", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := postForm(t, api, "/api/item/add", validProductForm("AUTH-001"), "not-a-token")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, CodeUnauthorized, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/AUTH-001", nil, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("credentials do not tell unknown emails apart", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		var details []string
+		for _, email := range []string{registeredUser, "nobody@gmail.com"} {
+			w := postForm(t, api, "/api/auth/login", url.Values{"email": {email}, "password": {"wrong-password"}}, "")
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			p := decodeProblem(t, w)
+			assert.Equal(t, CodeInvalidCredentials, p.Code)
+			details = append(details, p.Detail)
+		}
+		assert.NotEmpty(t, details[0])
+		assert.Equal(t, details[0], details[1])
+	})
+
+	t.Run("details leave out wrapped causes", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": `, bearer)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		p := decodeProblem(t, w)
+		assert.Equal(t, CodeBadRequest, p.Code)
+		assert.Empty(t, p.Detail)
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products?cursor=bm9wZQ", nil, bearer)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		p = decodeProblem(t, w)
+		assert.Equal(t, CodeInvalidListOptions, p.Code)
+		assert.Equal(t, `decode cursor "bm9wZQ" - invalid list options`, p.Detail)
+	})
+
+	t.Run("unknown routes", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := get(t, api, "/api/nowhere", "")
+		require.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, CodeNotFound, decodeProblem(t, w).Code)
+	})
+
+	t.Run("client request id is kept", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		r := httptest.NewRequest(http.MethodGet, "/api/v2/products/NOPE-001", nil)
+		r.Header.Set("Authorization", "Bearer "+bearer)
+		r.Header.Set("X-Request-ID", "trace-42")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		assert.Equal(t, "trace-42", decodeProblem(t, w).RequestID)
+	})
+
+	t.Run("problem types are documented", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := get(t, api, "/api/problems/product_exists", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"type":"/api/problems/product_exists","code":"product_exists","title":"A product with this SKU already exists","status":409}`, w.Body.String())
+
+		w = get(t, api, "/api/problems/nope", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"sampleBackend/internal/product"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	// maxBulkBodySize bounds the body of a bulk request, which carries up to
+	// product.MaxBulkSize products.
+	maxBulkBodySize = 8 << 20
+)
+
+type bulkItemError struct {
+	Code    ErrorCode    `json:"code"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+type bulkItemResult struct {
+	Index   int                `json:"index"`
+	SKU     string             `json:"sku,omitempty"`
+	Status  product.BulkStatus `json:"status"`
+	Version uint64             `json:"version,omitempty"`
+	Error   *bulkItemError     `json:"error,omitempty"`
+}
+
+func newBulkItemError(err error) *bulkItemError {
+	code := codeOf(err)
+	e := &bulkItemError{Code: code, Message: detailOf(err, code), Errors: fieldErrorsOf(err)}
+	if e.Message == "" {
+		e.Message = problemCatalog[code].Title
+	}
+	return e
+}
+
+// splitBulkBody returns the products of a bulk body: the elements of a JSON
+// array, or the non-blank lines of NDJSON.
+func splitBulkBody(contentType string, body []byte) ([][]byte, error) {
+	switch contentType {
+	case binding.MIMEJSON:
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("decode json array: %v - %w", err, errMalformed)
+		}
+		ret := make([][]byte, len(raw))
+		for i := range raw {
+			ret[i] = raw[i]
+		}
+		return ret, nil
+	case mimeNDJSON:
+		var ret [][]byte
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				ret = append(ret, line)
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("content type %q - %w", contentType, errUnsupportedContent)
+}
+
+func (api *API) handleV2ProductBulk() gin.HandlerFunc {
+	type (
+		request struct {
+			Mode   product.BulkMode `form:"mode"`
+			Atomic bool             `form:"atomic"`
+		}
+		item struct {
+			SKU      string          `json:"sku"`
+			Name     string          `json:"name"`
+			Quantity uint32          `json:"qty"`
+			Price    price           `json:"price"`
+			Unit     string          `json:"unit"`
+			Status   *product.Status `json:"status"`
+			Category string          `json:"category"`
+			Tags     []string        `json:"tags"`
+		}
+		summary struct {
+			Created int `json:"created"`
+			Updated int `json:"updated"`
+			Failed  int `json:"failed"`
+			Skipped int `json:"skipped"`
+		}
+		response struct {
+			Mode      product.BulkMode `json:"mode"`
+			Atomic    bool             `json:"atomic"`
+			Committed bool             `json:"committed"`
+			Summary   summary          `json:"summary"`
+			Results   []bulkItemResult `json:"results"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+		if r.Mode == "" {
+			r.Mode = product.BulkCreate
+		}
+
+		body, err := readBody(c, maxBulkBodySize)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		docs, err := splitBulkBody(c.ContentType(), body)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if len(docs) > product.MaxBulkSize {
+			abortWithError(c, fmt.Errorf("%d products, at most %d - %w", len(docs), product.MaxBulkSize, product.ErrBulkTooLarge))
+			return
+		}
+		fmt.Printf("product bulk: %s atomic %v, %d products\n", r.Mode, r.Atomic, len(docs))
+
+		// Products failing to decode are reported as is, the others go to
+		// the service. indexes maps the latter back to their position.
+		var (
+			results  = make([]bulkItemResult, len(docs))
+			products = make([]product.BulkProduct, 0, len(docs))
+			indexes  = make([]int, 0, len(docs))
+			failed   bool
+		)
+		for i, doc := range docs {
+			var (
+				it   item
+				verr = &validationError{}
+			)
+			results[i].Index = i
+			err := decodeJSON(doc, &it, verr)
+			if err == nil && len(verr.fields) > 0 {
+				err = verr
+			}
+			if err != nil {
+				results[i].Status, results[i].Error = product.BulkFailed, newBulkItemError(err)
+				failed = true
+				continue
+			}
+			p := product.BulkProduct{Product: product.Product{
+				SKU:      it.SKU,
+				Name:     it.Name,
+				Quantity: it.Quantity,
+				Price:    it.Price.Money,
+				Unit:     it.Unit,
+				Category: it.Category,
+				Tags:     it.Tags,
+			}}
+			if it.Status != nil {
+				p.Status, p.StatusSet = *it.Status, true
+			}
+			products = append(products, p)
+			indexes = append(indexes, i)
+		}
+
+		var written []product.BulkResult
+		if r.Atomic && failed {
+			written = make([]product.BulkResult, len(products))
+			for i, p := range products {
+				written[i] = product.BulkResult{SKU: p.SKU, Status: product.BulkSkipped}
+			}
+			err = product.ErrBulkAborted
+		} else {
+			written, err = api.prdSvc.BulkWrite(ctx, products, product.BulkOptions{Mode: r.Mode, Atomic: r.Atomic})
+		}
+		if err != nil && !product.IsErrBulkAborted(err) {
+			abortWithError(c, err)
+			return
+		}
+
+		resp := response{Mode: r.Mode, Atomic: r.Atomic, Committed: err == nil, Results: results}
+		for i, w := range written {
+			res := &results[indexes[i]]
+			res.SKU, res.Status = w.SKU, w.Status
+			if w.Product != nil {
+				res.Version = w.Product.Version
+			}
+			if w.Err != nil {
+				res.Error = newBulkItemError(w.Err)
+			}
+		}
+		for _, res := range results {
+			switch res.Status {
+			case product.BulkCreated:
+				resp.Summary.Created++
+			case product.BulkUpdated:
+				resp.Summary.Updated++
+			case product.BulkFailed:
+				resp.Summary.Failed++
+			case product.BulkSkipped:
+				resp.Summary.Skipped++
+			}
+		}
+
+		status := http.StatusOK
+		if !resp.Committed {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, resp)
+	}
+}
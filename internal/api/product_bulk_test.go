@@ -0,0 +1,155 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+)
+
+func TestAPIV2ProductsBulk(t *testing.T) {
+	path := "/api/v2/products/bulk"
+
+	type (
+		itemError struct {
+			Code   ErrorCode    `json:"code"`
+			Errors []FieldError `json:"errors"`
+		}
+		result struct {
+			Index   int        `json:"index"`
+			SKU     string     `json:"sku"`
+			Status  string     `json:"status"`
+			Version uint64     `json:"version"`
+			Error   *itemError `json:"error"`
+		}
+		response struct {
+			Mode      string         `json:"mode"`
+			Atomic    bool           `json:"atomic"`
+			Committed bool           `json:"committed"`
+			Summary   map[string]int `json:"summary"`
+			Results   []result       `json:"results"`
+		}
+	)
+	decode := func(t *testing.T, body []byte) response {
+		var got response
+		require.NoError(t, json.Unmarshal(body, &got))
+		return got
+	}
+	statuses := func(resp response) []string {
+		ret := make([]string, len(resp.Results))
+		for i, r := range resp.Results {
+			ret[i] = r.Status
+		}
+		return ret
+	}
+	ndjson := http.Header{"Content-Type": {"application/x-ndjson"}}
+
+	t.Run("create and upsert", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, path, `[
+			{"sku": "BLK-1", "name": "Bulk one", "price": 10, "unit": "Box"},
+			{"sku": "BLK-2", "name": "Bulk two", "price": 0, "unit": "Box"},
+			{"sku": "BLK-3", "name": "Bulk three", "price": 30, "unit": "Box", "color": "red"},
+			"BLK-4"
+		]`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		resp := decode(t, w.Body.Bytes())
+		assert.Equal(t, "create", resp.Mode)
+		assert.True(t, resp.Committed)
+		assert.Equal(t, []string{"created", "failed", "failed", "failed"}, statuses(resp))
+		assert.Equal(t, map[string]int{"created": 1, "updated": 0, "failed": 3, "skipped": 0}, resp.Summary)
+		assert.Equal(t, uint64(1), resp.Results[0].Version)
+		assert.Equal(t, CodeValidationFailed, resp.Results[1].Error.Code)
+		assert.Equal(t, []FieldError{{Field: "price", Code: "required"}}, withoutMessages(resp.Results[1].Error.Errors))
+		assert.Equal(t, []FieldError{{Field: "color", Code: "unknown_field"}}, withoutMessages(resp.Results[2].Error.Errors))
+		assert.Equal(t, CodeBadRequest, resp.Results[3].Error.Code)
+
+		body := `{"sku": "BLK-1", "name": "Bulk one", "price": 11, "unit": "Box"}
+{"sku": "BLK-2", "name": "Bulk two", "price": 20, "unit": "Box"}
+
+{"sku": "BLK-2", "name": "Bulk two", "price": 21, "unit": "Box"}
+`
+		w = doJSONWithHeader(t, api, http.MethodPost, path+"?mode=upsert", body, bearer, ndjson)
+		require.Equal(t, http.StatusOK, w.Code)
+		resp = decode(t, w.Body.Bytes())
+		assert.Equal(t, []string{"updated", "created", "failed"}, statuses(resp))
+		assert.Equal(t, CodeDuplicateSKU, resp.Results[2].Error.Code)
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/BLK-1", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"price":{"amount":"11","currency":"VND"}`)
+
+		// The status of an update can be omitted or the current one.
+		w = doJSON(t, api, http.MethodPost, path+"?mode=update", `[
+			{"sku": "BLK-1", "name": "Bulk one", "price": 12, "unit": "Box", "status": "active"},
+			{"sku": "BLK-2", "name": "Bulk two", "price": 22, "unit": "Box", "status": "draft"}
+		]`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		resp = decode(t, w.Body.Bytes())
+		assert.Equal(t, []string{"failed", "updated"}, statuses(resp))
+		assert.Equal(t, []FieldError{{Field: "status", Code: "read_only"}}, withoutMessages(resp.Results[0].Error.Errors))
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		body := `[
+			{"sku": "ATM-1", "name": "Atomic one", "price": 10, "unit": "Box"},
+			{"sku": "ATM-2", "name": "Atomic two", "price": 20, "unit": "Box"}
+		]`
+		w := doJSON(t, api, http.MethodPost, path+"?mode=update&atomic=true", body, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		resp := decode(t, w.Body.Bytes())
+		assert.False(t, resp.Committed)
+		assert.Equal(t, []string{"failed", "failed"}, statuses(resp))
+		assert.Equal(t, CodeProductNotFound, resp.Results[0].Error.Code)
+
+		w = doJSON(t, api, http.MethodPost, path+"?atomic=true", strings.Replace(body, `"price": 20`, `"price": "x"`, 1), bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []string{"skipped", "failed"}, statuses(decode(t, w.Body.Bytes())))
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/ATM-1", nil, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = doJSON(t, api, http.MethodPost, path+"?atomic=true", body, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		resp = decode(t, w.Body.Bytes())
+		assert.True(t, resp.Committed)
+		assert.Equal(t, []string{"created", "created"}, statuses(resp))
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		var many strings.Builder
+		for i := 0; i <= 1000; i++ {
+			fmt.Fprintf(&many, "{\"sku\": \"MANY-%d\"}\n", i)
+		}
+
+		tests := map[string]struct {
+			target string
+			body   string
+			header http.Header
+			code   ErrorCode
+		}{
+			"mode":         {path + "?mode=merge", `[]`, nil, CodeInvalidBulk},
+			"not an array": {path, `{"sku": "X"}`, nil, CodeBadRequest},
+			"content type": {path, `[]`, http.Header{"Content-Type": {"text/csv"}}, CodeUnsupportedMediaType},
+			"too many":     {path, many.String(), ndjson, CodeBulkTooLarge},
+		}
+		for name, tt := range tests {
+			w := doJSONWithHeader(t, api, http.MethodPost, tt.target, tt.body, bearer, tt.header)
+			assert.Equal(t, tt.code, decodeProblem(t, w).Code, name)
+		}
+	})
+}
@@ -0,0 +1,637 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/sheet"
+)
+
+const (
+	// exportPageSize is the number of products read at a time by an export.
+	exportPageSize = 500
+	// maxImportSize bounds the size of an imported sheet.
+	maxImportSize = 32 << 20
+	// maxImportRows bounds the number of products of an imported sheet.
+	maxImportRows = 10000
+)
+
+var (
+	errInvalidImport  = errors.New("invalid import")
+	errImportTooLarge = errors.New("too many rows in import")
+)
+
+// sheetColumns are the columns of an export, and the fields an import
+// column can be mapped to.
+var sheetColumns = []string{"sku", "name", "qty", "price", "currency", "unit", "status", "category", "tags", "version"}
+
+// sheetNumberColumns are the columns of an export spreadsheets can compute
+// with. The others, identifiers like the SKU, are always written as text.
+var sheetNumberColumns = map[string]bool{"qty": true, "price": true, "version": true}
+
+func sheetTextColumns() []int {
+	var ret []int
+	for i, c := range sheetColumns {
+		if !sheetNumberColumns[c] {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// sheetAliases are the other header names an import recognizes.
+var sheetAliases = map[string]string{
+	"quantity": "qty",
+}
+
+func productRow(p *product.Product) []string {
+	return []string{
+		p.SKU,
+		p.Name,
+		strconv.FormatUint(uint64(p.Quantity), 10),
+		p.Price.Decimal(),
+		p.Price.Currency,
+		p.Unit,
+		p.Status.String(),
+		p.Category,
+		strings.Join(p.Tags, ","),
+		strconv.FormatUint(p.Version, 10),
+	}
+}
+
+// exportParams are the parameters of an export job.
+type exportParams struct {
+	Format   sheet.Format        `json:"format"`
+	Filename string              `json:"filename"`
+	Options  product.ListOptions `json:"options"`
+}
+
+func exportFilename(f sheet.Format) string {
+	return fmt.Sprintf("products-%s.%s", time.Now().UTC().Format("20060102T150405Z"), f)
+}
+
+// exportSheet writes the products selected by opts to w, starting with page,
+// their first page. progress, when not nil, is called after each page.
+func (api *API) exportSheet(ctx context.Context, w io.Writer, f sheet.Format, opts product.ListOptions, page *product.Page, progress func(done, total int) error) (int, error) {
+	rows := 0
+	sw, err := sheet.NewWriter(f, w, sheet.WithTextColumns(sheetTextColumns()...))
+	if err == nil {
+		err = sw.WriteRow(sheetColumns)
+	}
+	for err == nil {
+		for i := 0; i < len(page.Items) && err == nil; i++ {
+			err = sw.WriteRow(productRow(page.Items[i]))
+			rows++
+		}
+		if err == nil && progress != nil {
+			err = progress(rows, page.Total)
+		}
+		if err != nil || page.Next == "" {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		opts.Cursor = page.Next
+		page, err = api.prdSvc.ListProduct(ctx, opts)
+	}
+	if err == nil {
+		err = sw.Close()
+	}
+	return rows, err
+}
+
+// runExport runs an export job. A resumed export starts over.
+func (api *API) runExport(ctx context.Context, t *job.Task) (interface{}, error) {
+	type (
+		result struct {
+			Rows int `json:"rows"`
+		}
+	)
+	var p exportParams
+	if err := t.DecodeParams(&p); err != nil {
+		return nil, fmt.Errorf("decode params: %w", err)
+	}
+	page, err := api.prdSvc.ListProduct(ctx, p.Options)
+	if err != nil {
+		return nil, err
+	}
+	w, err := t.CreateOutput(ctx, p.Format.ContentType(), p.Filename)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := api.exportSheet(ctx, w, p.Format, p.Options, page, func(done, total int) error {
+		return t.Progress(ctx, done, total)
+	})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result{Rows: rows}, nil
+}
+
+func (api *API) handleV2ProductExport() gin.HandlerFunc {
+	type (
+		request struct {
+			listRequest
+			Format sheet.Format `form:"format" binding:"omitempty,oneof=csv xlsx"`
+			Async  bool         `form:"async"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+		if r.Format == "" {
+			r.Format = sheet.CSV
+		}
+		opts, err := r.options()
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		opts.Limit = exportPageSize
+		fmt.Printf("product export: %s %#v async %v\n", r.Format, opts.Filter, r.Async)
+
+		// The first page is read before anything is sent, so invalid options
+		// still get a problem.
+		page, err := api.prdSvc.ListProduct(ctx, opts)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		name := exportFilename(r.Format)
+		if r.Async {
+			api.submitJob(c, jobProductExport, exportParams{Format: r.Format, Filename: name, Options: opts}, nil)
+			return
+		}
+
+		c.Header("Content-Type", r.Format.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		c.Status(http.StatusOK)
+
+		// Streaming started, the sheet is cut short instead.
+		if _, err := api.exportSheet(ctx, c.Writer, r.Format, opts, page, nil); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// upload is an uploaded sheet.
+type upload struct {
+	io.ReaderAt
+	io.Closer
+	size        int64
+	contentType string
+	filename    string
+}
+
+// importSource returns the uploaded sheet: the "file" part of a multipart
+// form or the raw body.
+func importSource(c *gin.Context) (*upload, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("parse request: %v - %w", err, errMalformed)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("parse request: %v - %w", err, errMalformed)
+		}
+		return &upload{ReaderAt: f, Closer: f, size: fh.Size, contentType: fh.Header.Get("Content-Type"), filename: fh.Filename}, nil
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %v - %w", err, errMalformed)
+	}
+	return &upload{ReaderAt: bytes.NewReader(body), Closer: io.NopCloser(nil), size: int64(len(body)), contentType: c.ContentType()}, nil
+}
+
+// importFormat tells the format of an upload from its content type, then
+// its file name.
+func importFormat(contentType, filename string) (sheet.Format, error) {
+	switch contentType {
+	case sheet.CSVContentType:
+		return sheet.CSV, nil
+	case sheet.XLSXContentType:
+		return sheet.XLSX, nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return sheet.CSV, nil
+	case ".xlsx":
+		return sheet.XLSX, nil
+	}
+	return "", fmt.Errorf("content type %q - %w", contentType, errUnsupportedContent)
+}
+
+// importColumns maps the header cells of a sheet to product fields through
+// mapping, from header name to field, or else by name. Unknown columns are
+// returned as ignored.
+func importColumns(header []string, mapping map[string]string) ([]string, []string, error) {
+	known := make(map[string]bool, len(sheetColumns))
+	for _, f := range sheetColumns {
+		known[f] = true
+	}
+	lowered := make(map[string]string, len(mapping))
+	for h, f := range mapping {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if !known[f] || f == "version" {
+			return nil, nil, fmt.Errorf("map[%s]: unknown field %q - %w", h, f, errInvalidImport)
+		}
+		lowered[strings.ToLower(strings.TrimSpace(h))] = f
+	}
+
+	var (
+		fields  = make([]string, len(header))
+		ignored []string
+		mapped  = make(map[string]string)
+	)
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		f, ok := lowered[name]
+		if !ok {
+			f = name
+			if alias, ok := sheetAliases[f]; ok {
+				f = alias
+			}
+		}
+		// The version of an export is informative only.
+		if !known[f] || f == "version" {
+			if h != "" {
+				ignored = append(ignored, h)
+			}
+			continue
+		}
+		if prev, dup := mapped[f]; dup {
+			return nil, nil, fmt.Errorf("columns %q and %q are both %s - %w", prev, h, f, errInvalidImport)
+		}
+		mapped[f] = h
+		fields[i] = f
+	}
+	if _, ok := mapped["sku"]; !ok {
+		return nil, nil, fmt.Errorf("no sku column - %w", errInvalidImport)
+	}
+	return fields, ignored, nil
+}
+
+// parseRow returns the product of a row given the field of each column. Its
+// status is set when the status cell is not blank.
+// With a currency column prices are decimals, in currency when the cell is
+// blank. Without one they are integers of minor units, as in the sheets
+// exported before currencies existed.
+func parseRow(row []string, fields []string, currency string) (product.BulkProduct, error) {
+	var (
+		p           product.BulkProduct
+		verr        = &validationError{}
+		price       string
+		hasCurrency bool
+	)
+	parseUint := func(field, s string, bits int) uint64 {
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			verr.add(field, codeInvalidType, "%s must be an integer between 0 and %d", field, uint64(1)<<bits-1)
+		}
+		return n
+	}
+	for i, f := range fields {
+		if f == "currency" {
+			hasCurrency = true
+		}
+		if f == "" || i >= len(row) {
+			continue
+		}
+		v := strings.TrimSpace(row[i])
+		switch {
+		case f == "sku":
+			p.SKU = v
+		case f == "name":
+			p.Name = v
+		case f == "unit":
+			p.Unit = v
+		case f == "category":
+			p.Category = v
+		case f == "tags":
+			for _, t := range strings.Split(v, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					p.Tags = append(p.Tags, t)
+				}
+			}
+		case f == "currency" && v != "":
+			currency = v
+		// Blank numbers are zero, as omitted JSON fields.
+		case v == "":
+		case f == "qty":
+			p.Quantity = uint32(parseUint(f, v, 32))
+		case f == "price":
+			price = v
+		case f == "status":
+			s, err := product.ParseStatus(v)
+			if err != nil {
+				verr.add(f, codeInvalidType, "%s must be %s", f, typeName(reflect.TypeOf(s)))
+			}
+			p.Status, p.StatusSet = s, true
+		}
+	}
+	switch {
+	case price == "":
+	case hasCurrency:
+		m, err := money.Parse(price, currency)
+		switch {
+		case money.IsErrInvalidCurrency(err):
+			verr.add("currency", product.CodeNotAllowed, "currency must be an ISO 4217 code")
+		case money.IsErrTooPrecise(err):
+			exp, _ := money.Exponent(strings.ToUpper(currency))
+			verr.add("price", codeInvalidType, "price must have at most %d decimals in %s", exp, strings.ToUpper(currency))
+		case err != nil:
+			verr.add("price", codeInvalidType, "price must be a decimal")
+		}
+		p.Price = m
+	default:
+		p.Price.Amount = int64(parseUint("price", price, 63))
+	}
+	if len(verr.fields) > 0 {
+		return p, verr
+	}
+	return p, nil
+}
+
+func blankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// importParams are the parameters of an import job.
+type importParams struct {
+	Mode    product.BulkMode  `json:"mode"`
+	DryRun  bool              `json:"dry_run"`
+	Format  sheet.Format      `json:"format"`
+	Mapping map[string]string `json:"mapping,omitempty"`
+	// User and IP are the actor of the writes of an import job.
+	User string `json:"user,omitempty"`
+	IP   string `json:"ip,omitempty"`
+}
+
+type importResult struct {
+	Row     int                `json:"row"`
+	SKU     string             `json:"sku,omitempty"`
+	Status  product.BulkStatus `json:"status"`
+	Version uint64             `json:"version,omitempty"`
+	Error   *bulkItemError     `json:"error,omitempty"`
+}
+
+type importSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+type importResponse struct {
+	DryRun         bool              `json:"dry_run"`
+	Mode           product.BulkMode  `json:"mode"`
+	Format         sheet.Format      `json:"format"`
+	Columns        map[string]string `json:"columns"`
+	IgnoredColumns []string          `json:"ignored_columns"`
+	Summary        importSummary     `json:"summary"`
+	Results        []importResult    `json:"results"`
+}
+
+// importer imports the rows of a sheet whose header was read.
+type importer struct {
+	params importParams
+	rows   sheet.Reader
+	fields []string
+	resp   importResponse
+}
+
+// newImporter reads the header of the sheet held by the size bytes of src,
+// so a sheet that cannot be imported is rejected before any row.
+func newImporter(p importParams, src io.ReaderAt, size int64) (*importer, error) {
+	rows, err := sheet.NewReader(p.Format, src, size)
+	if err != nil {
+		return nil, err
+	}
+	header, err := rows.ReadRow()
+	if err == io.EOF {
+		err = fmt.Errorf("empty sheet - %w", errInvalidImport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields, ignored, err := importColumns(header, p.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	im := &importer{
+		params: p,
+		rows:   rows,
+		fields: fields,
+		resp: importResponse{
+			DryRun:         p.DryRun,
+			Mode:           p.Mode,
+			Format:         p.Format,
+			Columns:        make(map[string]string),
+			IgnoredColumns: ignored,
+			Results:        []importResult{},
+		},
+	}
+	for i, f := range fields {
+		if f != "" {
+			im.resp.Columns[header[i]] = f
+		}
+	}
+	return im, nil
+}
+
+// run imports the rows. progress, when not nil, is called after each batch
+// with the number of rows read.
+func (im *importer) run(ctx context.Context, svc *product.Service, progress func(done int) error) (*importResponse, error) {
+	resp := &im.resp
+
+	// Rows are parsed first so the service only gets well-formed products,
+	// in batches of the bulk size.
+	var (
+		products []product.BulkProduct
+		pending  []int
+		seen     = make(map[string]int)
+	)
+	flush := func() error {
+		written, err := svc.BulkWrite(ctx, products, product.BulkOptions{Mode: im.params.Mode, DryRun: im.params.DryRun})
+		if err != nil {
+			return err
+		}
+		for i, w := range written {
+			res := &resp.Results[pending[i]]
+			res.Status = w.Status
+			if w.Product != nil {
+				res.Version = w.Product.Version
+			}
+			if w.Err != nil {
+				res.Error = newBulkItemError(w.Err)
+			}
+		}
+		products, pending = products[:0], pending[:0]
+		if progress != nil {
+			return progress(len(resp.Results))
+		}
+		return nil
+	}
+	for {
+		row, err := im.rows.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blankRow(row) {
+			continue
+		}
+		if len(resp.Results) == maxImportRows {
+			return nil, fmt.Errorf("more than %d rows - %w", maxImportRows, errImportTooLarge)
+		}
+
+		p, err := parseRow(row, im.fields, svc.Currency())
+		if err == nil && seen[p.SKU] != 0 {
+			err = fmt.Errorf("%s: also on row %d: %w", p.SKU, seen[p.SKU], product.ErrDuplicate)
+		}
+		resp.Results = append(resp.Results, importResult{Row: im.rows.Row(), SKU: p.SKU})
+		if err != nil {
+			res := &resp.Results[len(resp.Results)-1]
+			res.Status, res.Error = product.BulkFailed, newBulkItemError(err)
+			continue
+		}
+		seen[p.SKU] = im.rows.Row()
+
+		products = append(products, p)
+		pending = append(pending, len(resp.Results)-1)
+		if len(products) == product.MaxBulkSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	for _, res := range resp.Results {
+		switch res.Status {
+		case product.BulkCreated:
+			resp.Summary.Created++
+		case product.BulkUpdated:
+			resp.Summary.Updated++
+		case product.BulkFailed:
+			resp.Summary.Failed++
+		}
+	}
+	return resp, nil
+}
+
+// runImport runs an import job. Imports are not resumable: rows written
+// before an interruption would be reported differently when run again.
+func (api *API) runImport(ctx context.Context, t *job.Task) (interface{}, error) {
+	var p importParams
+	if err := t.DecodeParams(&p); err != nil {
+		return nil, fmt.Errorf("decode params: %w", err)
+	}
+	im, err := newImporter(p, t.Input, t.Input.Size())
+	if err != nil {
+		return nil, err
+	}
+	ctx = product.WithActor(ctx, product.Actor{User: p.User, IP: p.IP})
+	return im.run(ctx, api.prdSvc, func(done int) error {
+		return t.Progress(ctx, done, 0)
+	})
+}
+
+func (api *API) handleV2ProductImport() gin.HandlerFunc {
+	type (
+		request struct {
+			Mode   product.BulkMode `form:"mode" binding:"omitempty,oneof=create upsert update"`
+			DryRun bool             `form:"dry_run"`
+			Format sheet.Format     `form:"format" binding:"omitempty,oneof=csv xlsx"`
+			Async  bool             `form:"async"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+		if r.Mode == "" {
+			r.Mode = product.BulkCreate
+		}
+
+		src, err := importSource(c)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		defer src.Close()
+		if r.Format == "" {
+			if r.Format, err = importFormat(src.contentType, src.filename); err != nil {
+				abortWithError(c, err)
+				return
+			}
+		}
+		fmt.Printf("product import: %s %s dry run %v async %v, %d bytes\n", r.Format, r.Mode, r.DryRun, r.Async, src.size)
+
+		actor := product.ActorFrom(ctx)
+		params := importParams{Mode: r.Mode, DryRun: r.DryRun, Format: r.Format, Mapping: c.QueryMap("map"), User: actor.User, IP: actor.IP}
+		im, err := newImporter(params, src, src.size)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if r.Async {
+			api.submitJob(c, jobProductImport, params, io.NewSectionReader(src, 0, src.size))
+			return
+		}
+
+		resp, err := im.run(ctx, api.prdSvc, nil)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
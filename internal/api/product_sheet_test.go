@@ -0,0 +1,205 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/sheet"
+)
+
+type importResult struct {
+	Row    int    `json:"row"`
+	SKU    string `json:"sku"`
+	Status string `json:"status"`
+	Error  *struct {
+		Code   ErrorCode    `json:"code"`
+		Errors []FieldError `json:"errors"`
+	} `json:"error"`
+}
+
+type importResponse struct {
+	DryRun         bool              `json:"dry_run"`
+	Columns        map[string]string `json:"columns"`
+	IgnoredColumns []string          `json:"ignored_columns"`
+	Summary        map[string]int    `json:"summary"`
+	Results        []importResult    `json:"results"`
+}
+
+func decodeImport(t *testing.T, w *httptest.ResponseRecorder) importResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp importResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func readSheet(t *testing.T, f sheet.Format, data []byte) [][]string {
+	t.Helper()
+
+	r, err := sheet.NewReader(f, bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var rows [][]string
+	for {
+		row, err := r.ReadRow()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, append([]string(nil), row...))
+	}
+}
+
+func TestAPIV2ProductsImportExport(t *testing.T) {
+	api := makeAPI(t)
+	csvHeader := http.Header{"Content-Type": {"text/csv"}}
+
+	data := "SKU,Name,Quantity,Price,Unit,Status,Color\n" +
+		"SHT-1,Green tea,10,1000,Box,1,green\n" +
+		"SHT-2,Black tea,x,900,Box,1,black\n" +
+		"\n" +
+		"SHT-3,Oolong,5,0,Barrel,1,\n" +
+		"SHT-1,Green tea again,1,1,Box,1,\n" +
+		"SHT-4,White tea,3,1500,Box,0,white\n"
+
+	w := doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products/import?dry_run=true", data, bearer, csvHeader)
+	resp := decodeImport(t, w)
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, map[string]string{"SKU": "sku", "Name": "name", "Quantity": "qty", "Price": "price", "Unit": "unit", "Status": "status"}, resp.Columns)
+	assert.Equal(t, []string{"Color"}, resp.IgnoredColumns)
+	assert.Equal(t, map[string]int{"created": 2, "updated": 0, "failed": 3}, resp.Summary)
+	require.Len(t, resp.Results, 5)
+	rows := []int{}
+	for _, r := range resp.Results {
+		rows = append(rows, r.Row)
+	}
+	assert.Equal(t, []int{2, 3, 5, 6, 7}, rows)
+	assert.Equal(t, []FieldError{{Field: "qty", Code: "invalid_type"}}, withoutMessages(resp.Results[1].Error.Errors))
+	assert.Equal(t, []FieldError{{Field: "price", Code: "required"}, {Field: "unit", Code: "not_allowed"}}, withoutMessages(resp.Results[2].Error.Errors))
+	assert.Equal(t, CodeDuplicateSKU, resp.Results[3].Error.Code)
+
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products/SHT-1", nil, bearer)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products/import", data, bearer, csvHeader)
+	resp = decodeImport(t, w)
+	assert.False(t, resp.DryRun)
+	assert.Equal(t, map[string]int{"created": 2, "updated": 0, "failed": 3}, resp.Summary)
+	assert.Equal(t, "created", resp.Results[0].Status)
+
+	t.Run("export", func(t *testing.T) {
+		w := get(t, api, "/api/v2/products/export", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+		assert.Equal(t, "sku,name,qty,price,currency,unit,status,category,tags,version\nSHT-1,Green tea,10,1000,VND,Box,active,,,1\nSHT-4,White tea,3,1500,VND,Box,draft,,,1\n", w.Body.String())
+
+		w = get(t, api, "/api/v2/products/export?format=xlsx&status=0", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, sheet.XLSXContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, [][]string{
+			{"sku", "name", "qty", "price", "currency", "unit", "status", "category", "tags", "version"},
+			{"SHT-4", "White tea", "3", "1500", "VND", "Box", "draft", "", "", "1"},
+		}, readSheet(t, sheet.XLSX, w.Body.Bytes()))
+
+		w = get(t, api, "/api/v2/products/export?format=ods", bearer)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = get(t, api, "/api/v2/products/export?cursor=bogus", bearer)
+		assert.Equal(t, CodeInvalidListOptions, decodeProblem(t, w).Code)
+	})
+
+	t.Run("export formulas and identifiers as text", func(t *testing.T) {
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", map[string]interface{}{"sku": "8934567890123456", "name": "=HYPERLINK(\"http://x\")", "price": 100, "unit": "Box"}, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = get(t, api, "/api/v2/products/export", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "\n8934567890123456,\"'=HYPERLINK(\"\"http://x\"\")\",0,100,")
+
+		w = get(t, api, "/api/v2/products/export?format=xlsx", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		rows := readSheet(t, sheet.XLSX, w.Body.Bytes())
+		require.Len(t, rows, 2)
+		assert.Equal(t, []string{"8934567890123456", "=HYPERLINK(\"http://x\")"}, rows[1][:2])
+	})
+
+	t.Run("xlsx upload with mapping", func(t *testing.T) {
+		var sheetData bytes.Buffer
+		sw, err := sheet.NewWriter(sheet.XLSX, &sheetData)
+		require.NoError(t, err)
+		require.NoError(t, sw.WriteRow([]string{"Article", "Description", "Stock", "Price", "Unit"}))
+		require.NoError(t, sw.WriteRow([]string{"SHT-1", "Green tea", "42", "1100", "Box"}))
+		require.NoError(t, sw.WriteRow([]string{"SHT-9", "Matcha", "1", "3000", "Box"}))
+		require.NoError(t, sw.Close())
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, err := mw.CreateFormFile("file", "catalog.xlsx")
+		require.NoError(t, err)
+		_, err = part.Write(sheetData.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		target := "/api/v2/products/import?mode=update&map[Article]=sku&map[Description]=name&map[Stock]=qty"
+		w := doJSONWithHeader(t, api, http.MethodPost, target, body.String(), bearer, http.Header{"Content-Type": {mw.FormDataContentType()}})
+		resp := decodeImport(t, w)
+		assert.Equal(t, map[string]int{"created": 0, "updated": 1, "failed": 1}, resp.Summary)
+		assert.Equal(t, CodeProductNotFound, resp.Results[1].Error.Code)
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products/SHT-1", nil, bearer)
+		assert.Contains(t, w.Body.String(), `"qty":42`)
+	})
+
+	t.Run("bad imports", func(t *testing.T) {
+		tests := map[string]struct {
+			target string
+			body   string
+			header http.Header
+			code   ErrorCode
+		}{
+			"no sku":       {"/api/v2/products/import", "name,price\nTea,1\n", csvHeader, CodeInvalidImport},
+			"empty":        {"/api/v2/products/import", "", csvHeader, CodeInvalidImport},
+			"bad map":      {"/api/v2/products/import?map[A]=color", "A\nx\n", csvHeader, CodeInvalidImport},
+			"same column":  {"/api/v2/products/import", "sku,qty,quantity\n", csvHeader, CodeInvalidImport},
+			"not xlsx":     {"/api/v2/products/import?format=xlsx", "sku\nA\n", csvHeader, CodeInvalidImport},
+			"content type": {"/api/v2/products/import", "sku\nA\n", nil, CodeUnsupportedMediaType},
+			"mode":         {"/api/v2/products/import?mode=merge", "sku\nA\n", csvHeader, CodeBadRequest},
+			"too many":     {"/api/v2/products/import", "sku\n" + strings.Repeat("A\n", 10001), csvHeader, CodeImportTooLarge},
+		}
+		for name, tt := range tests {
+			w := doJSONWithHeader(t, api, http.MethodPost, tt.target, tt.body, bearer, tt.header)
+			assert.Equal(t, tt.code, decodeProblem(t, w).Code, name)
+		}
+	})
+}
+
+func TestAPIV2ProductsImportCurrency(t *testing.T) {
+	api := makeAPI(t)
+	csvHeader := http.Header{"Content-Type": {"text/csv"}}
+
+	data := "sku,name,price,currency,unit\n" +
+		"CUR-1,Green tea,12.5,usd,Box\n" +
+		"CUR-2,Black tea,1250,,Box\n" +
+		"CUR-3,Oolong,12.505,USD,Box\n" +
+		"CUR-4,Matcha,3,XYZ,Box\n"
+	w := doJSONWithHeader(t, api, http.MethodPost, "/api/v2/products/import", data, bearer, csvHeader)
+	resp := decodeImport(t, w)
+	assert.Equal(t, map[string]int{"created": 2, "updated": 0, "failed": 2}, resp.Summary)
+	assert.Equal(t, []FieldError{{Field: "price", Code: "invalid_type"}}, withoutMessages(resp.Results[2].Error.Errors))
+	assert.Equal(t, []FieldError{{Field: "currency", Code: "not_allowed"}}, withoutMessages(resp.Results[3].Error.Errors))
+
+	w = get(t, api, "/api/v2/products/export", bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sku,name,qty,price,currency,unit,status,category,tags,version\nCUR-1,Green tea,0,12.50,USD,Box,draft,,,1\nCUR-2,Black tea,0,1250,VND,Box,draft,,,1\n", w.Body.String())
+}
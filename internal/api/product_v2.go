@@ -0,0 +1,480 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"sampleBackend/internal/patch"
+	"sampleBackend/internal/product"
+)
+
+const v2ProductsPath = "/api/v2/products"
+
+// maxPatchAttempts bounds how often an unconditional patch is retried when
+// the product changes under it.
+const maxPatchAttempts = 5
+
+// acceptPatch lists the patch formats of PATCH /api/v2/products/:sku.
+const acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// productResource is the representation of a product in the v2 API.
+type productResource struct {
+	SKU       string         `json:"sku"`
+	Name      string         `json:"name"`
+	Quantity  uint32         `json:"qty"`
+	Reserved  uint32         `json:"reserved"`
+	Available uint32         `json:"available"`
+	Locations []stockLevel   `json:"locations"`
+	InTransit uint32         `json:"in_transit"`
+	Price     price          `json:"price"`
+	Unit      string         `json:"unit"`
+	Status    product.Status `json:"status"`
+	Category  string         `json:"category,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Version   uint64         `json:"version"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+func newProductResource(p *product.Product) *productResource {
+	return &productResource{
+		SKU:       p.SKU,
+		Name:      p.Name,
+		Quantity:  p.Quantity,
+		Reserved:  p.Reserved,
+		Available: p.Available(),
+		Locations: newStockLevels(p),
+		InTransit: p.InTransit,
+		Price:     price{Money: p.Price},
+		Unit:      p.Unit,
+		Status:    p.Status,
+		Category:  p.Category,
+		Tags:      p.Tags,
+		Version:   p.Version,
+		DeletedAt: deletedAt(p),
+		DeletedBy: p.DeletedBy,
+	}
+}
+
+// deletedAt is when p was deleted, nil when it is not.
+func deletedAt(p *product.Product) *time.Time {
+	if !p.Deleted() {
+		return nil
+	}
+	t := p.DeletedAt
+	return &t
+}
+
+// renderProduct replies with p and its ETag.
+func renderProduct(c *gin.Context, code int, p *product.Product) {
+	c.Header("ETag", etag(p.Version))
+	c.Header("Accept-Patch", acceptPatch)
+	c.JSON(code, newProductResource(p))
+}
+
+func productLocation(sku string) string {
+	return v2ProductsPath + "/" + url.PathEscape(sku)
+}
+
+func (api *API) routeV2(route gin.IRouter) {
+	g := route.Group("/api/v2", api.authorizationMiddleware())
+
+	g.GET("/products", api.handleProductList(true))
+	g.POST("/products", api.idempotent(), api.handleV2ProductCreate())
+	g.POST("/products/bulk", api.idempotent(), api.handleV2ProductBulk())
+	g.GET("/products/search", api.handleProductFullTextSearch(true))
+	g.GET("/products/export", api.handleV2ProductExport())
+	g.POST("/products/import", api.idempotent(), api.handleV2ProductImport())
+	g.GET("/products/:sku", api.handleV2ProductGet())
+	g.PUT("/products/:sku", api.idempotent(), api.handleV2ProductReplace())
+	g.PATCH("/products/:sku", api.idempotent(), api.handleV2ProductPatch())
+	g.POST("/products/:sku/status", api.idempotent(), api.handleV2ProductStatus())
+	g.DELETE("/products/:sku", api.idempotent(), api.handleV2ProductDelete())
+	g.GET("/products/:sku/history", api.handleV2ProductHistory())
+	g.POST("/products/:sku/movements", api.idempotent(), api.handleV2ProductMove())
+	g.GET("/products/:sku/movements", api.handleV2ProductMovements())
+	g.GET("/products/:sku/price", api.pricingRequired(), api.handleV2ProductPrice())
+	g.GET("/products/:sku/prices", api.pricingRequired(), api.handleV2ProductPrices())
+
+	lists := g.Group("/price-lists", api.pricingRequired())
+	lists.GET("", api.handleV2PriceLists())
+	lists.POST("", api.idempotent(), api.handleV2PriceListCreate())
+	lists.GET("/:list", api.handleV2PriceListGet())
+	lists.GET("/:list/prices", api.handleV2PriceListPrices())
+	lists.POST("/:list/prices", api.idempotent(), api.handleV2PriceAdd())
+	lists.DELETE("/:list/prices/:id", api.idempotent(), api.handleV2PriceRemove())
+
+	promotions := g.Group("/promotions", api.pricingRequired())
+	promotions.GET("", api.handleV2Promotions())
+	promotions.POST("", api.idempotent(), api.handleV2PromotionCreate())
+	promotions.GET("/:code", api.handleV2PromotionGet())
+	promotions.DELETE("/:code", api.idempotent(), api.handleV2PromotionDelete())
+	g.POST("/pricing/quote", api.pricingRequired(), api.handleV2Quote())
+
+	reservations := g.Group("/reservations", api.reservationsRequired())
+	reservations.POST("", api.idempotent(), api.handleV2ReservationCreate())
+	reservations.GET("/:id", api.handleV2ReservationGet())
+	reservations.POST("/:id/confirm", api.idempotent(), api.handleV2ReservationFinish(true))
+	reservations.POST("/:id/cancel", api.idempotent(), api.handleV2ReservationFinish(false))
+
+	warehouses := g.Group("/warehouses", api.warehousesRequired())
+	warehouses.GET("", api.handleV2Warehouses())
+	warehouses.POST("", api.idempotent(), api.handleV2WarehouseCreate())
+	warehouses.GET("/:code", api.handleV2WarehouseGet())
+
+	transfers := g.Group("/transfers", api.warehousesRequired())
+	transfers.GET("", api.handleV2Transfers())
+	transfers.POST("", api.idempotent(), api.handleV2TransferCreate())
+	transfers.GET("/:id", api.handleV2TransferGet())
+	transfers.POST("/:id/ship", api.idempotent(), api.handleV2TransferAction("ship", api.warehouses.Ship))
+	transfers.POST("/:id/receive", api.idempotent(), api.handleV2TransferAction("receive", api.warehouses.Receive))
+	transfers.POST("/:id/cancel", api.idempotent(), api.handleV2TransferAction("cancel", api.warehouses.Cancel))
+}
+
+func (api *API) handleV2ProductCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU      string         `json:"sku"`
+			Name     string         `json:"name"`
+			Quantity uint32         `json:"qty"`
+			Price    price          `json:"price"`
+			Unit     string         `json:"unit"`
+			Status   product.Status `json:"status"`
+			Category string         `json:"category"`
+			Tags     []string       `json:"tags"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product create: %#v\n", r)
+
+		p := product.Product{
+			SKU:      r.SKU,
+			Name:     r.Name,
+			Quantity: r.Quantity,
+			Price:    r.Price.Money,
+			Unit:     r.Unit,
+			Status:   r.Status,
+			Category: r.Category,
+			Tags:     r.Tags,
+		}
+		prd, err := api.prdSvc.AddProduct(ctx, p)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", productLocation(prd.SKU))
+		renderProduct(c, http.StatusCreated, prd)
+	}
+}
+
+func (api *API) handleV2ProductGet() gin.HandlerFunc {
+	type (
+		request struct {
+			IncludeDeleted bool `form:"include_deleted"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		prd, err := api.prdSvc.GetProduct(ctx, sku, r.IncludeDeleted)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		if inm := c.GetHeader("If-None-Match"); inm != "" && matchETag(inm, prd.Version, true) {
+			c.Header("ETag", etag(prd.Version))
+			c.Status(http.StatusNotModified)
+			return
+		}
+		renderProduct(c, http.StatusOK, prd)
+	}
+}
+
+// statusReadOnly rejects a status changed by a write other than
+// POST /api/v2/products/:sku/status.
+func statusReadOnly(verr *validationError) {
+	verr.add("status", product.CodeReadOnly, "status can only be changed with POST %s/{sku}/status", v2ProductsPath)
+}
+
+// handleV2ProductReplace replaces every field of a product but its status,
+// which may be omitted or has to be the current one.
+func (api *API) handleV2ProductReplace() gin.HandlerFunc {
+	type (
+		request struct {
+			SKU      string          `json:"sku"`
+			Name     string          `json:"name"`
+			Quantity uint32          `json:"qty"`
+			Price    price           `json:"price"`
+			Unit     string          `json:"unit"`
+			Status   *product.Status `json:"status"`
+			Category string          `json:"category"`
+			Tags     []string        `json:"tags"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if r.SKU != "" && r.SKU != sku {
+			abortWithError(c, fmt.Errorf("sku %q in body does not match the path - %w", r.SKU, errMalformed))
+			return
+		}
+		fmt.Printf("product replace: %#v\n", r)
+
+		version, err := api.expectedVersion(c, sku)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if r.Status != nil {
+			prd, err := api.prdSvc.SearchProduct(ctx, sku)
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+			if *r.Status != prd.Status {
+				verr := &validationError{}
+				statusReadOnly(verr)
+				abortWithError(c, verr)
+				return
+			}
+		}
+		prd, err := api.prdSvc.UpdateProduct(ctx, product.Product{
+			SKU:      sku,
+			Name:     r.Name,
+			Quantity: r.Quantity,
+			Price:    r.Price.Money,
+			Unit:     r.Unit,
+			Category: r.Category,
+			Tags:     r.Tags,
+			Version:  version,
+		})
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		renderProduct(c, http.StatusOK, prd)
+	}
+}
+
+// applyPatch applies the patch body of c to the representation of p, as a
+// merge patch or a JSON Patch depending on the content type. Plain JSON is
+// taken as a merge patch.
+func applyPatch(c *gin.Context, body []byte, p *product.Product) (*product.Product, error) {
+	doc, err := json.Marshal(newProductResource(p))
+	if err != nil {
+		return nil, err
+	}
+	switch c.ContentType() {
+	case patch.MergePatchType, binding.MIMEJSON:
+		doc, err = patch.MergePatch(doc, body)
+	case patch.JSONPatchType:
+		doc, err = patch.JSONPatch(doc, body)
+	default:
+		c.Header("Accept-Patch", acceptPatch)
+		return nil, fmt.Errorf("content type %q - %w", c.ContentType(), errUnsupportedContent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		r    productResource
+		verr = &validationError{}
+	)
+	if err := decodeJSON(doc, &r, verr); err != nil {
+		return nil, err
+	}
+	if r.SKU != p.SKU {
+		verr.add("sku", product.CodeReadOnly, "sku cannot be changed")
+	}
+	if r.Version != p.Version {
+		verr.add("version", product.CodeReadOnly, "version cannot be changed")
+	}
+	if r.Status != p.Status {
+		statusReadOnly(verr)
+	}
+	if r.Reserved != p.Reserved {
+		verr.add("reserved", product.CodeReadOnly, "reserved can only be changed with %s", v2ReservationsPath)
+	}
+	if r.Available != p.Available() {
+		verr.add("available", product.CodeReadOnly, "available cannot be changed")
+	}
+	if !reflect.DeepEqual(r.Locations, newStockLevels(p)) {
+		verr.add("locations", product.CodeReadOnly, "locations can only be changed with movements and %s", v2TransfersPath)
+	}
+	if r.InTransit != p.InTransit {
+		verr.add("in_transit", product.CodeReadOnly, "in_transit can only be changed with %s", v2TransfersPath)
+	}
+	if r.DeletedAt != nil {
+		verr.add("deleted_at", product.CodeReadOnly, "deleted_at cannot be changed")
+	}
+	if r.DeletedBy != "" {
+		verr.add("deleted_by", product.CodeReadOnly, "deleted_by cannot be changed")
+	}
+	if len(verr.fields) > 0 {
+		return nil, verr
+	}
+
+	return &product.Product{
+		SKU:      p.SKU,
+		Name:     r.Name,
+		Quantity: r.Quantity,
+		Price:    r.Price.Money,
+		Unit:     r.Unit,
+		Status:   r.Status,
+		Category: r.Category,
+		Tags:     r.Tags,
+		Version:  p.Version,
+	}, nil
+}
+
+func (api *API) handleV2ProductPatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		body, err := readBody(c, maxBodySize)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product patch: %v %s %s\n", sku, c.ContentType(), body)
+
+		ifMatch := c.GetHeader("If-Match")
+		for attempt := 1; ; attempt++ {
+			prd, err := api.prdSvc.SearchProduct(ctx, sku)
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+			if ifMatch != "" && !matchETag(ifMatch, prd.Version, false) {
+				abortWithError(c, fmt.Errorf("If-Match %s, current %s - %w", ifMatch, etag(prd.Version), errPreconditionFailed))
+				return
+			}
+
+			patched, err := applyPatch(c, body, prd)
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+			// The patch applies to the version read above. Without If-Match a
+			// concurrent write only means reading and patching again.
+			prd, err = api.prdSvc.UpdateProduct(ctx, *patched)
+			if product.IsErrConflict(err) && ifMatch == "" && attempt < maxPatchAttempts {
+				continue
+			}
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+
+			renderProduct(c, http.StatusOK, prd)
+			return
+		}
+	}
+}
+
+func (api *API) handleV2ProductDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+		fmt.Printf("product delete: %v\n", sku)
+
+		version, err := api.expectedVersion(c, sku)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		err = api.prdSvc.DeleteProduct(ctx, sku, version, caller(c))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (api *API) handleV2ProductStatus() gin.HandlerFunc {
+	type (
+		request struct {
+			Status *product.Status `json:"status" binding:"required"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		err := bind(c, &r)
+		if err == nil && !r.Status.Valid() {
+			verr := &validationError{}
+			verr.add("status", product.CodeNotAllowed, "status must be %s", typeName(reflect.TypeOf(*r.Status)))
+			err = verr
+		}
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product status: %v %s\n", sku, r.Status)
+
+		version, err := api.expectedVersion(c, sku)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		prd, err := api.prdSvc.SetStatus(ctx, sku, *r.Status, version)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		renderProduct(c, http.StatusOK, prd)
+	}
+}
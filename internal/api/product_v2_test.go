@@ -0,0 +1,458 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/money"
+)
+
+func TestAPIV2Products(t *testing.T) {
+	path := "/api/v2/products"
+
+	type item struct {
+		SKU      string      `json:"sku"`
+		Name     string      `json:"name"`
+		Quantity uint32      `json:"qty"`
+		Price    money.Money `json:"price"`
+		Unit     string      `json:"unit"`
+		Status   string      `json:"status"`
+	}
+	validItem := func() item {
+		return item{SKU: "V2-001", Name: "V2 Sehat", Quantity: 10, Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Carton", Status: "active"}
+	}
+	decode := func(t *testing.T, body []byte) item {
+		var got item
+		require.NoError(t, json.Unmarshal(body, &got))
+		return got
+	}
+
+	t.Run("requires authorization", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, path, nil, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		want := validItem()
+
+		w := doJSON(t, api, http.MethodPost, path, want, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, path+"/V2-001", w.Header().Get("Location"))
+		assert.Equal(t, want, decode(t, w.Body.Bytes()))
+
+		w = doJSON(t, api, http.MethodPost, path, want, bearer)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = doJSON(t, api, http.MethodGet, path+"/V2-001", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, decode(t, w.Body.Bytes()))
+
+		want.Name = "Replaced"
+		want.Quantity = 0
+		w = doJSON(t, api, http.MethodPut, path+"/V2-001", want, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, decode(t, w.Body.Bytes()))
+
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-001", `{"price": {"amount": "25"}}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"price":{"amount":"25.00","currency":"USD"}`)
+		want.Price.Amount = 2500
+		assert.Equal(t, want, decode(t, w.Body.Bytes()))
+
+		w = doJSON(t, api, http.MethodGet, path+"?sort=price", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"total":1`)
+
+		w = doJSON(t, api, http.MethodDelete, path+"/V2-001", nil, bearer)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			w = doJSON(t, api, method, path+"/V2-001", nil, bearer)
+			assert.Equal(t, http.StatusNotFound, w.Code, method)
+		}
+		w = doJSON(t, api, http.MethodPut, path+"/V2-001", want, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-001", `{"qty": 1}`, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("category and tags", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, path, `{"sku": "V2-TAG", "name": "Tea", "price": 1000, "unit": "Box", "category": "tea", "tags": ["organic", "green", "organic"]}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"category":"tea","tags":["green","organic"]`)
+
+		// The legacy update has no category nor tags and keeps them.
+		w = postForm(t, api, "/api/item/update", validProductForm("V2-TAG"), bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-TAG", `{"tags": ["sale"]}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"category":"tea","tags":["sale"]`)
+
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-TAG", `{"category": "Green tea", "tags": ["on sale"]}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"category","code":"invalid_format"`)
+		assert.Contains(t, w.Body.String(), `"field":"tags","code":"invalid_format"`)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, path, `{"sku": `, bearer)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		it := validItem()
+		w = doJSON(t, api, http.MethodPost, path, it, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		it.SKU = "V2-OTHER"
+		w = doJSON(t, api, http.MethodPut, path+"/V2-001", it, bearer)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-001", `{"unit": "Barrel", "price": 0}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"price","code":"required"`)
+		assert.Contains(t, w.Body.String(), `"field":"unit","code":"not_allowed"`)
+
+		w = doJSON(t, api, http.MethodPatch, path+"/V2-001", `{"sku": "V2-002"}`, bearer)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestAPILegacyDeprecation(t *testing.T) {
+	api := makeAPI(t)
+
+	w := get(t, api, "/api/items", bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v2/products>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestAPIV2ProductsConditional(t *testing.T) {
+	var (
+		api  = makeAPI(t)
+		path = "/api/v2/products/ETAG-001"
+	)
+	ifMatch := func(tag string) http.Header {
+		return http.Header{"If-Match": {tag}}
+	}
+
+	w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "ETAG-001", "name": "Etag", "price": 10, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"version":1`)
+
+	w = doJSON(t, api, http.MethodGet, path, nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	for _, tag := range []string{`"1"`, `W/"1"`, `"0", "1"`, `*`} {
+		w = doJSONWithHeader(t, api, http.MethodGet, path, nil, bearer, http.Header{"If-None-Match": {tag}})
+		assert.Equal(t, http.StatusNotModified, w.Code, tag)
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+	}
+	w = doJSONWithHeader(t, api, http.MethodGet, path, nil, bearer, http.Header{"If-None-Match": {`"2"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	replace := `{"name": "Etag", "price": 20, "unit": "Box"}`
+	for _, tag := range []string{`"2"`, `W/"1"`} {
+		w = doJSONWithHeader(t, api, http.MethodPut, path, replace, bearer, ifMatch(tag))
+		require.Equal(t, http.StatusPreconditionFailed, w.Code, tag)
+		assert.Contains(t, w.Body.String(), `"code":"precondition_failed"`)
+	}
+	w = doJSONWithHeader(t, api, http.MethodPut, path, replace, bearer, ifMatch(`"1"`))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// The first clerk still holds version 1 and must not overwrite.
+	data := validProductForm("ETAG-001")
+	r := httptest.NewRequest(http.MethodPost, "/api/item/update", strings.NewReader(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer "+bearer)
+	r.Header.Set("If-Match", `"1"`)
+	legacy := httptest.NewRecorder()
+	api.ServeHTTP(legacy, r)
+	assert.Equal(t, http.StatusPreconditionFailed, legacy.Code)
+
+	w = doJSONWithHeader(t, api, http.MethodPatch, path, `{"qty": 3}`, bearer, ifMatch(`"1"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doJSONWithHeader(t, api, http.MethodPatch, path, `{"qty": 3}`, bearer, ifMatch(`*`))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	w = doJSON(t, api, http.MethodPatch, path, `{"qty": 4}`, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	w = doJSONWithHeader(t, api, http.MethodDelete, path, nil, bearer, ifMatch(`"3"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doJSONWithHeader(t, api, http.MethodDelete, path, nil, bearer, ifMatch(`"4"`))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSONWithHeader(t, api, http.MethodDelete, path, nil, bearer, ifMatch(`*`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPIV2ProductsPatch(t *testing.T) {
+	api := makeAPI(t)
+	path := "/api/v2/products/PATCH-001"
+	ifMatch := func(tag string) http.Header {
+		return http.Header{"If-Match": {tag}}
+	}
+	patchWith := func(contentType, body string, header http.Header) *httptest.ResponseRecorder {
+		h := http.Header{"Content-Type": {contentType}}
+		for k, v := range header {
+			h[k] = v
+		}
+		return doJSONWithHeader(t, api, http.MethodPatch, path, body, bearer, h)
+	}
+
+	w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PATCH-001", "name": "Patched", "qty": 10, "price": 1000, "unit": "Box", "status": 1}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", w.Header().Get("Accept-Patch"))
+
+	// A bare amount is still taken, in the default currency.
+	w = patchWith("application/merge-patch+json", `{"price": 1200}`, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sku": "PATCH-001", "name": "Patched", "qty": 10, "reserved": 0, "available": 10, "locations": [{"location": "main", "qty": 10}], "in_transit": 0, "price": {"amount": "1200", "currency": "VND"}, "unit": "Box", "status": "active", "version": 2}`, w.Body.String())
+
+	w = patchWith("application/json-patch+json", `[
+		{"op": "test", "path": "/price/amount", "value": "1200"},
+		{"op": "test", "path": "/status", "value": "active"},
+		{"op": "copy", "from": "/unit", "path": "/name"}
+	]`, ifMatch(`"2"`))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sku": "PATCH-001", "name": "Box", "qty": 10, "reserved": 0, "available": 10, "locations": [{"location": "main", "qty": 10}], "in_transit": 0, "price": {"amount": "1200", "currency": "VND"}, "unit": "Box", "status": "active", "version": 3}`, w.Body.String())
+
+	w = patchWith("application/json-patch+json", `[{"op": "test", "path": "/price", "value": 1000}, {"op": "replace", "path": "/price", "value": 1}]`, nil)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, CodePatchTestFailed, decodeProblem(t, w).Code)
+
+	tests := map[string]struct {
+		contentType, body string
+		status            int
+		code              ErrorCode
+		errors            []FieldError
+	}{
+		"unknown path":  {"application/json-patch+json", `[{"op": "remove", "path": "/color"}]`, http.StatusUnprocessableEntity, "invalid_patch", nil},
+		"not a patch":   {"application/json-patch+json", `{"price": 1}`, http.StatusUnprocessableEntity, "invalid_patch", nil},
+		"malformed":     {"application/merge-patch+json", `{"price":`, http.StatusUnprocessableEntity, "invalid_patch", nil},
+		"content type":  {"text/plain", `{"price": 1}`, http.StatusUnsupportedMediaType, "unsupported_media_type", nil},
+		"empty":         {"application/merge-patch+json", ``, http.StatusBadRequest, "bad_request", nil},
+		"sku":           {"application/merge-patch+json", `{"sku": "PATCH-002"}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "sku", Code: "read_only"}}},
+		"version":       {"application/json-patch+json", `[{"op": "replace", "path": "/version", "value": 9}]`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "version", Code: "read_only"}}},
+		"reserved":      {"application/merge-patch+json", `{"reserved": 3}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "reserved", Code: "read_only"}}},
+		"locations":     {"application/merge-patch+json", `{"locations": [{"location": "north", "qty": 10}]}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "locations", Code: "read_only"}}},
+		"in transit":    {"application/json-patch+json", `[{"op": "replace", "path": "/in_transit", "value": 2}]`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "in_transit", Code: "read_only"}}},
+		"unknown field": {"application/merge-patch+json", `{"color": "red"}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "color", Code: "unknown_field"}}},
+		"wrong type":    {"application/merge-patch+json", `{"qty": "many"}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "qty", Code: "invalid_type"}}},
+		"removed name":  {"application/merge-patch+json", `{"name": null}`, http.StatusUnprocessableEntity, "validation_failed", []FieldError{{Field: "name", Code: "required"}}},
+	}
+	for name, tt := range tests {
+		w := patchWith(tt.contentType, tt.body, nil)
+		require.Equal(t, tt.status, w.Code, name)
+		p := decodeProblem(t, w)
+		assert.Equal(t, tt.code, p.Code, name)
+		if tt.errors == nil {
+			assert.Empty(t, p.Errors, name)
+		} else {
+			assert.Equal(t, tt.errors, withoutMessages(p.Errors), name)
+		}
+	}
+	w = patchWith("text/plain", `{}`, nil)
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", w.Header().Get("Accept-Patch"))
+
+	// Patches of different fields racing each other all land.
+	var wg sync.WaitGroup
+	for _, body := range []string{`{"qty": 7}`, `{"price": 900}`, `{"status": 1}`, `{"name": "Raced"}`} {
+		wg.Add(1)
+		go func(body string) {
+			defer wg.Done()
+			w := patchWith("application/merge-patch+json", body, nil)
+			assert.Equal(t, http.StatusOK, w.Code, body)
+		}(body)
+	}
+	wg.Wait()
+
+	w = doJSON(t, api, http.MethodGet, path, nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sku": "PATCH-001", "name": "Raced", "qty": 7, "reserved": 0, "available": 7, "locations": [{"location": "main", "qty": 7}], "in_transit": 0, "price": {"amount": "900", "currency": "VND"}, "unit": "Box", "status": "active", "version": 7}`, w.Body.String())
+}
+
+func TestAPIV2ProductsPrice(t *testing.T) {
+	api := makeAPI(t)
+
+	w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PRICE-1", "name": "Tea", "price": {"amount": "12.5", "currency": "usd"}, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"price":{"amount":"12.50","currency":"USD"}`)
+	w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PRICE-2", "name": "Tea", "price": {"amount": 1.234, "currency": "KWD"}, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"price":{"amount":"1.234","currency":"KWD"}`)
+	w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PRICE-3", "name": "Tea", "price": 25000, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"price":{"amount":"25000","currency":"VND"}`)
+
+	tests := map[string]struct {
+		price, message string
+	}{
+		"precision":    {`{"amount": "12.505", "currency": "USD"}`, "price amount must have at most 2 decimals in USD"},
+		"no decimals":  {`{"amount": "1.5", "currency": "JPY"}`, "price amount must have at most 0 decimals in JPY"},
+		"currency":     {`{"amount": "1", "currency": "XYZ"}`, "price currency must be an ISO 4217 code"},
+		"no amount":    {`{"currency": "USD"}`, `price must be an object such as {"amount": "12.50", "currency": "USD"}`},
+		"string":       {`"12.50"`, `price must be an object such as {"amount": "12.50", "currency": "USD"}`},
+		"out of range": {`{"amount": "100000000000000000", "currency": "USD"}`, "price amount is out of range"},
+	}
+	for name, tt := range tests {
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "PRICE-9", "name": "Tea", "price": `+tt.price+`, "unit": "Barrel"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code, name)
+		p := decodeProblem(t, w)
+		require.NotEmpty(t, p.Errors, name)
+		assert.Equal(t, FieldError{Field: "price", Code: "invalid_format", Message: tt.message}, p.Errors[len(p.Errors)-1], name)
+	}
+
+	// The legacy API keeps bare amounts of minor units.
+	w = get(t, api, "/api/items?sort=price", bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sku":"PRICE-1","name":"Tea","qty":0,"price":1250,`)
+
+	w = get(t, api, "/api/v2/products?currency=usd", bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+	assert.Contains(t, w.Body.String(), `"sku":"PRICE-1"`)
+	w = get(t, api, "/api/v2/products?min_price=1000&max_price=2000", bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":2`)
+}
+
+func TestAPIV2ProductsStatus(t *testing.T) {
+	var (
+		api    = makeAPI(t)
+		path   = "/api/v2/products/STATUS-001"
+		status = path + "/status"
+	)
+
+	w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "STATUS-001", "name": "Status", "price": 10, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"draft"`)
+	w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "STATUS-002", "name": "Live", "price": 10, "unit": "Box", "status": "active"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = doJSON(t, api, http.MethodPost, status, `{"status": "discontinued"}`, bearer)
+	require.Equal(t, http.StatusConflict, w.Code)
+	p := decodeProblem(t, w)
+	assert.Equal(t, CodeInvalidTransition, p.Code)
+	assert.Contains(t, p.Detail, "draft cannot change to discontinued, only to active, archived")
+
+	for _, body := range []string{`{}`, `{"status": "live"}`, `{"status": 9}`} {
+		w = doJSON(t, api, http.MethodPost, status, body, bearer)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+	w = doJSON(t, api, http.MethodPost, "/api/v2/products/STATUS-404/status", `{"status": "active"}`, bearer)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSONWithHeader(t, api, http.MethodPost, status, `{"status": "active"}`, bearer, http.Header{"If-Match": {`"2"`}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doJSONWithHeader(t, api, http.MethodPost, status, `{"status": "active"}`, bearer, http.Header{"If-Match": {`"1"`}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"status":"active"`)
+
+	// Other writes keep the status and reject changing it.
+	w = doJSON(t, api, http.MethodPatch, path, `{"status": "archived"}`, bearer)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "read_only", decodeProblem(t, w).Errors[0].Code)
+	w = doJSON(t, api, http.MethodPut, path, `{"name": "Status", "price": 10, "unit": "Box", "status": "draft"}`, bearer)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = doJSON(t, api, http.MethodPut, path, `{"name": "Replaced", "price": 10, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"active"`)
+
+	w = doJSON(t, api, http.MethodPost, status, `{"status": "discontinued"}`, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products?status=discontinued", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+	assert.Contains(t, w.Body.String(), `"sku":"STATUS-001"`)
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products?status=1", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sku":"STATUS-002"`)
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products?status=live", nil, bearer)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIV2ProductsSoftDelete(t *testing.T) {
+	var (
+		api     = makeAPI(t)
+		path    = "/api/v2/products/SOFT-001"
+		restore = "/api/admin/products/SOFT-001/restore"
+	)
+
+	w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "SOFT-001", "name": "Soft", "price": 10, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "deleted_at")
+
+	w = doJSON(t, api, http.MethodPost, restore, nil, adminBearer)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, CodeProductNotDeleted, decodeProblem(t, w).Code)
+
+	w = doJSON(t, api, http.MethodDelete, path, nil, bearer)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// Hidden by default, visible on request.
+	w = doJSON(t, api, http.MethodGet, path, nil, bearer)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":0`)
+	w = doJSON(t, api, http.MethodGet, "/api/v2/products?include_deleted=true", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+	assert.Contains(t, w.Body.String(), `"deleted_by":"user@gmail.com"`)
+	w = doJSON(t, api, http.MethodGet, path+"?include_deleted=true", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"deleted_at":`)
+
+	// Restore is conditional on the tombstone.
+	w = doJSONWithHeader(t, api, http.MethodPost, restore, nil, adminBearer, http.Header{"If-Match": {`"1"`}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doJSONWithHeader(t, api, http.MethodPost, restore, nil, adminBearer, http.Header{"If-Match": {`"2"`}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.NotContains(t, w.Body.String(), "deleted_")
+	w = doJSON(t, api, http.MethodGet, path, nil, bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(t, api, http.MethodPatch, path, `{"deleted_by": "someone"}`, bearer)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Creating a deleted SKU again starts over.
+	w = doJSON(t, api, http.MethodDelete, path, nil, bearer)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "SOFT-001", "name": "Again", "price": 20, "unit": "Box"}`, bearer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Again"`)
+
+	w = doJSON(t, api, http.MethodPost, "/api/admin/products/SOFT-404/restore", nil, adminBearer)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/pricing"
+)
+
+const v2PromotionsPath = "/api/v2/promotions"
+
+type tierResource struct {
+	MinQuantity uint32 `json:"min_qty"`
+	PercentOff  uint32 `json:"percent_off"`
+}
+
+type promotionResource struct {
+	Code       string         `json:"code"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	SKUs       []string       `json:"skus"`
+	Categories []string       `json:"categories"`
+	Tags       []string       `json:"tags"`
+	PercentOff uint32         `json:"percent_off,omitempty"`
+	AmountOff  *price         `json:"amount_off,omitempty"`
+	Buy        uint32         `json:"buy,omitempty"`
+	Get        uint32         `json:"get,omitempty"`
+	Tiers      []tierResource `json:"tiers,omitempty"`
+	ValidFrom  time.Time      `json:"valid_from"`
+	ValidUntil *time.Time     `json:"valid_until,omitempty"`
+	Priority   int            `json:"priority"`
+	Stackable  bool           `json:"stackable"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+func newPromotionResource(p *pricing.Promotion) *promotionResource {
+	r := &promotionResource{
+		Code:       p.Code,
+		Name:       p.Name,
+		Kind:       string(p.Kind),
+		SKUs:       p.SKUs,
+		Categories: p.Categories,
+		Tags:       p.Tags,
+		PercentOff: p.PercentOff,
+		Buy:        p.Buy,
+		Get:        p.Get,
+		ValidFrom:  p.From,
+		Priority:   p.Priority,
+		Stackable:  p.Stackable,
+		CreatedAt:  p.CreatedAt,
+	}
+	if r.SKUs == nil {
+		r.SKUs = []string{}
+	}
+	if r.Categories == nil {
+		r.Categories = []string{}
+	}
+	if r.Tags == nil {
+		r.Tags = []string{}
+	}
+	if !p.AmountOff.IsZero() {
+		r.AmountOff = &price{Money: p.AmountOff}
+	}
+	for _, t := range p.Tiers {
+		r.Tiers = append(r.Tiers, tierResource{MinQuantity: t.MinQuantity, PercentOff: t.PercentOff})
+	}
+	if !p.Until.IsZero() {
+		until := p.Until
+		r.ValidUntil = &until
+	}
+	return r
+}
+
+func promotionLocation(code string) string {
+	return v2PromotionsPath + "/" + url.PathEscape(code)
+}
+
+func (api *API) handleV2PromotionCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			Code       string         `json:"code"`
+			Name       string         `json:"name"`
+			Kind       string         `json:"kind"`
+			SKUs       []string       `json:"skus"`
+			Categories []string       `json:"categories"`
+			Tags       []string       `json:"tags"`
+			PercentOff uint32         `json:"percent_off"`
+			AmountOff  price          `json:"amount_off"`
+			Buy        uint32         `json:"buy"`
+			Get        uint32         `json:"get"`
+			Tiers      []tierResource `json:"tiers"`
+			ValidFrom  *time.Time     `json:"valid_from"`
+			ValidUntil *time.Time     `json:"valid_until"`
+			Priority   int            `json:"priority"`
+			Stackable  bool           `json:"stackable"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("promotion create: %#v\n", r)
+
+		p := pricing.Promotion{
+			Code:       r.Code,
+			Name:       r.Name,
+			Kind:       pricing.PromotionKind(r.Kind),
+			SKUs:       r.SKUs,
+			Categories: r.Categories,
+			Tags:       r.Tags,
+			PercentOff: r.PercentOff,
+			AmountOff:  r.AmountOff.Money,
+			Buy:        r.Buy,
+			Get:        r.Get,
+			Priority:   r.Priority,
+			Stackable:  r.Stackable,
+		}
+		for _, t := range r.Tiers {
+			p.Tiers = append(p.Tiers, pricing.Tier{MinQuantity: t.MinQuantity, PercentOff: t.PercentOff})
+		}
+		if r.ValidFrom != nil {
+			p.From = *r.ValidFrom
+		}
+		if r.ValidUntil != nil {
+			p.Until = *r.ValidUntil
+		}
+		created, err := api.pricing.CreatePromotion(ctx, p)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", promotionLocation(created.Code))
+		c.JSON(http.StatusCreated, newPromotionResource(created))
+	}
+}
+
+func (api *API) handleV2Promotions() gin.HandlerFunc {
+	type (
+		response struct {
+			Data []*promotionResource `json:"data"`
+		}
+	)
+	return func(c *gin.Context) {
+		promotions, err := api.pricing.Promotions(c.Request.Context())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		data := make([]*promotionResource, len(promotions))
+		for i := range promotions {
+			data[i] = newPromotionResource(&promotions[i])
+		}
+		c.JSON(http.StatusOK, response{Data: data})
+	}
+}
+
+func (api *API) handleV2PromotionGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := api.pricing.GetPromotion(c.Request.Context(), c.Param("code"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newPromotionResource(p))
+	}
+}
+
+func (api *API) handleV2PromotionDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Param("code")
+		fmt.Printf("promotion delete: %v\n", code)
+
+		err := api.pricing.DeletePromotion(c.Request.Context(), code)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleV2Quote prices a cart with the promotions active at a time, now by
+// default.
+func (api *API) handleV2Quote() gin.HandlerFunc {
+	type (
+		item struct {
+			SKU      string `json:"sku"`
+			Quantity uint32 `json:"qty"`
+		}
+		request struct {
+			Items []item     `json:"items"`
+			At    *time.Time `json:"at"`
+		}
+		discount struct {
+			Code   string `json:"code"`
+			Name   string `json:"name"`
+			Amount price  `json:"amount"`
+		}
+		line struct {
+			SKU        string     `json:"sku"`
+			Quantity   uint32     `json:"qty"`
+			UnitPrice  price      `json:"unit_price"`
+			Subtotal   price      `json:"subtotal"`
+			Discount   price      `json:"discount"`
+			Total      price      `json:"total"`
+			Promotions []discount `json:"promotions"`
+		}
+		response struct {
+			At       time.Time `json:"at"`
+			Currency string    `json:"currency"`
+			Lines    []line    `json:"lines"`
+			Subtotal price     `json:"subtotal"`
+			Discount price     `json:"discount"`
+			Total    price     `json:"total"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		items := make([]pricing.QuoteItem, len(r.Items))
+		for i, it := range r.Items {
+			items[i] = pricing.QuoteItem{SKU: it.SKU, Quantity: it.Quantity}
+		}
+		at := time.Now().UTC()
+		if r.At != nil {
+			at = *r.At
+		}
+		q, err := api.pricing.Quote(ctx, items, at)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		resp := response{
+			At:       q.At,
+			Currency: q.Currency,
+			Lines:    make([]line, len(q.Lines)),
+			Subtotal: price{Money: q.Subtotal},
+			Discount: price{Money: q.Discount},
+			Total:    price{Money: q.Total},
+		}
+		for i, l := range q.Lines {
+			resp.Lines[i] = line{
+				SKU:        l.SKU,
+				Quantity:   l.Quantity,
+				UnitPrice:  price{Money: l.UnitPrice},
+				Subtotal:   price{Money: l.Subtotal},
+				Discount:   price{Money: l.Discount},
+				Total:      price{Money: l.Total},
+				Promotions: make([]discount, len(l.Discounts)),
+			}
+			for j, d := range l.Discounts {
+				resp.Lines[i].Promotions[j] = discount{Code: d.Promotion, Name: d.Name, Amount: price{Money: d.Amount}}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,119 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/pricing"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIV2Promotions(t *testing.T) {
+	type (
+		discount struct {
+			Code   string      `json:"code"`
+			Amount money.Money `json:"amount"`
+		}
+		line struct {
+			SKU        string      `json:"sku"`
+			Quantity   uint32      `json:"qty"`
+			UnitPrice  money.Money `json:"unit_price"`
+			Discount   money.Money `json:"discount"`
+			Total      money.Money `json:"total"`
+			Promotions []discount  `json:"promotions"`
+		}
+		quote struct {
+			Currency string      `json:"currency"`
+			Lines    []line      `json:"lines"`
+			Subtotal money.Money `json:"subtotal"`
+			Discount money.Money `json:"discount"`
+			Total    money.Money `json:"total"`
+		}
+	)
+	path := "/api/v2/promotions"
+	usd := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "USD"} }
+
+	t.Run("requires a pricing service", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, "/api/v2/pricing/quote", `{"items": [{"sku": "PR-001", "qty": 1}]}`, bearer)
+		assert.Equal(t, CodePricingUnsupported, decodeProblem(t, w).Code)
+	})
+
+	t.Run("quotes a cart", func(t *testing.T) {
+		t.Parallel()
+
+		svc := product.NewService(memory.NewProductStorage())
+		api := makeAPIWithService(t, svc, WithPricing(pricing.NewService(memory.NewPriceStorage(), svc)))
+		for _, body := range []string{
+			`{"sku": "PR-001", "name": "Tea", "price": {"amount": "10.00", "currency": "USD"}, "unit": "Box"}`,
+			`{"sku": "PR-002", "name": "Cup", "price": {"amount": "5.00", "currency": "USD"}, "unit": "Piece", "category": "tableware"}`,
+		} {
+			w := doJSON(t, api, http.MethodPost, "/api/v2/products", body, bearer)
+			require.Equal(t, http.StatusCreated, w.Code)
+		}
+
+		w := doJSON(t, api, http.MethodPost, path, `{"code": "tea-dollar", "name": "1 USD off tea", "kind": "fixed", "skus": ["PR-001"], "amount_off": {"amount": "1", "currency": "USD"}, "stackable": true}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, path+"/tea-dollar", w.Header().Get("Location"))
+		w = doJSON(t, api, http.MethodPost, path, `{"code": "cups", "name": "3 cups for 2", "kind": "buy_x_get_y", "categories": ["tableware"], "buy": 2, "get": 1}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = doJSON(t, api, http.MethodPost, path, `{"code": "cups", "name": "Again", "kind": "percent", "percent_off": 5}`, bearer)
+		assert.Equal(t, CodePromotionExists, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, path, `{"code": "bulk", "name": "Bulk", "kind": "tiered", "tiers": [{"min_qty": 0, "percent_off": 5}]}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "tiers", Code: "not_allowed"}}, withoutMessages(decodeProblem(t, w).Errors))
+
+		w = doJSON(t, api, http.MethodPost, path, `{"code": "sale", "name": "Sale", "kind": "percent", "percent_off": 5, "tags": ["On sale"]}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "tags", Code: "invalid_format"}}, withoutMessages(decodeProblem(t, w).Errors))
+
+		w = doJSON(t, api, http.MethodGet, path+"/cups", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"skus":[],"categories":["tableware"],"tags":[]`)
+		w = doJSON(t, api, http.MethodGet, path, nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Data []struct {
+				Code string `json:"code"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, "cups", list.Data[0].Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/pricing/quote", `{"items": [{"sku": "PR-001", "qty": 2}, {"sku": "PR-002", "qty": 3}]}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var got quote
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, quote{
+			Currency: "USD",
+			Lines: []line{
+				{SKU: "PR-001", Quantity: 2, UnitPrice: usd(1000), Discount: usd(200), Total: usd(1800), Promotions: []discount{{Code: "tea-dollar", Amount: usd(200)}}},
+				{SKU: "PR-002", Quantity: 3, UnitPrice: usd(500), Discount: usd(500), Total: usd(1000), Promotions: []discount{{Code: "cups", Amount: usd(500)}}},
+			},
+			Subtotal: usd(3500),
+			Discount: usd(700),
+			Total:    usd(2800),
+		}, got)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/pricing/quote", `{"items": [{"sku": "PR-001", "qty": 0}]}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "items[0].qty", Code: "required"}}, withoutMessages(decodeProblem(t, w).Errors))
+		w = doJSON(t, api, http.MethodPost, "/api/v2/pricing/quote", `{"items": [{"sku": "PR-404", "qty": 1}]}`, bearer)
+		assert.Equal(t, CodeProductNotFound, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodDelete, path+"/cups", nil, bearer)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		w = doJSON(t, api, http.MethodGet, path+"/cups", nil, bearer)
+		assert.Equal(t, CodePromotionNotFound, decodeProblem(t, w).Code)
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+)
+
+const v2ReservationsPath = "/api/v2/reservations"
+
+var errReservationsUnsupported = errors.New("reservations not configured")
+
+// WithReservations serves the stock reservations of svc. Without it they
+// are not available.
+func WithReservations(svc *reservation.Service) Option {
+	return func(api *API) {
+		api.reservations = svc
+	}
+}
+
+type reservationItem struct {
+	SKU      string `json:"sku"`
+	Quantity uint32 `json:"qty"`
+}
+
+type reservationResource struct {
+	ID         string            `json:"id"`
+	Status     string            `json:"status"`
+	Items      []reservationItem `json:"items"`
+	Reference  string            `json:"reference,omitempty"`
+	CreatedBy  string            `json:"created_by,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+func newReservationResource(r *reservation.Reservation) *reservationResource {
+	res := &reservationResource{
+		ID:        r.ID,
+		Status:    string(r.Status),
+		Items:     make([]reservationItem, len(r.Items)),
+		Reference: r.Reference,
+		CreatedBy: r.CreatedBy,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+	}
+	for i, it := range r.Items {
+		res.Items[i] = reservationItem{SKU: it.SKU, Quantity: it.Quantity}
+	}
+	if !r.FinishedAt.IsZero() {
+		finished := r.FinishedAt
+		res.FinishedAt = &finished
+	}
+	return res
+}
+
+func reservationLocation(id string) string {
+	return v2ReservationsPath + "/" + url.PathEscape(id)
+}
+
+// reservationsRequired answers 501 when no reservation service is
+// configured.
+func (api *API) reservationsRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if api.reservations == nil {
+			abortWithError(c, errReservationsUnsupported)
+		}
+	}
+}
+
+// handleV2ReservationCreate reserves every item or, when one is short, none.
+// ttl is in seconds.
+func (api *API) handleV2ReservationCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			Items     []reservationItem `json:"items"`
+			TTL       uint32            `json:"ttl"`
+			Reference string            `json:"reference"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("reservation create: %#v\n", r)
+
+		items := make([]product.StockItem, len(r.Items))
+		for i, it := range r.Items {
+			items[i] = product.StockItem{SKU: it.SKU, Quantity: it.Quantity}
+		}
+		res, err := api.reservations.Reserve(ctx, items, time.Duration(r.TTL)*time.Second, r.Reference)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", reservationLocation(res.ID))
+		c.JSON(http.StatusCreated, newReservationResource(res))
+	}
+}
+
+func (api *API) handleV2ReservationGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := api.reservations.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newReservationResource(res))
+	}
+}
+
+// handleV2ReservationFinish confirms the reservation, selling its items, or
+// cancels it, giving them back.
+func (api *API) handleV2ReservationFinish(confirm bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			ctx = c.Request.Context()
+			id  = c.Param("id")
+			res *reservation.Reservation
+			err error
+		)
+		fmt.Printf("reservation finish: %v confirm=%v\n", id, confirm)
+
+		if confirm {
+			res, err = api.reservations.Confirm(ctx, id)
+		} else {
+			res, err = api.reservations.Cancel(ctx, id)
+		}
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newReservationResource(res))
+	}
+}
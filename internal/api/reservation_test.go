@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIV2Reservations(t *testing.T) {
+	type (
+		resource struct {
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			Reference string `json:"reference"`
+			CreatedBy string `json:"created_by"`
+		}
+		stock struct {
+			Quantity  uint32 `json:"qty"`
+			Reserved  uint32 `json:"reserved"`
+			Available uint32 `json:"available"`
+		}
+	)
+	path := "/api/v2/reservations"
+
+	t.Run("requires a reservation service", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodPost, path, `{"items": [{"sku": "RES-001", "qty": 1}]}`, bearer)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, CodeReservationsUnsupported, decodeProblem(t, w).Code)
+	})
+
+	t.Run("holds stock until confirmed or cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		svc := product.NewService(memory.NewProductStorage())
+		api := makeAPIWithService(t, svc, WithReservations(reservation.NewService(memory.NewReservationStorage(), svc)))
+		for _, body := range []string{
+			`{"sku": "RES-001", "name": "Tea", "qty": 5, "price": 10, "unit": "Box"}`,
+			`{"sku": "RES-002", "name": "Cup", "qty": 1, "price": 10, "unit": "Piece"}`,
+		} {
+			w := doJSON(t, api, http.MethodPost, "/api/v2/products", body, bearer)
+			require.Equal(t, http.StatusCreated, w.Code)
+		}
+		stockOf := func(sku string) stock {
+			w := doJSON(t, api, http.MethodGet, "/api/v2/products/"+sku, nil, bearer)
+			require.Equal(t, http.StatusOK, w.Code)
+			var s stock
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+			return s
+		}
+		reserve := func(body string) resource {
+			w := doJSON(t, api, http.MethodPost, path, body, bearer)
+			require.Equal(t, http.StatusCreated, w.Code)
+			var r resource
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+			assert.Equal(t, path+"/"+r.ID, w.Header().Get("Location"))
+			return r
+		}
+
+		first := reserve(`{"items": [{"sku": "RES-001", "qty": 2}, {"sku": "RES-002", "qty": 1}], "ttl": 600, "reference": "cart-1"}`)
+		assert.Equal(t, "pending", first.Status)
+		assert.Equal(t, "cart-1", first.Reference)
+		assert.Equal(t, registeredUser, first.CreatedBy)
+		assert.Equal(t, stock{Quantity: 5, Reserved: 2, Available: 3}, stockOf("RES-001"))
+
+		w := doJSON(t, api, http.MethodPost, path, `{"items": [{"sku": "RES-001", "qty": 1}, {"sku": "RES-002", "qty": 1}]}`, bearer)
+		assert.Equal(t, CodeInsufficientStock, decodeProblem(t, w).Code)
+		assert.Equal(t, stock{Quantity: 5, Reserved: 2, Available: 3}, stockOf("RES-001"))
+		w = doJSON(t, api, http.MethodPost, path, `{"items": [{"sku": "RES-001", "qty": 0}], "ttl": 100000}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "items[0].qty", Code: "required"}, {Field: "ttl", Code: "not_allowed"}}, withoutMessages(decodeProblem(t, w).Errors))
+		w = doJSON(t, api, http.MethodPatch, "/api/v2/products/RES-002", `{"qty": 0}`, bearer)
+		assert.Equal(t, CodeInsufficientStock, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodPost, path+"/"+first.ID+"/confirm", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var got resource
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, "confirmed", got.Status)
+		assert.Equal(t, stock{Quantity: 3, Reserved: 0, Available: 3}, stockOf("RES-001"))
+		assert.Equal(t, stock{}, stockOf("RES-002"))
+		w = doJSON(t, api, http.MethodPost, path+"/"+first.ID+"/cancel", nil, bearer)
+		assert.Equal(t, CodeReservationFinished, decodeProblem(t, w).Code)
+
+		second := reserve(`{"items": [{"sku": "RES-001", "qty": 3}]}`)
+		assert.Equal(t, stock{Quantity: 3, Reserved: 3, Available: 0}, stockOf("RES-001"))
+		w = doJSON(t, api, http.MethodPost, path+"/"+second.ID+"/cancel", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, stock{Quantity: 3, Reserved: 0, Available: 3}, stockOf("RES-001"))
+
+		w = doJSON(t, api, http.MethodGet, path+"/"+second.ID, nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, "cancelled", got.Status)
+		w = doJSON(t, api, http.MethodGet, path+"/nope", nil, bearer)
+		assert.Equal(t, CodeReservationNotFound, decodeProblem(t, w).Code)
+	})
+}
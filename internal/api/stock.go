@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/product"
+)
+
+var errLedgerUnsupported = errors.New("stock ledger not configured")
+
+// WithStockLedger serves the stock movements of the products from l.
+// Without it they are not available, movements can still be posted.
+func WithStockLedger(l *inventory.Ledger) Option {
+	return func(api *API) {
+		api.ledger = l
+	}
+}
+
+func (api *API) handleV2ProductMove() gin.HandlerFunc {
+	type (
+		request struct {
+			Kind      string `json:"kind"`
+			Delta     int64  `json:"delta"`
+			Reason    string `json:"reason"`
+			Reference string `json:"reference"`
+			Location  string `json:"location"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r   request
+			ctx = c.Request.Context()
+			sku = c.Param("sku")
+		)
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		fmt.Printf("product move: %v %#v\n", sku, r)
+
+		version, err := api.expectedVersion(c, sku)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if err := api.checkLocation(ctx, r.Location); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		prd, err := api.prdSvc.MoveStock(ctx, sku, product.Movement{
+			Kind:      product.MovementKind(r.Kind),
+			Delta:     r.Delta,
+			Reason:    r.Reason,
+			Reference: r.Reference,
+			Location:  r.Location,
+		}, version)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		renderProduct(c, http.StatusOK, prd)
+	}
+}
+
+func (api *API) handleV2ProductMovements() gin.HandlerFunc {
+	type (
+		request struct {
+			Cursor string `form:"cursor"`
+			Limit  int    `form:"limit" binding:"omitempty,min=1,max=500"`
+		}
+		movement struct {
+			Seq       uint64    `json:"seq"`
+			Kind      string    `json:"kind"`
+			Delta     int64     `json:"delta"`
+			Quantity  uint32    `json:"qty"`
+			Reason    string    `json:"reason"`
+			Reference string    `json:"reference,omitempty"`
+			Location  string    `json:"location"`
+			Version   uint64    `json:"version"`
+			User      string    `json:"user,omitempty"`
+			IP        string    `json:"ip,omitempty"`
+			Time      time.Time `json:"time"`
+		}
+		response struct {
+			Data       []*movement `json:"data"`
+			NextCursor string      `json:"next_cursor,omitempty"`
+		}
+	)
+	return func(c *gin.Context) {
+		var (
+			r    request
+			ctx  = c.Request.Context()
+			sku  = c.Param("sku")
+			data = []*movement{}
+		)
+
+		if api.ledger == nil {
+			abortWithError(c, errLedgerUnsupported)
+			return
+		}
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		page, err := api.ledger.Movements(ctx, sku, inventory.MovementOptions{Cursor: r.Cursor, Limit: r.Limit})
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		// A product without movements, e.g. created out of stock, has an
+		// empty ledger, an unknown one is not found.
+		if len(page.Entries) == 0 && r.Cursor == "" {
+			if _, err := api.prdSvc.GetProduct(ctx, sku, true); err != nil {
+				abortWithError(c, err)
+				return
+			}
+		}
+
+		for _, e := range page.Entries {
+			data = append(data, &movement{
+				Seq:       e.Seq,
+				Kind:      string(e.Kind),
+				Delta:     e.Delta,
+				Quantity:  e.Quantity,
+				Reason:    e.Reason,
+				Reference: e.Reference,
+				Location:  e.Location,
+				Version:   e.Version,
+				User:      e.User,
+				IP:        e.IP,
+				Time:      e.Time,
+			})
+		}
+
+		c.JSON(http.StatusOK, response{
+			Data:       data,
+			NextCursor: page.Next,
+		})
+	}
+}
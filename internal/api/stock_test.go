@@ -0,0 +1,100 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/inventory"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestAPIV2ProductMovements(t *testing.T) {
+	type (
+		movement struct {
+			Kind      string `json:"kind"`
+			Delta     int64  `json:"delta"`
+			Quantity  uint32 `json:"qty"`
+			Reason    string `json:"reason"`
+			Reference string `json:"reference"`
+			Version   uint64 `json:"version"`
+			User      string `json:"user"`
+		}
+		response struct {
+			Data       []movement `json:"data"`
+			NextCursor string     `json:"next_cursor"`
+		}
+	)
+	path := "/api/v2/products/STK-001/movements"
+
+	t.Run("requires a stock ledger", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, path, nil, bearer)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, CodeLedgerUnsupported, decodeProblem(t, w).Code)
+	})
+
+	t.Run("moves the stock", func(t *testing.T) {
+		t.Parallel()
+
+		ledger := inventory.NewLedger(memory.NewLedgerStorage())
+		svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(ledger.Record))
+		api := makeAPIWithService(t, svc, WithStockLedger(ledger))
+
+		w := doJSON(t, api, http.MethodGet, path, nil, bearer)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "STK-001", "name": "Stock", "qty": 5, "price": 10, "unit": "Box"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = doJSON(t, api, http.MethodPost, path, `{"kind": "receipt", "delta": 10, "reason": "delivery", "reference": "DN-1"}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var prd struct {
+			Quantity uint32 `json:"qty"`
+			Version  uint64 `json:"version"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prd))
+		assert.Equal(t, uint32(15), prd.Quantity)
+		assert.Equal(t, uint64(2), prd.Version)
+
+		w = doJSON(t, api, http.MethodPost, path, `{"kind": "sale", "delta": -20, "reason": "order"}`, bearer)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeInsufficientStock, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, path, `{"kind": "sale", "delta": 3, "reason": "Order!"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "delta", Code: "not_allowed"}, {Field: "reason", Code: "invalid_format"}}, withoutMessages(decodeProblem(t, w).Errors))
+		w = doJSONWithHeader(t, api, http.MethodPost, path, `{"kind": "sale", "delta": -3, "reason": "order"}`, bearer, http.Header{"If-Match": {`"1"`}})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = doJSON(t, api, http.MethodPost, path, `{"kind": "sale", "delta": -3, "reason": "order", "reference": "SO-7"}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doJSON(t, api, http.MethodPatch, "/api/v2/products/STK-001", `{"qty": 10}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = doJSON(t, api, http.MethodGet, path+"?limit=3", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var page response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.NotEmpty(t, page.NextCursor)
+		assert.Equal(t, []movement{
+			{Kind: "adjustment", Delta: -2, Quantity: 10, Reason: "overwrite", Version: 4, User: registeredUser},
+			{Kind: "sale", Delta: -3, Quantity: 12, Reason: "order", Reference: "SO-7", Version: 3, User: registeredUser},
+			{Kind: "receipt", Delta: 10, Quantity: 15, Reason: "delivery", Reference: "DN-1", Version: 2, User: registeredUser},
+		}, page.Data)
+
+		w = doJSON(t, api, http.MethodGet, path+"?cursor="+page.NextCursor, nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		page = response{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Empty(t, page.NextCursor)
+		assert.Equal(t, []movement{{Kind: "adjustment", Delta: 5, Quantity: 5, Reason: "initial", Version: 1, User: registeredUser}}, page.Data)
+
+		w = doJSON(t, api, http.MethodGet, path+"?cursor=bogus", nil, bearer)
+		assert.Equal(t, CodeInvalidMovements, decodeProblem(t, w).Code)
+	})
+}
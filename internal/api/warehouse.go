@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/warehouse"
+)
+
+const (
+	v2WarehousesPath = "/api/v2/warehouses"
+	v2TransfersPath  = "/api/v2/transfers"
+)
+
+var errWarehousesUnsupported = errors.New("warehouses not configured")
+
+// WithWarehouses serves the warehouses and transfers of svc. Without it
+// every stock is at product.DefaultLocation.
+func WithWarehouses(svc *warehouse.Service) Option {
+	return func(api *API) {
+		api.warehouses = svc
+	}
+}
+
+// stockLevel is the stock of a product at a location in the v2 API.
+type stockLevel struct {
+	Location string `json:"location"`
+	Quantity uint32 `json:"qty"`
+}
+
+func newStockLevels(p *product.Product) []stockLevel {
+	levels := p.StockLevels()
+	ret := make([]stockLevel, len(levels))
+	for i, l := range levels {
+		ret[i] = stockLevel{Location: l.Location, Quantity: l.Quantity}
+	}
+	return ret
+}
+
+type warehouseResource struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWarehouseResource(w *warehouse.Warehouse) *warehouseResource {
+	return &warehouseResource{Code: w.Code, Name: w.Name, CreatedAt: w.CreatedAt}
+}
+
+type transferResource struct {
+	ID          string            `json:"id"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Status      string            `json:"status"`
+	Items       []reservationItem `json:"items"`
+	Reference   string            `json:"reference,omitempty"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ShippedAt   *time.Time        `json:"shipped_at,omitempty"`
+	ReceivedAt  *time.Time        `json:"received_at,omitempty"`
+	CancelledAt *time.Time        `json:"cancelled_at,omitempty"`
+}
+
+// optionalTime is t, nil when it is zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func newTransferResource(t *warehouse.Transfer) *transferResource {
+	res := &transferResource{
+		ID:          t.ID,
+		From:        t.From,
+		To:          t.To,
+		Status:      string(t.Status),
+		Items:       make([]reservationItem, len(t.Items)),
+		Reference:   t.Reference,
+		CreatedBy:   t.CreatedBy,
+		CreatedAt:   t.CreatedAt,
+		ShippedAt:   optionalTime(t.ShippedAt),
+		ReceivedAt:  optionalTime(t.ReceivedAt),
+		CancelledAt: optionalTime(t.CancelledAt),
+	}
+	for i, it := range t.Items {
+		res.Items[i] = reservationItem{SKU: it.SKU, Quantity: it.Quantity}
+	}
+	return res
+}
+
+func transferLocation(id string) string {
+	return v2TransfersPath + "/" + url.PathEscape(id)
+}
+
+// warehousesRequired answers 501 when no warehouse service is configured.
+func (api *API) warehousesRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if api.warehouses == nil {
+			abortWithError(c, errWarehousesUnsupported)
+		}
+	}
+}
+
+// checkLocation checks stock can be moved at location, which is empty or
+// product.DefaultLocation, or a warehouse.
+func (api *API) checkLocation(ctx context.Context, location string) error {
+	if location == "" || location == product.DefaultLocation {
+		return nil
+	}
+	if api.warehouses == nil {
+		return errWarehousesUnsupported
+	}
+	if _, err := api.warehouses.GetWarehouse(ctx, location); err != nil {
+		return fmt.Errorf("location %s: %w", location, err)
+	}
+	return nil
+}
+
+func (api *API) handleV2Warehouses() gin.HandlerFunc {
+	type (
+		response struct {
+			Data []*warehouseResource `json:"data"`
+		}
+	)
+	return func(c *gin.Context) {
+		ws, err := api.warehouses.Warehouses(c.Request.Context())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		data := make([]*warehouseResource, len(ws))
+		for i := range ws {
+			data[i] = newWarehouseResource(&ws[i])
+		}
+		c.JSON(http.StatusOK, response{Data: data})
+	}
+}
+
+func (api *API) handleV2WarehouseCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			Code string `json:"code"`
+			Name string `json:"name"`
+		}
+	)
+	return func(c *gin.Context) {
+		var r request
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		w, err := api.warehouses.CreateWarehouse(c.Request.Context(), warehouse.Warehouse{Code: r.Code, Name: r.Name})
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", v2WarehousesPath+"/"+url.PathEscape(w.Code))
+		c.JSON(http.StatusCreated, newWarehouseResource(w))
+	}
+}
+
+func (api *API) handleV2WarehouseGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w, err := api.warehouses.GetWarehouse(c.Request.Context(), c.Param("code"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newWarehouseResource(w))
+	}
+}
+
+func (api *API) handleV2Transfers() gin.HandlerFunc {
+	type (
+		request struct {
+			Status string `form:"status" binding:"omitempty,oneof=pending in_transit received cancelled"`
+		}
+		response struct {
+			Data []*transferResource `json:"data"`
+		}
+	)
+	return func(c *gin.Context) {
+		var r request
+
+		err := c.ShouldBindQuery(&r)
+		if err != nil {
+			abortWithError(c, fmt.Errorf("parse request: %v - %w", err, errMalformed))
+			return
+		}
+
+		ts, err := api.warehouses.Transfers(c.Request.Context(), warehouse.TransferStatus(r.Status))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		data := make([]*transferResource, len(ts))
+		for i := range ts {
+			data[i] = newTransferResource(&ts[i])
+		}
+		c.JSON(http.StatusOK, response{Data: data})
+	}
+}
+
+// handleV2TransferCreate orders a transfer, which moves no stock until it
+// is shipped.
+func (api *API) handleV2TransferCreate() gin.HandlerFunc {
+	type (
+		request struct {
+			From      string            `json:"from"`
+			To        string            `json:"to"`
+			Items     []reservationItem `json:"items"`
+			Reference string            `json:"reference"`
+		}
+	)
+	return func(c *gin.Context) {
+		var r request
+
+		err := bind(c, &r)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		items := make([]product.StockItem, len(r.Items))
+		for i, it := range r.Items {
+			items[i] = product.StockItem{SKU: it.SKU, Quantity: it.Quantity}
+		}
+		t, err := api.warehouses.CreateTransfer(c.Request.Context(), r.From, r.To, items, r.Reference)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.Header("Location", transferLocation(t.ID))
+		c.JSON(http.StatusCreated, newTransferResource(t))
+	}
+}
+
+func (api *API) handleV2TransferGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, err := api.warehouses.GetTransfer(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newTransferResource(t))
+	}
+}
+
+// handleV2TransferAction ships, receives or cancels a transfer with do.
+func (api *API) handleV2TransferAction(name string, do func(ctx context.Context, id string) (*warehouse.Transfer, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		fmt.Printf("transfer %s: %v\n", name, id)
+
+		t, err := do(c.Request.Context(), id)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newTransferResource(t))
+	}
+}
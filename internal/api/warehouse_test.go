@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/api"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+	"sampleBackend/internal/warehouse"
+)
+
+func TestAPIV2Warehouses(t *testing.T) {
+	type (
+		level struct {
+			Location string `json:"location"`
+			Quantity uint32 `json:"qty"`
+		}
+		stock struct {
+			Quantity  uint32  `json:"qty"`
+			Available uint32  `json:"available"`
+			Locations []level `json:"locations"`
+			InTransit uint32  `json:"in_transit"`
+		}
+		transfer struct {
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			CreatedBy string `json:"created_by"`
+		}
+	)
+
+	t.Run("requires a warehouse service", func(t *testing.T) {
+		t.Parallel()
+
+		api := makeAPI(t)
+		w := doJSON(t, api, http.MethodGet, "/api/v2/warehouses", nil, bearer)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, CodeWarehousesUnsupported, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "WH-001", "name": "Tea", "qty": 5, "price": 10, "unit": "Box"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products/WH-001/movements", `{"kind": "receipt", "delta": 1, "reason": "purchase", "location": "north"}`, bearer)
+		assert.Equal(t, CodeWarehousesUnsupported, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products/WH-001/movements", `{"kind": "receipt", "delta": 1, "reason": "purchase", "location": "main"}`, bearer)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("moves stock between warehouses", func(t *testing.T) {
+		t.Parallel()
+
+		svc := product.NewService(memory.NewProductStorage())
+		api := makeAPIWithService(t, svc, WithWarehouses(warehouse.NewService(memory.NewWarehouseStorage(), svc)))
+		w := doJSON(t, api, http.MethodPost, "/api/v2/products", `{"sku": "WH-001", "name": "Tea", "qty": 10, "price": 10, "unit": "Box"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		stockOf := func() stock {
+			w := doJSON(t, api, http.MethodGet, "/api/v2/products/WH-001", nil, bearer)
+			require.Equal(t, http.StatusOK, w.Code)
+			var s stock
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+			return s
+		}
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/warehouses", `{"code": "north", "name": "North hub"}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v2/warehouses/north", w.Header().Get("Location"))
+		w = doJSON(t, api, http.MethodPost, "/api/v2/warehouses", `{"code": "north", "name": "North hub"}`, bearer)
+		assert.Equal(t, CodeWarehouseExists, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/warehouses", `{"code": "North", "name": "North hub"}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "code", Code: "invalid_format"}}, withoutMessages(decodeProblem(t, w).Errors))
+		w = doJSON(t, api, http.MethodGet, "/api/v2/warehouses/south", nil, bearer)
+		assert.Equal(t, CodeWarehouseNotFound, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/warehouses", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Data []struct {
+				Code string `json:"code"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, "main", list.Data[0].Code)
+		assert.Equal(t, "north", list.Data[1].Code)
+
+		// Movements are recorded at a location, which has to be a warehouse.
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products/WH-001/movements", `{"kind": "receipt", "delta": 2, "reason": "purchase", "location": "north"}`, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/products/WH-001/movements", `{"kind": "receipt", "delta": 2, "reason": "purchase", "location": "south"}`, bearer)
+		assert.Equal(t, CodeWarehouseNotFound, decodeProblem(t, w).Code)
+		assert.Equal(t, stock{Quantity: 12, Available: 12, Locations: []level{{"main", 10}, {"north", 2}}}, stockOf())
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/transfers", `{"from": "main", "to": "north", "items": [{"sku": "WH-001", "qty": 4}]}`, bearer)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var tr transfer
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tr))
+		assert.Equal(t, "/api/v2/transfers/"+tr.ID, w.Header().Get("Location"))
+		assert.Equal(t, "pending", tr.Status)
+		assert.Equal(t, registeredUser, tr.CreatedBy)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/transfers/"+tr.ID+"/receive", nil, bearer)
+		assert.Equal(t, CodeTransferState, decodeProblem(t, w).Code)
+		w = doJSON(t, api, http.MethodPost, "/api/v2/transfers/"+tr.ID+"/ship", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, stock{Quantity: 8, Available: 8, Locations: []level{{"main", 6}, {"north", 2}}, InTransit: 4}, stockOf())
+
+		// Listing by location shows the stock there.
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products?location=north", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		var page struct {
+			Data []stock `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Data, 1)
+		assert.Equal(t, []level{{"main", 6}, {"north", 2}}, page.Data[0].Locations)
+		assert.Equal(t, uint32(4), page.Data[0].InTransit)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products?location=south", nil, bearer)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Empty(t, page.Data)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/products?location=South!", nil, bearer)
+		assert.Equal(t, CodeInvalidListOptions, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/transfers/"+tr.ID+"/receive", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, stock{Quantity: 12, Available: 12, Locations: []level{{"main", 6}, {"north", 6}}}, stockOf())
+
+		w = doJSON(t, api, http.MethodGet, "/api/v2/transfers/"+tr.ID, nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tr))
+		assert.Equal(t, "received", tr.Status)
+		w = doJSON(t, api, http.MethodGet, "/api/v2/transfers?status=pending", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"data": []}`, w.Body.String())
+		w = doJSON(t, api, http.MethodGet, "/api/v2/transfers/missing", nil, bearer)
+		assert.Equal(t, CodeTransferNotFound, decodeProblem(t, w).Code)
+
+		w = doJSON(t, api, http.MethodPost, "/api/v2/transfers", `{"from": "north", "to": "north", "items": []}`, bearer)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, []FieldError{{Field: "items", Code: "required"}, {Field: "to", Code: "not_allowed"}}, withoutMessages(decodeProblem(t, w).Errors))
+	})
+}
@@ -0,0 +1,136 @@
+// Package audit records who changed which product, when, from where and
+// how, so the history of a product can be paged through.
+package audit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"sampleBackend/internal/product"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+var ErrInvalidOptions = errors.New("invalid history options")
+
+// FieldChange is the change of one field of a product. Old is nil when the
+// field was not set before, New when it is not set after.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// Entry is the record of one mutation of a product. Version is the version
+// the product reached, 0 when it was purged.
+type Entry struct {
+	Seq     uint64
+	SKU     string
+	Op      product.ChangeOp
+	Version uint64
+	User    string
+	IP      string
+	Time    time.Time
+	Changes []FieldChange
+}
+
+type Storage interface {
+	// Append records entries, ordered by Seq.
+	Append(ctx context.Context, entries []Entry) error
+	// History returns up to limit entries of sku with a Seq below before,
+	// newest first. A zero before starts from the newest entry.
+	History(ctx context.Context, sku string, before uint64, limit int) ([]Entry, error)
+}
+
+// HistoryOptions selects a page of the history of a product. Cursor is the
+// Next of the previous page.
+type HistoryOptions struct {
+	Cursor string
+	Limit  int
+}
+
+type Page struct {
+	Entries []Entry
+	Next    string
+}
+
+var fields = []struct {
+	name  string
+	value func(p *product.Product) interface{}
+}{
+	{"name", func(p *product.Product) interface{} { return p.Name }},
+	{"qty", func(p *product.Product) interface{} { return p.Quantity }},
+	{"reserved", func(p *product.Product) interface{} { return p.Reserved }},
+	{"price", func(p *product.Product) interface{} { return p.Price }},
+	{"unit", func(p *product.Product) interface{} { return p.Unit }},
+	{"status", func(p *product.Product) interface{} { return p.Status }},
+	{"category", func(p *product.Product) interface{} {
+		if p.Category == "" {
+			return nil
+		}
+		return p.Category
+	}},
+	{"tags", func(p *product.Product) interface{} {
+		if len(p.Tags) == 0 {
+			return nil
+		}
+		return p.Tags
+	}},
+	{"deleted_at", func(p *product.Product) interface{} {
+		if !p.Deleted() {
+			return nil
+		}
+		return p.DeletedAt
+	}},
+	{"deleted_by", func(p *product.Product) interface{} {
+		if p.DeletedBy == "" {
+			return nil
+		}
+		return p.DeletedBy
+	}},
+}
+
+// Diff returns the fields differing between before and after, named as in
+// the API. A nil before or after has no field set.
+func Diff(before, after *product.Product) []FieldChange {
+	var ret []FieldChange
+	for _, f := range fields {
+		var old, new interface{}
+		if before != nil {
+			old = f.value(before)
+		}
+		if after != nil {
+			new = f.value(after)
+		}
+		if !reflect.DeepEqual(old, new) {
+			ret = append(ret, FieldChange{Field: f.name, Old: old, New: new})
+		}
+	}
+	return ret
+}
+
+// NewEntry returns the entry recording c.
+func NewEntry(c product.Change) Entry {
+	e := Entry{
+		Seq:     c.Seq,
+		SKU:     c.SKU,
+		Op:      c.Op,
+		User:    c.Actor.User,
+		IP:      c.Actor.IP,
+		Time:    c.Time,
+		Changes: Diff(c.Before, c.After),
+	}
+	if c.After != nil {
+		e.Version = c.After.Version
+	}
+	return e
+}
+
+func IsErrInvalidOptions(err error) bool {
+	return errors.Is(err, ErrInvalidOptions)
+}
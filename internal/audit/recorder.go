@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"sampleBackend/internal/journal"
+	"sampleBackend/internal/product"
+)
+
+// Recorder records the changes of the catalog. Its Record is a
+// product.ChangeHook of the product service, so every write is recorded
+// before it returns.
+type Recorder struct {
+	storage Storage
+	journal *journal.Journal
+}
+
+func NewRecorder(s Storage) *Recorder {
+	return &Recorder{
+		storage: s,
+		journal: journal.New("audit"),
+	}
+}
+
+// Record records c.
+func (r *Recorder) Record(c product.Change) {
+	// A reset replaces the whole catalog and belongs to no product.
+	if c.Op == product.ChangeReset {
+		return
+	}
+
+	entries := []Entry{NewEntry(c)}
+	r.journal.Append(func(ctx context.Context) error {
+		return r.storage.Append(ctx, entries)
+	})
+}
+
+// History returns the page of the history of sku selected by opts, newest
+// first.
+func (r *Recorder) History(ctx context.Context, sku string, opts HistoryOptions) (*Page, error) {
+	before, limit, err := journal.Page(opts.Cursor, opts.Limit, DefaultHistoryLimit, MaxHistoryLimit, ErrInvalidOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.journal.Flush(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := r.storage.History(ctx, sku, before, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	page := &Page{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.Next = journal.Cursor(page.Entries[limit-1].Seq)
+	}
+	return page, nil
+}
@@ -0,0 +1,118 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/audit"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestDiff(t *testing.T) {
+	before := &product.Product{SKU: "A-1", Name: "Tea", Quantity: 5, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	after := *before
+	after.Quantity, after.Price.Amount = 0, 12
+	assert.Equal(t, []FieldChange{
+		{Field: "qty", Old: uint32(5), New: uint32(0)},
+		{Field: "price", Old: before.Price, New: after.Price},
+	}, Diff(before, &after))
+
+	assert.Empty(t, Diff(before, before))
+	assert.Len(t, Diff(nil, before), 6)
+
+	deleted := *before
+	deleted.DeletedAt, deleted.DeletedBy = time.Now(), "admin@gmail.com"
+	assert.Equal(t, []FieldChange{
+		{Field: "deleted_at", Old: nil, New: deleted.DeletedAt},
+		{Field: "deleted_by", Old: nil, New: "admin@gmail.com"},
+	}, Diff(before, &deleted))
+}
+
+func TestRecorderHistory(t *testing.T) {
+	ctx := context.Background()
+	r := NewRecorder(memory.NewAuditStorage())
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeRetention(3, 0), product.WithChangeHooks(r.Record))
+
+	clerk := product.WithActor(ctx, product.Actor{User: "clerk@gmail.com", IP: "10.0.0.1"})
+	p := product.Product{SKU: "H-1", Name: "Tea", Quantity: 5, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	_, err := svc.AddProduct(clerk, p)
+	require.NoError(t, err)
+	p.Quantity = 0
+	_, err = svc.UpdateProduct(clerk, p)
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteProduct(ctx, "H-1", 0, ""))
+
+	page, err := r.History(ctx, "H-1", HistoryOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, product.ChangeDelete, page.Entries[0].Op)
+	assert.Empty(t, page.Entries[0].User)
+	updated := page.Entries[1]
+	assert.Equal(t, product.ChangeUpdate, updated.Op)
+	assert.Equal(t, "clerk@gmail.com", updated.User)
+	assert.Equal(t, "10.0.0.1", updated.IP)
+	assert.Equal(t, uint64(2), updated.Version)
+	assert.Equal(t, []FieldChange{{Field: "qty", Old: uint32(5), New: uint32(0)}}, updated.Changes)
+
+	page, err = r.History(ctx, "H-1", HistoryOptions{Cursor: page.Next, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, product.ChangeCreate, page.Entries[0].Op)
+	assert.Empty(t, page.Next)
+
+	_, err = r.History(ctx, "H-1", HistoryOptions{Cursor: "%%"})
+	assert.True(t, IsErrInvalidOptions(err))
+	_, err = r.History(ctx, "H-1", HistoryOptions{Limit: MaxHistoryLimit + 1})
+	assert.True(t, IsErrInvalidOptions(err))
+
+	// Changes are recorded with their write, even those the change stream
+	// no longer retains.
+	for _, sku := range []string{"H-2", "H-3", "H-4", "H-5"} {
+		_, err = svc.AddProduct(ctx, product.Product{SKU: sku, Name: "Tea", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Box"})
+		require.NoError(t, err)
+	}
+	_, err = svc.Changes().ReadChanges(1, 0)
+	assert.True(t, product.IsErrChangeExpired(err))
+	page, err = r.History(ctx, "H-2", HistoryOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+}
+
+// failingStorage fails every append while failing is set.
+type failingStorage struct {
+	*memory.AuditStorage
+	failing bool
+}
+
+func (s *failingStorage) Append(ctx context.Context, entries []Entry) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	return s.AuditStorage.Append(ctx, entries)
+}
+
+func TestRecorderPending(t *testing.T) {
+	ctx := context.Background()
+	s := &failingStorage{AuditStorage: memory.NewAuditStorage(), failing: true}
+	r := NewRecorder(s)
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(r.Record))
+
+	_, err := svc.AddProduct(ctx, product.Product{SKU: "H-1", Name: "Tea", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	_, err = r.History(ctx, "H-1", HistoryOptions{})
+	assert.Error(t, err)
+
+	// Entries the storage failed to append are kept until it succeeds.
+	s.failing = false
+	page, err := r.History(ctx, "H-1", HistoryOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, product.ChangeCreate, page.Entries[0].Op)
+}
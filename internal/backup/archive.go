@@ -0,0 +1,224 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Format identifies archives produced by this package.
+	Format = "sample-backend-backup"
+	// Version is bumped on every incompatible change of the archive layout or
+	// of the record schemas. Version 2 hashes the passwords, version 3 adds
+	// the warehouses, transfers and reservations with the stock they hold.
+	// Archives of older versions are still restored.
+	Version = 3
+
+	manifestName     = "manifest.json"
+	usersName        = "users.ndjson"
+	productsName     = "products.ndjson"
+	warehousesName   = "warehouses.ndjson"
+	transfersName    = "transfers.ndjson"
+	reservationsName = "reservations.ndjson"
+
+	// maxEntrySize guards restore against decompression bombs.
+	maxEntrySize = 1 << 30
+)
+
+var (
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrPending is returned when stock is held by reservations or in
+	// transit and the Service has no service of those to archive or
+	// restore them with.
+	ErrPending = errors.New("stock reserved or in transit")
+)
+
+// Manifest is the first entry of an archive and describes the data entries
+// that follow it.
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []File    `json:"files"`
+}
+
+type File struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+}
+
+func (m *Manifest) file(name string) (*File, bool) {
+	for i := range m.Files {
+		if m.Files[i].Name == name {
+			return &m.Files[i], true
+		}
+	}
+	return nil, false
+}
+
+// encodeNDJSON writes one JSON document per line.
+func encodeNDJSON(records []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type entry struct {
+	name    string
+	records int
+	data    []byte
+}
+
+// writeArchive writes a gzip compressed tar with the manifest first so that
+// readers can reject a foreign format before touching any data.
+func writeArchive(w io.Writer, createdAt time.Time, entries []entry) (*Manifest, error) {
+	m := &Manifest{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: createdAt.UTC(),
+	}
+	for _, e := range entries {
+		sum := sha256.Sum256(e.data)
+		m.Files = append(m.Files, File{
+			Name:    e.name,
+			Records: e.records,
+			Size:    int64(len(e.data)),
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	all := append([]entry{{name: manifestName, data: manifest}}, entries...)
+	for _, e := range all {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Mode:     0o600,
+			Size:     int64(len(e.data)),
+			ModTime:  m.CreatedAt,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("write %s header: %w", e.name, err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, fmt.Errorf("write %s: %w", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip: %w", err)
+	}
+
+	return m, nil
+}
+
+// readArchive validates the manifest and the checksum of every data entry
+// and returns the entries' content by name.
+func readArchive(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open gzip: %v - %w", err, ErrInvalidArchive)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	next := func() (*tar.Header, []byte, error) {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Size > maxEntrySize {
+			return nil, nil, fmt.Errorf("entry %s too large - %w", hdr.Name, ErrInvalidArchive)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s: %v - %w", hdr.Name, err, ErrInvalidArchive)
+		}
+		return hdr, data, nil
+	}
+
+	hdr, data, err := next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read manifest: %v - %w", err, ErrInvalidArchive)
+	}
+	if hdr.Name != manifestName {
+		return nil, nil, fmt.Errorf("first entry is %q, not a manifest - %w", hdr.Name, ErrInvalidArchive)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, fmt.Errorf("decode manifest: %v - %w", err, ErrInvalidArchive)
+	}
+	if m.Format != Format {
+		return nil, nil, fmt.Errorf("unknown format %q - %w", m.Format, ErrInvalidArchive)
+	}
+	if m.Version < 1 || m.Version > Version {
+		return nil, nil, fmt.Errorf("unsupported version %d, want at most %d - %w", m.Version, Version, ErrInvalidArchive)
+	}
+
+	files := make(map[string][]byte, len(m.Files))
+	for {
+		hdr, data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read entry: %v - %w", err, ErrInvalidArchive)
+		}
+		f, ok := m.file(hdr.Name)
+		if !ok {
+			return nil, nil, fmt.Errorf("entry %q not in manifest - %w", hdr.Name, ErrInvalidArchive)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, nil, fmt.Errorf("entry %q checksum mismatch - %w", hdr.Name, ErrInvalidArchive)
+		}
+		files[hdr.Name] = data
+	}
+	for _, f := range m.Files {
+		if _, ok := files[f.Name]; !ok {
+			return nil, nil, fmt.Errorf("entry %q missing - %w", f.Name, ErrInvalidArchive)
+		}
+	}
+
+	return &m, files, nil
+}
+
+// decodeNDJSON calls fn with a decoder positioned on every line of data and
+// checks the record count announced by the manifest.
+func decodeNDJSON(f File, data []byte, fn func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	n := 0
+	for dec.More() {
+		if err := fn(dec); err != nil {
+			return fmt.Errorf("%s record %d: %v - %w", f.Name, n+1, err, ErrInvalidArchive)
+		}
+		n++
+	}
+	if n != f.Records {
+		return fmt.Errorf("%s has %d records, manifest says %d - %w", f.Name, n, f.Records, ErrInvalidArchive)
+	}
+	return nil
+}
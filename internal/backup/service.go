@@ -0,0 +1,544 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/user"
+	"sampleBackend/internal/warehouse"
+)
+
+type userRecord struct {
+	Email string `json:"email"`
+	// PasswordHash is the hash of the password, archives of version 1 have
+	// the Password itself instead.
+	PasswordHash string `json:"password_hash,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+type productRecord struct {
+	SKU      string `json:"sku"`
+	Name     string `json:"name"`
+	Quantity uint32 `json:"qty"`
+	Price    int64  `json:"price"`
+	// Currency is missing from archives of older servers, their prices are
+	// in the default currency of the restoring server.
+	Currency string `json:"currency,omitempty"`
+	Unit     string `json:"unit"`
+	Status   uint8  `json:"status"`
+	// Category and Tags are missing from archives of older servers.
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Version is missing from archives of older servers.
+	Version uint64 `json:"version,omitempty"`
+	// Locations is the stock at the locations other than the default one,
+	// which holds the rest of Quantity. It is missing from archives of
+	// older servers. Holds is the stock held by each pending reservation
+	// and InTransit the stock of the transfers in transit, both need the
+	// reservations and transfers of the archive.
+	Locations map[string]uint32 `json:"locations,omitempty"`
+	Holds     map[string]uint32 `json:"holds,omitempty"`
+	InTransit uint32            `json:"in_transit,omitempty"`
+	// DeletedAt and DeletedBy are set on the tombstones of deleted products.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// Service produces and restores archives of every user and product through
+// the domain services, so it works with any storage backend.
+type Service struct {
+	users        *user.Service
+	products     *product.Service
+	warehouses   *warehouse.Service
+	reservations *reservation.Service
+}
+
+type Option func(s *Service)
+
+// WithWarehouses archives the warehouses and the transfers, with the stock
+// in transit.
+func WithWarehouses(svc *warehouse.Service) Option {
+	return func(s *Service) {
+		s.warehouses = svc
+	}
+}
+
+// WithReservations archives the reservations, with the stock they hold.
+func WithReservations(svc *reservation.Service) Option {
+	return func(s *Service) {
+		s.reservations = svc
+	}
+}
+
+func NewService(users *user.Service, products *product.Service, opts ...Option) *Service {
+	s := &Service{
+		users:    users,
+		products: products,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Result is what a restore did, or would do on a dry run.
+type Result struct {
+	Manifest *Manifest
+	// DroppedReservations are the pending reservations which the archive
+	// does not have pending, DroppedTransfers the transfers pending or in
+	// transit which it does not have so. The restore ends them, with the
+	// stock they held.
+	DroppedReservations []string
+	DroppedTransfers    []string
+}
+
+// state is everything an archive holds. Warehouses is nil when the
+// warehouses and transfers are not archived, reservations when the
+// reservations are not.
+type state struct {
+	users    []user.User
+	products []product.Product
+	stock
+}
+
+// Backup writes an archive to w. Everything is copied at a single point in
+// time, the writes wait for the copy, so it is safe while serving traffic.
+// Without the reservations, the stock they hold is archived as available.
+// Without the transfers, stock in transit fails the backup with ErrPending.
+func (s *Service) Backup(ctx context.Context, w io.Writer) (*Manifest, error) {
+	st, createdAt, err := s.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userRecords := make([]interface{}, 0, len(st.users))
+	for _, u := range st.users {
+		userRecords = append(userRecords, userRecord{
+			Email:        u.Email,
+			PasswordHash: u.Password,
+		})
+	}
+	productRecords := make([]interface{}, 0, len(st.products))
+	for _, p := range st.products {
+		rec := productRecord{
+			SKU:       p.SKU,
+			Name:      p.Name,
+			Quantity:  p.Quantity,
+			Price:     p.Price.Amount,
+			Currency:  p.Price.Currency,
+			Unit:      p.Unit,
+			Status:    uint8(p.Status),
+			Category:  p.Category,
+			Tags:      p.Tags,
+			Version:   p.Version,
+			InTransit: p.InTransit,
+			DeletedBy: p.DeletedBy,
+		}
+		if len(p.Levels) > 0 {
+			rec.Locations = make(map[string]uint32, len(p.Levels))
+			for _, l := range p.Levels {
+				rec.Locations[l.Location] = l.Quantity
+			}
+		}
+		if len(p.Holds) > 0 && st.reservations != nil {
+			rec.Holds = make(map[string]uint32, len(p.Holds))
+			for _, h := range p.Holds {
+				rec.Holds[h.ID] = h.Quantity
+			}
+		}
+		if p.Deleted() {
+			deletedAt := p.DeletedAt
+			rec.DeletedAt = &deletedAt
+		}
+		productRecords = append(productRecords, rec)
+	}
+
+	usersData, err := encodeNDJSON(userRecords)
+	if err != nil {
+		return nil, fmt.Errorf("encode users: %w", err)
+	}
+	productsData, err := encodeNDJSON(productRecords)
+	if err != nil {
+		return nil, fmt.Errorf("encode products: %w", err)
+	}
+	stock, err := stockEntries(st.warehouses, st.transfers, st.reservations)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeArchive(w, createdAt, append([]entry{
+		{name: usersName, records: len(userRecords), data: usersData},
+		{name: productsName, records: len(productRecords), data: productsData},
+	}, stock...))
+}
+
+// frozen is the writes of every service frozen, until thawed.
+type frozen struct {
+	reservations *reservation.Frozen
+	warehouses   *warehouse.Frozen
+	products     *product.Frozen
+	users        *user.Frozen
+}
+
+// freeze freezes the services in the order their writes call each other.
+func (s *Service) freeze() *frozen {
+	var f frozen
+	if s.reservations != nil {
+		f.reservations = s.reservations.Freeze()
+	}
+	if s.warehouses != nil {
+		f.warehouses = s.warehouses.Freeze()
+	}
+	f.products = s.products.Freeze()
+	f.users = s.users.Freeze()
+	return &f
+}
+
+func (f *frozen) thaw() {
+	f.users.Thaw()
+	f.products.Thaw()
+	if f.warehouses != nil {
+		f.warehouses.Thaw()
+	}
+	if f.reservations != nil {
+		f.reservations.Thaw()
+	}
+}
+
+// snapshot copies everything, with the writes frozen.
+func (s *Service) snapshot(ctx context.Context) (state, time.Time, error) {
+	f := s.freeze()
+	defer f.thaw()
+
+	st, err := f.snapshot(ctx)
+	if err != nil {
+		return state{}, time.Time{}, err
+	}
+	if st.warehouses == nil {
+		for _, p := range st.products {
+			if p.InTransit > 0 {
+				return state{}, time.Time{}, fmt.Errorf("%s has %d in transit - %w", p.SKU, p.InTransit, ErrPending)
+			}
+		}
+	}
+	return st, time.Now(), nil
+}
+
+func (f *frozen) snapshot(ctx context.Context) (state, error) {
+	var (
+		st  state
+		err error
+	)
+	st.users, err = f.users.Snapshot(ctx)
+	if err != nil {
+		return state{}, fmt.Errorf("snapshot users: %w", err)
+	}
+	st.products, err = f.products.Snapshot(ctx)
+	if err != nil {
+		return state{}, fmt.Errorf("snapshot products: %w", err)
+	}
+	if f.warehouses != nil {
+		st.warehouses, st.transfers, err = f.warehouses.Snapshot(ctx)
+		if err != nil {
+			return state{}, err
+		}
+		if st.warehouses == nil {
+			st.warehouses = []warehouse.Warehouse{}
+		}
+	}
+	if f.reservations != nil {
+		st.reservations, err = f.reservations.Snapshot(ctx)
+		if err != nil {
+			return state{}, err
+		}
+		if st.reservations == nil {
+			st.reservations = []reservation.Reservation{}
+		}
+	}
+	return st, nil
+}
+
+// Restore validates the archive read from r and, unless dryRun is set,
+// replaces everything with its content at once. Nothing is written when
+// the archive fails validation, and what was replaced is put back when a
+// part cannot be. Archives without warehouses keep the current ones and
+// clear the transfers, archives without reservations clear them. Stock
+// held or in transit which the Service cannot restore the reservations or
+// transfers of fails the restore with ErrPending.
+func (s *Service) Restore(ctx context.Context, r io.Reader, dryRun bool) (*Result, error) {
+	m, files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		st     state
+		emails = make(map[string]struct{})
+		skus   = make(map[string]struct{})
+	)
+
+	f, _ := m.file(usersName)
+	if f == nil {
+		return nil, fmt.Errorf("entry %q missing - %w", usersName, ErrInvalidArchive)
+	}
+	err = decodeNDJSON(*f, files[usersName], func(dec *json.Decoder) error {
+		var rec userRecord
+		if err := dec.Decode(&rec); err != nil {
+			return err
+		}
+		if rec.Email == "" {
+			return errors.New("empty email")
+		}
+		if _, dup := emails[rec.Email]; dup {
+			return fmt.Errorf("duplicated email %q", rec.Email)
+		}
+		emails[rec.Email] = struct{}{}
+		hash := rec.PasswordHash
+		switch {
+		case m.Version == 1 && rec.PasswordHash == "":
+			h, err := s.users.HashPassword(rec.Password)
+			if err != nil {
+				return err
+			}
+			hash = h
+		case rec.Password != "":
+			return fmt.Errorf("%s: password in clear text", rec.Email)
+		case !user.IsHash(hash):
+			return fmt.Errorf("%s: invalid password hash", rec.Email)
+		}
+		st.users = append(st.users, user.User{
+			Email:    rec.Email,
+			Password: hash,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, _ = m.file(productsName)
+	if f == nil {
+		return nil, fmt.Errorf("entry %q missing - %w", productsName, ErrInvalidArchive)
+	}
+	err = decodeNDJSON(*f, files[productsName], func(dec *json.Decoder) error {
+		var rec productRecord
+		if err := dec.Decode(&rec); err != nil {
+			return err
+		}
+		if rec.SKU == "" {
+			return errors.New("empty sku")
+		}
+		if _, dup := skus[rec.SKU]; dup {
+			return fmt.Errorf("duplicated sku %q", rec.SKU)
+		}
+		skus[rec.SKU] = struct{}{}
+		p := product.Product{
+			SKU:       rec.SKU,
+			Name:      rec.Name,
+			Quantity:  rec.Quantity,
+			Price:     money.Money{Amount: rec.Price, Currency: rec.Currency},
+			Unit:      rec.Unit,
+			Status:    product.Status(rec.Status),
+			Category:  rec.Category,
+			Tags:      rec.Tags,
+			Version:   rec.Version,
+			InTransit: rec.InTransit,
+		}
+		levels, err := restoreLevels(rec.Locations, rec.Quantity)
+		if err != nil {
+			return fmt.Errorf("sku %q: %w", rec.SKU, err)
+		}
+		p.Levels = levels
+		holds, reserved, err := restoreHolds(rec.Holds, rec.Quantity)
+		if err != nil {
+			return fmt.Errorf("sku %q: %w", rec.SKU, err)
+		}
+		p.Holds, p.Reserved = holds, reserved
+		if rec.DeletedAt != nil {
+			if len(holds) > 0 {
+				return fmt.Errorf("sku %q: deleted with stock held", rec.SKU)
+			}
+			p.DeletedAt, p.DeletedBy = *rec.DeletedAt, rec.DeletedBy
+		}
+		st.products = append(st.products, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	st.stock, err = decodeStock(m, files)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHeld(st.products, st.stock); err != nil {
+		return nil, err
+	}
+
+	res, err := s.replace(ctx, st, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	res.Manifest = m
+	return res, nil
+}
+
+// replace replaces everything with st with the writes frozen, putting back
+// what was replaced when a part fails. On a dry run it only reports what
+// it would drop.
+func (s *Service) replace(ctx context.Context, st state, dryRun bool) (*Result, error) {
+	f := s.freeze()
+	defer f.thaw()
+
+	current, err := f.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{DroppedReservations: []string{}, DroppedTransfers: []string{}}
+	if f.reservations != nil {
+		pending := make(map[string]bool)
+		for _, r := range st.reservations {
+			pending[r.ID] = r.Status == reservation.StatusPending
+		}
+		for _, r := range current.reservations {
+			if r.Status == reservation.StatusPending && !pending[r.ID] {
+				res.DroppedReservations = append(res.DroppedReservations, r.ID)
+			}
+		}
+	}
+	if f.warehouses != nil {
+		active := make(map[string]bool)
+		for _, t := range st.transfers {
+			active[t.ID] = t.Status == warehouse.TransferPending || t.Status == warehouse.TransferInTransit
+		}
+		for _, t := range current.transfers {
+			if (t.Status == warehouse.TransferPending || t.Status == warehouse.TransferInTransit) && !active[t.ID] {
+				res.DroppedTransfers = append(res.DroppedTransfers, t.ID)
+			}
+		}
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	for _, p := range st.products {
+		switch {
+		case f.reservations == nil && p.Reserved > 0:
+			return nil, fmt.Errorf("%s has %d reserved in the archive - %w", p.SKU, p.Reserved, ErrPending)
+		case f.warehouses == nil && p.InTransit > 0:
+			return nil, fmt.Errorf("%s has %d in transit in the archive - %w", p.SKU, p.InTransit, ErrPending)
+		}
+	}
+	for _, p := range current.products {
+		switch {
+		case f.reservations == nil && p.Reserved > 0:
+			return nil, fmt.Errorf("%s has %d reserved - %w", p.SKU, p.Reserved, ErrPending)
+		case f.warehouses == nil && p.InTransit > 0:
+			return nil, fmt.Errorf("%s has %d in transit - %w", p.SKU, p.InTransit, ErrPending)
+		}
+	}
+
+	// Older archives have no warehouses, the current ones are kept.
+	if st.warehouses == nil {
+		st.warehouses, st.transfers = current.warehouses, []warehouse.Transfer{}
+	}
+	if st.reservations == nil {
+		st.reservations = []reservation.Reservation{}
+	}
+
+	var undo []func() error
+	putBack := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				fmt.Println("restore: put back failed:", err)
+			}
+		}
+	}
+	if err := f.users.Restore(ctx, st.users); err != nil {
+		return nil, err
+	}
+	undo = append(undo, func() error { return f.users.Restore(ctx, current.users) })
+	if err := f.products.Restore(ctx, st.products); err != nil {
+		putBack()
+		return nil, err
+	}
+	undo = append(undo, func() error { return f.products.Restore(ctx, current.products) })
+	if f.warehouses != nil {
+		if err := f.warehouses.Restore(ctx, st.warehouses, st.transfers); err != nil {
+			putBack()
+			return nil, err
+		}
+		undo = append(undo, func() error { return f.warehouses.Restore(ctx, current.warehouses, current.transfers) })
+	}
+	if f.reservations != nil {
+		if err := f.reservations.Restore(ctx, st.reservations); err != nil {
+			putBack()
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// restoreHolds returns the holds of holds, ordered by reservation, and the
+// stock they reserve, checking it fits in the quantity qty.
+func restoreHolds(holds map[string]uint32, qty uint32) ([]product.Hold, uint32, error) {
+	var (
+		ret   []product.Hold
+		total uint64
+	)
+	for id, q := range holds {
+		switch {
+		case id == "":
+			return nil, 0, errors.New("hold without reservation")
+		case q == 0:
+			continue
+		}
+		ret = append(ret, product.Hold{ID: id, Quantity: q})
+		total += uint64(q)
+	}
+	if total > uint64(qty) {
+		return nil, 0, fmt.Errorf("%d held, more than qty %d", total, qty)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret, uint32(total), nil
+}
+
+// restoreLevels returns the stock levels of locations, ordered by location,
+// checking they fit in the quantity qty.
+func restoreLevels(locations map[string]uint32, qty uint32) ([]product.StockLevel, error) {
+	var (
+		levels []product.StockLevel
+		total  uint64
+	)
+	for loc, q := range locations {
+		switch {
+		case loc == product.DefaultLocation || !product.ValidLocation(loc):
+			return nil, fmt.Errorf("invalid location %q", loc)
+		case q == 0:
+			continue
+		}
+		levels = append(levels, product.StockLevel{Location: loc, Quantity: q})
+		total += uint64(q)
+	}
+	if total > uint64(qty) {
+		return nil, fmt.Errorf("%d at locations, more than qty %d", total, qty)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Location < levels[j].Location })
+	return levels, nil
+}
+
+func IsErrInvalidArchive(err error) bool {
+	return errors.Is(err, ErrInvalidArchive)
+}
+
+func IsErrPending(err error) bool {
+	return errors.Is(err, ErrPending)
+}
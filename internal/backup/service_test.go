@@ -0,0 +1,333 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	. "sampleBackend/internal/backup"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/storage/memory"
+	"sampleBackend/internal/user"
+	"sampleBackend/internal/warehouse"
+)
+
+// failingStorage fails every restore of the products.
+type failingStorage struct {
+	*memory.ProductStorage
+}
+
+func (failingStorage) Restore(context.Context, []product.Product) error {
+	return errors.New("disk full")
+}
+
+type fixture struct {
+	users        *user.Service
+	products     *product.Service
+	warehouses   *warehouse.Service
+	reservations *reservation.Service
+	svc          *Service
+}
+
+func newFixture(t *testing.T, s product.Storage, emails ...string) fixture {
+	t.Helper()
+
+	ctx := context.Background()
+	f := fixture{
+		users:    user.NewService(memory.NewUserStorage(), user.WithHashCost(bcrypt.MinCost)),
+		products: product.NewService(s),
+	}
+	f.warehouses = warehouse.NewService(memory.NewWarehouseStorage(), f.products)
+	f.reservations = reservation.NewService(memory.NewReservationStorage(), f.products)
+	f.svc = NewService(f.users, f.products, WithWarehouses(f.warehouses), WithReservations(f.reservations))
+	for _, e := range emails {
+		require.NoError(t, f.users.CreateUser(ctx, user.User{Email: e, Password: "secret-" + e}))
+	}
+	return f
+}
+
+func (f fixture) addProduct(t *testing.T, sku string) {
+	t.Helper()
+
+	_, err := f.products.AddProduct(context.Background(), product.Product{SKU: sku, Name: "Tea", Quantity: 3, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+}
+
+func (f fixture) skus(t *testing.T) []string {
+	t.Helper()
+
+	products, err := f.products.Snapshot(context.Background())
+	require.NoError(t, err)
+	var ret []string
+	for _, p := range products {
+		ret = append(ret, p.SKU)
+	}
+	return ret
+}
+
+func (f fixture) canLogin(email string) bool {
+	_, err := f.users.Login(context.Background(), user.User{Email: email, Password: "secret-" + email})
+	return err == nil
+}
+
+func backup(t *testing.T, svc *Service) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	m, err := svc.Backup(context.Background(), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, Version, m.Version)
+	return buf.Bytes()
+}
+
+// entries returns the content of every entry of archive by name.
+func entries(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	ret := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return ret
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		ret[hdr.Name] = data
+	}
+}
+
+// repack writes the entries of files in order into a new archive.
+func repack(t *testing.T, names []string, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(files[name]))}))
+		_, err := tw.Write(files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// manifestOf returns the manifest of version describing files, one record
+// per line.
+func manifestOf(t *testing.T, version int, files map[string][]byte) []byte {
+	t.Helper()
+
+	m := Manifest{Format: Format, Version: version}
+	for _, name := range []string{"users.ndjson", "products.ndjson"} {
+		sum := sha256.Sum256(files[name])
+		m.Files = append(m.Files, File{
+			Name:    name,
+			Records: bytes.Count(files[name], []byte("\n")),
+			Size:    int64(len(files[name])),
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	return data
+}
+
+func TestServiceRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newFixture(t, memory.NewProductStorage(), "a@example.com", "b@example.com")
+	src.addProduct(t, "BK-1")
+	src.addProduct(t, "BK-2")
+	archive := backup(t, src.svc)
+
+	files := entries(t, archive)
+	assert.NotContains(t, string(files["users.ndjson"]), "secret-")
+	assert.Contains(t, string(files["users.ndjson"]), `"password_hash"`)
+
+	dst := newFixture(t, memory.NewProductStorage(), "old@example.com")
+	dst.addProduct(t, "OLD-1")
+	res, err := dst.svc.Restore(ctx, bytes.NewReader(archive), false)
+	require.NoError(t, err)
+	require.Len(t, res.Manifest.Files, 5)
+	assert.Equal(t, 2, res.Manifest.Files[0].Records)
+
+	assert.Equal(t, []string{"BK-1", "BK-2"}, dst.skus(t))
+	assert.True(t, dst.canLogin("a@example.com"))
+	assert.True(t, dst.canLogin("b@example.com"))
+	assert.False(t, dst.canLogin("old@example.com"))
+}
+
+func TestServiceDryRun(t *testing.T) {
+	ctx := context.Background()
+	src := newFixture(t, memory.NewProductStorage(), "a@example.com")
+	src.addProduct(t, "BK-1")
+	archive := backup(t, src.svc)
+
+	dst := newFixture(t, memory.NewProductStorage(), "old@example.com")
+	dst.addProduct(t, "OLD-1")
+	res, err := dst.svc.Restore(ctx, bytes.NewReader(archive), true)
+	require.NoError(t, err)
+	assert.Len(t, res.Manifest.Files, 5)
+	assert.Equal(t, []string{"OLD-1"}, dst.skus(t))
+	assert.True(t, dst.canLogin("old@example.com"))
+}
+
+func TestServiceRestoreInvalid(t *testing.T) {
+	ctx := context.Background()
+	src := newFixture(t, memory.NewProductStorage(), "a@example.com")
+	src.addProduct(t, "BK-1")
+	files := entries(t, backup(t, src.svc))
+	names := []string{"manifest.json", "users.ndjson", "products.ndjson"}
+
+	tampered := make(map[string][]byte, len(files))
+	for k, v := range files {
+		tampered[k] = v
+	}
+	tampered["products.ndjson"] = bytes.Replace(files["products.ndjson"], []byte(`"qty":3`), []byte(`"qty":9`), 1)
+
+	for name, archive := range map[string][]byte{
+		"checksum mismatch":  repack(t, names, tampered),
+		"missing entry":      repack(t, names[:2], files),
+		"manifest not first": repack(t, []string{"users.ndjson", "manifest.json", "products.ndjson"}, files),
+	} {
+		dst := newFixture(t, memory.NewProductStorage(), "old@example.com")
+		dst.addProduct(t, "OLD-1")
+		_, err := dst.svc.Restore(ctx, bytes.NewReader(archive), false)
+		assert.True(t, IsErrInvalidArchive(err), name)
+		assert.Equal(t, []string{"OLD-1"}, dst.skus(t), name)
+		assert.True(t, dst.canLogin("old@example.com"), name)
+	}
+
+	// Archives of version 1 had the passwords themselves, which are hashed.
+	users := []byte(`{"email":"v1@example.com","password":"secret-v1@example.com"}` + "\n")
+	dst := newFixture(t, memory.NewProductStorage())
+	v1 := map[string][]byte{
+		"manifest.json":   manifestOf(t, 1, map[string][]byte{"users.ndjson": users, "products.ndjson": nil}),
+		"users.ndjson":    users,
+		"products.ndjson": nil,
+	}
+	_, err := dst.svc.Restore(ctx, bytes.NewReader(repack(t, names, v1)), false)
+	require.NoError(t, err)
+	assert.True(t, dst.canLogin("v1@example.com"))
+
+	// Later archives must not have them.
+	v1["manifest.json"] = manifestOf(t, Version, map[string][]byte{"users.ndjson": users, "products.ndjson": nil})
+	_, err = dst.svc.Restore(ctx, bytes.NewReader(repack(t, names, v1)), false)
+	assert.True(t, IsErrInvalidArchive(err))
+}
+
+func TestServiceRestoreFailure(t *testing.T) {
+	ctx := context.Background()
+	src := newFixture(t, memory.NewProductStorage(), "a@example.com")
+	src.addProduct(t, "BK-1")
+	archive := backup(t, src.svc)
+
+	dst := newFixture(t, failingStorage{memory.NewProductStorage()}, "old@example.com")
+	_, err := dst.svc.Restore(ctx, bytes.NewReader(archive), false)
+	require.Error(t, err)
+	assert.False(t, IsErrInvalidArchive(err))
+
+	// The users replaced before the products failed are put back.
+	assert.True(t, dst.canLogin("old@example.com"))
+	assert.False(t, dst.canLogin("a@example.com"))
+}
+
+func TestServiceHeldStock(t *testing.T) {
+	ctx := context.Background()
+	src := newFixture(t, memory.NewProductStorage(), "a@example.com")
+	src.addProduct(t, "BK-1")
+	_, err := src.warehouses.CreateWarehouse(ctx, warehouse.Warehouse{Code: "north", Name: "North"})
+	require.NoError(t, err)
+	r, err := src.reservations.Reserve(ctx, []product.StockItem{{SKU: "BK-1", Quantity: 1}}, time.Hour, "cart-1")
+	require.NoError(t, err)
+	tr, err := src.warehouses.CreateTransfer(ctx, product.DefaultLocation, "north", []product.StockItem{{SKU: "BK-1", Quantity: 2}}, "")
+	require.NoError(t, err)
+	_, err = src.warehouses.Ship(ctx, tr.ID)
+	require.NoError(t, err)
+
+	// Stock held and in transit is archived with its reservation and
+	// transfer, while serving traffic.
+	archive := backup(t, src.svc)
+
+	dst := newFixture(t, memory.NewProductStorage())
+	dst.addProduct(t, "BK-1")
+	dropped, err := dst.reservations.Reserve(ctx, []product.StockItem{{SKU: "BK-1", Quantity: 1}}, time.Hour, "cart-2")
+	require.NoError(t, err)
+
+	// The reservations which a restore ends are reported, also on a dry
+	// run.
+	res, err := dst.svc.Restore(ctx, bytes.NewReader(archive), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dropped.ID}, res.DroppedReservations)
+	assert.Empty(t, res.DroppedTransfers)
+	res, err = dst.svc.Restore(ctx, bytes.NewReader(archive), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dropped.ID}, res.DroppedReservations)
+
+	p, err := dst.products.GetProduct(ctx, "BK-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), p.Reserved)
+	assert.Equal(t, uint32(2), p.InTransit)
+	_, err = dst.reservations.Get(ctx, dropped.ID)
+	assert.True(t, reservation.IsErrNotFound(err))
+
+	// The restored reservation and transfer carry on.
+	_, err = dst.reservations.Confirm(ctx, r.ID)
+	require.NoError(t, err)
+	_, err = dst.warehouses.Receive(ctx, tr.ID)
+	require.NoError(t, err)
+	p, err = dst.products.GetProduct(ctx, "BK-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), p.Quantity)
+	assert.Equal(t, []product.StockLevel{{Location: "north", Quantity: 2}}, p.Levels)
+
+	// Archives of older servers end the transfers and reservations.
+	_, err = dst.reservations.Reserve(ctx, []product.StockItem{{SKU: "BK-1", Quantity: 1}}, time.Hour, "cart-3")
+	require.NoError(t, err)
+	files := entries(t, archive)
+	v2 := map[string][]byte{
+		"users.ndjson":    files["users.ndjson"],
+		"products.ndjson": []byte(`{"sku":"BK-1","name":"Tea","qty":3,"price":10,"unit":"Box","status":0}` + "\n"),
+	}
+	v2["manifest.json"] = manifestOf(t, 2, v2)
+	res, err = dst.svc.Restore(ctx, bytes.NewReader(repack(t, []string{"manifest.json", "users.ndjson", "products.ndjson"}, v2)), false)
+	require.NoError(t, err)
+	assert.Len(t, res.DroppedReservations, 1)
+	_, err = dst.warehouses.GetWarehouse(ctx, "north")
+	require.NoError(t, err)
+
+	// Stock in transit must belong to a transfer in transit.
+	v1 := map[string][]byte{
+		"users.ndjson":    files["users.ndjson"],
+		"products.ndjson": bytes.Replace(v2["products.ndjson"], []byte(`"qty":3`), []byte(`"qty":3,"in_transit":1`), 1),
+	}
+	v1["manifest.json"] = manifestOf(t, 1, v1)
+	_, err = dst.svc.Restore(ctx, bytes.NewReader(repack(t, []string{"manifest.json", "users.ndjson", "products.ndjson"}, v1)), true)
+	assert.True(t, IsErrInvalidArchive(err))
+
+	// Without the services of reservations and transfers, the stock they
+	// hold cannot be archived nor restored.
+	bare := NewService(src.users, src.products)
+	_, err = bare.Backup(ctx, io.Discard)
+	assert.True(t, IsErrPending(err))
+	_, err = bare.Restore(ctx, bytes.NewReader(archive), false)
+	assert.True(t, IsErrPending(err))
+}
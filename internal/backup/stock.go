@@ -0,0 +1,310 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/warehouse"
+)
+
+type itemRecord struct {
+	SKU      string `json:"sku"`
+	Quantity uint32 `json:"qty"`
+}
+
+type warehouseRecord struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type transferRecord struct {
+	ID          string       `json:"id"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Items       []itemRecord `json:"items"`
+	Reference   string       `json:"reference,omitempty"`
+	Status      string       `json:"status"`
+	CreatedBy   string       `json:"created_by,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ShippedAt   *time.Time   `json:"shipped_at,omitempty"`
+	ReceivedAt  *time.Time   `json:"received_at,omitempty"`
+	CancelledAt *time.Time   `json:"cancelled_at,omitempty"`
+}
+
+type reservationRecord struct {
+	ID         string       `json:"id"`
+	Items      []itemRecord `json:"items"`
+	Reference  string       `json:"reference,omitempty"`
+	Status     string       `json:"status"`
+	CreatedBy  string       `json:"created_by,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+func itemRecords(items []product.StockItem) []itemRecord {
+	ret := make([]itemRecord, 0, len(items))
+	for _, it := range items {
+		ret = append(ret, itemRecord{SKU: it.SKU, Quantity: it.Quantity})
+	}
+	return ret
+}
+
+func stockItems(records []itemRecord) ([]product.StockItem, error) {
+	items := make([]product.StockItem, 0, len(records))
+	for _, rec := range records {
+		items = append(items, product.StockItem{SKU: rec.SKU, Quantity: rec.Quantity})
+	}
+	if err := product.ValidateStockItems(items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// timeRecord is t, nil when zero.
+func timeRecord(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOf(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// stock is the warehouses, transfers and reservations of an archive. A nil
+// slice is an entry missing from the archive.
+type stock struct {
+	warehouses   []warehouse.Warehouse
+	transfers    []warehouse.Transfer
+	reservations []reservation.Reservation
+}
+
+func stockEntries(warehouses []warehouse.Warehouse, transfers []warehouse.Transfer, reservations []reservation.Reservation) ([]entry, error) {
+	var entries []entry
+	if warehouses != nil {
+		records := make([]interface{}, 0, len(warehouses))
+		for _, w := range warehouses {
+			records = append(records, warehouseRecord{Code: w.Code, Name: w.Name, CreatedAt: w.CreatedAt})
+		}
+		data, err := encodeNDJSON(records)
+		if err != nil {
+			return nil, fmt.Errorf("encode warehouses: %w", err)
+		}
+		entries = append(entries, entry{name: warehousesName, records: len(records), data: data})
+
+		records = make([]interface{}, 0, len(transfers))
+		for _, t := range transfers {
+			records = append(records, transferRecord{
+				ID:          t.ID,
+				From:        t.From,
+				To:          t.To,
+				Items:       itemRecords(t.Items),
+				Reference:   t.Reference,
+				Status:      string(t.Status),
+				CreatedBy:   t.CreatedBy,
+				CreatedAt:   t.CreatedAt,
+				ShippedAt:   timeRecord(t.ShippedAt),
+				ReceivedAt:  timeRecord(t.ReceivedAt),
+				CancelledAt: timeRecord(t.CancelledAt),
+			})
+		}
+		data, err = encodeNDJSON(records)
+		if err != nil {
+			return nil, fmt.Errorf("encode transfers: %w", err)
+		}
+		entries = append(entries, entry{name: transfersName, records: len(records), data: data})
+	}
+	if reservations != nil {
+		records := make([]interface{}, 0, len(reservations))
+		for _, r := range reservations {
+			records = append(records, reservationRecord{
+				ID:         r.ID,
+				Items:      itemRecords(r.Items),
+				Reference:  r.Reference,
+				Status:     string(r.Status),
+				CreatedBy:  r.CreatedBy,
+				CreatedAt:  r.CreatedAt,
+				ExpiresAt:  r.ExpiresAt,
+				FinishedAt: timeRecord(r.FinishedAt),
+			})
+		}
+		data, err := encodeNDJSON(records)
+		if err != nil {
+			return nil, fmt.Errorf("encode reservations: %w", err)
+		}
+		entries = append(entries, entry{name: reservationsName, records: len(records), data: data})
+	}
+	return entries, nil
+}
+
+// decodeStock decodes the warehouses, transfers and reservations of an
+// archive, each of which may be missing. Transfers need the warehouses.
+func decodeStock(m *Manifest, files map[string][]byte) (stock, error) {
+	var st stock
+
+	if f, _ := m.file(warehousesName); f != nil {
+		st.warehouses = []warehouse.Warehouse{}
+		codes := make(map[string]struct{})
+		err := decodeNDJSON(*f, files[warehousesName], func(dec *json.Decoder) error {
+			var rec warehouseRecord
+			if err := dec.Decode(&rec); err != nil {
+				return err
+			}
+			w := warehouse.Warehouse{Code: rec.Code, Name: rec.Name, CreatedAt: rec.CreatedAt}
+			if err := w.Validate(); err != nil {
+				return err
+			}
+			if _, dup := codes[w.Code]; dup {
+				return fmt.Errorf("duplicated warehouse %q", w.Code)
+			}
+			codes[w.Code] = struct{}{}
+			st.warehouses = append(st.warehouses, w)
+			return nil
+		})
+		if err != nil {
+			return stock{}, err
+		}
+		codes[product.DefaultLocation] = struct{}{}
+
+		f, _ := m.file(transfersName)
+		if f == nil {
+			return stock{}, fmt.Errorf("entry %q missing - %w", transfersName, ErrInvalidArchive)
+		}
+		st.transfers = []warehouse.Transfer{}
+		ids := make(map[string]struct{})
+		err = decodeNDJSON(*f, files[transfersName], func(dec *json.Decoder) error {
+			var rec transferRecord
+			if err := dec.Decode(&rec); err != nil {
+				return err
+			}
+			switch warehouse.TransferStatus(rec.Status) {
+			case warehouse.TransferPending, warehouse.TransferInTransit, warehouse.TransferReceived, warehouse.TransferCancelled:
+			default:
+				return fmt.Errorf("transfer %q: unknown status %q", rec.ID, rec.Status)
+			}
+			if rec.ID == "" {
+				return errors.New("empty transfer id")
+			}
+			if _, dup := ids[rec.ID]; dup {
+				return fmt.Errorf("duplicated transfer %q", rec.ID)
+			}
+			ids[rec.ID] = struct{}{}
+			for _, code := range []string{rec.From, rec.To} {
+				if _, ok := codes[code]; !ok {
+					return fmt.Errorf("transfer %q: unknown warehouse %q", rec.ID, code)
+				}
+			}
+			items, err := stockItems(rec.Items)
+			if err != nil {
+				return fmt.Errorf("transfer %q: %v", rec.ID, err)
+			}
+			st.transfers = append(st.transfers, warehouse.Transfer{
+				ID:          rec.ID,
+				From:        rec.From,
+				To:          rec.To,
+				Items:       items,
+				Reference:   rec.Reference,
+				Status:      warehouse.TransferStatus(rec.Status),
+				CreatedBy:   rec.CreatedBy,
+				CreatedAt:   rec.CreatedAt,
+				ShippedAt:   timeOf(rec.ShippedAt),
+				ReceivedAt:  timeOf(rec.ReceivedAt),
+				CancelledAt: timeOf(rec.CancelledAt),
+			})
+			return nil
+		})
+		if err != nil {
+			return stock{}, err
+		}
+	}
+
+	if f, _ := m.file(reservationsName); f != nil {
+		st.reservations = []reservation.Reservation{}
+		ids := make(map[string]struct{})
+		err := decodeNDJSON(*f, files[reservationsName], func(dec *json.Decoder) error {
+			var rec reservationRecord
+			if err := dec.Decode(&rec); err != nil {
+				return err
+			}
+			switch reservation.Status(rec.Status) {
+			case reservation.StatusPending, reservation.StatusConfirmed, reservation.StatusCancelled, reservation.StatusExpired:
+			default:
+				return fmt.Errorf("reservation %q: unknown status %q", rec.ID, rec.Status)
+			}
+			if rec.ID == "" {
+				return errors.New("empty reservation id")
+			}
+			if _, dup := ids[rec.ID]; dup {
+				return fmt.Errorf("duplicated reservation %q", rec.ID)
+			}
+			ids[rec.ID] = struct{}{}
+			items, err := stockItems(rec.Items)
+			if err != nil {
+				return fmt.Errorf("reservation %q: %v", rec.ID, err)
+			}
+			st.reservations = append(st.reservations, reservation.Reservation{
+				ID:         rec.ID,
+				Items:      items,
+				Reference:  rec.Reference,
+				Status:     reservation.Status(rec.Status),
+				CreatedBy:  rec.CreatedBy,
+				CreatedAt:  rec.CreatedAt,
+				ExpiresAt:  rec.ExpiresAt,
+				FinishedAt: timeOf(rec.FinishedAt),
+			})
+			return nil
+		})
+		if err != nil {
+			return stock{}, err
+		}
+	}
+	return st, nil
+}
+
+// checkHeld checks the stock of products held or in transit belongs to the
+// pending reservations and the transfers in transit of st.
+func checkHeld(products []product.Product, st stock) error {
+	held := make(map[string]map[string]uint32)
+	for _, r := range st.reservations {
+		if r.Status != reservation.StatusPending {
+			continue
+		}
+		for _, it := range r.Items {
+			if held[it.SKU] == nil {
+				held[it.SKU] = make(map[string]uint32)
+			}
+			held[it.SKU][r.ID] = it.Quantity
+		}
+	}
+	shipped := make(map[string]uint64)
+	for _, t := range st.transfers {
+		if t.Status != warehouse.TransferInTransit {
+			continue
+		}
+		for _, it := range t.Items {
+			shipped[it.SKU] += uint64(it.Quantity)
+		}
+	}
+
+	for _, p := range products {
+		for _, h := range p.Holds {
+			if q, ok := held[p.SKU][h.ID]; !ok || h.Quantity > q {
+				return fmt.Errorf("sku %q: %d held by %q, not a pending reservation of it - %w", p.SKU, h.Quantity, h.ID, ErrInvalidArchive)
+			}
+		}
+		if uint64(p.InTransit) > shipped[p.SKU] {
+			return fmt.Errorf("sku %q: %d in transit, %d in the transfers in transit - %w", p.SKU, p.InTransit, shipped[p.SKU], ErrInvalidArchive)
+		}
+	}
+	return nil
+}
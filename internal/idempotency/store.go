@@ -0,0 +1,269 @@
+// Package idempotency remembers the responses of requests by idempotency key,
+// so that retries of a request get the response of the first attempt instead
+// of running again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long responses are remembered by default.
+	DefaultTTL = 24 * time.Hour
+	// DefaultMaxKeys is how many keys are remembered per caller by default.
+	DefaultMaxKeys = 1000
+	// DefaultMaxBodySize is the size of the largest response body
+	// remembered by default.
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	ErrKeyReused = errors.New("idempotency key reused with another request")
+	// ErrTooManyKeys is returned when every key of a caller is held by a
+	// running request.
+	ErrTooManyKeys = errors.New("too many idempotency keys in use")
+	// ErrNotKept is returned for a key whose request completed with a
+	// response too large to be kept.
+	ErrNotKept = errors.New("idempotency key response not kept")
+)
+
+// Response is a recorded response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	// seq orders the entries of a caller by age.
+	seq uint64
+	// done is closed once the request holding the key completed or released
+	// it.
+	done    chan struct{}
+	resp    *Response
+	expires time.Time
+	// notKept is set when the request completed with a response larger
+	// than maxBody.
+	notKept bool
+}
+
+func (e *entry) completed() bool {
+	return e.resp != nil || e.notKept
+}
+
+// Store keeps responses in memory, per caller and key, for its TTL. Keys are
+// lost on restart.
+type Store struct {
+	ttl     time.Duration
+	maxKeys int
+	maxBody int
+	now     func() time.Time
+
+	mu sync.Mutex
+	// entries are the keys of each caller.
+	entries   map[string]map[string]*entry
+	seq       uint64
+	lastSweep time.Time
+}
+
+type Option func(s *Store)
+
+// WithMaxKeys sets how many keys are remembered per caller. The oldest
+// response of a caller is forgotten to make room for a new key.
+func WithMaxKeys(n int) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxKeys = n
+		}
+	}
+}
+
+// WithMaxBodySize sets the size of the largest response body remembered.
+func WithMaxBodySize(n int) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxBody = n
+		}
+	}
+}
+
+func NewStore(ttl time.Duration, opts ...Option) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	s := &Store{
+		ttl:     ttl,
+		maxKeys: DefaultMaxKeys,
+		maxBody: DefaultMaxBodySize,
+		now:     time.Now,
+		entries: make(map[string]map[string]*entry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// MaxBodySize is the size of the largest response body remembered.
+func (s *Store) MaxBodySize() int {
+	return s.maxBody
+}
+
+// Begin claims key for a request of caller identified by fingerprint, a
+// digest of what makes two requests the same.
+//
+// When a response was recorded for the key it is returned. When another
+// request holds the key, Begin waits for it to finish first. Otherwise the
+// key is claimed: the request runs and completes or releases the claim.
+// A key used with another fingerprint fails with ErrKeyReused, a key whose
+// response was too large to keep with ErrNotKept.
+func (s *Store) Begin(ctx context.Context, caller, key, fingerprint string) (*Response, *Claim, error) {
+	for {
+		s.mu.Lock()
+		now := s.now()
+		s.sweep(now)
+		keys := s.entries[caller]
+		e, ok := keys[key]
+		if ok && e.completed() && !now.Before(e.expires) {
+			delete(keys, key)
+			ok = false
+		}
+		if !ok {
+			if keys == nil {
+				keys = make(map[string]*entry)
+				s.entries[caller] = keys
+			}
+			if len(keys) >= s.maxKeys && !s.evict(keys) {
+				s.mu.Unlock()
+				return nil, nil, fmt.Errorf("%d keys running: %w", len(keys), ErrTooManyKeys)
+			}
+			s.seq++
+			e = &entry{fingerprint: fingerprint, seq: s.seq, done: make(chan struct{})}
+			keys[key] = e
+			s.mu.Unlock()
+			return nil, &Claim{s: s, caller: caller, key: key, e: e}, nil
+		}
+		resp, notKept := e.resp, e.notKept
+		s.mu.Unlock()
+
+		if e.fingerprint != fingerprint {
+			return nil, nil, fmt.Errorf("key %q: %w", key, ErrKeyReused)
+		}
+		if notKept {
+			return nil, nil, fmt.Errorf("key %q: %w", key, ErrNotKept)
+		}
+		if resp != nil {
+			return resp, nil, nil
+		}
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// evict forgets the oldest completed key of keys. It reports false when
+// every key is held by a running request. It must be called with mu held.
+func (s *Store) evict(keys map[string]*entry) bool {
+	var oldest string
+	var found *entry
+	for k, e := range keys {
+		if e.completed() && (found == nil || e.seq < found.seq) {
+			oldest, found = k, e
+		}
+	}
+	if found == nil {
+		return false
+	}
+	delete(keys, oldest)
+	return true
+}
+
+// sweep drops the expired responses, at most once per minute.
+func (s *Store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for caller, keys := range s.entries {
+		for k, e := range keys {
+			if e.completed() && !now.Before(e.expires) {
+				delete(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			delete(s.entries, caller)
+		}
+	}
+}
+
+// Claim is a key held by a running request.
+type Claim struct {
+	s      *Store
+	caller string
+	key    string
+	e      *entry
+	once   sync.Once
+}
+
+// Complete records resp as the response of the key. A response with a body
+// larger than the store keeps is not recorded, and retries of the key fail
+// with ErrNotKept until it expires.
+func (c *Claim) Complete(resp Response) {
+	c.once.Do(func() {
+		c.s.mu.Lock()
+		if len(resp.Body) > c.s.maxBody {
+			c.e.notKept = true
+		} else {
+			c.e.resp = &resp
+		}
+		c.e.expires = c.s.now().Add(c.s.ttl)
+		c.s.mu.Unlock()
+		close(c.e.done)
+	})
+}
+
+// Discard records the request completed without keeping its response, e.g.
+// when its body was too large: retries of the key fail with ErrNotKept
+// until it expires.
+func (c *Claim) Discard() {
+	c.once.Do(func() {
+		c.s.mu.Lock()
+		c.e.notKept = true
+		c.e.expires = c.s.now().Add(c.s.ttl)
+		c.s.mu.Unlock()
+		close(c.e.done)
+	})
+}
+
+// Release frees the key without a response, e.g. after a server error, so
+// that a retry runs again.
+func (c *Claim) Release() {
+	c.once.Do(func() {
+		c.s.mu.Lock()
+		if keys := c.s.entries[c.caller]; keys[c.key] == c.e {
+			delete(keys, c.key)
+		}
+		c.s.mu.Unlock()
+		close(c.e.done)
+	})
+}
+
+func IsErrKeyReused(err error) bool {
+	return errors.Is(err, ErrKeyReused)
+}
+
+func IsErrTooManyKeys(err error) bool {
+	return errors.Is(err, ErrTooManyKeys)
+}
+
+func IsErrNotKept(err error) bool {
+	return errors.Is(err, ErrNotKept)
+}
@@ -0,0 +1,153 @@
+package idempotency_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/idempotency"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	created := Response{Status: http.StatusCreated, Header: http.Header{"Location": {"/a"}}, Body: []byte(`{}`)}
+
+	t.Run("replays", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewStore(time.Hour)
+		resp, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+		claim.Complete(created)
+
+		resp, claim, err = s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+		assert.Nil(t, claim)
+		assert.Equal(t, &created, resp)
+
+		_, _, err = s.Begin(ctx, "ann", "k1", "add b")
+		assert.True(t, IsErrKeyReused(err))
+
+		// Keys belong to their caller.
+		resp, claim, err = s.Begin(ctx, "bob", "k1", "add b")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+		assert.NotNil(t, claim)
+	})
+
+	t.Run("released keys run again", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewStore(time.Hour)
+		_, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+		claim.Release()
+
+		resp, claim, err := s.Begin(ctx, "ann", "k1", "add b")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+		assert.NotNil(t, claim)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewStore(10 * time.Millisecond)
+		_, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+		claim.Complete(created)
+
+		time.Sleep(20 * time.Millisecond)
+		resp, claim, err := s.Begin(ctx, "ann", "k1", "add b")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+		assert.NotNil(t, claim)
+	})
+
+	t.Run("duplicates wait for the request in flight", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewStore(time.Hour)
+		_, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+				assert.NoError(t, err)
+				assert.Nil(t, claim)
+				assert.Equal(t, &created, resp)
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		claim.Complete(created)
+		wg.Wait()
+
+		_, claim, err = s.Begin(ctx, "ann", "k2", "add a")
+		require.NoError(t, err)
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, _, err = s.Begin(timeout, "ann", "k2", "add a")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		claim.Release()
+	})
+
+	t.Run("keeps at most max keys per caller", func(t *testing.T) {
+		t.Parallel()
+		s := NewStore(time.Hour, WithMaxKeys(2))
+		for _, key := range []string{"k1", "k2", "k3"} {
+			_, claim, err := s.Begin(ctx, "ann", key, "add "+key)
+			require.NoError(t, err)
+			claim.Complete(created)
+		}
+
+		// k1, the oldest, was forgotten to keep k3.
+		resp, claim, err := s.Begin(ctx, "ann", "k1", "add other")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+		require.NotNil(t, claim)
+		resp, _, err = s.Begin(ctx, "ann", "k3", "add k3")
+		require.NoError(t, err)
+		assert.Equal(t, &created, resp)
+
+		// Running keys are never forgotten.
+		_, other, err := s.Begin(ctx, "ann", "k4", "add k4")
+		require.NoError(t, err)
+		_, _, err = s.Begin(ctx, "ann", "k5", "add k5")
+		assert.True(t, IsErrTooManyKeys(err))
+		claim.Release()
+		other.Release()
+
+		// Other callers have their own keys.
+		_, _, err = s.Begin(ctx, "bob", "k5", "add k5")
+		assert.NoError(t, err)
+	})
+
+	t.Run("large responses are not kept", func(t *testing.T) {
+		t.Parallel()
+		s := NewStore(time.Hour, WithMaxBodySize(1))
+		_, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		require.NoError(t, err)
+		claim.Complete(created)
+
+		resp, claim, err := s.Begin(ctx, "ann", "k1", "add a")
+		assert.True(t, IsErrNotKept(err))
+		assert.Nil(t, resp)
+		assert.Nil(t, claim)
+
+		_, claim, err = s.Begin(ctx, "ann", "k2", "add a")
+		require.NoError(t, err)
+		claim.Discard()
+		_, _, err = s.Begin(ctx, "ann", "k2", "add a")
+		assert.True(t, IsErrNotKept(err))
+	})
+}
@@ -0,0 +1,108 @@
+// Package inventory keeps the ledger of the stock movements of the products,
+// why, by whom and from where their quantity changed.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sampleBackend/internal/product"
+)
+
+const (
+	DefaultMovementLimit = 50
+	MaxMovementLimit     = 500
+)
+
+var ErrInvalidOptions = errors.New("invalid movement options")
+
+// Entry is a movement of the stock of a product at Location, recorded from
+// the change of the catalog which made it. Seq orders the entries of the
+// ledger, a change may make several. Quantity is the stock after the change
+// across every location, Version the version of the product, both 0 once
+// purged.
+type Entry struct {
+	Seq       uint64
+	SKU       string
+	Kind      product.MovementKind
+	Delta     int64
+	Location  string
+	Quantity  uint32
+	Reason    string
+	Reference string
+	Version   uint64
+	User      string
+	IP        string
+	Time      time.Time
+}
+
+type Storage interface {
+	// Append records entries, ordered by Seq.
+	Append(ctx context.Context, entries []Entry) error
+	// Movements returns up to limit entries of sku with a Seq below before,
+	// newest first. A zero before starts from the newest entry.
+	Movements(ctx context.Context, sku string, before uint64, limit int) ([]Entry, error)
+}
+
+// MovementOptions selects a page of the movements of a product. Cursor is
+// the Next of the previous page.
+type MovementOptions struct {
+	Cursor string
+	Limit  int
+}
+
+type Page struct {
+	Entries []Entry
+	Next    string
+}
+
+// NewEntries returns the entries recording the movements of c, none when c
+// did not move the stock. Their Seq is left to the ledger.
+func NewEntries(c product.Change) []Entry {
+	if c.Op == product.ChangeReset {
+		var entries []Entry
+		for _, r := range c.Resets {
+			entries = append(entries, newEntries(c, r.SKU, r.Quantity, r.Version, r.Movements)...)
+		}
+		return entries
+	}
+	var (
+		qty     uint32
+		version uint64
+	)
+	if c.After != nil {
+		qty, version = c.After.Quantity, c.After.Version
+	}
+	return newEntries(c, c.SKU, qty, version, product.MovementsOf(c))
+}
+
+// newEntries returns the entries of the movements of sku made by c, after
+// which it has qty at version.
+func newEntries(c product.Change, sku string, qty uint32, version uint64, movements []product.Movement) []Entry {
+	entries := make([]Entry, 0, len(movements))
+	for _, m := range movements {
+		location := m.Location
+		if location == "" {
+			location = product.DefaultLocation
+		}
+		entries = append(entries, Entry{
+			SKU:       sku,
+			Kind:      m.Kind,
+			Delta:     m.Delta,
+			Location:  location,
+			Quantity:  qty,
+			Reason:    m.Reason,
+			Reference: m.Reference,
+			Version:   version,
+			User:      c.Actor.User,
+			IP:        c.Actor.IP,
+			Time:      c.Time,
+		})
+	}
+	return entries
+}
+
+func IsErrInvalidOptions(err error) bool {
+	return errors.Is(err, ErrInvalidOptions)
+}
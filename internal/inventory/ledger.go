@@ -0,0 +1,71 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"sampleBackend/internal/journal"
+	"sampleBackend/internal/product"
+)
+
+// Ledger records the stock movements of the catalog. Its Record is a
+// product.ChangeHook of the product service, so every movement is recorded
+// before the write making it returns.
+type Ledger struct {
+	storage Storage
+	journal *journal.Journal
+
+	// mu numbers the entries in the order they are appended.
+	mu  sync.Mutex
+	seq uint64
+}
+
+func NewLedger(s Storage) *Ledger {
+	return &Ledger{
+		storage: s,
+		journal: journal.New("inventory"),
+	}
+}
+
+// Record records the movements of c, if any.
+func (l *Ledger) Record(c product.Change) {
+	entries := NewEntries(c)
+	if len(entries) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range entries {
+		l.seq++
+		entries[i].Seq = l.seq
+	}
+	l.journal.Append(func(ctx context.Context) error {
+		return l.storage.Append(ctx, entries)
+	})
+}
+
+// Movements returns the page of the movements of sku selected by opts,
+// newest first.
+func (l *Ledger) Movements(ctx context.Context, sku string, opts MovementOptions) (*Page, error) {
+	before, limit, err := journal.Page(opts.Cursor, opts.Limit, DefaultMovementLimit, MaxMovementLimit, ErrInvalidOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.journal.Flush(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := l.storage.Movements(ctx, sku, before, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("read movements: %w", err)
+	}
+
+	page := &Page{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.Next = journal.Cursor(page.Entries[limit-1].Seq)
+	}
+	return page, nil
+}
@@ -0,0 +1,179 @@
+package inventory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/inventory"
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+// failingStorage fails every append while failing is set.
+type failingStorage struct {
+	*memory.LedgerStorage
+	failing bool
+}
+
+func (s *failingStorage) Append(ctx context.Context, entries []Entry) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	return s.LedgerStorage.Append(ctx, entries)
+}
+
+func TestLedgerMovements(t *testing.T) {
+	ctx := context.Background()
+	// Movements are recorded with their write, the retention of the change
+	// stream loses none.
+	l := NewLedger(memory.NewLedgerStorage())
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeRetention(1, 0), product.WithChangeHooks(l.Record))
+
+	clerk := product.WithActor(ctx, product.Actor{User: "clerk@gmail.com", IP: "10.0.0.1"})
+	p := product.Product{SKU: "L-1", Name: "Tea", Quantity: 5, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	_, err := svc.AddProduct(ctx, p)
+	require.NoError(t, err)
+	_, err = svc.MoveStock(clerk, "L-1", product.Movement{Kind: product.MovementSale, Delta: -2, Reason: "order", Reference: "SO-1"}, 0)
+	require.NoError(t, err)
+	// Writes leaving the quantity alone are no movement.
+	_, err = svc.SetStatus(ctx, "L-1", product.StatusActive, 0)
+	require.NoError(t, err)
+	p.Quantity = 10
+	_, err = svc.UpdateProduct(ctx, p)
+	require.NoError(t, err)
+
+	page, err := l.Movements(ctx, "L-1", MovementOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, product.MovementAdjustment, page.Entries[0].Kind)
+	assert.Equal(t, product.ReasonOverwrite, page.Entries[0].Reason)
+	assert.Equal(t, int64(7), page.Entries[0].Delta)
+	assert.Equal(t, uint32(10), page.Entries[0].Quantity)
+	sale := page.Entries[1]
+	assert.Equal(t, product.MovementSale, sale.Kind)
+	assert.Equal(t, int64(-2), sale.Delta)
+	assert.Equal(t, uint32(3), sale.Quantity)
+	assert.Equal(t, "SO-1", sale.Reference)
+	assert.Equal(t, "clerk@gmail.com", sale.User)
+	assert.Equal(t, "10.0.0.1", sale.IP)
+	assert.Equal(t, uint64(2), sale.Version)
+
+	page, err = l.Movements(ctx, "L-1", MovementOptions{Cursor: page.Next, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, product.ReasonInitial, page.Entries[0].Reason)
+	assert.Equal(t, int64(5), page.Entries[0].Delta)
+	assert.Empty(t, page.Next)
+
+	_, err = l.Movements(ctx, "L-1", MovementOptions{Cursor: "%%"})
+	assert.True(t, IsErrInvalidOptions(err))
+	_, err = l.Movements(ctx, "L-1", MovementOptions{Limit: MaxMovementLimit + 1})
+	assert.True(t, IsErrInvalidOptions(err))
+}
+
+func TestLedgerPending(t *testing.T) {
+	ctx := context.Background()
+	s := &failingStorage{LedgerStorage: memory.NewLedgerStorage(), failing: true}
+	l := NewLedger(s)
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(l.Record))
+
+	_, err := svc.AddProduct(ctx, product.Product{SKU: "L-1", Name: "Tea", Quantity: 5, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	_, err = l.Movements(ctx, "L-1", MovementOptions{})
+	assert.Error(t, err)
+
+	// Movements the storage failed to append are kept until it succeeds.
+	s.failing = false
+	page, err := l.Movements(ctx, "L-1", MovementOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, product.ReasonInitial, page.Entries[0].Reason)
+}
+
+func TestLedgerSaleAcrossLocations(t *testing.T) {
+	ctx := context.Background()
+	l := NewLedger(memory.NewLedgerStorage())
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(l.Record))
+
+	_, err := svc.AddProduct(ctx, product.Product{SKU: "L-1", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	_, err = svc.MoveStock(ctx, "L-1", product.Movement{Kind: product.MovementReceipt, Delta: 5, Reason: "purchase", Location: "north"}, 0)
+	require.NoError(t, err)
+	items := []product.StockItem{{SKU: "L-1", Quantity: 12}}
+	require.NoError(t, svc.ReserveStock(ctx, items, "r-1"))
+	require.NoError(t, svc.CommitStock(ctx, items, "r-1"))
+
+	// A sale taking from two locations is two entries, paged apart.
+	page, err := l.Movements(ctx, "L-1", MovementOptions{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "north", page.Entries[0].Location)
+	assert.Equal(t, int64(-2), page.Entries[0].Delta)
+	assert.Equal(t, uint32(3), page.Entries[0].Quantity)
+	page, err = l.Movements(ctx, "L-1", MovementOptions{Cursor: page.Next, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, product.DefaultLocation, page.Entries[0].Location)
+	assert.Equal(t, int64(-10), page.Entries[0].Delta)
+}
+
+// sum returns the sum of the movements of sku, which must match its stock.
+func sum(t *testing.T, l *Ledger, sku string) int64 {
+	t.Helper()
+
+	page, err := l.Movements(context.Background(), sku, MovementOptions{Limit: MaxMovementLimit})
+	require.NoError(t, err)
+	var total int64
+	for _, e := range page.Entries {
+		total += e.Delta
+	}
+	return total
+}
+
+func TestLedgerPurgeAndRestore(t *testing.T) {
+	ctx := context.Background()
+	l := NewLedger(memory.NewLedgerStorage())
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeHooks(l.Record))
+
+	p := product.Product{SKU: "L-1", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	_, err := svc.AddProduct(ctx, p)
+	require.NoError(t, err)
+	_, err = svc.MoveStock(ctx, "L-1", product.Movement{Kind: product.MovementReceipt, Delta: 5, Reason: "purchase", Location: "north"}, 0)
+	require.NoError(t, err)
+
+	// A purge takes out the stock left at every location.
+	require.NoError(t, svc.DeleteProduct(ctx, "L-1", 0, ""))
+	n, err := svc.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	assert.Equal(t, int64(0), sum(t, l, "L-1"))
+	p.Quantity = 4
+	_, err = svc.AddProduct(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), sum(t, l, "L-1"))
+
+	// A restore moves the stock to the restored one.
+	snapshot, err := svc.Snapshot(ctx)
+	require.NoError(t, err)
+	_, err = svc.MoveStock(ctx, "L-1", product.Movement{Kind: product.MovementSale, Delta: -3, Reason: "order"}, 0)
+	require.NoError(t, err)
+	p.SKU = "L-2"
+	_, err = svc.AddProduct(ctx, p)
+	require.NoError(t, err)
+	f := svc.Freeze()
+	require.NoError(t, f.Restore(ctx, snapshot))
+	f.Thaw()
+
+	assert.Equal(t, int64(4), sum(t, l, "L-1"))
+	assert.Equal(t, int64(0), sum(t, l, "L-2"))
+	page, err := l.Movements(ctx, "L-2", MovementOptions{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, product.ReasonReset, page.Entries[0].Reason)
+	assert.Equal(t, uint32(0), page.Entries[0].Quantity)
+}
@@ -0,0 +1,107 @@
+// Package job runs long tasks in the background. Jobs are recorded in a
+// Storage, so their outcome outlives the request that submitted them and,
+// with a persistent storage, a restart of the server.
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrFinished    = errors.New("job already finished")
+	ErrNoOutput    = errors.New("job has no output")
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Finished reports whether a job in status s will not change anymore.
+func (s Status) Finished() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Progress counts the units of work of a job, Total is 0 while unknown.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Output describes the file produced by a job.
+type Output struct {
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+}
+
+// Job is the record of a job. Params and Result are JSON documents owned by
+// the handler of Kind.
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     Status          `json:"status"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	HasInput   bool            `json:"has_input,omitempty"`
+	Progress   Progress        `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Output     *Output         `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Attempts   int             `json:"attempts"`
+	CreatedBy  string          `json:"created_by,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Blob is a file attached to a job: its input or its output.
+type Blob interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+type Storage interface {
+	Create(ctx context.Context, j Job) error
+	Get(ctx context.Context, id string) (*Job, error)
+	Update(ctx context.Context, j Job) error
+	// List returns every job ordered by creation.
+	List(ctx context.Context) ([]Job, error)
+	// CreateBlob returns a writer of the blob name of job id, replacing any
+	// previous one once closed.
+	CreateBlob(ctx context.Context, id, name string) (io.WriteCloser, error)
+	OpenBlob(ctx context.Context, id, name string) (Blob, error)
+	// Delete removes the record of job id and its blobs.
+	Delete(ctx context.Context, id string) error
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrUnknownKind(err error) bool {
+	return errors.Is(err, ErrUnknownKind)
+}
+
+func IsErrFinished(err error) bool {
+	return errors.Is(err, ErrFinished)
+}
+
+func IsErrNoOutput(err error) bool {
+	return errors.Is(err, ErrNoOutput)
+}
@@ -0,0 +1,541 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"sampleBackend/internal/storage"
+)
+
+const (
+	inputBlob  = "input"
+	outputBlob = "output"
+
+	defaultWorkers      = 2
+	defaultDrainTimeout = 30 * time.Second
+	// maxAttempts bounds how often a resumable job is started again after
+	// being interrupted.
+	maxAttempts = 3
+)
+
+var (
+	errInterrupted = errors.New("interrupted by a restart")
+	errAborted     = errors.New("aborted by shutdown")
+)
+
+// Handler runs the jobs of a kind. The value returned by Run is recorded as
+// the result of the job, as JSON.
+type Handler struct {
+	Run func(ctx context.Context, t *Task) (interface{}, error)
+	// Resumable handlers can run a job again from the start after a restart
+	// or a shutdown interrupted it. Jobs of other handlers fail instead.
+	Resumable bool
+}
+
+type Option func(s *Service)
+
+// WithWorkers sets how many jobs run at the same time.
+func WithWorkers(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithDrainTimeout sets how long Run waits for running jobs once its
+// context is done, before aborting them.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(s *Service) {
+		s.drainTimeout = d
+	}
+}
+
+type Service struct {
+	storage      Storage
+	handlers     map[string]Handler
+	workers      int
+	drainTimeout time.Duration
+
+	// mu guards the fields below and serializes the updates of job records.
+	mu       sync.Mutex
+	pending  []string
+	running  map[string]context.CancelFunc
+	canceled map[string]bool
+	aborted  bool
+	wake     chan struct{}
+}
+
+func NewService(s Storage, opts ...Option) *Service {
+	svc := &Service{
+		storage:      s,
+		handlers:     make(map[string]Handler),
+		workers:      defaultWorkers,
+		drainTimeout: defaultDrainTimeout,
+		running:      make(map[string]context.CancelFunc),
+		canceled:     make(map[string]bool),
+		wake:         make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// Register sets the handler of the jobs of kind. It must be called before
+// Run.
+func (s *Service) Register(kind string, h Handler) {
+	s.handlers[kind] = h
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("job id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// Submit queues a job of kind for the user createdBy. params is stored as
+// JSON, input, when not nil, is stored as the input of the job.
+func (s *Service) Submit(ctx context.Context, kind, createdBy string, params interface{}, input io.Reader) (*Job, error) {
+	if _, ok := s.handlers[kind]; !ok {
+		return nil, fmt.Errorf("%q: %w", kind, ErrUnknownKind)
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encode params: %w", err)
+	}
+
+	j := Job{
+		ID:        newID(),
+		Kind:      kind,
+		Status:    StatusQueued,
+		Params:    raw,
+		HasInput:  input != nil,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	// The input is stored first, so a recorded job always has it.
+	if input != nil {
+		w, err := s.storage.CreateBlob(ctx, j.ID, inputBlob)
+		if err != nil {
+			return nil, fmt.Errorf("store input: %w", err)
+		}
+		if _, err := io.Copy(w, input); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("store input: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("store input: %w", err)
+		}
+	}
+	if err := s.storage.Create(ctx, j); err != nil {
+		return nil, fmt.Errorf("create job: %w", err)
+	}
+
+	s.enqueue(j.ID)
+	return &j, nil
+}
+
+func (s *Service) enqueue(ids ...string) {
+	s.mu.Lock()
+	s.pending = append(s.pending, ids...)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *Service) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*Job, error) {
+	j, err := s.storage.Get(ctx, id)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+	return j, nil
+}
+
+// OpenOutput returns the output of a succeeded job.
+func (s *Service) OpenOutput(ctx context.Context, id string) (*Job, Blob, error) {
+	j, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j.Status != StatusSucceeded || j.Output == nil {
+		return nil, nil, fmt.Errorf("%s is %s: %w", id, j.Status, ErrNoOutput)
+	}
+	b, err := s.storage.OpenBlob(ctx, id, outputBlob)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open output: %w", err)
+	}
+	return j, b, nil
+}
+
+// Cancel cancels a queued job at once. A running job is asked to stop and
+// becomes canceled when its handler returns.
+func (s *Service) Cancel(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Status.Finished() {
+		return nil, fmt.Errorf("%s is %s: %w", id, j.Status, ErrFinished)
+	}
+
+	if cancel, ok := s.running[id]; ok {
+		s.canceled[id] = true
+		cancel()
+		return j, nil
+	}
+
+	for i, pid := range s.pending {
+		if pid == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	now := time.Now()
+	j.Status, j.FinishedAt = StatusCanceled, &now
+	if err := s.storage.Update(ctx, *j); err != nil {
+		return nil, fmt.Errorf("update job: %w", err)
+	}
+	return j, nil
+}
+
+// PurgeFinished deletes the jobs finished before t, with their input and
+// output. It returns how many were deleted.
+func (s *Service) PurgeFinished(ctx context.Context, t time.Time) (int, error) {
+	jobs, err := s.storage.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list jobs: %w", err)
+	}
+
+	n := 0
+	for _, j := range jobs {
+		if !j.Status.Finished() || j.FinishedAt == nil || !j.FinishedAt.Before(t) {
+			continue
+		}
+		s.mu.Lock()
+		err := s.storage.Delete(ctx, j.ID)
+		s.mu.Unlock()
+		if err != nil && !storage.IsErrNotFound(err) {
+			return n, fmt.Errorf("delete job %s: %w", j.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RunPurge deletes every interval the jobs finished for longer than
+// retention, until ctx is done.
+func (s *Service) RunPurge(ctx context.Context, retention, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeFinished(ctx, time.Now().Add(-retention))
+		if err != nil {
+			fmt.Println("job purge: failed:", err)
+		} else if n > 0 {
+			fmt.Printf("job purge: %d finished jobs deleted\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run runs the queued jobs until ctx is done. It first recovers the jobs
+// left unfinished by a previous process: queued jobs and interrupted
+// resumable jobs are queued again, other interrupted jobs fail.
+//
+// Once ctx is done no job is started anymore and the running ones are given
+// the drain timeout to finish, then aborted. Jobs still queued stay so for
+// the next Run.
+func (s *Service) Run(ctx context.Context) error {
+	if err := s.resume(ctx); err != nil {
+		return err
+	}
+
+	// Jobs are not bound to ctx, which only means draining.
+	jobCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, jobCtx)
+		}()
+	}
+
+	<-ctx.Done()
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(s.drainTimeout):
+		s.mu.Lock()
+		s.aborted = true
+		s.mu.Unlock()
+		abort()
+		<-drained
+	}
+	return ctx.Err()
+}
+
+func (s *Service) resume(ctx context.Context) error {
+	jobs, err := s.storage.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+
+	s.mu.Lock()
+	pending := make(map[string]bool, len(s.pending))
+	for _, id := range s.pending {
+		pending[id] = true
+	}
+	s.mu.Unlock()
+
+	var queued []string
+	for _, j := range jobs {
+		switch j.Status {
+		case StatusQueued:
+			if !pending[j.ID] {
+				queued = append(queued, j.ID)
+			}
+		case StatusRunning:
+			h, ok := s.handlers[j.Kind]
+			if ok && h.Resumable && j.Attempts < maxAttempts {
+				j.Status = StatusQueued
+				queued = append(queued, j.ID)
+			} else {
+				now := time.Now()
+				j.Status, j.Error, j.FinishedAt = StatusFailed, errInterrupted.Error(), &now
+			}
+			if err := s.storage.Update(ctx, j); err != nil {
+				return fmt.Errorf("update job: %w", err)
+			}
+		}
+	}
+	if len(queued) > 0 {
+		fmt.Printf("job: resuming %d jobs\n", len(queued))
+		s.enqueue(queued...)
+	}
+	return nil
+}
+
+func (s *Service) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return "", false
+	}
+	id := s.pending[0]
+	s.pending = s.pending[1:]
+	if len(s.pending) > 0 {
+		s.signal()
+	}
+	return id, true
+}
+
+func (s *Service) work(ctx, jobCtx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		id, ok := s.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+		s.run(jobCtx, id)
+	}
+}
+
+// start marks job id running. It returns nil when the job is not queued
+// anymore, e.g. canceled.
+func (s *Service) start(ctx context.Context, id string) (*Job, context.Context, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, err := s.Get(ctx, id)
+	if err != nil || j.Status != StatusQueued {
+		return nil, nil, err
+	}
+	now := time.Now()
+	j.Status, j.StartedAt, j.Error = StatusRunning, &now, ""
+	j.Attempts++
+	if err := s.storage.Update(ctx, *j); err != nil {
+		return nil, nil, fmt.Errorf("update job: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.running[id] = cancel
+	return j, runCtx, nil
+}
+
+func (s *Service) run(ctx context.Context, id string) {
+	j, runCtx, err := s.start(ctx, id)
+	if err != nil {
+		fmt.Printf("job %s: start: %v\n", id, err)
+		return
+	}
+	if j == nil {
+		return
+	}
+	fmt.Printf("job %s: %s started, attempt %d\n", id, j.Kind, j.Attempts)
+
+	t := &Task{ID: j.ID, Params: j.Params, svc: s}
+	var result interface{}
+	if j.HasInput {
+		t.Input, err = s.storage.OpenBlob(runCtx, id, inputBlob)
+	}
+	if err == nil {
+		result, err = s.runHandler(runCtx, s.handlers[j.Kind], t)
+	}
+	if t.Input != nil {
+		t.Input.Close()
+	}
+	s.finish(ctx, id, result, err)
+}
+
+// runHandler runs h, turning a panic into an error so a faulty job does not
+// stop the worker.
+func (s *Service) runHandler(ctx context.Context, h Handler, t *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if h.Run == nil {
+		return nil, ErrUnknownKind
+	}
+	return h.Run(ctx, t)
+}
+
+func (s *Service) finish(ctx context.Context, id string, result interface{}, runErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running[id]()
+	delete(s.running, id)
+	canceled := s.canceled[id]
+	delete(s.canceled, id)
+
+	// Records are read again for the progress and output set by the task.
+	j, err := s.storage.Get(context.Background(), id)
+	if err != nil {
+		fmt.Printf("job %s: finish: %v\n", id, err)
+		return
+	}
+	now := time.Now()
+	j.FinishedAt = &now
+	switch {
+	case runErr == nil:
+		j.Status = StatusSucceeded
+		if j.Result, err = json.Marshal(result); err != nil {
+			j.Status, j.Error = StatusFailed, fmt.Sprintf("encode result: %v", err)
+		}
+	case canceled:
+		j.Status = StatusCanceled
+	case s.aborted && s.handlers[j.Kind].Resumable:
+		j.Status, j.FinishedAt = StatusQueued, nil
+	case s.aborted:
+		j.Status, j.Error = StatusFailed, errAborted.Error()
+	default:
+		j.Status, j.Error = StatusFailed, runErr.Error()
+	}
+	if err := s.storage.Update(context.Background(), *j); err != nil {
+		fmt.Printf("job %s: finish: %v\n", id, err)
+		return
+	}
+	fmt.Printf("job %s: %s\n", id, j.Status)
+}
+
+// Task is the job given to a handler.
+type Task struct {
+	ID     string
+	Params json.RawMessage
+	// Input is the input submitted with the job, nil without.
+	Input Blob
+
+	svc *Service
+}
+
+// DecodeParams decodes the parameters of the job into v.
+func (t *Task) DecodeParams(v interface{}) error {
+	return json.Unmarshal(t.Params, v)
+}
+
+// Progress records that done units of work out of total are done.
+func (t *Task) Progress(ctx context.Context, done, total int) error {
+	return t.svc.update(ctx, t.ID, func(j *Job) {
+		j.Progress = Progress{Done: done, Total: total}
+	})
+}
+
+// CreateOutput returns the writer of the file produced by the job, served
+// once the job succeeded.
+func (t *Task) CreateOutput(ctx context.Context, contentType, filename string) (io.WriteCloser, error) {
+	w, err := t.svc.storage.CreateBlob(ctx, t.ID, outputBlob)
+	if err != nil {
+		return nil, fmt.Errorf("create output: %w", err)
+	}
+	err = t.svc.update(ctx, t.ID, func(j *Job) {
+		j.Output = &Output{ContentType: contentType, Filename: filename}
+	})
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *Service) update(ctx context.Context, id string, f func(j *Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	f(j)
+	if err := s.storage.Update(ctx, *j); err != nil {
+		return fmt.Errorf("update job: %w", err)
+	}
+	return nil
+}
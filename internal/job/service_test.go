@@ -0,0 +1,289 @@
+package job_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/job"
+	"sampleBackend/internal/storage/memory"
+)
+
+func waitStatus(t *testing.T, svc *Service, id string, want Status) *Job {
+	t.Helper()
+
+	var j *Job
+	require.Eventually(t, func() bool {
+		var err error
+		j, err = svc.Get(context.Background(), id)
+		require.NoError(t, err)
+		return j.Status == want
+	}, 5*time.Second, time.Millisecond, "job %s never %s", id, want)
+	return j
+}
+
+// blockingHandler runs until release is closed or the job is canceled.
+func blockingHandler(started chan<- string, release <-chan struct{}, resumable bool) Handler {
+	return Handler{
+		Resumable: resumable,
+		Run: func(ctx context.Context, t *Task) (interface{}, error) {
+			started <- t.ID
+			select {
+			case <-release:
+				return "released", nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+}
+
+func startService(t *testing.T, svc *Service) (cancel func(), done <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- svc.Run(ctx) }()
+	t.Cleanup(cancel)
+	return cancel, errc
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("runs jobs", func(t *testing.T) {
+		t.Parallel()
+
+		svc := NewService(memory.NewJobStorage())
+		svc.Register("upper", Handler{Run: func(ctx context.Context, t *Task) (interface{}, error) {
+			var params struct{ Suffix string }
+			if err := t.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			in, err := io.ReadAll(t.Input)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.Progress(ctx, 1, 2); err != nil {
+				return nil, err
+			}
+			w, err := t.CreateOutput(ctx, "text/plain", "upper.txt")
+			if err != nil {
+				return nil, err
+			}
+			io.WriteString(w, strings.ToUpper(string(in))+params.Suffix)
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return map[string]int{"bytes": len(in)}, t.Progress(ctx, 2, 2)
+		}})
+		svc.Register("fail", Handler{Run: func(context.Context, *Task) (interface{}, error) {
+			return nil, errors.New("out of tea")
+		}})
+		svc.Register("panic", Handler{Run: func(context.Context, *Task) (interface{}, error) {
+			panic("kettle exploded")
+		}})
+		startService(t, svc)
+
+		_, err := svc.Submit(ctx, "brew", "ann", nil, nil)
+		assert.True(t, IsErrUnknownKind(err))
+
+		j, err := svc.Submit(ctx, "upper", "ann", map[string]string{"Suffix": "!"}, strings.NewReader("green tea"))
+		require.NoError(t, err)
+		assert.Equal(t, StatusQueued, j.Status)
+
+		j = waitStatus(t, svc, j.ID, StatusSucceeded)
+		assert.Equal(t, Progress{Done: 2, Total: 2}, j.Progress)
+		assert.JSONEq(t, `{"bytes": 9}`, string(j.Result))
+		assert.Equal(t, 1, j.Attempts)
+		assert.NotNil(t, j.FinishedAt)
+		_, out, err := svc.OpenOutput(ctx, j.ID)
+		require.NoError(t, err)
+		data, err := io.ReadAll(out)
+		require.NoError(t, err)
+		assert.Equal(t, "GREEN TEA!", string(data))
+		require.NoError(t, out.Close())
+
+		_, err = svc.Cancel(ctx, j.ID)
+		assert.True(t, IsErrFinished(err))
+
+		for kind, msg := range map[string]string{"fail": "out of tea", "panic": "panic: kettle exploded"} {
+			j, err := svc.Submit(ctx, kind, "ann", nil, nil)
+			require.NoError(t, err)
+			j = waitStatus(t, svc, j.ID, StatusFailed)
+			assert.Equal(t, msg, j.Error)
+			_, _, err = svc.OpenOutput(ctx, j.ID)
+			assert.True(t, IsErrNoOutput(err))
+		}
+
+		_, err = svc.Get(ctx, "missing")
+		assert.True(t, IsErrNotFound(err))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			started = make(chan string, 2)
+			release = make(chan struct{})
+			svc     = NewService(memory.NewJobStorage(), WithWorkers(1))
+		)
+		svc.Register("block", blockingHandler(started, release, false))
+		startService(t, svc)
+
+		running, err := svc.Submit(ctx, "block", "ann", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, running.ID, <-started)
+		queued, err := svc.Submit(ctx, "block", "ann", nil, nil)
+		require.NoError(t, err)
+
+		j, err := svc.Cancel(ctx, queued.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCanceled, j.Status)
+
+		_, err = svc.Cancel(ctx, running.ID)
+		require.NoError(t, err)
+		waitStatus(t, svc, running.ID, StatusCanceled)
+
+		// The worker is free again and the canceled job never started.
+		next, err := svc.Submit(ctx, "block", "ann", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, next.ID, <-started)
+		close(release)
+		waitStatus(t, svc, next.ID, StatusSucceeded)
+	})
+
+	t.Run("drains on shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			started = make(chan string, 1)
+			release = make(chan struct{})
+			svc     = NewService(memory.NewJobStorage(), WithWorkers(1))
+		)
+		svc.Register("block", blockingHandler(started, release, false))
+		stop, done := startService(t, svc)
+
+		running, err := svc.Submit(ctx, "block", "ann", nil, nil)
+		require.NoError(t, err)
+		<-started
+		queued, err := svc.Submit(ctx, "block", "ann", nil, nil)
+		require.NoError(t, err)
+
+		stop()
+		select {
+		case <-done:
+			t.Fatal("Run returned before the running job finished")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		waitStatus(t, svc, running.ID, StatusSucceeded)
+		waitStatus(t, svc, queued.ID, StatusQueued)
+	})
+
+	t.Run("aborts after the drain timeout and resumes", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			started = make(chan string, 4)
+			release = make(chan struct{})
+			jobs    = memory.NewJobStorage()
+			svc     = NewService(jobs, WithDrainTimeout(10*time.Millisecond))
+		)
+		svc.Register("export", blockingHandler(started, release, true))
+		svc.Register("import", blockingHandler(started, release, false))
+		stop, done := startService(t, svc)
+
+		export, err := svc.Submit(ctx, "export", "ann", nil, nil)
+		require.NoError(t, err)
+		imp, err := svc.Submit(ctx, "import", "ann", nil, nil)
+		require.NoError(t, err)
+		<-started
+		<-started
+
+		stop()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		waitStatus(t, svc, export.ID, StatusQueued)
+		assert.Equal(t, "aborted by shutdown", waitStatus(t, svc, imp.ID, StatusFailed).Error)
+
+		// A new process over the same records resumes the export.
+		svc = NewService(jobs)
+		svc.Register("export", blockingHandler(started, release, true))
+		svc.Register("import", blockingHandler(started, release, false))
+		startService(t, svc)
+		assert.Equal(t, export.ID, <-started)
+		close(release)
+		j := waitStatus(t, svc, export.ID, StatusSucceeded)
+		assert.Equal(t, 2, j.Attempts)
+	})
+
+	t.Run("resumes after a crash", func(t *testing.T) {
+		t.Parallel()
+
+		jobs := memory.NewJobStorage()
+		records := []Job{
+			{ID: "queued", Kind: "export", Status: StatusQueued},
+			{ID: "export", Kind: "export", Status: StatusRunning, Attempts: 1},
+			{ID: "exhausted", Kind: "export", Status: StatusRunning, Attempts: 3},
+			{ID: "import", Kind: "import", Status: StatusRunning, Attempts: 1},
+			{ID: "done", Kind: "import", Status: StatusSucceeded, Attempts: 1},
+		}
+		for _, j := range records {
+			require.NoError(t, jobs.Create(ctx, j))
+		}
+
+		svc := NewService(jobs)
+		noop := Handler{Resumable: true, Run: func(context.Context, *Task) (interface{}, error) { return nil, nil }}
+		svc.Register("export", noop)
+		noop.Resumable = false
+		svc.Register("import", noop)
+		startService(t, svc)
+
+		waitStatus(t, svc, "queued", StatusSucceeded)
+		assert.Equal(t, 2, waitStatus(t, svc, "export", StatusSucceeded).Attempts)
+		assert.Equal(t, "interrupted by a restart", waitStatus(t, svc, "exhausted", StatusFailed).Error)
+		assert.Equal(t, "interrupted by a restart", waitStatus(t, svc, "import", StatusFailed).Error)
+		waitStatus(t, svc, "done", StatusSucceeded)
+	})
+
+	t.Run("purges finished jobs", func(t *testing.T) {
+		t.Parallel()
+
+		jobs := memory.NewJobStorage()
+		old, recent := time.Now().Add(-2*time.Hour), time.Now()
+		records := []Job{
+			{ID: "old", Kind: "export", Status: StatusSucceeded, FinishedAt: &old},
+			{ID: "failed", Kind: "export", Status: StatusFailed, FinishedAt: &old},
+			{ID: "recent", Kind: "export", Status: StatusSucceeded, FinishedAt: &recent},
+			{ID: "queued", Kind: "export", Status: StatusQueued},
+		}
+		for _, j := range records {
+			require.NoError(t, jobs.Create(ctx, j))
+		}
+		w, err := jobs.CreateBlob(ctx, "old", "output")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		svc := NewService(jobs)
+		n, err := svc.PurgeFinished(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		for _, id := range []string{"old", "failed"} {
+			_, err = svc.Get(ctx, id)
+			assert.True(t, IsErrNotFound(err), id)
+		}
+		_, err = jobs.OpenBlob(ctx, "old", "output")
+		assert.Error(t, err)
+		for _, id := range []string{"recent", "queued"} {
+			_, err = svc.Get(ctx, id)
+			assert.NoError(t, err, id)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// Package journal appends the records made from the changes of the catalog
+// to their storage, in order, and pages through them newest first. It is
+// shared by the audit log and the stock ledger.
+package journal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Journal serializes the appends of records to a storage. A batch the
+// storage fails to append is kept, with the ones after it, and appended
+// again before any other.
+type Journal struct {
+	name string
+
+	mu      sync.Mutex
+	pending []func(ctx context.Context) error
+}
+
+// New returns a journal logging its failures as name.
+func New(name string) *Journal {
+	return &Journal{
+		name: name,
+	}
+}
+
+// Append appends a batch of records with write, after the pending ones.
+// Failures are logged, the batch stays pending until Flush or the next
+// Append.
+func (j *Journal) Append(write func(ctx context.Context) error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pending = append(j.pending, write)
+	if err := j.flush(context.Background()); err != nil {
+		fmt.Printf("%s: %d batches pending: %v\n", j.name, len(j.pending), err)
+	}
+}
+
+// Flush appends the pending batches, so that reads see every record.
+func (j *Journal) Flush(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.flush(ctx)
+}
+
+// flush must be called with mu held.
+func (j *Journal) flush(ctx context.Context) error {
+	for len(j.pending) > 0 {
+		if err := j.pending[0](ctx); err != nil {
+			return fmt.Errorf("append %s: %w", j.name, err)
+		}
+		j.pending[0] = nil
+		j.pending = j.pending[1:]
+	}
+	j.pending = nil
+	return nil
+}
+
+// Page returns the Seq the page selected by cursor starts before, 0 for
+// the first page, and its limit, defaultLimit when 0. Invalid options
+// fail with errInvalid.
+func Page(cursor string, limit, defaultLimit, maxLimit int, errInvalid error) (uint64, int, error) {
+	if limit < 0 || limit > maxLimit {
+		return 0, 0, fmt.Errorf("limit %d, at most %d - %w", limit, maxLimit, errInvalid)
+	}
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if cursor == "" {
+		return 0, limit, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("decode cursor %q - %w", cursor, errInvalid)
+	}
+	seq, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil || seq == 0 {
+		return 0, 0, fmt.Errorf("decode cursor %q - %w", b, errInvalid)
+	}
+	return seq, limit, nil
+}
+
+// Cursor is the cursor of the page following the record seq.
+func Cursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(seq, 10)))
+}
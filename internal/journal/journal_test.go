@@ -0,0 +1,61 @@
+package journal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/journal"
+)
+
+var errInvalid = errors.New("invalid options")
+
+func TestJournalPending(t *testing.T) {
+	var (
+		j       = New("test")
+		failing = true
+		written []int
+	)
+	write := func(batch int) func(ctx context.Context) error {
+		return func(context.Context) error {
+			if failing {
+				return errors.New("disk full")
+			}
+			written = append(written, batch)
+			return nil
+		}
+	}
+
+	j.Append(write(1))
+	j.Append(write(2))
+	assert.Error(t, j.Flush(context.Background()))
+	assert.Empty(t, written)
+
+	// Pending batches go first, in order.
+	failing = false
+	j.Append(write(3))
+	assert.Equal(t, []int{1, 2, 3}, written)
+	require.NoError(t, j.Flush(context.Background()))
+}
+
+func TestPage(t *testing.T) {
+	before, limit, err := Page("", 0, 50, 500, errInvalid)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), before)
+	assert.Equal(t, 50, limit)
+
+	before, limit, err = Page(Cursor(42), 10, 50, 500, errInvalid)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), before)
+	assert.Equal(t, 10, limit)
+
+	for _, cursor := range []string{"!", Cursor(0)} {
+		_, _, err = Page(cursor, 0, 50, 500, errInvalid)
+		assert.True(t, errors.Is(err, errInvalid), cursor)
+	}
+	_, _, err = Page("", 501, 50, 500, errInvalid)
+	assert.True(t, errors.Is(err, errInvalid))
+}
@@ -0,0 +1,311 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrTooPrecise       = errors.New("amount more precise than its currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount out of range")
+)
+
+// exponents maps the ISO 4217 codes of the supported currencies to the
+// number of decimals of their minor unit.
+var exponents = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "LAK": 2, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3,
+	"PHP": 2, "PLN": 2, "SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3,
+	"TRY": 2, "TWD": 2, "USD": 2, "VND": 0, "XAF": 0, "XOF": 0, "ZAR": 2,
+}
+
+// Exponent returns the number of decimals of the minor unit of currency,
+// e.g. 2 for USD and 0 for VND.
+func Exponent(currency string) (int, bool) {
+	e, ok := exponents[currency]
+	return e, ok
+}
+
+func ValidCurrency(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+// Money is an amount in the minor unit of its currency, e.g. 1250 USD is
+// 12.50 dollars and 1250 VND is 1250 dong. The zero Money has no currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency. The code is matched ignoring
+// case.
+func New(amount int64, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if !ValidCurrency(currency) {
+		return Money{}, fmt.Errorf("%q - %w", currency, ErrInvalidCurrency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Parse parses a decimal amount of currency such as "12.50". It may have
+// fewer decimals than the currency, but not more: "12.505" USD is rejected
+// rather than rounded.
+func Parse(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exp, ok := Exponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%q - %w", currency, ErrInvalidCurrency)
+	}
+
+	s := amount
+	neg := strings.HasPrefix(s, "-")
+	if neg || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" || !digits(whole) || !digits(frac) {
+		return Money{}, fmt.Errorf("%q is not a decimal - %w", amount, ErrInvalidAmount)
+	}
+	if len(frac) > exp {
+		if strings.TrimRight(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%q has more than %d decimals for %s - %w", amount, exp, currency, ErrTooPrecise)
+		}
+		frac = frac[:exp]
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	var n int64
+	if v := strings.TrimLeft(whole+frac, "0"); v != "" {
+		var err error
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Money{}, fmt.Errorf("%q - %w", amount, ErrOverflow)
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return Money{Amount: n, Currency: currency}, nil
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) IsZero() bool {
+	return m == Money{}
+}
+
+// Decimal formats the amount with the decimals of the currency, e.g. "12.50"
+// for 1250 USD.
+func (m Money) Decimal() string {
+	exp, _ := Exponent(m.Currency)
+	s := strconv.FormatInt(m.Amount, 10)
+	sign := ""
+	if m.Amount < 0 {
+		sign, s = "-", s[1:]
+	}
+	if exp == 0 {
+		return sign + s
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) check(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%s and %s - %w", m.Currency, o.Currency, ErrCurrencyMismatch)
+	}
+	return nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.check(o); err != nil {
+		return Money{}, err
+	}
+	if o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount || o.Amount < 0 && m.Amount < math.MinInt64-o.Amount {
+		return Money{}, fmt.Errorf("%v + %v - %w", m, o, ErrOverflow)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.check(o); err != nil {
+		return Money{}, err
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Cmp compares m and o, which must be in the same currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.check(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) Mul(n int64) (Money, error) {
+	return m.MulRat(n, 1)
+}
+
+// MulRat multiplies m by num/den and rounds the result to the minor unit,
+// half to even, e.g. 15% of 0.10 USD is 0.02 USD.
+func (m Money) MulRat(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, fmt.Errorf("division by zero - %w", ErrInvalidAmount)
+	}
+	r := new(big.Rat).Mul(big.NewRat(m.Amount, 1), big.NewRat(num, den))
+	n, err := roundHalfEven(r)
+	if err != nil {
+		return Money{}, fmt.Errorf("%v * %d/%d - %w", m, num, den, err)
+	}
+	return Money{Amount: n, Currency: m.Currency}, nil
+}
+
+func roundHalfEven(r *big.Rat) (int64, error) {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Compare twice the remainder to the denominator, which is positive.
+	twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	if c := twice.Cmp(r.Denom()); c > 0 || c == 0 && q.Bit(0) == 1 {
+		q.Add(q, big.NewInt(int64(rem.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return q.Int64(), nil
+}
+
+// Allocate splits m into parts proportional to ratios without losing a
+// minor unit: the remainder goes one unit at a time to the first parts.
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	var total int64
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("negative ratio %d - %w", r, ErrInvalidAmount)
+		}
+		total += r
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("ratios sum to %d - %w", total, ErrInvalidAmount)
+	}
+
+	var (
+		parts = make([]Money, len(ratios))
+		rest  = m.Amount
+	)
+	for i, r := range ratios {
+		n := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(r))
+		n.Quo(n, big.NewInt(total))
+		parts[i] = Money{Amount: n.Int64(), Currency: m.Currency}
+		rest -= parts[i].Amount
+	}
+	unit := int64(1)
+	if rest < 0 {
+		unit = -1
+	}
+	for i := 0; rest != 0; i = (i + 1) % len(parts) {
+		if ratios[i] == 0 {
+			continue
+		}
+		parts[i].Amount += unit
+		rest -= unit
+	}
+	return parts, nil
+}
+
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON writes m as {"amount": "12.50", "currency": "USD"}, the amount
+// being a decimal string so that no client reads it as a float. The zero
+// Money is null.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+// UnmarshalJSON reads what MarshalJSON writes. The amount may also be a
+// JSON number, which is parsed from its text, not as a float.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*m = Money{}
+		return nil
+	}
+	var v jsonMoney
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("%v - %w", err, ErrInvalidAmount)
+	}
+	amount := string(v.Amount)
+	if s, err := strconv.Unquote(amount); err == nil {
+		amount = s
+	}
+	if amount == "" {
+		return fmt.Errorf("missing amount - %w", ErrInvalidAmount)
+	}
+	parsed, err := Parse(amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func IsErrInvalidCurrency(err error) bool {
+	return errors.Is(err, ErrInvalidCurrency)
+}
+
+func IsErrInvalidAmount(err error) bool {
+	return errors.Is(err, ErrInvalidAmount)
+}
+
+func IsErrTooPrecise(err error) bool {
+	return errors.Is(err, ErrTooPrecise)
+}
+
+func IsErrCurrencyMismatch(err error) bool {
+	return errors.Is(err, ErrCurrencyMismatch)
+}
+
+func IsErrOverflow(err error) bool {
+	return errors.Is(err, ErrOverflow)
+}
@@ -0,0 +1,107 @@
+package money_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		want             Money
+		decimal          string
+	}{
+		{"12.50", "USD", Money{1250, "USD"}, "12.50"},
+		{"12.5", "usd", Money{1250, "USD"}, "12.50"},
+		{"12", "USD", Money{1200, "USD"}, "12.00"},
+		{".05", "EUR", Money{5, "EUR"}, "0.05"},
+		{"-0.05", "EUR", Money{-5, "EUR"}, "-0.05"},
+		{"1250", "VND", Money{1250, "VND"}, "1250"},
+		{"1250.00", "JPY", Money{1250, "JPY"}, "1250"},
+		{"1.234", "KWD", Money{1234, "KWD"}, "1.234"},
+		{"0", "USD", Money{0, "USD"}, "0.00"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		require.NoError(t, err, tt.amount)
+		assert.Equal(t, tt.want, got, tt.amount)
+		assert.Equal(t, tt.decimal, got.Decimal(), tt.amount)
+	}
+
+	for _, amount := range []string{"", ".", "1,5", "1.2.3", "abc", "--1"} {
+		_, err := Parse(amount, "USD")
+		assert.True(t, IsErrInvalidAmount(err), amount)
+	}
+	_, err := Parse("12.505", "USD")
+	assert.True(t, IsErrTooPrecise(err))
+	_, err = Parse("1250.5", "VND")
+	assert.True(t, IsErrTooPrecise(err))
+	_, err = Parse("99999999999999999999", "VND")
+	assert.True(t, IsErrOverflow(err))
+	_, err = Parse("1", "XYZ")
+	assert.True(t, IsErrInvalidCurrency(err))
+}
+
+func TestArithmetic(t *testing.T) {
+	must := func(m Money, err error) Money {
+		t.Helper()
+		require.NoError(t, err)
+		return m
+	}
+	usd := func(n int64) Money { return Money{Amount: n, Currency: "USD"} }
+
+	assert.Equal(t, usd(350), must(usd(100).Add(usd(250))))
+	assert.Equal(t, usd(-150), must(usd(100).Sub(usd(250))))
+	assert.Equal(t, usd(300), must(usd(100).Mul(3)))
+	_, err := usd(100).Add(Money{Amount: 100, Currency: "VND"})
+	assert.True(t, IsErrCurrencyMismatch(err))
+	_, err = usd(1 << 62).Mul(4)
+	assert.True(t, IsErrOverflow(err))
+
+	// Halves round to the even minor unit, away from zero otherwise.
+	for _, tt := range []struct {
+		amount, num, den, want int64
+	}{
+		{10, 15, 100, 2},   // 1.5
+		{10, 25, 100, 2},   // 2.5
+		{10, 35, 100, 4},   // 3.5
+		{10, 36, 100, 4},   // 3.6
+		{-10, 25, 100, -2}, // -2.5
+		{-10, 36, 100, -4}, // -3.6
+		{1000, 1, 3, 333},
+	} {
+		assert.Equal(t, usd(tt.want), must(usd(tt.amount).MulRat(tt.num, tt.den)), "%d*%d/%d", tt.amount, tt.num, tt.den)
+	}
+
+	parts, err := usd(100).Allocate(1, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{usd(34), usd(33), usd(33)}, parts)
+	parts, err = usd(-5).Allocate(0, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{usd(0), usd(-3), usd(-2)}, parts)
+	_, err = usd(5).Allocate(0)
+	assert.True(t, IsErrInvalidAmount(err))
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(struct{ Price, None Money }{Price: Money{1250, "USD"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Price": {"amount": "12.50", "currency": "USD"}, "None": null}`, string(b))
+
+	var m Money
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": "12.50", "currency": "USD"}`), &m))
+	assert.Equal(t, Money{1250, "USD"}, m)
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 0.3, "currency": "EUR"}`), &m))
+	assert.Equal(t, Money{30, "EUR"}, m)
+	require.NoError(t, json.Unmarshal([]byte(`null`), &m))
+	assert.True(t, m.IsZero())
+
+	for _, doc := range []string{`{"currency": "USD"}`, `{"amount": "1", "currency": "USD", "rate": 1}`, `12`} {
+		assert.True(t, IsErrInvalidAmount(json.Unmarshal([]byte(doc), &m)), doc)
+	}
+}
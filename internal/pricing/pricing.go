@@ -0,0 +1,184 @@
+// Package pricing keeps named price lists, e.g. retail, wholesale or one per
+// region, and the prices of the products in each of them over time. It also
+// keeps the promotions and quotes carts with them.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+)
+
+var (
+	ErrInvalid       = errors.New("invalid price")
+	ErrListNotFound  = errors.New("price list not found")
+	ErrListExist     = errors.New("price list exist")
+	ErrPriceNotFound = errors.New("price not found")
+	// ErrPriceStarted is returned when removing a price already in effect,
+	// the prices of the past are kept as they were.
+	ErrPriceStarted = errors.New("price already in effect")
+)
+
+const (
+	MaxCodeLength = 32
+	MaxNameLength = 120
+)
+
+var codePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// List is a named set of prices, all in Currency.
+type List struct {
+	Code      string
+	Name      string
+	Currency  string
+	CreatedAt time.Time
+}
+
+// Entry is the price of a product in a list from From until Until, forever
+// when Until is zero. The windows of the entries of a product may overlap:
+// the one which started last is in effect, so a temporary price laid over a
+// lasting one gives way to it again when it ends.
+type Entry struct {
+	ID        uint64
+	List      string
+	SKU       string
+	Price     money.Money
+	From      time.Time
+	Until     time.Time
+	CreatedAt time.Time
+	CreatedBy string
+}
+
+// Covers reports whether e is valid at t.
+func (e Entry) Covers(t time.Time) bool {
+	return !t.Before(e.From) && (e.Until.IsZero() || t.Before(e.Until))
+}
+
+type Storage interface {
+	// CreateList fails with storage.ErrAlreadyExist when the code is taken.
+	CreateList(ctx context.Context, l List) error
+	GetList(ctx context.Context, code string) (*List, error)
+	// Lists returns every list ordered by code.
+	Lists(ctx context.Context) ([]List, error)
+	// AddEntry stores e under a new ID, which it returns.
+	AddEntry(ctx context.Context, e Entry) (uint64, error)
+	GetEntry(ctx context.Context, id uint64) (*Entry, error)
+	// Entries returns the entries of list and sku ordered by ID. An empty
+	// list or sku matches all of them.
+	Entries(ctx context.Context, list, sku string) ([]Entry, error)
+	DeleteEntry(ctx context.Context, id uint64) error
+
+	// CreatePromotion fails with storage.ErrAlreadyExist when the code is
+	// taken.
+	CreatePromotion(ctx context.Context, p Promotion) error
+	GetPromotion(ctx context.Context, code string) (*Promotion, error)
+	// Promotions returns every promotion ordered by code.
+	Promotions(ctx context.Context) ([]Promotion, error)
+	DeletePromotion(ctx context.Context, code string) error
+}
+
+// ValidationError lists every field of a list, an entry, a promotion or a
+// quote breaking a rule.
+type ValidationError struct {
+	Fields []product.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// fieldErrors keeps the first error of every field.
+type fieldErrors []product.FieldError
+
+func (fe *fieldErrors) add(field, code, format string, args ...interface{}) {
+	for _, f := range *fe {
+		if f.Field == field {
+			return
+		}
+	}
+	*fe = append(*fe, product.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (fe fieldErrors) err() error {
+	if len(fe) > 0 {
+		return &ValidationError{Fields: fe}
+	}
+	return nil
+}
+
+func (l List) Validate() error {
+	var fields fieldErrors
+	switch {
+	case l.Code == "":
+		fields.add("code", product.CodeRequired, "code is required")
+	case len(l.Code) > MaxCodeLength:
+		fields.add("code", product.CodeTooLong, "code must be at most %d characters", MaxCodeLength)
+	case !codePattern.MatchString(l.Code):
+		fields.add("code", product.CodeInvalidFormat, "code must be lower case letters and digits separated by single hyphens")
+	}
+
+	switch {
+	case strings.TrimSpace(l.Name) == "":
+		fields.add("name", product.CodeRequired, "name is required")
+	case !utf8.ValidString(l.Name):
+		fields.add("name", product.CodeInvalidFormat, "name must be valid UTF-8")
+	case utf8.RuneCountInString(l.Name) > MaxNameLength:
+		fields.add("name", product.CodeTooLong, "name must be at most %d characters", MaxNameLength)
+	}
+
+	if !money.ValidCurrency(l.Currency) {
+		fields.add("currency", product.CodeNotAllowed, "currency must be an ISO 4217 code")
+	}
+	return fields.err()
+}
+
+// effective returns the entry of entries in effect at t, nil when there is
+// none. Entries which started at the same time are ordered by ID.
+func effective(entries []Entry, t time.Time) *Entry {
+	var ret *Entry
+	for i := range entries {
+		e := &entries[i]
+		if !e.Covers(t) {
+			continue
+		}
+		if ret == nil || e.From.After(ret.From) || (e.From.Equal(ret.From) && e.ID > ret.ID) {
+			ret = e
+		}
+	}
+	return ret
+}
+
+func IsErrInvalid(err error) bool {
+	return errors.Is(err, ErrInvalid)
+}
+
+func IsErrListNotFound(err error) bool {
+	return errors.Is(err, ErrListNotFound)
+}
+
+func IsErrListExist(err error) bool {
+	return errors.Is(err, ErrListExist)
+}
+
+func IsErrPriceNotFound(err error) bool {
+	return errors.Is(err, ErrPriceNotFound)
+}
+
+func IsErrPriceStarted(err error) bool {
+	return errors.Is(err, ErrPriceStarted)
+}
@@ -0,0 +1,289 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("promotion not found")
+	ErrPromotionExist    = errors.New("promotion exist")
+)
+
+// PromotionKind is how a promotion discounts the products it targets.
+type PromotionKind string
+
+const (
+	// PromotionPercent takes PercentOff off the line.
+	PromotionPercent PromotionKind = "percent"
+	// PromotionFixed takes AmountOff off every unit.
+	PromotionFixed PromotionKind = "fixed"
+	// PromotionBuyXGetY gives Get units for free out of every Buy+Get.
+	PromotionBuyXGetY PromotionKind = "buy_x_get_y"
+	// PromotionTiered takes the PercentOff of the highest tier reached by
+	// the quantity off the line.
+	PromotionTiered PromotionKind = "tiered"
+)
+
+var PromotionKinds = []PromotionKind{PromotionPercent, PromotionFixed, PromotionBuyXGetY, PromotionTiered}
+
+// Tier is a quantity break of a tiered promotion.
+type Tier struct {
+	MinQuantity uint32
+	PercentOff  uint32
+}
+
+// Promotion discounts the products of SKUs, Categories or Tags, every
+// product when all are empty, from From until Until, forever when Until is
+// zero.
+//
+// A product may be targeted by several promotions. The stackable ones add
+// up, in Priority order, each on what the previous left; an exclusive one
+// applies alone. The customer gets whichever of these is the best deal.
+type Promotion struct {
+	Code       string
+	Name       string
+	Kind       PromotionKind
+	SKUs       []string
+	Categories []string
+	Tags       []string
+	PercentOff uint32
+	AmountOff  money.Money
+	Buy, Get   uint32
+	Tiers      []Tier
+	From       time.Time
+	Until      time.Time
+	Priority   int
+	Stackable  bool
+	CreatedAt  time.Time
+}
+
+// Active reports whether p is valid at t.
+func (p Promotion) Active(t time.Time) bool {
+	return !t.Before(p.From) && (p.Until.IsZero() || t.Before(p.Until))
+}
+
+// Targets reports whether p discounts prd, which has one of its SKUs,
+// Categories or Tags.
+func (p Promotion) Targets(prd *product.Product) bool {
+	if len(p.SKUs) == 0 && len(p.Categories) == 0 && len(p.Tags) == 0 {
+		return true
+	}
+	for _, s := range p.SKUs {
+		if s == prd.SKU {
+			return true
+		}
+	}
+	for _, c := range p.Categories {
+		if c == prd.Category {
+			return true
+		}
+	}
+	for _, t := range p.Tags {
+		for _, pt := range prd.Tags {
+			if t == pt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Promotion) Validate() error {
+	var fields fieldErrors
+	switch {
+	case p.Code == "":
+		fields.add("code", product.CodeRequired, "code is required")
+	case len(p.Code) > MaxCodeLength:
+		fields.add("code", product.CodeTooLong, "code must be at most %d characters", MaxCodeLength)
+	case !codePattern.MatchString(p.Code):
+		fields.add("code", product.CodeInvalidFormat, "code must be lower case letters and digits separated by single hyphens")
+	}
+
+	switch {
+	case strings.TrimSpace(p.Name) == "":
+		fields.add("name", product.CodeRequired, "name is required")
+	case !utf8.ValidString(p.Name):
+		fields.add("name", product.CodeInvalidFormat, "name must be valid UTF-8")
+	case utf8.RuneCountInString(p.Name) > MaxNameLength:
+		fields.add("name", product.CodeTooLong, "name must be at most %d characters", MaxNameLength)
+	}
+
+	for _, c := range p.Categories {
+		if !product.ValidLabel(c) {
+			fields.add("categories", product.CodeInvalidFormat, "categories must be at most %d lower case letters and digits separated by single hyphens", product.MaxLabelLength)
+			break
+		}
+	}
+	for _, t := range p.Tags {
+		if !product.ValidLabel(t) {
+			fields.add("tags", product.CodeInvalidFormat, "tags must be at most %d lower case letters and digits separated by single hyphens", product.MaxLabelLength)
+			break
+		}
+	}
+
+	switch p.Kind {
+	case PromotionPercent:
+		if p.PercentOff < 1 || p.PercentOff > 100 {
+			fields.add("percent_off", product.CodeNotAllowed, "percent_off must be between 1 and 100")
+		}
+	case PromotionFixed:
+		switch {
+		case p.AmountOff.Amount <= 0:
+			fields.add("amount_off", product.CodeRequired, "amount_off must be greater than zero")
+		case !money.ValidCurrency(p.AmountOff.Currency):
+			fields.add("amount_off", product.CodeNotAllowed, "amount_off currency must be an ISO 4217 code")
+		}
+	case PromotionBuyXGetY:
+		if p.Buy < 1 {
+			fields.add("buy", product.CodeRequired, "buy must be at least 1")
+		}
+		if p.Get < 1 {
+			fields.add("get", product.CodeRequired, "get must be at least 1")
+		}
+	case PromotionTiered:
+		if len(p.Tiers) == 0 {
+			fields.add("tiers", product.CodeRequired, "tiers are required")
+		}
+		for i, t := range p.Tiers {
+			if t.MinQuantity < 1 || (i > 0 && t.MinQuantity <= p.Tiers[i-1].MinQuantity) {
+				fields.add("tiers", product.CodeNotAllowed, "tiers must have increasing min_qty from 1")
+			}
+			if t.PercentOff < 1 || t.PercentOff > 100 {
+				fields.add("tiers", product.CodeNotAllowed, "tiers must have a percent_off between 1 and 100")
+			}
+		}
+	default:
+		names := make([]string, len(PromotionKinds))
+		for i, k := range PromotionKinds {
+			names[i] = string(k)
+		}
+		fields.add("kind", product.CodeNotAllowed, "kind must be one of %s", strings.Join(names, ", "))
+	}
+
+	if !p.Until.IsZero() && !p.Until.After(p.From) {
+		fields.add("valid_until", product.CodeNotAllowed, "valid_until must be after valid_from")
+	}
+	return fields.err()
+}
+
+// discount returns how much p takes off a line of qty units at unit, of
+// which remaining is left to pay. It is zero when p does not apply.
+func (p Promotion) discount(unit, remaining money.Money, qty uint32) (money.Money, error) {
+	var (
+		off = money.Money{Currency: remaining.Currency}
+		err error
+	)
+	switch p.Kind {
+	case PromotionPercent:
+		off, err = remaining.MulRat(int64(p.PercentOff), 100)
+	case PromotionFixed:
+		if p.AmountOff.Currency == remaining.Currency {
+			off, err = p.AmountOff.Mul(int64(qty))
+		}
+	case PromotionBuyXGetY:
+		free := qty / (p.Buy + p.Get) * p.Get
+		off, err = unit.Mul(int64(free))
+	case PromotionTiered:
+		for i := len(p.Tiers) - 1; i >= 0; i-- {
+			if qty >= p.Tiers[i].MinQuantity {
+				off, err = remaining.MulRat(int64(p.Tiers[i].PercentOff), 100)
+				break
+			}
+		}
+	}
+	if err != nil {
+		return money.Money{}, err
+	}
+	if off.Amount > remaining.Amount {
+		off = remaining
+	}
+	return off, nil
+}
+
+// CreatePromotion stores p, which starts now unless it has a From. An
+// AmountOff without currency is in the default currency of the products.
+func (s *Service) CreatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	now := time.Now().UTC()
+	if p.Kind == PromotionFixed && p.AmountOff.Currency == "" {
+		p.AmountOff.Currency = s.products.Currency()
+	}
+	p.AmountOff.Currency = strings.ToUpper(p.AmountOff.Currency)
+	if p.From.IsZero() {
+		p.From = now
+	}
+	p.From = p.From.UTC()
+	if !p.Until.IsZero() {
+		p.Until = p.Until.UTC()
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.CreatedAt = now
+
+	err := s.storage.CreatePromotion(ctx, p)
+	if err != nil {
+		if storage.IsErrAlreadyExist(err) {
+			return nil, fmt.Errorf("create promotion %s: %v - %w", p.Code, err, ErrPromotionExist)
+		}
+		return nil, fmt.Errorf("create promotion: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *Service) GetPromotion(ctx context.Context, code string) (*Promotion, error) {
+	p, err := s.storage.GetPromotion(ctx, code)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", code, ErrPromotionNotFound)
+		}
+		return nil, fmt.Errorf("get promotion: %w", err)
+	}
+	return p, nil
+}
+
+func (s *Service) Promotions(ctx context.Context) ([]Promotion, error) {
+	promotions, err := s.storage.Promotions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list promotions: %w", err)
+	}
+	return promotions, nil
+}
+
+func (s *Service) DeletePromotion(ctx context.Context, code string) error {
+	err := s.storage.DeletePromotion(ctx, code)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return fmt.Errorf("%s: %w", code, ErrPromotionNotFound)
+		}
+		return fmt.Errorf("delete promotion: %w", err)
+	}
+	return nil
+}
+
+// byPriority orders promotions by decreasing Priority, then by code.
+func byPriority(promotions []Promotion) {
+	sort.SliceStable(promotions, func(i, j int) bool {
+		if promotions[i].Priority != promotions[j].Priority {
+			return promotions[i].Priority > promotions[j].Priority
+		}
+		return promotions[i].Code < promotions[j].Code
+	})
+}
+
+func IsErrPromotionNotFound(err error) bool {
+	return errors.Is(err, ErrPromotionNotFound)
+}
+
+func IsErrPromotionExist(err error) bool {
+	return errors.Is(err, ErrPromotionExist)
+}
@@ -0,0 +1,173 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+)
+
+// MaxQuoteItems bounds the lines of a quote.
+const MaxQuoteItems = 100
+
+type QuoteItem struct {
+	SKU      string
+	Quantity uint32
+}
+
+// Discount is what a promotion took off a line.
+type Discount struct {
+	Promotion string
+	Name      string
+	Amount    money.Money
+}
+
+type QuoteLine struct {
+	SKU       string
+	Quantity  uint32
+	UnitPrice money.Money
+	Subtotal  money.Money
+	Discount  money.Money
+	Total     money.Money
+	Discounts []Discount
+}
+
+// Quote prices a cart at a time. Every line is in Currency.
+type Quote struct {
+	At       time.Time
+	Currency string
+	Lines    []QuoteLine
+	Subtotal money.Money
+	Discount money.Money
+	Total    money.Money
+}
+
+// Quote prices items at t, from the prices of the products less the
+// promotions active at t.
+func (s *Service) Quote(ctx context.Context, items []QuoteItem, t time.Time) (*Quote, error) {
+	var fields fieldErrors
+	switch {
+	case len(items) == 0:
+		fields.add("items", product.CodeRequired, "items are required")
+	case len(items) > MaxQuoteItems:
+		fields.add("items", product.CodeTooLong, "items must be at most %d", MaxQuoteItems)
+	}
+	seen := make(map[string]bool, len(items))
+	for i, it := range items {
+		if seen[it.SKU] {
+			fields.add(fmt.Sprintf("items[%d].sku", i), product.CodeNotAllowed, "sku appears more than once")
+		}
+		seen[it.SKU] = true
+		if it.Quantity == 0 {
+			fields.add(fmt.Sprintf("items[%d].qty", i), product.CodeRequired, "qty must be at least 1")
+		}
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
+	}
+
+	all, err := s.Promotions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var active []Promotion
+	for _, p := range all {
+		if p.Active(t) {
+			active = append(active, p)
+		}
+	}
+	byPriority(active)
+
+	q := &Quote{At: t, Lines: make([]QuoteLine, len(items))}
+	for i, it := range items {
+		p, err := s.products.GetProduct(ctx, it.SKU, false)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			q.Currency = p.Price.Currency
+			q.Subtotal = money.Money{Currency: q.Currency}
+			q.Discount, q.Total = q.Subtotal, q.Subtotal
+		}
+		if p.Price.Currency != q.Currency {
+			fields.add(fmt.Sprintf("items[%d].sku", i), product.CodeNotAllowed, "price is in %s, the quote in %s", p.Price.Currency, q.Currency)
+			continue
+		}
+
+		line, err := quoteLine(it, p, active)
+		if err != nil {
+			return nil, fmt.Errorf("quote %s: %w", it.SKU, err)
+		}
+		q.Lines[i] = *line
+		if q.Subtotal, err = q.Subtotal.Add(line.Subtotal); err != nil {
+			return nil, fmt.Errorf("quote: %w", err)
+		}
+		if q.Discount, err = q.Discount.Add(line.Discount); err != nil {
+			return nil, fmt.Errorf("quote: %w", err)
+		}
+		if q.Total, err = q.Total.Add(line.Total); err != nil {
+			return nil, fmt.Errorf("quote: %w", err)
+		}
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// quoteLine prices it at the price of prd with the best deal of the
+// promotions, ordered by priority: either all the stackable ones or a single
+// exclusive one.
+func quoteLine(it QuoteItem, prd *product.Product, promotions []Promotion) (*QuoteLine, error) {
+	unit := prd.Price
+	subtotal, err := unit.Mul(int64(it.Quantity))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stacked   []Discount
+		remaining = subtotal
+	)
+	for _, p := range promotions {
+		if !p.Stackable || !p.Targets(prd) {
+			continue
+		}
+		off, err := p.discount(unit, remaining, it.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		if off.Amount == 0 {
+			continue
+		}
+		stacked = append(stacked, Discount{Promotion: p.Code, Name: p.Name, Amount: off})
+		remaining.Amount -= off.Amount
+	}
+
+	discounts, total := stacked, remaining
+	for _, p := range promotions {
+		if p.Stackable || !p.Targets(prd) {
+			continue
+		}
+		off, err := p.discount(unit, subtotal, it.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		if off.Amount > subtotal.Amount-total.Amount {
+			discounts = []Discount{{Promotion: p.Code, Name: p.Name, Amount: off}}
+			total = money.Money{Amount: subtotal.Amount - off.Amount, Currency: subtotal.Currency}
+		}
+	}
+
+	return &QuoteLine{
+		SKU:       it.SKU,
+		Quantity:  it.Quantity,
+		UnitPrice: unit,
+		Subtotal:  subtotal,
+		Discount:  money.Money{Amount: subtotal.Amount - total.Amount, Currency: subtotal.Currency},
+		Total:     total,
+		Discounts: discounts,
+	}, nil
+}
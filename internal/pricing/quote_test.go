@@ -0,0 +1,147 @@
+package pricing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/pricing"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestPromotionValidate(t *testing.T) {
+	now := time.Now()
+	fieldsOf := func(err error) []string {
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		ret := make([]string, len(verr.Fields))
+		for i, f := range verr.Fields {
+			ret[i] = f.Field
+		}
+		return ret
+	}
+
+	valid := Promotion{Code: "sale", Name: "Sale", Kind: PromotionPercent, PercentOff: 10}
+	assert.NoError(t, valid.Validate())
+	assert.Equal(t, []string{"code", "name", "kind"}, fieldsOf(Promotion{Code: "Sale!"}.Validate()))
+	assert.Equal(t, []string{"percent_off"}, fieldsOf(Promotion{Code: "sale", Name: "Sale", Kind: PromotionPercent, PercentOff: 101}.Validate()))
+	assert.Equal(t, []string{"amount_off"}, fieldsOf(Promotion{Code: "sale", Name: "Sale", Kind: PromotionFixed, AmountOff: money.Money{Amount: 1}}.Validate()))
+	assert.Equal(t, []string{"buy", "get"}, fieldsOf(Promotion{Code: "sale", Name: "Sale", Kind: PromotionBuyXGetY}.Validate()))
+	assert.Equal(t, []string{"tiers"}, fieldsOf(Promotion{Code: "sale", Name: "Sale", Kind: PromotionTiered, Tiers: []Tier{{MinQuantity: 5, PercentOff: 5}, {MinQuantity: 5, PercentOff: 10}}}.Validate()))
+	assert.Equal(t, []string{"categories", "tags"}, fieldsOf(Promotion{Code: "sale", Name: "Sale", Kind: PromotionPercent, PercentOff: 10, Categories: []string{"Tea"}, Tags: []string{"ok", "not ok"}}.Validate()))
+	valid.From, valid.Until = now, now
+	assert.Equal(t, []string{"valid_until"}, fieldsOf(valid.Validate()))
+}
+
+func TestServiceQuote(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewPriceStorage(), products)
+	for _, p := range []product.Product{
+		{SKU: "A-1", Name: "Tea", Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Box"},
+		{SKU: "B-1", Name: "Cup", Price: money.Money{Amount: 500, Currency: "USD"}, Unit: "Piece"},
+		{SKU: "C-1", Name: "Pot", Price: money.Money{Amount: 2000, Currency: "EUR"}, Unit: "Piece"},
+	} {
+		_, err := products.AddProduct(ctx, p)
+		require.NoError(t, err)
+	}
+	now := time.Now()
+	for _, p := range []Promotion{
+		{Code: "ten-off", Name: "10% off", Kind: PromotionPercent, PercentOff: 10, Stackable: true},
+		{Code: "tea-dollar", Name: "1 USD off tea", Kind: PromotionFixed, SKUs: []string{"A-1"}, AmountOff: money.Money{Amount: 100, Currency: "usd"}, Stackable: true, Priority: 10},
+		{Code: "cups-3-for-2", Name: "3 cups for 2", Kind: PromotionBuyXGetY, SKUs: []string{"B-1"}, Buy: 2, Get: 1},
+		{Code: "tea-bulk", Name: "Tea in bulk", Kind: PromotionTiered, SKUs: []string{"A-1"}, Tiers: []Tier{{MinQuantity: 5, PercentOff: 5}, {MinQuantity: 10, PercentOff: 20}}},
+		{Code: "tomorrow", Name: "Half price tomorrow", Kind: PromotionPercent, PercentOff: 50, From: now.Add(24 * time.Hour), Until: now.Add(48 * time.Hour)},
+	} {
+		_, err := svc.CreatePromotion(ctx, p)
+		require.NoError(t, err)
+	}
+	// Promotions without valid_from start when created.
+	now = time.Now()
+	_, err := svc.CreatePromotion(ctx, Promotion{Code: "ten-off", Name: "Again", Kind: PromotionPercent, PercentOff: 1})
+	assert.True(t, IsErrPromotionExist(err))
+	usd := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "USD"} }
+	codes := func(l QuoteLine) []string {
+		ret := make([]string, len(l.Discounts))
+		for i, d := range l.Discounts {
+			ret[i] = d.Promotion
+		}
+		return ret
+	}
+
+	q, err := svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 3}, {SKU: "B-1", Quantity: 6}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "USD", q.Currency)
+	require.Len(t, q.Lines, 2)
+	// The stackable ones apply in priority order, each on what is left.
+	assert.Equal(t, []string{"tea-dollar", "ten-off"}, codes(q.Lines[0]))
+	assert.Equal(t, []Discount{{Promotion: "tea-dollar", Name: "1 USD off tea", Amount: usd(300)}, {Promotion: "ten-off", Name: "10% off", Amount: usd(270)}}, q.Lines[0].Discounts)
+	assert.Equal(t, usd(2430), q.Lines[0].Total)
+	// A better exclusive one applies alone.
+	assert.Equal(t, []string{"cups-3-for-2"}, codes(q.Lines[1]))
+	assert.Equal(t, usd(1000), q.Lines[1].Discount)
+	assert.Equal(t, usd(6000), q.Subtotal)
+	assert.Equal(t, usd(1570), q.Discount)
+	assert.Equal(t, usd(4430), q.Total)
+
+	q, err = svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 10}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tea-bulk"}, codes(q.Lines[0]))
+	assert.Equal(t, usd(8000), q.Total)
+
+	q, err = svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 1}}, now.Add(25*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tomorrow"}, codes(q.Lines[0]))
+	assert.Equal(t, usd(500), q.Total)
+
+	require.NoError(t, svc.DeletePromotion(ctx, "ten-off"))
+	assert.True(t, IsErrPromotionNotFound(svc.DeletePromotion(ctx, "ten-off")))
+	q, err = svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 1}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, usd(900), q.Total)
+
+	_, err = svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 1}, {SKU: "C-1", Quantity: 1}, {SKU: "A-1"}}, now)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 2)
+	assert.Equal(t, "items[2].sku", verr.Fields[0].Field)
+	assert.Equal(t, "items[2].qty", verr.Fields[1].Field)
+	_, err = svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 1}, {SKU: "C-1", Quantity: 1}}, now)
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "items[1].sku", verr.Fields[0].Field)
+	_, err = svc.Quote(ctx, []QuoteItem{{SKU: "Z-1", Quantity: 1}}, now)
+	assert.True(t, product.IsErrNotFound(err))
+}
+
+func TestServiceQuoteTargets(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewPriceStorage(), products)
+	for _, p := range []product.Product{
+		{SKU: "A-1", Name: "Green tea", Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Box", Category: "tea", Tags: []string{"organic"}},
+		{SKU: "B-1", Name: "Cup", Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Piece", Category: "tableware", Tags: []string{"sale"}},
+		{SKU: "C-1", Name: "Pot", Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Piece", Category: "tableware"},
+	} {
+		_, err := products.AddProduct(ctx, p)
+		require.NoError(t, err)
+	}
+	for _, p := range []Promotion{
+		{Code: "tea-week", Name: "Tea week", Kind: PromotionPercent, PercentOff: 10, Categories: []string{"tea"}, Stackable: true},
+		{Code: "clearance", Name: "Clearance", Kind: PromotionPercent, PercentOff: 20, Tags: []string{"sale", "outlet"}, Stackable: true},
+	} {
+		_, err := svc.CreatePromotion(ctx, p)
+		require.NoError(t, err)
+	}
+
+	q, err := svc.Quote(ctx, []QuoteItem{{SKU: "A-1", Quantity: 1}, {SKU: "B-1", Quantity: 1}, {SKU: "C-1", Quantity: 1}}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, q.Lines, 3)
+	assert.Equal(t, []Discount{{Promotion: "tea-week", Name: "Tea week", Amount: money.Money{Amount: 100, Currency: "USD"}}}, q.Lines[0].Discounts)
+	assert.Equal(t, []Discount{{Promotion: "clearance", Name: "Clearance", Amount: money.Money{Amount: 200, Currency: "USD"}}}, q.Lines[1].Discounts)
+	assert.Empty(t, q.Lines[2].Discounts)
+}
@@ -0,0 +1,177 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+)
+
+// maxClockSkew is how far in the past a price may start, for clients whose
+// clock is a little ahead. It then starts at once.
+const maxClockSkew = time.Minute
+
+type Service struct {
+	storage  Storage
+	products *product.Service
+}
+
+// NewService returns a service pricing the products of products.
+func NewService(s Storage, products *product.Service) *Service {
+	return &Service{
+		storage:  s,
+		products: products,
+	}
+}
+
+func (s *Service) CreateList(ctx context.Context, l List) (*List, error) {
+	l.Currency = strings.ToUpper(l.Currency)
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	l.CreatedAt = time.Now().UTC()
+
+	err := s.storage.CreateList(ctx, l)
+	if err != nil {
+		if storage.IsErrAlreadyExist(err) {
+			return nil, fmt.Errorf("create price list %s: %v - %w", l.Code, err, ErrListExist)
+		}
+		return nil, fmt.Errorf("create price list: %w", err)
+	}
+	return &l, nil
+}
+
+func (s *Service) GetList(ctx context.Context, code string) (*List, error) {
+	l, err := s.storage.GetList(ctx, code)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", code, ErrListNotFound)
+		}
+		return nil, fmt.Errorf("get price list: %w", err)
+	}
+	return l, nil
+}
+
+func (s *Service) Lists(ctx context.Context) ([]List, error) {
+	lists, err := s.storage.Lists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list price lists: %w", err)
+	}
+	return lists, nil
+}
+
+// AddPrice prices e.SKU in e.List from e.From, now when it is zero, until
+// e.Until. Prices cannot start in the past, so a change is either made now
+// or scheduled ahead. The price is in the currency of the list when it has
+// none.
+func (s *Service) AddPrice(ctx context.Context, e Entry) (*Entry, error) {
+	l, err := s.GetList(ctx, e.List)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.products.GetProduct(ctx, e.SKU, false); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if e.Price.Currency == "" {
+		e.Price.Currency = l.Currency
+	}
+	e.Price.Currency = strings.ToUpper(e.Price.Currency)
+	if e.From.IsZero() || (e.From.Before(now) && now.Sub(e.From) <= maxClockSkew) {
+		e.From = now
+	}
+	e.From = e.From.UTC()
+	if !e.Until.IsZero() {
+		e.Until = e.Until.UTC()
+	}
+
+	var fields fieldErrors
+	switch {
+	case e.Price.Amount <= 0:
+		fields.add("price", product.CodeRequired, "price must be greater than zero")
+	case e.Price.Currency != l.Currency:
+		fields.add("price", product.CodeNotAllowed, "price currency must be %s, the currency of the list", l.Currency)
+	}
+	if e.From.Before(now) {
+		fields.add("valid_from", product.CodeNotAllowed, "valid_from must not be in the past")
+	}
+	if !e.Until.IsZero() && !e.Until.After(e.From) {
+		fields.add("valid_until", product.CodeNotAllowed, "valid_until must be after valid_from")
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
+	}
+
+	e.CreatedAt, e.CreatedBy = now, product.ActorFrom(ctx).User
+	e.ID, err = s.storage.AddEntry(ctx, e)
+	if err != nil {
+		return nil, fmt.Errorf("add price: %w", err)
+	}
+	return &e, nil
+}
+
+// RemovePrice cancels the price id of list, which must not have started.
+func (s *Service) RemovePrice(ctx context.Context, list string, id uint64) error {
+	e, err := s.storage.GetEntry(ctx, id)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return fmt.Errorf("price %d: %w", id, ErrPriceNotFound)
+		}
+		return fmt.Errorf("get price: %w", err)
+	}
+	if e.List != list {
+		return fmt.Errorf("price %d of %s: %w", id, list, ErrPriceNotFound)
+	}
+	if !time.Now().Before(e.From) {
+		return fmt.Errorf("price %d started at %s - %w", id, e.From.Format(time.RFC3339), ErrPriceStarted)
+	}
+
+	err = s.storage.DeleteEntry(ctx, id)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return fmt.Errorf("price %d: %w", id, ErrPriceNotFound)
+		}
+		return fmt.Errorf("delete price: %w", err)
+	}
+	return nil
+}
+
+// Prices returns the prices of sku in list, past, current and scheduled,
+// ordered by when they start. An empty list or sku matches all of them, so
+// the prices of sku in every list are its price history.
+func (s *Service) Prices(ctx context.Context, list, sku string) ([]Entry, error) {
+	if list != "" {
+		if _, err := s.GetList(ctx, list); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := s.storage.Entries(ctx, list, sku)
+	if err != nil {
+		return nil, fmt.Errorf("list prices: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].From.Before(entries[j].From)
+	})
+	return entries, nil
+}
+
+// Resolve returns the price of sku in list in effect at t.
+func (s *Service) Resolve(ctx context.Context, list, sku string, t time.Time) (*Entry, error) {
+	if _, err := s.GetList(ctx, list); err != nil {
+		return nil, err
+	}
+	entries, err := s.storage.Entries(ctx, list, sku)
+	if err != nil {
+		return nil, fmt.Errorf("list prices: %w", err)
+	}
+	e := effective(entries, t)
+	if e == nil {
+		return nil, fmt.Errorf("no price of %s in %s at %s: %w", sku, list, t.Format(time.RFC3339), ErrPriceNotFound)
+	}
+	return e, nil
+}
@@ -0,0 +1,116 @@
+package pricing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/pricing"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceLists(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(memory.NewPriceStorage(), product.NewService(memory.NewProductStorage()))
+
+	l, err := svc.CreateList(ctx, List{Code: "retail", Name: "Retail", Currency: "usd"})
+	require.NoError(t, err)
+	assert.Equal(t, "USD", l.Currency)
+	assert.False(t, l.CreatedAt.IsZero())
+	_, err = svc.CreateList(ctx, List{Code: "retail", Name: "Retail again", Currency: "USD"})
+	assert.True(t, IsErrListExist(err))
+	_, err = svc.CreateList(ctx, List{Code: "eu-wholesale", Name: "EU wholesale", Currency: "EUR"})
+	require.NoError(t, err)
+
+	_, err = svc.CreateList(ctx, List{Code: "Retail 2", Currency: "XXX1"})
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	fields := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		fields[i] = f.Field
+	}
+	assert.Equal(t, []string{"code", "name", "currency"}, fields)
+
+	lists, err := svc.Lists(ctx)
+	require.NoError(t, err)
+	require.Len(t, lists, 2)
+	assert.Equal(t, "eu-wholesale", lists[0].Code)
+	_, err = svc.GetList(ctx, "vip")
+	assert.True(t, IsErrListNotFound(err))
+}
+
+func TestServicePrices(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewPriceStorage(), products)
+	_, err := products.AddProduct(ctx, product.Product{SKU: "P-1", Name: "Tea", Price: money.Money{Amount: 1000, Currency: "USD"}, Unit: "Box"})
+	require.NoError(t, err)
+	_, err = svc.CreateList(ctx, List{Code: "retail", Name: "Retail", Currency: "USD"})
+	require.NoError(t, err)
+
+	usd := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "USD"} }
+	now := time.Now()
+	clerk := product.WithActor(ctx, product.Actor{User: "clerk@gmail.com"})
+
+	_, err = svc.Resolve(ctx, "retail", "P-1", now)
+	assert.True(t, IsErrPriceNotFound(err))
+
+	current, err := svc.AddPrice(clerk, Entry{List: "retail", SKU: "P-1", Price: money.Money{Amount: 1200}})
+	require.NoError(t, err)
+	assert.Equal(t, usd(1200), current.Price)
+	assert.Equal(t, "clerk@gmail.com", current.CreatedBy)
+	assert.False(t, current.From.Before(now))
+
+	// A lasting change next week, and a sale over it the week after.
+	raise, err := svc.AddPrice(ctx, Entry{List: "retail", SKU: "P-1", Price: usd(1500), From: now.Add(7 * 24 * time.Hour)})
+	require.NoError(t, err)
+	sale, err := svc.AddPrice(ctx, Entry{List: "retail", SKU: "P-1", Price: usd(999), From: now.Add(14 * 24 * time.Hour), Until: now.Add(21 * 24 * time.Hour)})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		at   time.Duration
+		want uint64
+	}{
+		{time.Hour, current.ID},
+		{8 * 24 * time.Hour, raise.ID},
+		{15 * 24 * time.Hour, sale.ID},
+		{22 * 24 * time.Hour, raise.ID},
+	} {
+		e, err := svc.Resolve(ctx, "retail", "P-1", now.Add(tc.at))
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, e.ID, "at +%s", tc.at)
+	}
+	_, err = svc.Resolve(ctx, "retail", "P-1", now.Add(-time.Hour))
+	assert.True(t, IsErrPriceNotFound(err))
+	_, err = svc.Resolve(ctx, "vip", "P-1", now)
+	assert.True(t, IsErrListNotFound(err))
+
+	_, err = svc.AddPrice(ctx, Entry{List: "retail", SKU: "P-1", Price: money.Money{Amount: 1, Currency: "EUR"}, From: now.Add(-time.Hour), Until: now.Add(-2 * time.Hour)})
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 3)
+	assert.Equal(t, "price", verr.Fields[0].Field)
+	assert.Equal(t, "valid_from", verr.Fields[1].Field)
+	assert.Equal(t, "valid_until", verr.Fields[2].Field)
+	_, err = svc.AddPrice(ctx, Entry{List: "retail", SKU: "P-404", Price: usd(1)})
+	assert.True(t, product.IsErrNotFound(err))
+	_, err = svc.AddPrice(ctx, Entry{List: "vip", SKU: "P-1", Price: usd(1)})
+	assert.True(t, IsErrListNotFound(err))
+
+	// Scheduled prices can be cancelled, not the ones in effect.
+	assert.True(t, IsErrPriceStarted(svc.RemovePrice(ctx, "retail", current.ID)))
+	assert.True(t, IsErrPriceNotFound(svc.RemovePrice(ctx, "vip", sale.ID)))
+	require.NoError(t, svc.RemovePrice(ctx, "retail", sale.ID))
+	assert.True(t, IsErrPriceNotFound(svc.RemovePrice(ctx, "retail", sale.ID)))
+
+	history, err := svc.Prices(ctx, "", "P-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, current.ID, history[0].ID)
+	assert.Equal(t, raise.ID, history[1].ID)
+}
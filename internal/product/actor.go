@@ -0,0 +1,23 @@
+package product
+
+import "context"
+
+// Actor is who made a change and from where.
+type Actor struct {
+	User string
+	IP   string
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx attributing the writes made with it to a.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFrom returns the actor carried by ctx, the zero Actor when there is
+// none.
+func ActorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
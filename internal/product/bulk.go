@@ -0,0 +1,338 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"sampleBackend/internal/storage"
+)
+
+// MaxBulkSize is the maximum number of products of one bulk write.
+const MaxBulkSize = 1000
+
+// maxUpsertAttempts bounds the attempts of an upsert racing with writers
+// creating and deleting the same SKU.
+const maxUpsertAttempts = 3
+
+var (
+	ErrInvalidBulk  = errors.New("invalid bulk request")
+	ErrBulkTooLarge = errors.New("too many products in bulk request")
+	// ErrBulkAborted is returned when an atomic bulk write is rolled back
+	// because one of its products failed.
+	ErrBulkAborted = errors.New("bulk write aborted")
+	ErrDuplicate   = errors.New("sku appears more than once")
+)
+
+type BulkMode string
+
+const (
+	// BulkCreate fails products whose SKU exists.
+	BulkCreate BulkMode = "create"
+	// BulkUpsert creates missing products and replaces existing ones.
+	BulkUpsert BulkMode = "upsert"
+	// BulkUpdate fails products whose SKU does not exist.
+	BulkUpdate BulkMode = "update"
+)
+
+func (m BulkMode) valid() bool {
+	switch m {
+	case BulkCreate, BulkUpsert, BulkUpdate:
+		return true
+	}
+	return false
+}
+
+type BulkStatus string
+
+const (
+	BulkCreated BulkStatus = "created"
+	BulkUpdated BulkStatus = "updated"
+	BulkFailed  BulkStatus = "failed"
+	// BulkSkipped marks the products not written because an atomic bulk
+	// write was aborted.
+	BulkSkipped BulkStatus = "skipped"
+)
+
+// BulkResult is the outcome for one product of a bulk write. Product is the
+// stored product when it was written, Err the reason when it failed.
+type BulkResult struct {
+	SKU     string
+	Status  BulkStatus
+	Product *Product
+	Err     error
+}
+
+// BulkProduct is a product of a bulk write. Its status is written when it
+// is created. An update keeps the current status: it fails when StatusSet
+// and the status is another one, as only SetStatus changes it.
+type BulkProduct struct {
+	Product
+	StatusSet bool
+}
+
+// Write is one write of Storage.Apply: a create when Create is set, an
+// update compare-and-swap on Product.Version otherwise.
+type Write struct {
+	Create  bool
+	Product Product
+}
+
+// BulkOptions controls a bulk write.
+type BulkOptions struct {
+	Mode BulkMode
+	// Atomic writes every product or, when one fails, none.
+	Atomic bool
+	// DryRun reports what a write would do without writing.
+	DryRun bool
+}
+
+// BulkWrite writes products according to opts and reports the outcome of
+// each, in order. Without Atomic every product is written on its own and
+// failures do not affect the others. With Atomic either every product is
+// written or none is, and ErrBulkAborted is returned along with the results
+// when one failed.
+func (s *Service) BulkWrite(ctx context.Context, products []BulkProduct, opts BulkOptions) ([]BulkResult, error) {
+	mode := opts.Mode
+	if !mode.valid() {
+		return nil, fmt.Errorf("mode %q - %w", mode, ErrInvalidBulk)
+	}
+	if len(products) > MaxBulkSize {
+		return nil, fmt.Errorf("%d products, at most %d - %w", len(products), MaxBulkSize, ErrBulkTooLarge)
+	}
+
+	products = append([]BulkProduct(nil), products...)
+	results := make([]BulkResult, len(products))
+	seen := make(map[string]bool, len(products))
+	for i := range products {
+		s.normalize(&products[i].Product)
+		p := products[i]
+		results[i].SKU = p.SKU
+		if seen[p.SKU] {
+			results[i].Status, results[i].Err = BulkFailed, fmt.Errorf("%s: %w", p.SKU, ErrDuplicate)
+			continue
+		}
+		seen[p.SKU] = true
+		if err := p.Validate(); err != nil {
+			results[i].Status, results[i].Err = BulkFailed, err
+		}
+	}
+
+	if opts.DryRun {
+		return results, s.bulkCheck(ctx, products, mode, opts.Atomic, results)
+	}
+	if opts.Atomic {
+		return results, s.bulkWriteAtomic(ctx, products, mode, results)
+	}
+
+	for i, p := range products {
+		if results[i].Status == BulkFailed {
+			continue
+		}
+		results[i].Status, results[i].Product, results[i].Err = s.bulkWriteOne(ctx, p, mode)
+	}
+	return results, nil
+}
+
+func (s *Service) bulkWriteOne(ctx context.Context, p BulkProduct, mode BulkMode) (BulkStatus, *Product, error) {
+	p.Version = 0
+	for attempt := 1; ; attempt++ {
+		if mode != BulkUpdate {
+			prd, err := s.AddProduct(ctx, p.Product)
+			if err == nil {
+				return BulkCreated, prd, nil
+			}
+			if mode == BulkCreate || !IsErrExist(err) {
+				return BulkFailed, nil, err
+			}
+		}
+
+		prd, err := s.update(ctx, p.Product, !p.StatusSet, false)
+		switch {
+		case err == nil:
+			return BulkUpdated, prd, nil
+		case IsErrNotFound(err) && mode == BulkUpsert && attempt < maxUpsertAttempts:
+			// Deleted since the create failed.
+			continue
+		}
+		return BulkFailed, nil, err
+	}
+}
+
+// statusChanged is the error of an update changing the status from current.
+func statusChanged(current Status) error {
+	return &ValidationError{Fields: []FieldError{{Field: "status", Code: CodeReadOnly, Message: fmt.Sprintf("status is %s and only changes on its own", current)}}}
+}
+
+// bulkCheck sets the results products would get from a write, without
+// writing. Products are not locked, so a write may still turn out different.
+func (s *Service) bulkCheck(ctx context.Context, products []BulkProduct, mode BulkMode, atomic bool, results []BulkResult) error {
+	failed := false
+	for i, p := range products {
+		if results[i].Status == BulkFailed {
+			failed = true
+			continue
+		}
+
+		before, err := s.lookup(ctx, p.SKU)
+		exist := before != nil && !before.Deleted()
+		switch {
+		case err != nil:
+			return err
+		case exist && mode == BulkCreate:
+			results[i].Status, results[i].Err = BulkFailed, ErrExist
+			failed = true
+		case exist && p.StatusSet && p.Status != before.Status:
+			results[i].Status, results[i].Err = BulkFailed, statusChanged(before.Status)
+			failed = true
+		case exist:
+			results[i].Status = BulkUpdated
+		case mode == BulkUpdate:
+			results[i].Status, results[i].Err = BulkFailed, ErrNotFound
+			failed = true
+		default:
+			results[i].Status = BulkCreated
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Status != BulkFailed {
+				results[i].Status = BulkSkipped
+			}
+		}
+		return ErrBulkAborted
+	}
+	return nil
+}
+
+func (s *Service) bulkWriteAtomic(ctx context.Context, products []BulkProduct, mode BulkMode, results []BulkResult) error {
+	skus := make([]string, len(products))
+	for i, p := range products {
+		skus[i] = p.SKU
+	}
+	unlock := s.lockSKUs(skus)
+	defer unlock()
+
+	var (
+		writes  = make([]Write, 0, len(products))
+		befores = make([]*Product, len(products))
+		failed  bool
+	)
+	for i, bp := range products {
+		if results[i].Status == BulkFailed {
+			failed = true
+			continue
+		}
+
+		p := bp.Product
+		p.DeletedAt, p.DeletedBy = time.Time{}, ""
+		before, err := s.lookup(ctx, p.SKU)
+		switch {
+		case err != nil:
+			return err
+		case before != nil && !before.Deleted():
+			if mode == BulkCreate {
+				results[i].Status, results[i].Err = BulkFailed, ErrExist
+				failed = true
+				continue
+			}
+			if bp.StatusSet && p.Status != before.Status {
+				results[i].Status, results[i].Err = BulkFailed, statusChanged(before.Status)
+				failed = true
+				continue
+			}
+			p.Status, p.Reserved, p.Holds = before.Status, before.Reserved, before.Holds
+			p.Levels, p.InTransit = before.Levels, before.InTransit
+			if err := p.checkStock(); err != nil {
+				results[i].Status, results[i].Err = BulkFailed, err
+				failed = true
+				continue
+			}
+			befores[i] = before
+			p.Version = before.Version
+			writes = append(writes, Write{Product: p})
+		case mode == BulkUpdate:
+			results[i].Status, results[i].Err = BulkFailed, ErrNotFound
+			failed = true
+			continue
+		case before != nil:
+			// Replaces the tombstone of a deleted product.
+			p.Version, p.Reserved, p.Holds, p.Levels, p.InTransit = before.Version, 0, nil, nil, 0
+			writes = append(writes, Write{Product: p})
+		default:
+			p.Version, p.Reserved, p.Holds, p.Levels, p.InTransit = 0, 0, nil, nil, 0
+			writes = append(writes, Write{Create: true, Product: p})
+		}
+	}
+
+	if failed {
+		for i := range results {
+			if results[i].Status != BulkFailed {
+				results[i].Status = BulkSkipped
+			}
+		}
+		return ErrBulkAborted
+	}
+
+	if err := s.storage.Apply(ctx, writes); err != nil {
+		if storage.IsErrConflict(err) || storage.IsErrAlreadyExist(err) || storage.IsErrNotFound(err) {
+			return fmt.Errorf("apply: %v - %w", err, ErrConflict)
+		}
+		return fmt.Errorf("apply: %w", err)
+	}
+
+	for i, p := range products {
+		after, err := s.storage.Get(ctx, p.SKU)
+		if err != nil {
+			return fmt.Errorf("get product: %w", err)
+		}
+		results[i].Product = after
+		if befores[i] == nil {
+			results[i].Status = BulkCreated
+			s.changes.append(Change{Op: ChangeCreate, SKU: p.SKU, After: after, Actor: ActorFrom(ctx)})
+			continue
+		}
+		results[i].Status = BulkUpdated
+		if after.Version != befores[i].Version {
+			s.changes.append(Change{Op: ChangeUpdate, SKU: p.SKU, Before: befores[i], After: after, Actor: ActorFrom(ctx)})
+		}
+	}
+	return nil
+}
+
+// lockSKUs locks the stripes of skus in a fixed order and returns the
+// function unlocking them.
+func (s *Service) lockSKUs(skus []string) func() {
+	var held [lockStripes]bool
+	for _, sku := range skus {
+		held[s.stripe(sku)] = true
+	}
+	var locked []int
+	for i := range held {
+		if held[i] {
+			s.locks[i].Lock()
+			locked = append(locked, i)
+		}
+	}
+	return func() {
+		sort.Sort(sort.Reverse(sort.IntSlice(locked)))
+		for _, i := range locked {
+			s.locks[i].Unlock()
+		}
+	}
+}
+
+func IsErrInvalidBulk(err error) bool {
+	return errors.Is(err, ErrInvalidBulk)
+}
+
+func IsErrBulkTooLarge(err error) bool {
+	return errors.Is(err, ErrBulkTooLarge)
+}
+
+func IsErrBulkAborted(err error) bool {
+	return errors.Is(err, ErrBulkAborted)
+}
@@ -0,0 +1,116 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceBulkWrite(t *testing.T) {
+	ctx := context.Background()
+	// Prices come without currency, as from legacy clients.
+	newProduct := func(sku string, price int64) BulkProduct {
+		return BulkProduct{Product: Product{SKU: sku, Name: "Bulk " + sku, Price: money.Money{Amount: price}, Unit: "Box"}}
+	}
+	statuses := func(results []BulkResult) []BulkStatus {
+		ret := make([]BulkStatus, len(results))
+		for i, r := range results {
+			ret[i] = r.Status
+		}
+		return ret
+	}
+	storages := map[string]func() Storage{
+		"memory": func() Storage { return memory.NewProductStorage() },
+		"event":  func() Storage { return memory.NewProductEventStorage(0) },
+	}
+
+	for name, newStorage := range storages {
+		newStorage := newStorage
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			svc := NewService(newStorage())
+			_, err := svc.AddProduct(ctx, newProduct("B-1", 10).Product)
+			require.NoError(t, err)
+			batch := []BulkProduct{newProduct("B-1", 11), newProduct("B-2", 20), {Product: Product{SKU: "B-3"}}, newProduct("B-2", 21)}
+
+			results, err := svc.BulkWrite(ctx, batch, BulkOptions{Mode: BulkCreate})
+			require.NoError(t, err)
+			assert.Equal(t, []BulkStatus{BulkFailed, BulkCreated, BulkFailed, BulkFailed}, statuses(results))
+			assert.True(t, IsErrExist(results[0].Err))
+			assert.True(t, IsErrInvalid(results[2].Err))
+			assert.ErrorIs(t, results[3].Err, ErrDuplicate)
+			assert.Equal(t, uint64(1), results[1].Product.Version)
+
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-1", 12), newProduct("B-4", 40)}, BulkOptions{Mode: BulkUpdate})
+			require.NoError(t, err)
+			assert.Equal(t, []BulkStatus{BulkUpdated, BulkFailed}, statuses(results))
+			assert.True(t, IsErrNotFound(results[1].Err))
+			assert.Equal(t, money.Money{Amount: 12, Currency: DefaultCurrency}, results[0].Product.Price)
+
+			head := svc.Changes().Head()
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-1", 13), newProduct("B-5", 50), {Product: Product{SKU: "B-6"}}}, BulkOptions{Mode: BulkUpsert, Atomic: true})
+			assert.True(t, IsErrBulkAborted(err))
+			assert.Equal(t, []BulkStatus{BulkSkipped, BulkSkipped, BulkFailed}, statuses(results))
+			assert.Equal(t, head, svc.Changes().Head())
+			_, err = svc.SearchProduct(ctx, "B-5")
+			assert.True(t, IsErrNotFound(err))
+
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-1", 13), newProduct("B-5", 50)}, BulkOptions{Mode: BulkUpsert, Atomic: true, DryRun: true})
+			require.NoError(t, err)
+			assert.Equal(t, []BulkStatus{BulkUpdated, BulkCreated}, statuses(results))
+			assert.Nil(t, results[0].Product)
+			assert.Equal(t, head, svc.Changes().Head())
+
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-1", 13), newProduct("B-5", 50)}, BulkOptions{Mode: BulkUpsert, Atomic: true})
+			require.NoError(t, err)
+			assert.Equal(t, []BulkStatus{BulkUpdated, BulkCreated}, statuses(results))
+			assert.Equal(t, uint64(3), results[0].Product.Version)
+			changes, err := svc.Changes().ReadChanges(head, 10)
+			require.NoError(t, err)
+			require.Len(t, changes, 2)
+			assert.Equal(t, ChangeUpdate, changes[0].Op)
+			assert.Equal(t, ChangeCreate, changes[1].Op)
+
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-5", 51), newProduct("B-7", 70)}, BulkOptions{Mode: BulkUpdate, Atomic: true})
+			assert.True(t, IsErrBulkAborted(err))
+			assert.Equal(t, []BulkStatus{BulkSkipped, BulkFailed}, statuses(results))
+			got, err := svc.SearchProduct(ctx, "B-5")
+			require.NoError(t, err)
+			assert.Equal(t, money.Money{Amount: 50, Currency: DefaultCurrency}, got.Price)
+
+			// Updates keep the status, which cannot be changed.
+			_, err = svc.SetStatus(ctx, "B-5", StatusActive, 0)
+			require.NoError(t, err)
+			draft, active := newProduct("B-5", 52), newProduct("B-5", 52)
+			draft.StatusSet = true
+			active.Status, active.StatusSet = StatusActive, true
+			for _, opts := range []BulkOptions{{Mode: BulkUpsert}, {Mode: BulkUpdate, Atomic: true}, {Mode: BulkUpdate, DryRun: true}} {
+				results, err = svc.BulkWrite(ctx, []BulkProduct{draft}, opts)
+				require.Len(t, results, 1)
+				assert.Equal(t, BulkFailed, results[0].Status)
+				var verr *ValidationError
+				require.ErrorAs(t, results[0].Err, &verr)
+				assert.Equal(t, "status", verr.Fields[0].Field)
+				assert.Equal(t, CodeReadOnly, verr.Fields[0].Code)
+			}
+			results, err = svc.BulkWrite(ctx, []BulkProduct{newProduct("B-5", 53)}, BulkOptions{Mode: BulkUpsert})
+			require.NoError(t, err)
+			assert.Equal(t, StatusActive, results[0].Product.Status)
+			results, err = svc.BulkWrite(ctx, []BulkProduct{active}, BulkOptions{Mode: BulkUpdate, Atomic: true})
+			require.NoError(t, err)
+			assert.Equal(t, BulkUpdated, results[0].Status)
+
+			_, err = svc.BulkWrite(ctx, nil, BulkOptions{Mode: "merge"})
+			assert.True(t, IsErrInvalidBulk(err))
+			_, err = svc.BulkWrite(ctx, make([]BulkProduct, MaxBulkSize+1), BulkOptions{Mode: BulkCreate})
+			assert.True(t, IsErrBulkTooLarge(err))
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChangeRetention    = 100000
+	defaultChangeRetentionAge = 24 * time.Hour
+)
+
+var ErrChangeExpired = errors.New("change offset expired")
+
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+	// ChangeRestore brings back a deleted product.
+	ChangeRestore ChangeOp = "restore"
+	// ChangePurge removes the tombstone of a deleted product for good.
+	ChangePurge ChangeOp = "purge"
+	// ChangeReset means the whole catalog was replaced, e.g. by a restore.
+	// Consumers have to reload from a snapshot.
+	ChangeReset ChangeOp = "reset"
+)
+
+// Change is one successful mutation of the catalog. Before is nil on create,
+// After is the tombstone on delete and nil on purge. Actor is taken from the
+// context of the write. Movements are set on the changes made by MoveStock
+// and the stock operations, a sale may take from several locations.
+type Change struct {
+	Seq       uint64
+	Op        ChangeOp
+	SKU       string
+	Before    *Product
+	After     *Product
+	Time      time.Time
+	Actor     Actor
+	Movements []Movement
+	// Resets are set on resets, one for each product whose stock moved.
+	Resets []StockReset
+}
+
+// StockReset is the stock of a product which a reset moved: Quantity and
+// Version are the ones after it, 0 when it removed the product.
+type StockReset struct {
+	SKU       string
+	Quantity  uint32
+	Version   uint64
+	Movements []Movement
+}
+
+// ChangeHook records a change synchronously. Hooks are called in Seq order
+// while the write is still under way, so the change is recorded before the
+// write returns and cannot expire first. They must not write products nor
+// read the change stream.
+type ChangeHook func(c Change)
+
+// ChangeStream is the ordered stream of catalog changes. Sequence numbers
+// start at 1 and increase by one per change.
+//
+// A consumer bootstrapping from scratch reads Head, then loads a snapshot,
+// then follows the stream from that head. Changes already contained in the
+// snapshot are replayed, which is harmless when applying the After image.
+type ChangeStream interface {
+	// Head returns the sequence number the next change will get.
+	Head() uint64
+	// ReadChanges returns up to limit changes starting at sequence from
+	// without blocking. It fails with ErrChangeExpired when from fell out of
+	// the retention window.
+	ReadChanges(from uint64, limit int) ([]Change, error)
+	// WaitChanges is ReadChanges, but blocks until at least one change is
+	// available or ctx is done.
+	WaitChanges(ctx context.Context, from uint64, limit int) ([]Change, error)
+}
+
+// ChangeLog is an in-memory ChangeStream keeping the most recent changes
+// within a count and an age limit.
+type ChangeLog struct {
+	mu sync.Mutex
+	// changes[start:] are the retained changes, the dropped prefix is
+	// compacted away once it dominates the slice.
+	changes []Change
+	start   int
+	next    uint64
+	notify  chan struct{}
+	maxLen  int
+	maxAge  time.Duration
+	hooks   []ChangeHook
+}
+
+// NewChangeLog returns a log retaining at most maxLen changes no older than
+// maxAge. Zero values disable the respective limit.
+func NewChangeLog(maxLen int, maxAge time.Duration) *ChangeLog {
+	return &ChangeLog{
+		next:   1,
+		notify: make(chan struct{}),
+		maxLen: maxLen,
+		maxAge: maxAge,
+	}
+}
+
+// append publishes c under the next sequence number, at the current time,
+// and calls the hooks with it.
+func (cl *ChangeLog) append(c Change) Change {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	c.Seq, c.Time = cl.next, time.Now()
+	cl.next++
+	cl.changes = append(cl.changes, c)
+	cl.trim(c.Time)
+	for _, hook := range cl.hooks {
+		hook(Change{Seq: c.Seq, Op: c.Op, SKU: c.SKU, Before: clone(c.Before), After: clone(c.After), Time: c.Time, Actor: c.Actor, Movements: c.Movements, Resets: c.Resets})
+	}
+
+	close(cl.notify)
+	cl.notify = make(chan struct{})
+
+	return c
+}
+
+func (cl *ChangeLog) trim(now time.Time) {
+	if cl.maxLen > 0 && len(cl.changes)-cl.start > cl.maxLen {
+		cl.start = len(cl.changes) - cl.maxLen
+	}
+	if cl.maxAge > 0 {
+		for cl.start < len(cl.changes) && now.Sub(cl.changes[cl.start].Time) > cl.maxAge {
+			cl.start++
+		}
+	}
+	if cl.start > 0 && cl.start >= len(cl.changes)/2 {
+		cl.changes = append(cl.changes[:0:0], cl.changes[cl.start:]...)
+		cl.start = 0
+	}
+}
+
+func (cl *ChangeLog) Head() uint64 {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return cl.next
+}
+
+func (cl *ChangeLog) ReadChanges(from uint64, limit int) ([]Change, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	ret, _, err := cl.read(from, limit)
+	return ret, err
+}
+
+func (cl *ChangeLog) WaitChanges(ctx context.Context, from uint64, limit int) ([]Change, error) {
+	for {
+		cl.mu.Lock()
+		ret, notify, err := cl.read(from, limit)
+		cl.mu.Unlock()
+		if err != nil || len(ret) > 0 {
+			return ret, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// read must be called with mu held. It also returns the channel closed on the
+// next append.
+func (cl *ChangeLog) read(from uint64, limit int) ([]Change, <-chan struct{}, error) {
+	cl.trim(time.Now())
+
+	retained := cl.changes[cl.start:]
+	first := cl.next - uint64(len(retained))
+	if from < first {
+		return nil, nil, ErrChangeExpired
+	}
+	if from >= cl.next {
+		return nil, cl.notify, nil
+	}
+
+	changes := retained[from-first:]
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	ret := make([]Change, len(changes))
+	for i, c := range changes {
+		c.Before, c.After = clone(c.Before), clone(c.After)
+		ret[i] = c
+	}
+	return ret, cl.notify, nil
+}
+
+func clone(p *Product) *Product {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func IsErrChangeExpired(err error) bool {
+	return errors.Is(err, ErrChangeExpired)
+}
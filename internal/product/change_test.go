@@ -0,0 +1,162 @@
+package product_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceChanges(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("mutations produce ordered changes", func(t *testing.T) {
+		t.Parallel()
+
+		svc := NewService(memory.NewProductStorage())
+		stream := svc.Changes()
+		require.Equal(t, uint64(1), stream.Head())
+
+		p := Product{SKU: "CDC-001", Name: "cdc", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+		created, err := svc.AddProduct(ctx, p)
+		require.NoError(t, err)
+		p.Version = 1
+		assert.Equal(t, p, *created)
+		_, err = svc.AddProduct(ctx, p)
+		require.True(t, IsErrExist(err))
+
+		updated := p
+		updated.Price.Amount = 20
+		got, err := svc.UpdateProduct(ctx, updated)
+		require.NoError(t, err)
+		updated.Version = 2
+		assert.Equal(t, updated, *got)
+
+		_, err = svc.UpdateProduct(ctx, Product{SKU: "cdc-001"})
+		require.True(t, IsErrInvalid(err))
+		_, err = svc.UpdateProduct(ctx, Product{SKU: "CDC-404", Name: "cdc", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+		require.True(t, IsErrNotFound(err))
+
+		// Stale versions are rejected and leave no change behind.
+		_, err = svc.UpdateProduct(ctx, p)
+		require.True(t, IsErrConflict(err))
+		require.True(t, IsErrConflict(svc.DeleteProduct(ctx, p.SKU, 1, "cdc@example.com")))
+		require.NoError(t, svc.DeleteProduct(ctx, p.SKU, 2, "cdc@example.com"))
+
+		changes, err := stream.ReadChanges(1, 0)
+		require.NoError(t, err)
+		require.Len(t, changes, 3)
+
+		assert.Equal(t, uint64(1), changes[0].Seq)
+		assert.Equal(t, ChangeCreate, changes[0].Op)
+		assert.Nil(t, changes[0].Before)
+		assert.Equal(t, p, *changes[0].After)
+
+		assert.Equal(t, uint64(2), changes[1].Seq)
+		assert.Equal(t, ChangeUpdate, changes[1].Op)
+		assert.Equal(t, p, *changes[1].Before)
+		assert.Equal(t, updated, *changes[1].After)
+
+		assert.Equal(t, uint64(3), changes[2].Seq)
+		assert.Equal(t, ChangeDelete, changes[2].Op)
+		assert.Equal(t, updated, *changes[2].Before)
+		assert.True(t, changes[2].After.Deleted())
+		assert.Equal(t, "cdc@example.com", changes[2].After.DeletedBy)
+		assert.Equal(t, uint64(3), changes[2].After.Version)
+
+		changes, err = stream.ReadChanges(2, 1)
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Equal(t, uint64(2), changes[0].Seq)
+
+		changes, err = stream.ReadChanges(stream.Head(), 0)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("wait for changes", func(t *testing.T) {
+		t.Parallel()
+
+		svc := NewService(memory.NewProductStorage())
+		stream := svc.Changes()
+
+		done := make(chan []Change)
+		go func() {
+			changes, err := stream.WaitChanges(ctx, 1, 10)
+			assert.NoError(t, err)
+			done <- changes
+		}()
+
+		_, err := svc.AddProduct(ctx, Product{SKU: "WAIT-001", Name: "wait", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+		require.NoError(t, err)
+		select {
+		case changes := <-done:
+			require.Len(t, changes, 1)
+			assert.Equal(t, "WAIT-001", changes[0].SKU)
+		case <-time.After(5 * time.Second):
+			t.Fatal("WaitChanges not woken up")
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = stream.WaitChanges(cctx, stream.Head(), 10)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("retention window", func(t *testing.T) {
+		t.Parallel()
+
+		svc := NewService(memory.NewProductStorage(), WithChangeRetention(5, time.Hour))
+		for i := 0; i < 20; i++ {
+			_, err := svc.AddProduct(ctx, Product{SKU: fmt.Sprintf("RET-%02d", i), Name: "ret", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+		}
+
+		_, err := svc.Changes().ReadChanges(1, 0)
+		assert.True(t, IsErrChangeExpired(err))
+
+		changes, err := svc.Changes().ReadChanges(16, 0)
+		require.NoError(t, err)
+		require.Len(t, changes, 5)
+		assert.Equal(t, "RET-19", changes[4].SKU)
+	})
+
+	t.Run("concurrent updates are ordered per sku", func(t *testing.T) {
+		t.Parallel()
+
+		svc := NewService(memory.NewProductStorage())
+		_, err := svc.AddProduct(ctx, Product{SKU: "ORD-001", Name: "ord", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_, err := svc.UpdateProduct(ctx, Product{SKU: "ORD-001", Name: "ord", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Quantity: uint32(w*100 + i)})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		changes, err := svc.Changes().ReadChanges(1, 0)
+		require.NoError(t, err)
+		require.Len(t, changes, 401)
+		for i := 1; i < len(changes); i++ {
+			assert.Equal(t, changes[i-1].Seq+1, changes[i].Seq)
+			assert.Equal(t, *changes[i-1].After, *changes[i].Before)
+			assert.Equal(t, changes[i].Before.Version+1, changes[i].After.Version)
+		}
+	})
+}
@@ -0,0 +1,300 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sampleBackend/internal/money"
+)
+
+var (
+	ErrTemporalUnsupported = errors.New("storage does not keep product history")
+	ErrHistoryCompacted    = errors.New("product history compacted")
+)
+
+type EventType string
+
+const (
+	EventProductCreated    EventType = "ProductCreated"
+	EventDetailsChanged    EventType = "DetailsChanged"
+	EventPriceChanged      EventType = "PriceChanged"
+	EventQuantityAdjusted  EventType = "QuantityAdjusted"
+	EventReservedAdjusted  EventType = "ReservedAdjusted"
+	EventLevelsChanged     EventType = "LevelsChanged"
+	EventInTransitAdjusted EventType = "InTransitAdjusted"
+	EventStatusChanged     EventType = "StatusChanged"
+	EventProductDeleted    EventType = "ProductDeleted"
+	EventProductRestored   EventType = "ProductRestored"
+	EventProductPurged     EventType = "ProductPurged"
+)
+
+// Event is an immutable fact about a product. Only the payload fields
+// relevant to Type are set:
+//
+//	ProductCreated    Name, Unit, Price, Quantity, Status, Category, Tags
+//	DetailsChanged    Name, Unit, Category, Tags
+//	PriceChanged      Price
+//	QuantityAdjusted  Delta
+//	ReservedAdjusted  Hold, Delta
+//	LevelsChanged     Levels
+//	InTransitAdjusted Delta
+//	StatusChanged     Status
+//	ProductDeleted    DeletedAt, DeletedBy
+//	ProductRestored   none
+//	ProductPurged     none
+//
+// A ProductDeleted event turns the product into a tombstone and drops its
+// reservations, a purged one is gone.
+type Event struct {
+	// Seq is the position in the whole store, Version the position in the
+	// stream of the SKU. Both start at 1. ProductVersion is the
+	// Product.Version reached by the write the event belongs to.
+	Seq            uint64
+	Version        uint64
+	ProductVersion uint64
+	SKU            string
+	Type           EventType
+	Time           time.Time
+
+	Name     string
+	Unit     string
+	Price    money.Money
+	Quantity uint32
+	Delta    int64
+	Status   Status
+	Levels   []StockLevel
+	Hold     string
+	Category string
+	Tags     []string
+
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// TemporalStorage is implemented by storages that keep the full history of
+// every product.
+type TemporalStorage interface {
+	// Events returns the events of sku in order. Storages compacting the
+	// history return the events since the oldest one kept.
+	Events(ctx context.Context, sku string) ([]Event, error)
+	// GetAt returns sku as it was at t. It fails with ErrHistoryCompacted
+	// when t is before the compacted history.
+	GetAt(ctx context.Context, sku string, t time.Time) (*Product, error)
+}
+
+// Diff returns the events turning before into after. A nil before creates
+// the product, a nil after purges it. Events only carry payload, Seq,
+// Version, ProductVersion and Time are set by the store.
+func Diff(before, after *Product) []Event {
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		// Only restored products are created with stock held, at other
+		// locations or in transit, or deleted.
+		events := []Event{{
+			SKU:      after.SKU,
+			Type:     EventProductCreated,
+			Name:     after.Name,
+			Unit:     after.Unit,
+			Price:    after.Price,
+			Quantity: after.Quantity,
+			Status:   after.Status,
+			Category: after.Category,
+			Tags:     after.Tags,
+		}}
+		for _, h := range after.Holds {
+			events = append(events, Event{SKU: after.SKU, Type: EventReservedAdjusted, Hold: h.ID, Delta: int64(h.Quantity)})
+		}
+		if len(after.Levels) > 0 {
+			events = append(events, Event{SKU: after.SKU, Type: EventLevelsChanged, Levels: after.Levels})
+		}
+		if after.InTransit > 0 {
+			events = append(events, Event{SKU: after.SKU, Type: EventInTransitAdjusted, Delta: int64(after.InTransit)})
+		}
+		if after.Deleted() {
+			events = append(events, deleted(after))
+		}
+		return events
+	case after == nil:
+		return []Event{{SKU: before.SKU, Type: EventProductPurged}}
+	case !before.Deleted() && after.Deleted():
+		// Deleting drops the holds, any other change comes first.
+		live := *after
+		live.DeletedAt, live.DeletedBy = time.Time{}, ""
+		live.Reserved, live.Holds = before.Reserved, before.Holds
+		return append(Diff(before, &live), deleted(after))
+	}
+
+	var events []Event
+	if before.Deleted() && !after.Deleted() {
+		events = append(events, Event{SKU: after.SKU, Type: EventProductRestored})
+	}
+	if before.Name != after.Name || before.Unit != after.Unit || before.Category != after.Category || !equalTags(before.Tags, after.Tags) {
+		events = append(events, Event{
+			SKU:      after.SKU,
+			Type:     EventDetailsChanged,
+			Name:     after.Name,
+			Unit:     after.Unit,
+			Category: after.Category,
+			Tags:     after.Tags,
+		})
+	}
+	if before.Price != after.Price {
+		events = append(events, Event{SKU: after.SKU, Type: EventPriceChanged, Price: after.Price})
+	}
+	if before.Quantity != after.Quantity {
+		events = append(events, Event{
+			SKU:   after.SKU,
+			Type:  EventQuantityAdjusted,
+			Delta: int64(after.Quantity) - int64(before.Quantity),
+		})
+	}
+	for _, id := range changedHolds(before.Holds, after.Holds) {
+		events = append(events, Event{
+			SKU:   after.SKU,
+			Type:  EventReservedAdjusted,
+			Hold:  id,
+			Delta: int64(after.HeldBy(id)) - int64(before.HeldBy(id)),
+		})
+	}
+	if !equalLevels(before.Levels, after.Levels) {
+		events = append(events, Event{SKU: after.SKU, Type: EventLevelsChanged, Levels: after.Levels})
+	}
+	if before.InTransit != after.InTransit {
+		events = append(events, Event{
+			SKU:   after.SKU,
+			Type:  EventInTransitAdjusted,
+			Delta: int64(after.InTransit) - int64(before.InTransit),
+		})
+	}
+	if before.Status != after.Status {
+		events = append(events, Event{SKU: after.SKU, Type: EventStatusChanged, Status: after.Status})
+	}
+	if after.Deleted() && (before.DeletedAt != after.DeletedAt || before.DeletedBy != after.DeletedBy) {
+		events = append(events, deleted(after))
+	}
+	return events
+}
+
+func deleted(p *Product) Event {
+	return Event{SKU: p.SKU, Type: EventProductDeleted, DeletedAt: p.DeletedAt, DeletedBy: p.DeletedBy}
+}
+
+// Replay folds events into the product they describe. It returns nil when
+// the product does not exist after the last event.
+func Replay(events []Event) *Product {
+	return Fold(nil, events)
+}
+
+// Fold applies events to a copy of p, nil when the product does not exist,
+// and returns the result. Holds and Levels are copied on write, a shallow
+// copy is enough.
+func Fold(p *Product, events []Event) *Product {
+	if p != nil {
+		cp := *p
+		p = &cp
+	}
+	for _, e := range events {
+		switch e.Type {
+		case EventProductCreated:
+			p = &Product{
+				SKU:      e.SKU,
+				Name:     e.Name,
+				Quantity: e.Quantity,
+				Price:    e.Price,
+				Unit:     e.Unit,
+				Status:   e.Status,
+				Category: e.Category,
+				Tags:     e.Tags,
+			}
+		case EventProductPurged:
+			p = nil
+		}
+		if p == nil {
+			continue
+		}
+		p.Version = e.ProductVersion
+
+		switch e.Type {
+		case EventDetailsChanged:
+			p.Name, p.Unit = e.Name, e.Unit
+			p.Category, p.Tags = e.Category, e.Tags
+		case EventPriceChanged:
+			p.Price = e.Price
+		case EventQuantityAdjusted:
+			p.Quantity = uint32(int64(p.Quantity) + e.Delta)
+		case EventReservedAdjusted:
+			p.hold(e.Hold, e.Delta)
+		case EventLevelsChanged:
+			p.Levels = e.Levels
+		case EventInTransitAdjusted:
+			p.InTransit = uint32(int64(p.InTransit) + e.Delta)
+		case EventStatusChanged:
+			p.Status = e.Status
+		case EventProductDeleted:
+			p.DeletedAt, p.DeletedBy = e.DeletedAt, e.DeletedBy
+			p.Reserved, p.Holds = 0, nil
+		case EventProductRestored:
+			p.DeletedAt, p.DeletedBy = time.Time{}, ""
+		}
+	}
+	return p
+}
+
+// changedHolds returns the IDs of the holds differing between a and b, in
+// order.
+func changedHolds(a, b []Hold) []string {
+	var ids []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || i < len(a) && a[i].ID < b[j].ID:
+			ids = append(ids, a[i].ID)
+			i++
+		case i == len(a) || b[j].ID < a[i].ID:
+			ids = append(ids, b[j].ID)
+			j++
+		default:
+			if a[i].Quantity != b[j].Quantity {
+				ids = append(ids, a[i].ID)
+			}
+			i++
+			j++
+		}
+	}
+	return ids
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalLevels(a, b []StockLevel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func IsErrTemporalUnsupported(err error) bool {
+	return errors.Is(err, ErrTemporalUnsupported)
+}
+
+func IsErrHistoryCompacted(err error) bool {
+	return errors.Is(err, ErrHistoryCompacted)
+}
@@ -0,0 +1,65 @@
+package product
+
+import "strings"
+
+// Filter narrows a product query. Zero-valued fields do not filter, except
+// that deleted products only match with IncludeDeleted. Unit, NamePrefix and
+// Currency are compared case-insensitively, bounds are inclusive. Price bounds
+// are in minor units of the currency of each product. With Location only the
+// products with stock there match, unless MinQuantity is set, and the
+// quantity bounds apply to the stock there.
+type Filter struct {
+	Status      *Status
+	Unit        string
+	NamePrefix  string
+	MinPrice    *uint64
+	MaxPrice    *uint64
+	Currency    string
+	MinQuantity *uint32
+	MaxQuantity *uint32
+	Location    string
+
+	IncludeDeleted bool
+}
+
+func (f Filter) IsZero() bool {
+	return f == Filter{}
+}
+
+func (f Filter) Match(p Product) bool {
+	if p.Deleted() && !f.IncludeDeleted {
+		return false
+	}
+	if f.Status != nil && p.Status != *f.Status {
+		return false
+	}
+	if f.Unit != "" && !strings.EqualFold(p.Unit, f.Unit) {
+		return false
+	}
+	if f.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(p.Name), strings.ToLower(f.NamePrefix)) {
+		return false
+	}
+	if f.Currency != "" && !strings.EqualFold(p.Price.Currency, f.Currency) {
+		return false
+	}
+	if f.MinPrice != nil && (p.Price.Amount < 0 || uint64(p.Price.Amount) < *f.MinPrice) {
+		return false
+	}
+	if f.MaxPrice != nil && p.Price.Amount >= 0 && uint64(p.Price.Amount) > *f.MaxPrice {
+		return false
+	}
+	q := p.Quantity
+	if f.Location != "" {
+		q = p.StockAt(f.Location)
+		if q == 0 && f.MinQuantity == nil {
+			return false
+		}
+	}
+	if f.MinQuantity != nil && q < *f.MinQuantity {
+		return false
+	}
+	if f.MaxQuantity != nil && q > *f.MaxQuantity {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,294 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sampleBackend/internal/money"
+)
+
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+type SortField string
+
+const (
+	SortBySKU      SortField = "sku"
+	SortByName     SortField = "name"
+	SortByPrice    SortField = "price"
+	SortByQuantity SortField = "qty"
+)
+
+func (f SortField) Valid() bool {
+	switch f {
+	case SortBySKU, SortByName, SortByPrice, SortByQuantity:
+		return true
+	}
+	return false
+}
+
+// ListOptions selects a page of products. The order is always total: ties
+// on the sort field are broken by SKU, so cursors stay stable. A zero Limit
+// returns every matching product.
+type ListOptions struct {
+	Filter
+
+	Sort   SortField
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+func (o ListOptions) sortField() SortField {
+	if o.Sort == "" {
+		return SortBySKU
+	}
+	return o.Sort
+}
+
+// Less reports whether a sorts before b in the order requested by o.
+func (o ListOptions) Less(a, b *Product) bool {
+	c := 0
+	switch o.sortField() {
+	case SortByName:
+		c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case SortByPrice:
+		c = comparePrice(a.Price, b.Price)
+	case SortByQuantity:
+		c = compareUint(uint64(a.Quantity), uint64(b.Quantity))
+	}
+	if c == 0 {
+		c = strings.Compare(a.SKU, b.SKU)
+	}
+	if o.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrice orders prices by currency, then amount, as prices in
+// different currencies cannot be compared.
+func comparePrice(a, b money.Money) int {
+	if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+		return c
+	}
+	switch {
+	case a.Amount < b.Amount:
+		return -1
+	case a.Amount > b.Amount:
+		return 1
+	}
+	return 0
+}
+
+// SortProducts orders products as requested by o.
+func (o ListOptions) SortProducts(products []Product) {
+	sort.Slice(products, func(i, j int) bool {
+		return o.Less(&products[i], &products[j])
+	})
+}
+
+// Page is one page of a product listing. Total counts every product matching
+// the filter, Next and Prev are empty when there is no such page.
+type Page struct {
+	Items []*Product
+	Total int
+	Next  string
+	Prev  string
+}
+
+// cursor points between two products of a listing. Key holds the SKU and
+// the sort field of the product next to it.
+type cursor struct {
+	Sort     SortField `json:"s"`
+	Desc     bool      `json:"d,omitempty"`
+	Backward bool      `json:"b,omitempty"`
+	Key      Product   `json:"k"`
+}
+
+func (o ListOptions) encodeCursor(p Product, backward bool) string {
+	key := Product{SKU: p.SKU}
+	switch o.sortField() {
+	case SortByName:
+		key.Name = p.Name
+	case SortByPrice:
+		key.Price = p.Price
+	case SortByQuantity:
+		key.Quantity = p.Quantity
+	}
+
+	b, _ := json.Marshal(cursor{Sort: o.sortField(), Desc: o.Desc, Backward: backward, Key: key})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (o ListOptions) decodeCursor() (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("decode cursor %q - %w", o.Cursor, ErrInvalidListOptions)
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("decode cursor %q - %w", o.Cursor, ErrInvalidListOptions)
+	}
+	if c.Sort != o.sortField() || c.Desc != o.Desc {
+		return nil, fmt.Errorf("cursor was issued for another sort order - %w", ErrInvalidListOptions)
+	}
+	return &c, nil
+}
+
+// Validate checks the sort field and the limit of o.
+func (o ListOptions) Validate() error {
+	if o.Sort != "" && !o.Sort.Valid() {
+		return fmt.Errorf("unknown sort field %q - %w", o.Sort, ErrInvalidListOptions)
+	}
+	if o.Limit < 0 {
+		return fmt.Errorf("negative limit - %w", ErrInvalidListOptions)
+	}
+	return nil
+}
+
+// Paginate cuts the page selected by o out of products, which must hold
+// every product matching o.Filter already sorted by o.Less.
+func Paginate(products []Product, o ListOptions) (*Page, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		total    = len(products)
+		lo, hi   = 0, total
+		backward bool
+	)
+	if o.Cursor != "" {
+		c, err := o.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		backward = c.Backward
+		if backward {
+			// Everything strictly before the key.
+			hi = sort.Search(total, func(i int) bool { return !o.Less(&products[i], &c.Key) })
+		} else {
+			// Everything strictly after the key.
+			lo = sort.Search(total, func(i int) bool { return o.Less(&c.Key, &products[i]) })
+		}
+	}
+	if o.Limit > 0 && hi-lo > o.Limit {
+		if backward {
+			lo = hi - o.Limit
+		} else {
+			hi = lo + o.Limit
+		}
+	}
+
+	page := &Page{
+		Items: make([]*Product, 0, hi-lo),
+		Total: total,
+	}
+	for i := lo; i < hi; i++ {
+		p := products[i]
+		page.Items = append(page.Items, &p)
+	}
+	if hi < total && hi > 0 {
+		page.Next = o.encodeCursor(products[hi-1], false)
+	}
+	if lo > 0 && lo < total {
+		page.Prev = o.encodeCursor(products[lo], true)
+	}
+
+	return page, nil
+}
+
+// Scan cuts the page selected by o out of products, which must be sorted by
+// o.Less in ascending order whatever o.Desc, keeping the ones matching
+// o.Filter, of which there are total. Unlike Paginate, it starts from the
+// cursor and only visits the products up to the end of the page and the
+// next match on each side of it.
+func Scan(products []Product, total int, o ListOptions) (*Page, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	n := len(products)
+	at := func(i int) *Product {
+		if o.Desc {
+			return &products[n-1-i]
+		}
+		return &products[i]
+	}
+	// find returns the first match from i on by step, -1 or n when none.
+	find := func(i, step int) int {
+		for ; i >= 0 && i < n && !o.Filter.Match(*at(i)); i += step {
+		}
+		return i
+	}
+
+	var (
+		lo, hi   = 0, n
+		backward bool
+	)
+	if o.Cursor != "" {
+		c, err := o.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		backward = c.Backward
+		if backward {
+			hi = sort.Search(n, func(i int) bool { return !o.Less(at(i), &c.Key) })
+		} else {
+			lo = sort.Search(n, func(i int) bool { return o.Less(&c.Key, at(i)) })
+		}
+	}
+
+	var matches []int
+	full := func() bool { return o.Limit > 0 && len(matches) == o.Limit }
+	if backward {
+		for i := find(hi-1, -1); i >= 0 && !full(); i = find(i-1, -1) {
+			matches = append(matches, i)
+		}
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	} else {
+		for i := find(lo, 1); i < n && !full(); i = find(i+1, 1) {
+			matches = append(matches, i)
+		}
+	}
+
+	page := &Page{
+		Items: make([]*Product, 0, len(matches)),
+		Total: total,
+	}
+	for _, i := range matches {
+		p := *at(i)
+		page.Items = append(page.Items, &p)
+	}
+	if len(matches) > 0 {
+		first, last := matches[0], matches[len(matches)-1]
+		if find(last+1, 1) < n {
+			page.Next = o.encodeCursor(*at(last), false)
+		}
+		if find(first-1, -1) >= 0 {
+			page.Prev = o.encodeCursor(*at(first), true)
+		}
+	}
+
+	return page, nil
+}
+
+func IsErrInvalidListOptions(err error) bool {
+	return errors.Is(err, ErrInvalidListOptions)
+}
@@ -0,0 +1,149 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+)
+
+// DefaultLocation holds the stock of a product which is not at another
+// location, e.g. all of it before warehouses were used.
+const DefaultLocation = "main"
+
+// MaxLocationLength bounds the code of a location.
+const MaxLocationLength = 32
+
+// Reason codes of the transfer movements made by ShipStock and
+// ReceiveStock.
+const (
+	ReasonTransferOut = "transfer_out"
+	ReasonTransferIn  = "transfer_in"
+)
+
+var locationPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// StockLevel is the stock of a product at a location.
+type StockLevel struct {
+	Location string
+	Quantity uint32
+}
+
+// ValidLocation reports whether code is a well-formed location code.
+func ValidLocation(code string) bool {
+	return len(code) <= MaxLocationLength && locationPattern.MatchString(code)
+}
+
+// StockAt returns the stock of p at location, the part of Quantity not at
+// another location for DefaultLocation.
+func (p Product) StockAt(location string) uint32 {
+	if location == "" || location == DefaultLocation {
+		if n := p.elsewhere(); n < p.Quantity {
+			return p.Quantity - n
+		}
+		return 0
+	}
+	for _, l := range p.Levels {
+		if l.Location == location {
+			return l.Quantity
+		}
+	}
+	return 0
+}
+
+// StockLevels returns the stock of p at every location holding some,
+// DefaultLocation first and the others by code.
+func (p Product) StockLevels() []StockLevel {
+	ret := make([]StockLevel, 0, len(p.Levels)+1)
+	if q := p.StockAt(DefaultLocation); q > 0 || len(p.Levels) == 0 {
+		ret = append(ret, StockLevel{Location: DefaultLocation, Quantity: q})
+	}
+	return append(ret, p.Levels...)
+}
+
+// elsewhere is the stock of p at the locations other than DefaultLocation.
+func (p Product) elsewhere() uint32 {
+	var n uint32
+	for _, l := range p.Levels {
+		n += l.Quantity
+	}
+	return n
+}
+
+// checkStock checks the quantity of p covers its reserved stock and its
+// stock at other locations, after the quantity was set directly.
+func (p Product) checkStock() error {
+	switch {
+	case p.Quantity < p.Reserved:
+		return fmt.Errorf("qty %d, reserved %d - %w", p.Quantity, p.Reserved, ErrInsufficientStock)
+	case p.Quantity < p.elsewhere():
+		return fmt.Errorf("qty %d, %d at other locations than %s - %w", p.Quantity, p.elsewhere(), DefaultLocation, ErrInsufficientStock)
+	}
+	return nil
+}
+
+// moveAt adds delta to the stock of p at location and to its Quantity. The
+// levels are copied, as p may share them with its before image.
+func (p *Product) moveAt(location string, delta int64) error {
+	at := int64(p.StockAt(location))
+	switch {
+	case at+delta < 0:
+		return fmt.Errorf("%s has %d at %s, moving %d - %w", p.SKU, at, location, delta, ErrInsufficientStock)
+	case int64(p.Quantity)+delta > math.MaxUint32:
+		return &ValidationError{Fields: []FieldError{{Field: "delta", Code: CodeNotAllowed, Message: fmt.Sprintf("qty must stay at most %d", uint32(math.MaxUint32))}}}
+	}
+	p.Quantity = uint32(int64(p.Quantity) + delta)
+	if location == "" || location == DefaultLocation {
+		return nil
+	}
+
+	levels := make([]StockLevel, 0, len(p.Levels)+1)
+	for _, l := range p.Levels {
+		if l.Location != location {
+			levels = append(levels, l)
+		}
+	}
+	if q := uint32(at + delta); q > 0 {
+		levels = append(levels, StockLevel{Location: location, Quantity: q})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Location < levels[j].Location })
+	if len(levels) == 0 {
+		levels = nil
+	}
+	p.Levels = levels
+	return nil
+}
+
+// ShipStock takes the items of a transfer out of the stock at from and puts
+// them in transit, recording a transfer movement with the reason
+// ReasonTransferOut and reference for each. Reserved stock cannot be
+// shipped.
+func (s *Service) ShipStock(ctx context.Context, items []StockItem, from, reference string) error {
+	return s.moveItems(ctx, items, false, func(p *Product, qty uint32) ([]Movement, error) {
+		if p.Available() < qty {
+			return nil, fmt.Errorf("%s has %d available, shipping %d - %w", p.SKU, p.Available(), qty, ErrInsufficientStock)
+		}
+		if err := p.moveAt(from, -int64(qty)); err != nil {
+			return nil, err
+		}
+		p.InTransit += qty
+		return []Movement{{Kind: MovementTransfer, Delta: -int64(qty), Reason: ReasonTransferOut, Reference: reference, Location: from}}, nil
+	})
+}
+
+// ReceiveStock takes the items of a transfer out of transit and adds them
+// to the stock at to, recording a transfer movement with the reason
+// ReasonTransferIn and reference for each.
+func (s *Service) ReceiveStock(ctx context.Context, items []StockItem, to, reference string) error {
+	return s.moveItems(ctx, items, false, func(p *Product, qty uint32) ([]Movement, error) {
+		if p.InTransit < qty {
+			return nil, fmt.Errorf("%s has %d in transit, receiving %d - %w", p.SKU, p.InTransit, qty, ErrInsufficientStock)
+		}
+		p.InTransit -= qty
+		if err := p.moveAt(to, int64(qty)); err != nil {
+			return nil, err
+		}
+		return []Movement{{Kind: MovementTransfer, Delta: int64(qty), Reason: ReasonTransferIn, Reference: reference, Location: to}}, nil
+	})
+}
@@ -0,0 +1,91 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceStockLocations(t *testing.T) {
+	for name, storage := range map[string]func() Storage{
+		"memory":       func() Storage { return memory.NewProductStorage() },
+		"eventsourced": func() Storage { return memory.NewProductEventStorage(0) },
+	} {
+		storage := storage
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := NewService(storage())
+			_, err := svc.AddProduct(ctx, Product{SKU: "LC-1", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+			get := func() *Product {
+				p, err := svc.GetProduct(ctx, "LC-1", false)
+				require.NoError(t, err)
+				return p
+			}
+			assert.Equal(t, []StockLevel{{Location: DefaultLocation, Quantity: 10}}, get().StockLevels())
+
+			p, err := svc.MoveStock(ctx, "LC-1", Movement{Kind: MovementReceipt, Delta: 5, Reason: "purchase", Location: "north"}, 0)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(15), p.Quantity)
+			assert.Equal(t, []StockLevel{{Location: DefaultLocation, Quantity: 10}, {Location: "north", Quantity: 5}}, p.StockLevels())
+			_, err = svc.MoveStock(ctx, "LC-1", Movement{Kind: MovementSale, Delta: -6, Reason: "order", Location: "north"}, 0)
+			assert.True(t, IsErrInsufficientStock(err))
+			_, err = svc.MoveStock(ctx, "LC-1", Movement{Kind: MovementReceipt, Delta: 1, Reason: "purchase", Location: "North!"}, 0)
+			assert.True(t, IsErrInvalid(err))
+
+			// Shipping takes the stock out of the location until received.
+			require.NoError(t, svc.ShipStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 4}}, DefaultLocation, "t-1"))
+			p = get()
+			assert.Equal(t, uint32(11), p.Quantity)
+			assert.Equal(t, uint32(4), p.InTransit)
+			assert.Equal(t, uint32(6), p.StockAt(DefaultLocation))
+			err = svc.ShipStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 6}}, "north", "t-2")
+			assert.True(t, IsErrInsufficientStock(err))
+			err = svc.ReceiveStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 5}}, "south", "t-1")
+			assert.True(t, IsErrInsufficientStock(err))
+			require.NoError(t, svc.ReceiveStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 4}}, "south", "t-1"))
+			p = get()
+			assert.Equal(t, uint32(15), p.Quantity)
+			assert.Equal(t, uint32(0), p.InTransit)
+			assert.Equal(t, []StockLevel{{Location: DefaultLocation, Quantity: 6}, {Location: "north", Quantity: 5}, {Location: "south", Quantity: 4}}, p.StockLevels())
+
+			// The stock at other locations cannot be overwritten.
+			_, err = svc.UpdateProduct(ctx, Product{SKU: "LC-1", Name: "Tea", Quantity: 8, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			assert.True(t, IsErrInsufficientStock(err))
+			p, err = svc.UpdateProduct(ctx, Product{SKU: "LC-1", Name: "Tea", Quantity: 9, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+			assert.Equal(t, uint32(0), p.StockAt(DefaultLocation))
+			assert.Equal(t, uint32(4), p.StockAt("south"))
+
+			// A reserved item is sold from the locations in order, with a sale
+			// per location, as no single one may hold enough.
+			require.NoError(t, svc.ReserveStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 7}}, "r-1"))
+			head := svc.Changes().Head()
+			require.NoError(t, svc.CommitStock(ctx, []StockItem{{SKU: "LC-1", Quantity: 7}}, "r-1"))
+			p = get()
+			assert.Equal(t, []StockLevel{{Location: "south", Quantity: 2}}, p.StockLevels())
+			assert.Equal(t, uint32(0), p.Reserved)
+			changes, err := svc.Changes().ReadChanges(head, 0)
+			require.NoError(t, err)
+			require.Len(t, changes, 1)
+			assert.Equal(t, []Movement{
+				{Kind: MovementSale, Delta: -5, Reason: ReasonReservation, Reference: "r-1", Location: "north"},
+				{Kind: MovementSale, Delta: -2, Reason: ReasonReservation, Reference: "r-1", Location: "south"},
+			}, MovementsOf(changes[0]))
+
+			f := Filter{Location: "south"}
+			assert.True(t, f.Match(*p))
+			f.Location = "north"
+			assert.False(t, f.Match(*p))
+			min := uint32(0)
+			f.MinQuantity = &min
+			assert.True(t, f.Match(*p))
+		})
+	}
+}
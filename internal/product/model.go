@@ -1,10 +1,60 @@
 package product
 
+import (
+	"time"
+
+	"sampleBackend/internal/money"
+)
+
+// DefaultCurrency is the currency of prices given without one, which the bare
+// integer prices stored before currencies existed are read in.
+const DefaultCurrency = "VND"
+
 type Product struct {
 	SKU      string
 	Name     string
 	Quantity uint32
-	Price    uint64
-	Unit     string
-	Status   uint8
+	// Reserved is the part of Quantity held for pending reservations, the
+	// sum of Holds. Both only change through ReserveStock, ReleaseStock and
+	// CommitStock.
+	Reserved uint32
+	Holds    []Hold
+	// Levels is the stock at the locations other than DefaultLocation, by
+	// location code, which holds the rest of Quantity. InTransit is the
+	// stock shipped between locations, which is not part of Quantity.
+	Levels    []StockLevel
+	InTransit uint32
+	Price     money.Money
+	Unit      string
+	Status    Status
+	// Category and Tags group products, e.g. for promotions. Tags are kept
+	// sorted without duplicates.
+	Category string
+	Tags     []string
+	// Version counts the writes of the product, starting at 1. Storages
+	// assign it and use it for compare-and-swap.
+	Version uint64
+	// DeletedAt is set on deleted products, which are kept as tombstones
+	// until purged. DeletedBy is the user who deleted it.
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// Hold is the stock of a product held by one reservation.
+type Hold struct {
+	ID       string
+	Quantity uint32
+}
+
+// Available is the stock which is not reserved.
+func (p Product) Available() uint32 {
+	if p.Reserved > p.Quantity {
+		return 0
+	}
+	return p.Quantity - p.Reserved
+}
+
+// Deleted reports whether p is a tombstone.
+func (p Product) Deleted() bool {
+	return !p.DeletedAt.IsZero()
 }
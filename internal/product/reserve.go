@@ -0,0 +1,229 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"sampleBackend/internal/storage"
+)
+
+// MaxStockItems bounds the products of one reservation or transfer.
+const MaxStockItems = 100
+
+// ReasonReservation is the reason code of the sales made by confirming a
+// reservation.
+const ReasonReservation = "reservation"
+
+// StockItem is a quantity of a product.
+type StockItem struct {
+	SKU      string
+	Quantity uint32
+}
+
+// ValidateStockItems checks items are distinct products, each with a
+// quantity.
+func ValidateStockItems(items []StockItem) error {
+	var fields []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case len(items) == 0:
+		add("items", CodeRequired, "items are required")
+	case len(items) > MaxStockItems:
+		add("items", CodeTooLong, "items must be at most %d", MaxStockItems)
+	}
+	seen := make(map[string]bool, len(items))
+	for i, it := range items {
+		switch {
+		case it.SKU == "":
+			add(fmt.Sprintf("items[%d].sku", i), CodeRequired, "sku is required")
+		case seen[it.SKU]:
+			add(fmt.Sprintf("items[%d].sku", i), CodeNotAllowed, "sku appears more than once")
+		}
+		seen[it.SKU] = true
+		if it.Quantity == 0 {
+			add(fmt.Sprintf("items[%d].qty", i), CodeRequired, "qty must be at least 1")
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ReserveStock takes items from the available stock of the products and
+// holds them for the reservation hold, for every item or, when a product is
+// missing or short, for none. The products are written at once, so
+// concurrent reservations never oversell.
+func (s *Service) ReserveStock(ctx context.Context, items []StockItem, hold string) error {
+	if hold == "" {
+		return &ValidationError{Fields: []FieldError{{Field: "hold", Code: CodeRequired, Message: "hold is required"}}}
+	}
+	return s.moveItems(ctx, items, false, func(p *Product, qty uint32) ([]Movement, error) {
+		if p.Available() < qty {
+			return nil, fmt.Errorf("%s has %d available, reserving %d - %w", p.SKU, p.Available(), qty, ErrInsufficientStock)
+		}
+		p.hold(hold, int64(qty))
+		return nil, nil
+	})
+}
+
+// ReleaseStock gives the items held by hold back to the available stock.
+// Products deleted since dropped their holds and are skipped, so a
+// reservation never releases the stock of another one.
+func (s *Service) ReleaseStock(ctx context.Context, items []StockItem, hold string) error {
+	return s.moveItems(ctx, items, true, func(p *Product, qty uint32) ([]Movement, error) {
+		held := p.HeldBy(hold)
+		if held == 0 {
+			return nil, errUnchanged
+		}
+		if qty > held {
+			qty = held
+		}
+		p.hold(hold, -int64(qty))
+		return nil, nil
+	})
+}
+
+// CommitStock takes the items held by hold out of the stock, recording a
+// sale with the reason ReasonReservation and hold as reference for each.
+// Reservations hold stock across every location, so each item is sold from
+// DefaultLocation first, then from the other locations in order, with a sale
+// per location. Items which are not held anymore, e.g. because the product
+// was deleted, fail the whole commit.
+func (s *Service) CommitStock(ctx context.Context, items []StockItem, hold string) error {
+	return s.moveItems(ctx, items, false, func(p *Product, qty uint32) ([]Movement, error) {
+		if held := p.HeldBy(hold); held < qty || p.Quantity < qty {
+			return nil, fmt.Errorf("%s has %d held by %s, committing %d - %w", p.SKU, held, hold, qty, ErrInsufficientStock)
+		}
+		locations := make([]string, 0, len(p.Levels)+1)
+		locations = append(locations, DefaultLocation)
+		for _, l := range p.Levels {
+			locations = append(locations, l.Location)
+		}
+
+		var (
+			movements []Movement
+			left      = qty
+		)
+		for _, location := range locations {
+			take := p.StockAt(location)
+			if take > left {
+				take = left
+			}
+			if take == 0 {
+				continue
+			}
+			if err := p.moveAt(location, -int64(take)); err != nil {
+				return nil, err
+			}
+			m := Movement{Kind: MovementSale, Delta: -int64(take), Reason: ReasonReservation, Reference: hold}
+			if location != DefaultLocation {
+				m.Location = location
+			}
+			movements = append(movements, m)
+			left -= take
+		}
+		p.hold(hold, -int64(qty))
+		return movements, nil
+	})
+}
+
+// HeldBy is the stock of p held by the reservation id.
+func (p Product) HeldBy(id string) uint32 {
+	for _, h := range p.Holds {
+		if h.ID == id {
+			return h.Quantity
+		}
+	}
+	return 0
+}
+
+// hold adds delta to the stock of p held by id and to Reserved. The holds
+// are copied, as p may share them with its before image.
+func (p *Product) hold(id string, delta int64) {
+	held := int64(p.HeldBy(id)) + delta
+	holds := make([]Hold, 0, len(p.Holds)+1)
+	for _, h := range p.Holds {
+		if h.ID != id {
+			holds = append(holds, h)
+		}
+	}
+	if held > 0 {
+		holds = append(holds, Hold{ID: id, Quantity: uint32(held)})
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ID < holds[j].ID })
+	if len(holds) == 0 {
+		holds = nil
+	}
+	p.Holds = holds
+	p.Reserved = uint32(int64(p.Reserved) + delta)
+}
+
+// moveItems applies set to the product of every item, holding the locks
+// of all of them, and writes the products at once. Missing products fail
+// with ErrNotFound unless skipMissing.
+func (s *Service) moveItems(ctx context.Context, items []StockItem, skipMissing bool, set func(p *Product, qty uint32) ([]Movement, error)) error {
+	if err := ValidateStockItems(items); err != nil {
+		return err
+	}
+	skus := make([]string, len(items))
+	for i, it := range items {
+		skus[i] = it.SKU
+	}
+	unlock := s.lockSKUs(skus)
+	defer unlock()
+
+	var (
+		writes    = make([]Write, 0, len(items))
+		befores   = make([]*Product, 0, len(items))
+		movements = make([][]Movement, 0, len(items))
+	)
+	for _, it := range items {
+		before, err := s.lookup(ctx, it.SKU)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.Deleted() {
+			if skipMissing {
+				continue
+			}
+			return fmt.Errorf("%s: %w", it.SKU, ErrNotFound)
+		}
+		p := *before
+		m, err := set(&p, it.Quantity)
+		if err != nil {
+			if errors.Is(err, errUnchanged) {
+				continue
+			}
+			return err
+		}
+		writes = append(writes, Write{Product: p})
+		befores = append(befores, before)
+		movements = append(movements, m)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	if err := s.storage.Apply(ctx, writes); err != nil {
+		if storage.IsErrConflict(err) || storage.IsErrNotFound(err) {
+			return fmt.Errorf("apply: %v - %w", err, ErrConflict)
+		}
+		return fmt.Errorf("apply: %w", err)
+	}
+
+	for i, w := range writes {
+		after, err := s.storage.Get(ctx, w.Product.SKU)
+		if err != nil {
+			return fmt.Errorf("get product: %w", err)
+		}
+		s.changes.append(Change{Op: ChangeUpdate, SKU: w.Product.SKU, Before: befores[i], After: after, Actor: ActorFrom(ctx), Movements: movements[i]})
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package product_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceReserveStock(t *testing.T) {
+	for name, storage := range map[string]func() Storage{
+		"memory":       func() Storage { return memory.NewProductStorage() },
+		"eventsourced": func() Storage { return memory.NewProductEventStorage(0) },
+	} {
+		storage := storage
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := NewService(storage())
+			for _, p := range []Product{
+				{SKU: "RS-1", Name: "Tea", Quantity: 5, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"},
+				{SKU: "RS-2", Name: "Cup", Quantity: 2, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Piece"},
+			} {
+				_, err := svc.AddProduct(ctx, p)
+				require.NoError(t, err)
+			}
+			get := func(sku string) *Product {
+				p, err := svc.GetProduct(ctx, sku, false)
+				require.NoError(t, err)
+				return p
+			}
+
+			require.NoError(t, svc.ReserveStock(ctx, []StockItem{{SKU: "RS-1", Quantity: 4}, {SKU: "RS-2", Quantity: 1}}, "r-1"))
+			assert.Equal(t, uint32(1), get("RS-1").Available())
+			assert.Equal(t, uint32(4), get("RS-1").Reserved)
+			assert.Equal(t, []Hold{{ID: "r-1", Quantity: 4}}, get("RS-1").Holds)
+
+			// One short product fails the whole reservation.
+			err := svc.ReserveStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}, {SKU: "RS-1", Quantity: 2}}, "r-2")
+			assert.True(t, IsErrInsufficientStock(err))
+			assert.Equal(t, uint32(1), get("RS-2").Reserved)
+			err = svc.ReserveStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}, {SKU: "RS-404", Quantity: 1}}, "r-2")
+			assert.True(t, IsErrNotFound(err))
+			assert.Equal(t, uint32(1), get("RS-2").Reserved)
+			err = svc.ReserveStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}, {SKU: "RS-2"}}, "r-2")
+			assert.True(t, IsErrInvalid(err))
+			err = svc.ReserveStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}}, "")
+			assert.True(t, IsErrInvalid(err))
+
+			// Reserved stock cannot be overwritten or sold.
+			_, err = svc.UpdateProduct(ctx, Product{SKU: "RS-1", Name: "Tea", Quantity: 3, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			assert.True(t, IsErrInsufficientStock(err))
+			_, err = svc.MoveStock(ctx, "RS-1", Movement{Kind: MovementSale, Delta: -2, Reason: "order"}, 0)
+			assert.True(t, IsErrInsufficientStock(err))
+			p, err := svc.UpdateProduct(ctx, Product{SKU: "RS-1", Name: "Green tea", Quantity: 6, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+			assert.Equal(t, uint32(4), p.Reserved)
+
+			head := svc.Changes().Head()
+			require.NoError(t, svc.CommitStock(ctx, []StockItem{{SKU: "RS-1", Quantity: 3}}, "r-1"))
+			assert.Equal(t, uint32(3), get("RS-1").Quantity)
+			assert.Equal(t, uint32(1), get("RS-1").Reserved)
+			changes, err := svc.Changes().ReadChanges(head, 0)
+			require.NoError(t, err)
+			require.Len(t, changes, 1)
+			assert.Equal(t, []Movement{{Kind: MovementSale, Delta: -3, Reason: ReasonReservation, Reference: "r-1"}}, MovementsOf(changes[0]))
+			err = svc.CommitStock(ctx, []StockItem{{SKU: "RS-1", Quantity: 2}}, "r-1")
+			assert.True(t, IsErrInsufficientStock(err))
+			// Nor is the stock held by another reservation.
+			err = svc.CommitStock(ctx, []StockItem{{SKU: "RS-1", Quantity: 1}}, "r-2")
+			assert.True(t, IsErrInsufficientStock(err))
+
+			require.NoError(t, svc.ReleaseStock(ctx, []StockItem{{SKU: "RS-1", Quantity: 5}, {SKU: "RS-404", Quantity: 1}}, "r-1"))
+			assert.Equal(t, uint32(0), get("RS-1").Reserved)
+			assert.Nil(t, get("RS-1").Holds)
+			assert.Equal(t, uint32(3), get("RS-1").Available())
+
+			// Deleting a product drops its reservations, which release
+			// nothing afterwards, even when the product was reserved again.
+			require.NoError(t, svc.DeleteProduct(ctx, "RS-2", 0, "admin"))
+			p, err = svc.RestoreProduct(ctx, "RS-2", 0)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(0), p.Reserved)
+			require.NoError(t, svc.ReserveStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 2}}, "r-3"))
+			require.NoError(t, svc.ReleaseStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}}, "r-1"))
+			assert.Equal(t, uint32(2), get("RS-2").Reserved)
+			assert.Equal(t, uint32(0), get("RS-2").Available())
+			err = svc.CommitStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 1}}, "r-1")
+			assert.True(t, IsErrInsufficientStock(err))
+			require.NoError(t, svc.CommitStock(ctx, []StockItem{{SKU: "RS-2", Quantity: 2}}, "r-3"))
+			assert.Equal(t, uint32(0), get("RS-2").Quantity)
+		})
+	}
+}
+
+func TestServiceReserveStockConcurrently(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(memory.NewProductStorage())
+	for _, sku := range []string{"RC-1", "RC-2"} {
+		_, err := svc.AddProduct(ctx, Product{SKU: sku, Name: "Stock", Quantity: 50, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+		require.NoError(t, err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		reserved int64
+	)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Opposite orders would deadlock without ordered locks.
+			items := []StockItem{{SKU: "RC-1", Quantity: 3}, {SKU: "RC-2", Quantity: 2}}
+			if i%2 == 1 {
+				items[0], items[1] = items[1], items[0]
+			}
+			err := svc.ReserveStock(ctx, items, fmt.Sprintf("r-%d", i))
+			if err == nil {
+				atomic.AddInt64(&reserved, 1)
+				return
+			}
+			assert.True(t, IsErrInsufficientStock(err))
+		}(i)
+	}
+	wg.Wait()
+
+	// 16 reservations take 48 of RC-1, the 17th would oversell it.
+	assert.Equal(t, int64(16), reserved)
+	p, err := svc.GetProduct(ctx, "RC-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(48), p.Reserved)
+	p, err = svc.GetProduct(ctx, "RC-2", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(32), p.Reserved)
+}
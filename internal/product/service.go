@@ -4,85 +4,634 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"sampleBackend/internal/storage"
 )
 
+// lockStripes is the number of mutexes serializing writes per SKU.
+const lockStripes = 64
+
 var (
 	ErrExist    = errors.New("item exist")
 	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("version conflict")
+	// ErrNotDeleted is returned when restoring a product which is not
+	// deleted.
+	ErrNotDeleted = errors.New("product not deleted")
 )
 
 type Storage interface {
 	Create(ctx context.Context, p Product) error
 	Get(ctx context.Context, sku string) (*Product, error)
+	// Update and Delete are compare-and-swap: a non-zero version must match
+	// the stored one or storage.ErrConflict is returned. Writes increment the
+	// version, Create stores version 1 or, for a purged SKU, goes on from the
+	// version of the purge: versions never repeat for a SKU.
 	Update(ctx context.Context, p Product) error
-	Delete(ctx context.Context, sku string) error
-	List(ctx context.Context) ([]*Product, error)
+	// Delete removes sku for good. Deleted products are updated into
+	// tombstones, Delete purges them.
+	Delete(ctx context.Context, sku string, version uint64) error
+	// List returns the page of products selected by opts.
+	List(ctx context.Context, opts ListOptions) (*Page, error)
+	// Query returns the products matching f ordered by SKU. Backends are
+	// expected to answer it from indexes rather than a full scan.
+	Query(ctx context.Context, f Filter) ([]*Product, error)
+	// Snapshot returns a point-in-time copy of every product.
+	Snapshot(ctx context.Context) ([]Product, error)
+	// Restore atomically replaces every product.
+	Restore(ctx context.Context, products []Product) error
+	// Apply performs every write or, when one of them fails, none.
+	Apply(ctx context.Context, writes []Write) error
+}
+
+type Option func(s *Service)
+
+// WithTransitions replaces DefaultTransitions as the status changes allowed
+// by s.
+func WithTransitions(t Transitions) Option {
+	return func(s *Service) {
+		s.transitions = t
+	}
+}
+
+// WithCurrency replaces DefaultCurrency as the currency of the prices given
+// without one.
+func WithCurrency(currency string) Option {
+	return func(s *Service) {
+		s.currency = currency
+	}
+}
+
+// WithChangeRetention bounds the change stream to maxLen changes no older
+// than maxAge.
+func WithChangeRetention(maxLen int, maxAge time.Duration) Option {
+	return func(s *Service) {
+		s.changes = NewChangeLog(maxLen, maxAge)
+	}
+}
+
+// WithChangeHooks calls hooks with every change made through s before the
+// write making it returns.
+func WithChangeHooks(hooks ...ChangeHook) Option {
+	return func(s *Service) {
+		s.hooks = append(s.hooks, hooks...)
+	}
 }
 
 type Service struct {
-	storage Storage
+	storage     Storage
+	changes     *ChangeLog
+	hooks       []ChangeHook
+	transitions Transitions
+	currency    string
+
+	// locks serialize the read of the before image, the write and the append
+	// to the change log of a SKU, so changes are ordered as they were applied.
+	locks [lockStripes]sync.Mutex
+}
+
+func NewService(s Storage, opts ...Option) *Service {
+	svc := &Service{
+		storage:     s,
+		changes:     NewChangeLog(defaultChangeRetention, defaultChangeRetentionAge),
+		transitions: DefaultTransitions,
+		currency:    DefaultCurrency,
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	svc.changes.hooks = svc.hooks
+	return svc
 }
 
-func NewService(s Storage) *Service {
-	return &Service{
-		storage: s,
+// Changes returns the stream of successful mutations made through s.
+func (s *Service) Changes() ChangeStream {
+	return s.changes
+}
+
+func (s *Service) lock(sku string) *sync.Mutex {
+	return &s.locks[s.stripe(sku)]
+}
+
+func (s *Service) stripe(sku string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(sku); i++ {
+		h ^= uint32(sku[i])
+		h *= 16777619
 	}
+	return h % lockStripes
 }
 
-func (s *Service) AddProduct(ctx context.Context, p Product) error {
-	err := s.storage.Create(ctx, p)
+func (s *Service) lockAll() {
+	for i := range s.locks {
+		s.locks[i].Lock()
+	}
+}
+
+func (s *Service) unlockAll() {
+	for i := len(s.locks) - 1; i >= 0; i-- {
+		s.locks[i].Unlock()
+	}
+}
+
+// lookup returns the stored product of sku, a tombstone when it was deleted,
+// or nil when there is none.
+func (s *Service) lookup(ctx context.Context, sku string) (*Product, error) {
+	p, err := s.storage.Get(ctx, sku)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+	return p, nil
+}
+
+// AddProduct creates p and returns it as stored, at version 1. A deleted
+// product with the same SKU is replaced, its version continues.
+func (s *Service) AddProduct(ctx context.Context, p Product) (*Product, error) {
+	s.normalize(&p)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.DeletedAt, p.DeletedBy = time.Time{}, ""
+	p.Reserved, p.Holds, p.Levels, p.InTransit = 0, nil, nil, 0
+
+	mu := s.lock(p.SKU)
+	mu.Lock()
+	defer mu.Unlock()
+
+	tomb, err := s.lookup(ctx, p.SKU)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tomb == nil:
+		err = s.storage.Create(ctx, p)
+	case !tomb.Deleted():
+		return nil, ErrExist
+	default:
+		p.Version = tomb.Version
+		err = s.storage.Update(ctx, p)
+	}
 	if err != nil {
 		if storage.IsErrAlreadyExist(err) {
-			return ErrExist
+			return nil, ErrExist
 		}
-		return err
+		return nil, err
 	}
 
-	return nil
+	after, err := s.storage.Get(ctx, p.SKU)
+	if err != nil {
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+	s.changes.append(Change{Op: ChangeCreate, SKU: p.SKU, After: after, Actor: ActorFrom(ctx)})
+	return after, nil
+}
+
+// UpdateProduct replaces the product with the SKU of p and returns it as
+// stored. Unless p.Version is 0 it must be the current version, otherwise
+// ErrConflict is returned. The status is kept, it only changes through
+// SetStatus, and so are the reserved stock and the stock at the locations
+// other than DefaultLocation, which the quantity may not go below.
+func (s *Service) UpdateProduct(ctx context.Context, p Product) (*Product, error) {
+	return s.update(ctx, p, true, false)
+}
+
+// UpdateProductKeepingGroups is UpdateProduct for the clients which do not
+// know categories and tags: the ones of the product are kept.
+func (s *Service) UpdateProductKeepingGroups(ctx context.Context, p Product) (*Product, error) {
+	return s.update(ctx, p, true, true)
 }
 
-func (s *Service) UpdateProduct(ctx context.Context, p Product) error {
-	err := s.storage.Update(ctx, p)
+// update is UpdateProduct, failing when keepStatus is false and the status
+// of p is not the current one instead of ignoring it, and keeping the
+// category and tags with keepGroups.
+func (s *Service) update(ctx context.Context, p Product, keepStatus, keepGroups bool) (*Product, error) {
+	s.normalize(&p)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.DeletedAt, p.DeletedBy = time.Time{}, ""
+
+	mu := s.lock(p.SKU)
+	mu.Lock()
+	defer mu.Unlock()
+
+	before, err := s.lookup(ctx, p.SKU)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil || before.Deleted() {
+		return nil, ErrNotFound
+	}
+	if p.Version != 0 && p.Version != before.Version {
+		return nil, fmt.Errorf("version %d, current %d - %w", p.Version, before.Version, ErrConflict)
+	}
+	if !keepStatus && p.Status != before.Status {
+		return nil, statusChanged(before.Status)
+	}
+	p.Status, p.Reserved, p.Holds = before.Status, before.Reserved, before.Holds
+	p.Levels, p.InTransit = before.Levels, before.InTransit
+	if keepGroups {
+		p.Category, p.Tags = before.Category, before.Tags
+	}
+	if err := p.checkStock(); err != nil {
+		return nil, err
+	}
+
+	// Writes of the SKU are serialized by mu, so the storage only detects
+	// writers bypassing the service.
+	p.Version = before.Version
+	err = s.storage.Update(ctx, p)
 	if err != nil {
 		if storage.IsErrNotFound(err) {
+			return nil, ErrNotFound
+		}
+		if storage.IsErrConflict(err) {
+			return nil, fmt.Errorf("update product: %v - %w", err, ErrConflict)
+		}
+		return nil, err
+	}
+
+	after, err := s.storage.Get(ctx, p.SKU)
+	if err != nil {
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+	if after.Version != before.Version {
+		s.changes.append(Change{Op: ChangeUpdate, SKU: p.SKU, Before: before, After: after, Actor: ActorFrom(ctx)})
+	}
+	return after, nil
+}
+
+// DeleteProduct deletes sku on behalf of the user by. The product is kept
+// as a tombstone until restored or purged, its reservations are dropped.
+// Unless version is 0 it must be the current version, otherwise ErrConflict
+// is returned.
+func (s *Service) DeleteProduct(ctx context.Context, sku string, version uint64, by string) error {
+	_, err := s.modify(ctx, sku, version, func(p *Product) error {
+		if p.Deleted() {
 			return ErrNotFound
 		}
-		return err
+		p.DeletedAt, p.DeletedBy = time.Now().UTC(), by
+		p.Reserved, p.Holds = 0, nil
+		return nil
+	}, ChangeDelete, nil)
+	return err
+}
+
+// RestoreProduct brings back the deleted product sku and returns it. Unless
+// version is 0 it must be the version of the tombstone. Restoring a product
+// which is not deleted fails with ErrNotDeleted.
+func (s *Service) RestoreProduct(ctx context.Context, sku string, version uint64) (*Product, error) {
+	return s.modify(ctx, sku, version, func(p *Product) error {
+		if !p.Deleted() {
+			return ErrNotDeleted
+		}
+		p.DeletedAt, p.DeletedBy = time.Time{}, ""
+		return nil
+	}, ChangeRestore, nil)
+}
+
+// SetStatus changes the status of sku and returns the product. Unless
+// version is 0 it must be the current version. The change must be allowed
+// by the transitions of s, otherwise ErrInvalidTransition is returned.
+func (s *Service) SetStatus(ctx context.Context, sku string, status Status, version uint64) (*Product, error) {
+	if !status.Valid() {
+		return nil, fmt.Errorf("status %d - %w", status, ErrInvalidStatus)
 	}
+	return s.modify(ctx, sku, version, func(p *Product) error {
+		if p.Deleted() {
+			return ErrNotFound
+		}
+		if p.Status == status {
+			return errUnchanged
+		}
+		if err := s.transitions.check(p.Status, status); err != nil {
+			return err
+		}
+		p.Status = status
+		return nil
+	}, ChangeUpdate, nil)
+}
 
-	return nil
+// Currency returns the currency of the prices given without one.
+func (s *Service) Currency() string {
+	return s.currency
+}
+
+// normalize sets the default currency of a price given without one, as by
+// legacy clients sending a bare amount, and normalizes its case. The tags are
+// sorted and their duplicates dropped.
+func (s *Service) normalize(p *Product) {
+	if p.Price.Currency == "" {
+		p.Price.Currency = s.currency
+	}
+	p.Price.Currency = strings.ToUpper(p.Price.Currency)
+
+	if len(p.Tags) == 0 {
+		p.Tags = nil
+		return
+	}
+	tags := append([]string(nil), p.Tags...)
+	sort.Strings(tags)
+	n := 1
+	for _, t := range tags[1:] {
+		if t != tags[n-1] {
+			tags[n] = t
+			n++
+		}
+	}
+	p.Tags = tags[:n]
 }
 
-func (s *Service) DeleteProduct(ctx context.Context, sku string) error {
-	err := s.storage.Delete(ctx, sku)
+// Transitions returns the status changes allowed by s.
+func (s *Service) Transitions() Transitions {
+	return s.transitions
+}
+
+// errUnchanged is returned by the set function of modify when there is
+// nothing to write.
+var errUnchanged = errors.New("unchanged")
+
+// modify writes the product sku as changed by set and records the change
+// as op, with the stock movements if any.
+func (s *Service) modify(ctx context.Context, sku string, version uint64, set func(p *Product) error, op ChangeOp, movements []Movement) (*Product, error) {
+	mu := s.lock(sku)
+	mu.Lock()
+	defer mu.Unlock()
+
+	before, err := s.lookup(ctx, sku)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrNotFound
+	}
+	if version != 0 && version != before.Version {
+		return nil, fmt.Errorf("version %d, current %d - %w", version, before.Version, ErrConflict)
+	}
+	p := *before
+	if err := set(&p); err != nil {
+		if errors.Is(err, errUnchanged) {
+			return before, nil
+		}
+		return nil, err
+	}
+
+	err = s.storage.Update(ctx, p)
 	if err != nil {
 		if storage.IsErrNotFound(err) {
-			return ErrNotFound
+			return nil, ErrNotFound
 		}
-		return err
+		if storage.IsErrConflict(err) {
+			return nil, fmt.Errorf("%s product: %v - %w", op, err, ErrConflict)
+		}
+		return nil, err
 	}
 
-	return nil
+	after, err := s.storage.Get(ctx, sku)
+	if err != nil {
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+	s.changes.append(Change{Op: op, SKU: sku, Before: before, After: after, Actor: ActorFrom(ctx), Movements: movements})
+	return after, nil
 }
 
-func (s *Service) ListProduct(ctx context.Context) ([]*Product, error) {
-	return s.storage.List(ctx)
+// PurgeDeleted removes for good the products deleted before t and returns
+// how many.
+func (s *Service) PurgeDeleted(ctx context.Context, t time.Time) (int, error) {
+	products, err := s.storage.Query(ctx, Filter{IncludeDeleted: true})
+	if err != nil {
+		return 0, fmt.Errorf("query products: %w", err)
+	}
+
+	purged := 0
+	for _, p := range products {
+		if !p.Deleted() || !p.DeletedAt.Before(t) {
+			continue
+		}
+		ok, err := s.purge(ctx, p.SKU, t)
+		if err != nil {
+			return purged, err
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purge removes sku if it is still a tombstone older than t.
+func (s *Service) purge(ctx context.Context, sku string, t time.Time) (bool, error) {
+	mu := s.lock(sku)
+	mu.Lock()
+	defer mu.Unlock()
+
+	before, err := s.lookup(ctx, sku)
+	if err != nil || before == nil || !before.Deleted() || !before.DeletedAt.Before(t) {
+		return false, err
+	}
+	err = s.storage.Delete(ctx, sku, before.Version)
+	if err != nil {
+		if storage.IsErrNotFound(err) || storage.IsErrConflict(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("purge product: %w", err)
+	}
+
+	s.changes.append(Change{Op: ChangePurge, SKU: sku, Before: before, Actor: ActorFrom(ctx)})
+	return true, nil
+}
+
+// RunPurge purges every interval the products deleted for longer than
+// retention, until ctx is done.
+func (s *Service) RunPurge(ctx context.Context, retention, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if err != nil {
+			fmt.Println("product purge: failed:", err)
+		} else if n > 0 {
+			fmt.Printf("product purge: %d deleted products purged\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) ListProduct(ctx context.Context, opts ListOptions) (*Page, error) {
+	page, err := s.storage.List(ctx, opts)
+	if err != nil {
+		if IsErrInvalidListOptions(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("list products: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Service) QueryProduct(ctx context.Context, f Filter) ([]*Product, error) {
+	return s.storage.Query(ctx, f)
 }
 
 func (s *Service) SearchProduct(ctx context.Context, sku string) (*Product, error) {
-	p, err := s.storage.Get(ctx, sku)
+	return s.GetProduct(ctx, sku, false)
+}
+
+// GetProduct returns the product sku. Deleted products are only returned
+// with includeDeleted.
+func (s *Service) GetProduct(ctx context.Context, sku string, includeDeleted bool) (*Product, error) {
+	p, err := s.lookup(ctx, sku)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || p.Deleted() && !includeDeleted {
+		return nil, ErrNotFound
+	}
+	return p, nil
+}
+
+// ProductEvents returns how sku reached its current state. It requires a
+// TemporalStorage.
+func (s *Service) ProductEvents(ctx context.Context, sku string) ([]Event, error) {
+	ts, ok := s.storage.(TemporalStorage)
+	if !ok {
+		return nil, ErrTemporalUnsupported
+	}
+
+	events, err := ts.Events(ctx, sku)
 	if err != nil {
 		if storage.IsErrNotFound(err) {
 			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("get product: %w", err)
+		return nil, fmt.Errorf("get events: %w", err)
+	}
+	return events, nil
+}
+
+// ProductAt returns sku as it was at t. It requires a TemporalStorage.
+func (s *Service) ProductAt(ctx context.Context, sku string, t time.Time) (*Product, error) {
+	ts, ok := s.storage.(TemporalStorage)
+	if !ok {
+		return nil, ErrTemporalUnsupported
 	}
 
+	p, err := ts.GetAt(ctx, sku, t)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get product at %v: %w", t, err)
+	}
+	if p.Deleted() {
+		return nil, ErrNotFound
+	}
 	return p, nil
 }
 
+// Snapshot returns a consistent copy of every product, used by backups.
+func (s *Service) Snapshot(ctx context.Context) ([]Product, error) {
+	return s.storage.Snapshot(ctx)
+}
+
+// Restore replaces every product, used by backups. Prices without currency
+// get the default one.
+func (s *Service) Restore(ctx context.Context, products []Product) error {
+	f := s.Freeze()
+	defer f.Thaw()
+	return f.Restore(ctx, products)
+}
+
+// Frozen blocks the writes of a Service until thawed, so that backups
+// snapshot or replace the products together with other stores.
+type Frozen struct {
+	s    *Service
+	once sync.Once
+}
+
+// Freeze waits for the writes in progress and blocks the next ones until
+// Thaw.
+func (s *Service) Freeze() *Frozen {
+	s.lockAll()
+	return &Frozen{s: s}
+}
+
+func (f *Frozen) Thaw() {
+	f.once.Do(f.s.unlockAll)
+}
+
+// Snapshot returns a copy of every product, which no write changes while
+// frozen.
+func (f *Frozen) Snapshot(ctx context.Context) ([]Product, error) {
+	return f.s.storage.Snapshot(ctx)
+}
+
+// Restore replaces every product. Prices without currency get the default
+// one. The reset published lists the stock it moved.
+func (f *Frozen) Restore(ctx context.Context, products []Product) error {
+	products = append([]Product(nil), products...)
+	for i := range products {
+		f.s.normalize(&products[i])
+	}
+
+	before, err := f.s.storage.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("restore products: %w", err)
+	}
+	if err := f.s.storage.Restore(ctx, products); err != nil {
+		return fmt.Errorf("restore products: %w", err)
+	}
+
+	c := Change{Op: ChangeReset, Actor: ActorFrom(ctx)}
+	after, err := f.s.storage.Snapshot(ctx)
+	if err != nil {
+		fmt.Println("restore products: stock reset unknown:", err)
+	} else {
+		c.Resets = stockResets(before, after)
+	}
+	f.s.changes.append(c)
+	return nil
+}
+
+// stockResets returns the stock moved from the products before to after,
+// by SKU.
+func stockResets(before, after []Product) []StockReset {
+	bySKU := make(map[string]*Product, len(before))
+	for i := range before {
+		bySKU[before[i].SKU] = &before[i]
+	}
+	var ret []StockReset
+	for i := range after {
+		p := &after[i]
+		if m := levelMovements(bySKU[p.SKU], p, ReasonReset); len(m) > 0 {
+			ret = append(ret, StockReset{SKU: p.SKU, Quantity: p.Quantity, Version: p.Version, Movements: m})
+		}
+		delete(bySKU, p.SKU)
+	}
+	for i := range before {
+		p := &before[i]
+		if _, removed := bySKU[p.SKU]; !removed {
+			continue
+		}
+		if m := levelMovements(p, nil, ReasonReset); len(m) > 0 {
+			ret = append(ret, StockReset{SKU: p.SKU, Movements: m})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].SKU < ret[j].SKU })
+	return ret
+}
+
 func IsErrExist(err error) bool {
 	return errors.Is(err, ErrExist)
 }
@@ -90,3 +639,11 @@ func IsErrExist(err error) bool {
 func IsErrNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+func IsErrNotDeleted(err error) bool {
+	return errors.Is(err, ErrNotDeleted)
+}
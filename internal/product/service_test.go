@@ -0,0 +1,158 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestServiceSetStatus(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(memory.NewProductStorage(), WithTransitions(Transitions{
+		StatusDraft:  {StatusActive},
+		StatusActive: {StatusArchived},
+	}))
+	_, err := svc.AddProduct(ctx, Product{SKU: "ST-1", Name: "Status", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+
+	_, err = svc.SetStatus(ctx, "ST-1", StatusArchived, 0)
+	require.True(t, IsErrInvalidTransition(err))
+	assert.Contains(t, err.Error(), "draft cannot change to archived, only to active")
+	_, err = svc.SetStatus(ctx, "ST-1", StatusActive, 2)
+	require.True(t, IsErrConflict(err))
+	_, err = svc.SetStatus(ctx, "ST-1", Status(9), 0)
+	require.True(t, IsErrInvalidStatus(err))
+	_, err = svc.SetStatus(ctx, "ST-404", StatusActive, 0)
+	require.True(t, IsErrNotFound(err))
+
+	p, err := svc.SetStatus(ctx, "ST-1", StatusActive, 1)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, p.Status)
+	assert.Equal(t, uint64(2), p.Version)
+
+	// Setting the current status writes nothing.
+	p, err = svc.SetStatus(ctx, "ST-1", StatusActive, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), p.Version)
+
+	// Updates keep the status.
+	p, err = svc.UpdateProduct(ctx, Product{SKU: "ST-1", Name: "Renamed", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Status: StatusDraft})
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, p.Status)
+
+	// Clients which do not know categories and tags keep the current ones.
+	_, err = svc.UpdateProduct(ctx, Product{SKU: "ST-1", Name: "Renamed", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Category: "tea", Tags: []string{"green"}})
+	require.NoError(t, err)
+	p, err = svc.UpdateProductKeepingGroups(ctx, Product{SKU: "ST-1", Name: "Again", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	assert.Equal(t, "tea", p.Category)
+	assert.Equal(t, []string{"green"}, p.Tags)
+
+	_, err = svc.SetStatus(ctx, "ST-1", StatusArchived, 0)
+	require.NoError(t, err)
+	_, err = svc.SetStatus(ctx, "ST-1", StatusActive, 0)
+	require.True(t, IsErrInvalidTransition(err))
+	assert.Contains(t, err.Error(), "archived is final")
+}
+
+func TestServiceSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	storages := map[string]func() Storage{
+		"memory": func() Storage { return memory.NewProductStorage() },
+		"event":  func() Storage { return memory.NewProductEventStorage(0) },
+	}
+
+	for name, newStorage := range storages {
+		newStorage := newStorage
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			svc := NewService(newStorage())
+			for _, sku := range []string{"SD-1", "SD-2"} {
+				_, err := svc.AddProduct(ctx, Product{SKU: sku, Name: "Soft " + sku, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, svc.DeleteProduct(ctx, "SD-1", 1, "admin@gmail.com"))
+			require.True(t, IsErrNotFound(svc.DeleteProduct(ctx, "SD-1", 0, "admin@gmail.com")))
+
+			// Tombstones are hidden unless asked for.
+			_, err := svc.SearchProduct(ctx, "SD-1")
+			require.True(t, IsErrNotFound(err))
+			_, err = svc.UpdateProduct(ctx, Product{SKU: "SD-1", Name: "Soft", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Box"})
+			require.True(t, IsErrNotFound(err))
+			tomb, err := svc.GetProduct(ctx, "SD-1", true)
+			require.NoError(t, err)
+			assert.True(t, tomb.Deleted())
+			assert.Equal(t, "admin@gmail.com", tomb.DeletedBy)
+			assert.Equal(t, uint64(2), tomb.Version)
+
+			page, err := svc.ListProduct(ctx, ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, page.Items, 1)
+			assert.Equal(t, "SD-2", page.Items[0].SKU)
+			page, err = svc.ListProduct(ctx, ListOptions{Filter: Filter{IncludeDeleted: true}})
+			require.NoError(t, err)
+			assert.Len(t, page.Items, 2)
+
+			// Restore checks the tombstone version.
+			_, err = svc.RestoreProduct(ctx, "SD-1", 1)
+			require.True(t, IsErrConflict(err))
+			restored, err := svc.RestoreProduct(ctx, "SD-1", 2)
+			require.NoError(t, err)
+			assert.False(t, restored.Deleted())
+			assert.Empty(t, restored.DeletedBy)
+			assert.Equal(t, uint64(3), restored.Version)
+			_, err = svc.RestoreProduct(ctx, "SD-1", 0)
+			require.True(t, IsErrNotDeleted(err))
+			_, err = svc.RestoreProduct(ctx, "SD-404", 0)
+			require.True(t, IsErrNotFound(err))
+
+			// Creating over a tombstone replaces it.
+			require.NoError(t, svc.DeleteProduct(ctx, "SD-2", 0, "admin@gmail.com"))
+			created, err := svc.AddProduct(ctx, Product{SKU: "SD-2", Name: "New", Price: money.Money{Amount: 5, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+			assert.False(t, created.Deleted())
+			assert.Equal(t, "New", created.Name)
+			assert.Equal(t, uint64(3), created.Version)
+
+			// Only tombstones older than the cutoff are purged.
+			require.NoError(t, svc.DeleteProduct(ctx, "SD-1", 0, "admin@gmail.com"))
+			n, err := svc.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Zero(t, n)
+			n, err = svc.PurgeDeleted(ctx, time.Now().Add(time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+			_, err = svc.GetProduct(ctx, "SD-1", true)
+			require.True(t, IsErrNotFound(err))
+			_, err = svc.GetProduct(ctx, "SD-2", false)
+			require.NoError(t, err)
+
+			changes, err := svc.Changes().ReadChanges(1, 0)
+			require.NoError(t, err)
+			ops := make([]ChangeOp, len(changes))
+			for i, c := range changes {
+				ops[i] = c.Op
+			}
+			assert.Equal(t, []ChangeOp{
+				ChangeCreate, ChangeCreate, ChangeDelete, ChangeRestore,
+				ChangeDelete, ChangeCreate, ChangeDelete, ChangePurge,
+			}, ops)
+			assert.Nil(t, changes[len(changes)-1].After)
+
+			// A product created again after a purge does not reuse versions,
+			// so stale entity tags do not match it.
+			created, err = svc.AddProduct(ctx, Product{SKU: "SD-1", Name: "New", Price: money.Money{Amount: 5, Currency: "VND"}, Unit: "Box"})
+			require.NoError(t, err)
+			assert.Equal(t, uint64(6), created.Version)
+		})
+	}
+}
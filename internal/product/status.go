@@ -0,0 +1,195 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidTransition = errors.New("status transition not allowed")
+	ErrInvalidStatus     = errors.New("unknown status")
+)
+
+// Status is the lifecycle state of a product. The numbers are the ones
+// stored and used by the legacy API, where 0 was inactive and 1 active.
+type Status uint8
+
+const (
+	StatusDraft        Status = 0
+	StatusActive       Status = 1
+	StatusDiscontinued Status = 2
+	StatusArchived     Status = 3
+
+	statusInvalid Status = 255
+)
+
+// Statuses lists every status in order.
+var Statuses = []Status{StatusDraft, StatusActive, StatusDiscontinued, StatusArchived}
+
+var statusNames = map[Status]string{
+	StatusDraft:        "draft",
+	StatusActive:       "active",
+	StatusDiscontinued: "discontinued",
+	StatusArchived:     "archived",
+}
+
+func (s Status) Valid() bool {
+	_, ok := statusNames[s]
+	return ok
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+// ParseStatus parses a status from its name, ignoring case, or its number.
+func ParseStatus(v string) (Status, error) {
+	for s, name := range statusNames {
+		if strings.EqualFold(v, name) {
+			return s, nil
+		}
+	}
+	n, err := strconv.ParseUint(v, 10, 8)
+	if err != nil || !Status(n).Valid() {
+		return 0, fmt.Errorf("%q - %w", v, ErrInvalidStatus)
+	}
+	return Status(n), nil
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	v, err := ParseStatus(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// UnmarshalJSON takes a name or a number. Any other value decodes to an
+// invalid status, so that validation reports it along with its field.
+func (s *Status) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	*s = statusInvalid
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		if v, err := ParseStatus(name); err == nil {
+			*s = v
+		}
+		return nil
+	}
+	var n uint8
+	if err := json.Unmarshal(b, &n); err == nil {
+		*s = Status(n)
+	}
+	return nil
+}
+
+// Transitions maps each status to the statuses a product in it may change
+// to.
+type Transitions map[Status][]Status
+
+// DefaultTransitions lets a draft go live or be archived unpublished, and a
+// live product be discontinued, brought back, then archived for good.
+var DefaultTransitions = Transitions{
+	StatusDraft:        {StatusActive, StatusArchived},
+	StatusActive:       {StatusDiscontinued},
+	StatusDiscontinued: {StatusActive, StatusArchived},
+}
+
+// Allowed reports whether a product may change from one status to another.
+// Keeping the same status is always allowed.
+func (t Transitions) Allowed(from, to Status) bool {
+	if from == to {
+		return true
+	}
+	for _, s := range t[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns ErrInvalidTransition when from may not change to to.
+func (t Transitions) check(from, to Status) error {
+	if t.Allowed(from, to) {
+		return nil
+	}
+	allowed := make([]string, len(t[from]))
+	for i, s := range t[from] {
+		allowed[i] = s.String()
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("%s is final, cannot change to %s - %w", from, to, ErrInvalidTransition)
+	}
+	return fmt.Errorf("%s cannot change to %s, only to %s - %w", from, to, strings.Join(allowed, ", "), ErrInvalidTransition)
+}
+
+// String formats t as read by ParseTransitions.
+func (t Transitions) String() string {
+	var rules []string
+	for _, from := range Statuses {
+		if len(t[from]) == 0 {
+			continue
+		}
+		to := make([]string, len(t[from]))
+		for i, s := range t[from] {
+			to[i] = s.String()
+		}
+		rules = append(rules, from.String()+":"+strings.Join(to, "|"))
+	}
+	return strings.Join(rules, ";")
+}
+
+// ParseTransitions parses a table written as rules separated by semicolons,
+// each a status, a colon and the statuses it may change to separated by
+// bars, e.g. "draft:active|archived;active:discontinued".
+func ParseTransitions(v string) (Transitions, error) {
+	t := make(Transitions)
+	for _, rule := range strings.Split(v, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("rule %q has no colon - %w", rule, ErrInvalidStatus)
+		}
+		from, err := ParseStatus(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule, err)
+		}
+		for _, name := range strings.Split(parts[1], "|") {
+			to, err := ParseStatus(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule, err)
+			}
+			if !t.Allowed(from, to) {
+				t[from] = append(t[from], to)
+			}
+		}
+		sort.Slice(t[from], func(i, j int) bool { return t[from][i] < t[from][j] })
+	}
+	return t, nil
+}
+
+func IsErrInvalidTransition(err error) bool {
+	return errors.Is(err, ErrInvalidTransition)
+}
+
+func IsErrInvalidStatus(err error) bool {
+	return errors.Is(err, ErrInvalidStatus)
+}
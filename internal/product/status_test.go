@@ -0,0 +1,62 @@
+package product_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/product"
+)
+
+func TestParseStatus(t *testing.T) {
+	for in, want := range map[string]Status{
+		"draft":    StatusDraft,
+		"Active":   StatusActive,
+		"2":        StatusDiscontinued,
+		"ARCHIVED": StatusArchived,
+	} {
+		got, err := ParseStatus(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "live", "4", "-1"} {
+		_, err := ParseStatus(in)
+		assert.True(t, IsErrInvalidStatus(err), in)
+	}
+
+	var v struct{ Status Status }
+	require.NoError(t, json.Unmarshal([]byte(`{"Status": "discontinued"}`), &v))
+	assert.Equal(t, StatusDiscontinued, v.Status)
+	require.NoError(t, json.Unmarshal([]byte(`{"Status": 1}`), &v))
+	assert.Equal(t, StatusActive, v.Status)
+	for _, in := range []string{`"live"`, `300`, `true`} {
+		require.NoError(t, json.Unmarshal([]byte(`{"Status": `+in+`}`), &v))
+		assert.False(t, v.Status.Valid(), in)
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"Status": 1}`), &v))
+
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Status": "active"}`, string(b))
+}
+
+func TestParseTransitions(t *testing.T) {
+	tr, err := ParseTransitions(DefaultTransitions.String())
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTransitions, tr)
+	assert.Equal(t, "draft:active|archived;active:discontinued;discontinued:active|archived", tr.String())
+
+	tr, err = ParseTransitions(" archived : draft ; draft:active|1 ")
+	require.NoError(t, err)
+	assert.Equal(t, Transitions{StatusArchived: {StatusDraft}, StatusDraft: {StatusActive}}, tr)
+	assert.True(t, tr.Allowed(StatusArchived, StatusDraft))
+	assert.True(t, tr.Allowed(StatusActive, StatusActive))
+	assert.False(t, tr.Allowed(StatusActive, StatusDraft))
+
+	for _, in := range []string{"draft", "draft:live", "gone:active"} {
+		_, err := ParseTransitions(in)
+		assert.True(t, IsErrInvalidStatus(err), in)
+	}
+}
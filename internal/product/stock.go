@@ -0,0 +1,200 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+const (
+	MaxReasonLength    = 32
+	MaxReferenceLength = 120
+)
+
+// MovementKind is why the stock of a product moved.
+type MovementKind string
+
+const (
+	MovementReceipt    MovementKind = "receipt"
+	MovementSale       MovementKind = "sale"
+	MovementAdjustment MovementKind = "adjustment"
+	MovementReturn     MovementKind = "return"
+	MovementTransfer   MovementKind = "transfer"
+)
+
+var MovementKinds = []MovementKind{MovementReceipt, MovementSale, MovementAdjustment, MovementReturn, MovementTransfer}
+
+// Reason codes of the movements recorded for writes setting the quantity
+// directly, rather than through MoveStock. Purges take out the stock of
+// the tombstone, resets move it to what they replaced it with.
+const (
+	ReasonInitial   = "initial"
+	ReasonOverwrite = "overwrite"
+	ReasonPurge     = "purge"
+	ReasonReset     = "reset"
+)
+
+var reasonPattern = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// Movement is a change of Delta units of the stock of a product at
+// Location, DefaultLocation when empty. Reason is a machine-readable code,
+// Reference points to what caused it, e.g. an order or a delivery note.
+type Movement struct {
+	Kind      MovementKind
+	Delta     int64
+	Reason    string
+	Reference string
+	Location  string
+}
+
+// Validate checks m against the rules of its kind: receipts and returns add
+// stock, sales take it, adjustments and transfers go either way.
+func (m Movement) Validate() error {
+	var fields []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch m.Kind {
+	case MovementReceipt, MovementReturn:
+		if m.Delta <= 0 {
+			add("delta", CodeNotAllowed, "delta of a %s must be positive", m.Kind)
+		}
+	case MovementSale:
+		if m.Delta >= 0 {
+			add("delta", CodeNotAllowed, "delta of a %s must be negative", m.Kind)
+		}
+	case MovementAdjustment, MovementTransfer:
+		if m.Delta == 0 {
+			add("delta", CodeRequired, "delta must not be zero")
+		}
+	default:
+		names := make([]string, len(MovementKinds))
+		for i, k := range MovementKinds {
+			names[i] = string(k)
+		}
+		add("kind", CodeNotAllowed, "kind must be one of %s", strings.Join(names, ", "))
+	}
+
+	switch {
+	case m.Reason == "":
+		add("reason", CodeRequired, "reason is required")
+	case len(m.Reason) > MaxReasonLength:
+		add("reason", CodeTooLong, "reason must be at most %d characters", MaxReasonLength)
+	case !reasonPattern.MatchString(m.Reason):
+		add("reason", CodeInvalidFormat, "reason must be lower case letters and digits separated by single underscores")
+	}
+
+	if m.Location != "" && !ValidLocation(m.Location) {
+		add("location", CodeInvalidFormat, "location must be lower case letters and digits separated by single hyphens, at most %d characters", MaxLocationLength)
+	}
+
+	switch {
+	case !utf8.ValidString(m.Reference):
+		add("reference", CodeInvalidFormat, "reference must be valid UTF-8")
+	case utf8.RuneCountInString(m.Reference) > MaxReferenceLength:
+		add("reference", CodeTooLong, "reference must be at most %d characters", MaxReferenceLength)
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// MoveStock applies m to the stock of sku at the location of m and returns
+// the product. The movement is published with the change, so a ledger
+// following the change stream always adds up to the quantity. Unless
+// version is 0 it must be the current version. Taking more than the
+// available stock fails with ErrInsufficientStock.
+func (s *Service) MoveStock(ctx context.Context, sku string, m Movement, version uint64) (*Product, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return s.modify(ctx, sku, version, func(p *Product) error {
+		if p.Deleted() {
+			return ErrNotFound
+		}
+		if int64(p.Quantity)+m.Delta < int64(p.Reserved) {
+			return fmt.Errorf("%s has %d available, moving %d - %w", sku, p.Available(), m.Delta, ErrInsufficientStock)
+		}
+		return p.moveAt(m.Location, m.Delta)
+	}, ChangeUpdate, []Movement{m})
+}
+
+// MovementsOf returns the stock movements made by c, none when it did not
+// move the stock. Writes setting the quantity directly are adjustments at
+// DefaultLocation, with the reason ReasonInitial on create and
+// ReasonOverwrite otherwise. Purges are adjustments at every location, the
+// movements of resets are in their Resets.
+func MovementsOf(c Change) []Movement {
+	if len(c.Movements) > 0 {
+		return append([]Movement(nil), c.Movements...)
+	}
+	if c.After == nil {
+		if c.Before == nil {
+			return nil
+		}
+		return levelMovements(c.Before, nil, ReasonPurge)
+	}
+	var before uint32
+	if c.Before != nil {
+		before = c.Before.Quantity
+	}
+	if c.After.Quantity == before {
+		return nil
+	}
+
+	m := Movement{Kind: MovementAdjustment, Delta: int64(c.After.Quantity) - int64(before), Reason: ReasonOverwrite}
+	if c.Op == ChangeCreate {
+		m.Reason = ReasonInitial
+	}
+	return []Movement{m}
+}
+
+// levelMovements returns the adjustments turning the stock of before at
+// every location into the one of after, nil products having none.
+func levelMovements(before, after *Product, reason string) []Movement {
+	var none Product
+	if before == nil {
+		before = &none
+	}
+	if after == nil {
+		after = &none
+	}
+	locations := []string{DefaultLocation}
+	seen := map[string]bool{DefaultLocation: true}
+	for _, levels := range [][]StockLevel{before.Levels, after.Levels} {
+		for _, l := range levels {
+			if !seen[l.Location] {
+				seen[l.Location] = true
+				locations = append(locations, l.Location)
+			}
+		}
+	}
+	sort.Strings(locations[1:])
+
+	var movements []Movement
+	for _, loc := range locations {
+		delta := int64(after.StockAt(loc)) - int64(before.StockAt(loc))
+		if delta == 0 {
+			continue
+		}
+		m := Movement{Kind: MovementAdjustment, Delta: delta, Reason: reason}
+		if loc != DefaultLocation {
+			m.Location = loc
+		}
+		movements = append(movements, m)
+	}
+	return movements
+}
+
+func IsErrInsufficientStock(err error) bool {
+	return errors.Is(err, ErrInsufficientStock)
+}
@@ -0,0 +1,71 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestMovementValidate(t *testing.T) {
+	assert.NoError(t, Movement{Kind: MovementReceipt, Delta: 5, Reason: "po_received", Reference: "PO-1"}.Validate())
+	assert.NoError(t, Movement{Kind: MovementTransfer, Delta: -5, Reason: "rebalance"}.Validate())
+
+	for _, m := range []Movement{
+		{Kind: MovementReceipt, Delta: -1, Reason: "po"},
+		{Kind: MovementReturn, Reason: "po"},
+		{Kind: MovementSale, Delta: 1, Reason: "order"},
+		{Kind: MovementAdjustment, Reason: "count"},
+	} {
+		var verr *ValidationError
+		require.ErrorAs(t, m.Validate(), &verr, m.Kind)
+		assert.Equal(t, "delta", verr.Fields[0].Field, m.Kind)
+	}
+
+	var verr *ValidationError
+	require.ErrorAs(t, Movement{Kind: "theft", Reason: "Lost Box"}.Validate(), &verr)
+	require.Len(t, verr.Fields, 2)
+	assert.Equal(t, "kind", verr.Fields[0].Field)
+	assert.Equal(t, "reason", verr.Fields[1].Field)
+}
+
+func TestServiceMoveStock(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(memory.NewProductStorage())
+	_, err := svc.AddProduct(ctx, Product{SKU: "MV-1", Name: "Stock", Quantity: 3, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	head := svc.Changes().Head()
+
+	p, err := svc.MoveStock(ctx, "MV-1", Movement{Kind: MovementReceipt, Delta: 10, Reason: "po_received", Reference: "PO-7"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(13), p.Quantity)
+	assert.Equal(t, uint64(2), p.Version)
+
+	_, err = svc.MoveStock(ctx, "MV-1", Movement{Kind: MovementSale, Delta: -14, Reason: "order"}, 0)
+	assert.True(t, IsErrInsufficientStock(err))
+	_, err = svc.MoveStock(ctx, "MV-1", Movement{Kind: MovementSale, Delta: -1, Reason: "order"}, 1)
+	assert.True(t, IsErrConflict(err))
+	_, err = svc.MoveStock(ctx, "MV-404", Movement{Kind: MovementSale, Delta: -1, Reason: "order"}, 0)
+	assert.True(t, IsErrNotFound(err))
+	_, err = svc.MoveStock(ctx, "MV-1", Movement{Kind: MovementAdjustment, Delta: 1 << 32, Reason: "count"}, 0)
+	assert.True(t, IsErrInvalid(err))
+
+	_, err = svc.UpdateProduct(ctx, Product{SKU: "MV-1", Name: "Stock", Quantity: 7, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+
+	changes, err := svc.Changes().ReadChanges(head, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, []Movement{{Kind: MovementReceipt, Delta: 10, Reason: "po_received", Reference: "PO-7"}}, MovementsOf(changes[0]))
+	assert.Equal(t, []Movement{{Kind: MovementAdjustment, Delta: -6, Reason: ReasonOverwrite}}, MovementsOf(changes[1]))
+
+	first, err := svc.Changes().ReadChanges(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Movement{{Kind: MovementAdjustment, Delta: 3, Reason: ReasonInitial}}, MovementsOf(first[0]))
+	assert.Empty(t, MovementsOf(Change{Op: ChangeUpdate, Before: first[0].After, After: first[0].After}))
+}
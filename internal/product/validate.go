@@ -0,0 +1,145 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"sampleBackend/internal/money"
+)
+
+var ErrInvalid = errors.New("invalid product")
+
+const (
+	MaxSKULength   = 32
+	MaxNameLength  = 120
+	MaxLabelLength = 32
+	MaxTags        = 20
+)
+
+// Units lists the allowed units of measure. They are matched ignoring case.
+var Units = []string{"Piece", "Box", "Carton", "Pack", "Bag", "Bottle", "Can", "Kg", "Gram", "Liter"}
+
+var (
+	skuPattern   = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+	labelPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Machine-readable codes of a FieldError.
+const (
+	CodeRequired      = "required"
+	CodeInvalidFormat = "invalid_format"
+	CodeTooLong       = "too_long"
+	CodeNotAllowed    = "not_allowed"
+	CodeReadOnly      = "read_only"
+)
+
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// ValidationError lists every field of a product breaking a domain rule.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// Validate checks p against the domain rules. The error, if any, is a
+// *ValidationError.
+func (p Product) Validate() error {
+	var fields []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case p.SKU == "":
+		add("sku", CodeRequired, "sku is required")
+	case len(p.SKU) > MaxSKULength:
+		add("sku", CodeTooLong, "sku must be at most %d characters", MaxSKULength)
+	case !skuPattern.MatchString(p.SKU):
+		add("sku", CodeInvalidFormat, "sku must be upper case letters and digits separated by single hyphens")
+	}
+
+	switch {
+	case strings.TrimSpace(p.Name) == "":
+		add("name", CodeRequired, "name is required")
+	case !utf8.ValidString(p.Name):
+		add("name", CodeInvalidFormat, "name must be valid UTF-8")
+	case utf8.RuneCountInString(p.Name) > MaxNameLength:
+		add("name", CodeTooLong, "name must be at most %d characters", MaxNameLength)
+	}
+
+	switch {
+	case p.Price.Amount <= 0:
+		add("price", CodeRequired, "price must be greater than zero")
+	case !money.ValidCurrency(p.Price.Currency):
+		add("price", CodeNotAllowed, "price currency must be an ISO 4217 code")
+	}
+
+	switch {
+	case p.Unit == "":
+		add("unit", CodeRequired, "unit is required")
+	case !ValidUnit(p.Unit):
+		add("unit", CodeNotAllowed, "unit must be one of %s", strings.Join(Units, ", "))
+	}
+
+	if !p.Status.Valid() {
+		names := make([]string, len(Statuses))
+		for i, s := range Statuses {
+			names[i] = s.String()
+		}
+		add("status", CodeNotAllowed, "status must be one of %s", strings.Join(names, ", "))
+	}
+
+	if p.Category != "" && !ValidLabel(p.Category) {
+		add("category", CodeInvalidFormat, "category must be at most %d lower case letters and digits separated by single hyphens", MaxLabelLength)
+	}
+	if len(p.Tags) > MaxTags {
+		add("tags", CodeTooLong, "tags must be at most %d", MaxTags)
+	}
+	for _, t := range p.Tags {
+		if !ValidLabel(t) {
+			add("tags", CodeInvalidFormat, "tags must be at most %d lower case letters and digits separated by single hyphens", MaxLabelLength)
+			break
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func ValidUnit(unit string) bool {
+	for _, u := range Units {
+		if strings.EqualFold(u, unit) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidLabel reports whether label is a valid category or tag.
+func ValidLabel(label string) bool {
+	return len(label) <= MaxLabelLength && labelPattern.MatchString(label)
+}
+
+func IsErrInvalid(err error) bool {
+	return errors.Is(err, ErrInvalid)
+}
@@ -0,0 +1,96 @@
+package product_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	. "sampleBackend/internal/product"
+)
+
+func TestProductValidate(t *testing.T) {
+	valid := Product{SKU: "ABC-123", Name: "Green tea", Price: money.Money{Amount: 100, Currency: "VND"}, Unit: "carton", Status: StatusActive}
+	require.NoError(t, valid.Validate())
+
+	tests := map[string]struct {
+		alter func(p *Product)
+		want  []FieldError
+	}{
+		"empty": {
+			alter: func(p *Product) { *p = Product{} },
+			want: []FieldError{
+				{Field: "sku", Code: CodeRequired},
+				{Field: "name", Code: CodeRequired},
+				{Field: "price", Code: CodeRequired},
+				{Field: "unit", Code: CodeRequired},
+			},
+		},
+		"sku with double hyphen": {
+			alter: func(p *Product) { p.SKU = "ABC--123" },
+			want:  []FieldError{{Field: "sku", Code: CodeInvalidFormat}},
+		},
+		"sku too long": {
+			alter: func(p *Product) { p.SKU = strings.Repeat("A", MaxSKULength+1) },
+			want:  []FieldError{{Field: "sku", Code: CodeTooLong}},
+		},
+		"blank name": {
+			alter: func(p *Product) { p.Name = "   " },
+			want:  []FieldError{{Field: "name", Code: CodeRequired}},
+		},
+		"name counts runes": {
+			alter: func(p *Product) { p.Name = strings.Repeat("é", MaxNameLength) },
+		},
+		"unknown unit and status": {
+			alter: func(p *Product) { p.Unit, p.Status = "Barrel", 7 },
+			want: []FieldError{
+				{Field: "unit", Code: CodeNotAllowed},
+				{Field: "status", Code: CodeNotAllowed},
+			},
+		},
+		"category and tags": {
+			alter: func(p *Product) { p.Category, p.Tags = "green-tea", []string{"organic", "new"} },
+		},
+		"invalid category and tag": {
+			alter: func(p *Product) { p.Category, p.Tags = "Green tea", []string{"organic", "on sale"} },
+			want: []FieldError{
+				{Field: "category", Code: CodeInvalidFormat},
+				{Field: "tags", Code: CodeInvalidFormat},
+			},
+		},
+		"too many tags": {
+			alter: func(p *Product) {
+				for i := 0; i <= MaxTags; i++ {
+					p.Tags = append(p.Tags, strings.Repeat("a", i+1))
+				}
+			},
+			want: []FieldError{{Field: "tags", Code: CodeTooLong}},
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			p := valid
+			test.alter(&p)
+
+			err := p.Validate()
+			if test.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.True(t, IsErrInvalid(err))
+
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr))
+			var got []FieldError
+			for _, f := range verr.Fields {
+				assert.NotEmpty(t, f.Message)
+				got = append(got, FieldError{Field: f.Field, Code: f.Code})
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Package reservation holds stock for a while, e.g. during the payment of a
+// checkout. A reservation takes its items from the available stock of the
+// products until it is confirmed, which sells them, or cancelled or expired,
+// which gives them back.
+package reservation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sampleBackend/internal/product"
+)
+
+var (
+	ErrNotFound = errors.New("reservation not found")
+	ErrFinished = errors.New("reservation already finished")
+	ErrExpired  = errors.New("reservation expired")
+)
+
+const (
+	DefaultTTL = 15 * time.Minute
+	MaxTTL     = 24 * time.Hour
+	// DefaultRetention is how long finished reservations are kept by
+	// default.
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusConfirmed Status = "confirmed"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+)
+
+// Finished reports whether a reservation in status s will not change
+// anymore.
+func (s Status) Finished() bool {
+	return s != StatusPending
+}
+
+// Reservation is stock held until ExpiresAt. Reference points to what it
+// is for, e.g. a cart or an order.
+type Reservation struct {
+	ID         string
+	Items      []product.StockItem
+	Reference  string
+	Status     Status
+	CreatedBy  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	FinishedAt time.Time
+}
+
+// Expired reports whether r is pending past its expiry at t.
+func (r Reservation) Expired(t time.Time) bool {
+	return r.Status == StatusPending && !t.Before(r.ExpiresAt)
+}
+
+type Storage interface {
+	Create(ctx context.Context, r Reservation) error
+	Get(ctx context.Context, id string) (*Reservation, error)
+	Update(ctx context.Context, r Reservation) error
+	// Expired returns the pending reservations expiring before t.
+	Expired(ctx context.Context, t time.Time) ([]Reservation, error)
+	// Prune deletes the reservations finished before t and returns how
+	// many.
+	Prune(ctx context.Context, t time.Time) (int, error)
+	// Snapshot returns every reservation by creation, Restore replaces them.
+	Snapshot(ctx context.Context) ([]Reservation, error)
+	Restore(ctx context.Context, reservations []Reservation) error
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrFinished(err error) bool {
+	return errors.Is(err, ErrFinished)
+}
+
+func IsErrExpired(err error) bool {
+	return errors.Is(err, ErrExpired)
+}
@@ -0,0 +1,307 @@
+package reservation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+)
+
+// lockStripes is the number of mutexes serializing the transitions of the
+// reservations.
+const lockStripes = 64
+
+// MaxReferenceLength bounds the reference of a reservation.
+const MaxReferenceLength = 120
+
+type Service struct {
+	storage  Storage
+	products *product.Service
+
+	locks [lockStripes]sync.Mutex
+	// writes is held for reading by the writes of reservations and for
+	// writing by Freeze.
+	writes sync.RWMutex
+}
+
+func NewService(s Storage, products *product.Service) *Service {
+	return &Service{storage: s, products: products}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reservation id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *Service) lock(id string) *sync.Mutex {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return &s.locks[h%lockStripes]
+}
+
+// Reserve holds items for ttl, DefaultTTL when 0. Either every item is
+// taken from the available stock or, when a product is missing or short,
+// none is and the error says which.
+func (s *Service) Reserve(ctx context.Context, items []product.StockItem, ttl time.Duration, reference string) (*Reservation, error) {
+	var fields []product.FieldError
+	if err := product.ValidateStockItems(items); err != nil {
+		var verr *product.ValidationError
+		if !errors.As(err, &verr) {
+			return nil, err
+		}
+		fields = verr.Fields
+	}
+	switch {
+	case ttl == 0:
+		ttl = DefaultTTL
+	case ttl < time.Second || ttl > MaxTTL:
+		fields = append(fields, product.FieldError{Field: "ttl", Code: product.CodeNotAllowed, Message: fmt.Sprintf("ttl must be between 1s and %s", MaxTTL)})
+	}
+	if len(reference) > MaxReferenceLength {
+		fields = append(fields, product.FieldError{Field: "reference", Code: product.CodeTooLong, Message: fmt.Sprintf("reference must be at most %d characters", MaxReferenceLength)})
+	}
+	if len(fields) > 0 {
+		return nil, &product.ValidationError{Fields: fields}
+	}
+
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	items = append([]product.StockItem(nil), items...)
+	id := newID()
+	if err := s.products.ReserveStock(ctx, items, id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	r := Reservation{
+		ID:        id,
+		Items:     items,
+		Reference: reference,
+		Status:    StatusPending,
+		CreatedBy: product.ActorFrom(ctx).User,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.storage.Create(ctx, r); err != nil {
+		if rerr := s.products.ReleaseStock(ctx, items, r.ID); rerr != nil {
+			fmt.Printf("reservation: release %s failed: %v\n", r.ID, rerr)
+		}
+		return nil, fmt.Errorf("create reservation: %w", err)
+	}
+	return &r, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*Reservation, error) {
+	r, err := s.storage.Get(ctx, id)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get reservation: %w", err)
+	}
+	return r, nil
+}
+
+// Confirm sells the items of the pending reservation id. A reservation
+// past its expiry is expired instead and ErrExpired returned.
+func (s *Service) Confirm(ctx context.Context, id string) (*Reservation, error) {
+	return s.finish(ctx, id, StatusConfirmed, func(r *Reservation) error {
+		return s.products.CommitStock(ctx, r.Items, r.ID)
+	})
+}
+
+// Cancel gives the items of the pending reservation id back.
+func (s *Service) Cancel(ctx context.Context, id string) (*Reservation, error) {
+	return s.finish(ctx, id, StatusCancelled, func(r *Reservation) error {
+		return s.products.ReleaseStock(ctx, r.Items, r.ID)
+	})
+}
+
+// finish moves the pending reservation id to status once apply succeeded.
+func (s *Service) finish(ctx context.Context, id string, status Status, apply func(r *Reservation) error) (*Reservation, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	mu := s.lock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	r, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status.Finished() {
+		return nil, fmt.Errorf("%s is %s: %w", id, r.Status, ErrFinished)
+	}
+	now := time.Now().UTC()
+	if r.Expired(now) && status != StatusCancelled {
+		if err := s.expire(ctx, r, now); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s expired at %v: %w", id, r.ExpiresAt, ErrExpired)
+	}
+
+	if err := apply(r); err != nil {
+		return nil, err
+	}
+	r.Status, r.FinishedAt = status, now
+	if err := s.storage.Update(ctx, *r); err != nil {
+		return nil, fmt.Errorf("update reservation: %w", err)
+	}
+	return r, nil
+}
+
+// expire releases the items of r and marks it expired. The caller holds
+// the lock of r.
+func (s *Service) expire(ctx context.Context, r *Reservation, t time.Time) error {
+	if err := s.products.ReleaseStock(ctx, r.Items, r.ID); err != nil {
+		return err
+	}
+	r.Status, r.FinishedAt = StatusExpired, t
+	if err := s.storage.Update(ctx, *r); err != nil {
+		return fmt.Errorf("update reservation: %w", err)
+	}
+	return nil
+}
+
+// ExpireReservations releases the pending reservations expired at t and
+// returns how many. A reservation failing to expire does not stop the
+// others: the error lists every one that failed, and wraps the first
+// error.
+func (s *Service) ExpireReservations(ctx context.Context, t time.Time) (int, error) {
+	expired, err := s.storage.Expired(ctx, t)
+	if err != nil {
+		return 0, fmt.Errorf("list expired reservations: %w", err)
+	}
+
+	var (
+		n      int
+		failed []string
+		first  error
+	)
+	for _, r := range expired {
+		ok, err := s.expireOne(ctx, r.ID, t)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed = append(failed, r.ID)
+			continue
+		}
+		if ok {
+			n++
+		}
+	}
+	if first != nil {
+		return n, fmt.Errorf("%d reservations not expired (%s), first: %w", len(failed), strings.Join(failed, ", "), first)
+	}
+	return n, nil
+}
+
+// PruneReservations deletes the reservations finished before t and returns
+// how many.
+func (s *Service) PruneReservations(ctx context.Context, t time.Time) (int, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	n, err := s.storage.Prune(ctx, t)
+	if err != nil {
+		return n, fmt.Errorf("prune reservations: %w", err)
+	}
+	return n, nil
+}
+
+// expireOne expires id if it is still pending past its expiry at t.
+func (s *Service) expireOne(ctx context.Context, id string, t time.Time) (bool, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	mu := s.lock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	r, err := s.Get(ctx, id)
+	if err != nil || !r.Expired(t) {
+		return false, err
+	}
+	return true, s.expire(ctx, r, t)
+}
+
+// RunExpiry expires reservations every interval until ctx is done, and
+// deletes the ones finished for longer than retention.
+func (s *Service) RunExpiry(ctx context.Context, interval, retention time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		n, err := s.ExpireReservations(ctx, now)
+		if err != nil {
+			fmt.Println("reservation expiry: failed:", err)
+		}
+		if n > 0 {
+			fmt.Printf("reservation expiry: %d reservations released\n", n)
+		}
+		n, err = s.PruneReservations(ctx, now.Add(-retention))
+		if err != nil {
+			fmt.Println("reservation expiry: failed:", err)
+		} else if n > 0 {
+			fmt.Printf("reservation expiry: %d finished reservations deleted\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Frozen blocks the writes of the reservations of a Service until thawed,
+// so that backups snapshot or replace them together with their holds.
+type Frozen struct {
+	s    *Service
+	once sync.Once
+}
+
+// Freeze waits for the writes of reservations in progress and blocks the
+// next ones until Thaw. It must be called before product.Service.Freeze,
+// as the writes of reservations write products.
+func (s *Service) Freeze() *Frozen {
+	s.writes.Lock()
+	return &Frozen{s: s}
+}
+
+func (f *Frozen) Thaw() {
+	f.once.Do(f.s.writes.Unlock)
+}
+
+// Snapshot returns a copy of every reservation, used by backups.
+func (f *Frozen) Snapshot(ctx context.Context) ([]Reservation, error) {
+	rs, err := f.s.storage.Snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot reservations: %w", err)
+	}
+	return rs, nil
+}
+
+// Restore replaces every reservation, used by backups. The holds of the
+// pending ones are restored with the products.
+func (f *Frozen) Restore(ctx context.Context, reservations []Reservation) error {
+	if err := f.s.storage.Restore(ctx, reservations); err != nil {
+		return fmt.Errorf("restore reservations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package reservation_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	. "sampleBackend/internal/reservation"
+	"sampleBackend/internal/storage/memory"
+)
+
+func TestService(t *testing.T) {
+	ctx := product.WithActor(context.Background(), product.Actor{User: "shop@example.com"})
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewReservationStorage(), products)
+	_, err := products.AddProduct(ctx, product.Product{SKU: "RV-1", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	stock := func() (uint32, uint32) {
+		p, err := products.GetProduct(ctx, "RV-1", false)
+		require.NoError(t, err)
+		return p.Quantity, p.Reserved
+	}
+
+	confirmed, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-1", Quantity: 3}}, 0, "cart-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, confirmed.Status)
+	assert.Equal(t, "shop@example.com", confirmed.CreatedBy)
+	assert.WithinDuration(t, confirmed.CreatedAt.Add(DefaultTTL), confirmed.ExpiresAt, 0)
+	cancelled, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-1", Quantity: 2}}, time.Minute, "cart-2")
+	require.NoError(t, err)
+	expiring, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-1", Quantity: 4}}, time.Second, "cart-3")
+	require.NoError(t, err)
+	_, err = svc.Reserve(ctx, []product.StockItem{{SKU: "RV-1", Quantity: 2}}, 0, "cart-4")
+	assert.True(t, product.IsErrInsufficientStock(err))
+	_, err = svc.Reserve(ctx, nil, MaxTTL+time.Second, "")
+	var verr *product.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 2)
+	assert.Equal(t, "items", verr.Fields[0].Field)
+	assert.Equal(t, "ttl", verr.Fields[1].Field)
+	q, reserved := stock()
+	assert.Equal(t, uint32(10), q)
+	assert.Equal(t, uint32(9), reserved)
+
+	r, err := svc.Confirm(ctx, confirmed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusConfirmed, r.Status)
+	assert.False(t, r.FinishedAt.IsZero())
+	q, reserved = stock()
+	assert.Equal(t, uint32(7), q)
+	assert.Equal(t, uint32(6), reserved)
+	_, err = svc.Cancel(ctx, confirmed.ID)
+	assert.True(t, IsErrFinished(err))
+
+	r, err = svc.Cancel(ctx, cancelled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, r.Status)
+	_, err = svc.Confirm(ctx, cancelled.ID)
+	assert.True(t, IsErrFinished(err))
+	q, reserved = stock()
+	assert.Equal(t, uint32(7), q)
+	assert.Equal(t, uint32(4), reserved)
+
+	n, err := svc.ExpireReservations(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = svc.ExpireReservations(ctx, expiring.ExpiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	r, err = svc.Get(ctx, expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusExpired, r.Status)
+	_, reserved = stock()
+	assert.Equal(t, uint32(0), reserved)
+
+	_, err = svc.Get(ctx, "nope")
+	assert.True(t, IsErrNotFound(err))
+}
+
+func TestServiceConfirmExpired(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewReservationStorage(), products)
+	_, err := products.AddProduct(ctx, product.Product{SKU: "RV-2", Name: "Tea", Quantity: 1, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+
+	r, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-2", Quantity: 1}}, time.Second, "")
+	require.NoError(t, err)
+	time.Sleep(time.Until(r.ExpiresAt))
+
+	// Confirming after the expiry expires the reservation, even before
+	// the expiry ran.
+	_, err = svc.Confirm(ctx, r.ID)
+	assert.True(t, IsErrExpired(err))
+	r, err = svc.Get(ctx, r.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusExpired, r.Status)
+	p, err := products.GetProduct(ctx, "RV-2", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), p.Available())
+}
+
+func TestServiceDeletedProduct(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewReservationStorage(), products)
+	_, err := products.AddProduct(ctx, product.Product{SKU: "RV-3", Name: "Tea", Quantity: 2, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+
+	dropped, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-3", Quantity: 2}}, 0, "")
+	require.NoError(t, err)
+	require.NoError(t, products.DeleteProduct(ctx, "RV-3", 0, "admin"))
+	_, err = products.RestoreProduct(ctx, "RV-3", 0)
+	require.NoError(t, err)
+	held, err := svc.Reserve(ctx, []product.StockItem{{SKU: "RV-3", Quantity: 2}}, 0, "")
+	require.NoError(t, err)
+
+	// The reservation dropped by the deletion gives back nothing of the
+	// stock held since, which cannot be sold twice.
+	_, err = svc.Cancel(ctx, dropped.ID)
+	require.NoError(t, err)
+	p, err := products.GetProduct(ctx, "RV-3", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), p.Available())
+	_, err = svc.Reserve(ctx, []product.StockItem{{SKU: "RV-3", Quantity: 1}}, 0, "")
+	assert.True(t, product.IsErrInsufficientStock(err))
+	_, err = svc.Confirm(ctx, held.ID)
+	require.NoError(t, err)
+}
+
+// failingStorage fails the updates of the reservation id.
+type failingStorage struct {
+	*memory.ReservationStorage
+	id string
+}
+
+func (fs failingStorage) Update(ctx context.Context, r Reservation) error {
+	if r.ID == fs.id {
+		return errors.New("disk full")
+	}
+	return fs.ReservationStorage.Update(ctx, r)
+}
+
+func TestServiceExpireAndPrune(t *testing.T) {
+	ctx := context.Background()
+	products := product.NewService(memory.NewProductStorage())
+	storage := &failingStorage{ReservationStorage: memory.NewReservationStorage()}
+	svc := NewService(storage, products)
+	_, err := products.AddProduct(ctx, product.Product{SKU: "RV-4", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+
+	items := []product.StockItem{{SKU: "RV-4", Quantity: 1}}
+	failing, err := svc.Reserve(ctx, items, time.Second, "")
+	require.NoError(t, err)
+	expiring, err := svc.Reserve(ctx, items, 2*time.Second, "")
+	require.NoError(t, err)
+	pending, err := svc.Reserve(ctx, items, time.Hour, "")
+	require.NoError(t, err)
+	storage.id = failing.ID
+
+	// The failure does not stop the expiry of the next reservation.
+	n, err := svc.ExpireReservations(ctx, expiring.ExpiresAt)
+	assert.ErrorContains(t, err, failing.ID)
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, 1, n)
+	r, err := svc.Get(ctx, expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusExpired, r.Status)
+
+	// Only the reservations finished before the time are deleted.
+	storage.id = ""
+	confirmed, err := svc.Confirm(ctx, pending.ID)
+	require.NoError(t, err)
+	n, err = svc.PruneReservations(ctx, confirmed.FinishedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = svc.PruneReservations(ctx, r.FinishedAt.Add(time.Nanosecond))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = svc.Get(ctx, expiring.ID)
+	assert.True(t, IsErrNotFound(err))
+	_, err = svc.Get(ctx, pending.ID)
+	assert.True(t, IsErrNotFound(err))
+	_, err = svc.Get(ctx, failing.ID)
+	assert.NoError(t, err)
+}
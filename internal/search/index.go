@@ -0,0 +1,267 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"sampleBackend/internal/product"
+)
+
+const (
+	// prefixWeight discounts a term matched by prefix against an exact match.
+	prefixWeight = 0.6
+	// leadingBonus rewards names starting with the first query word.
+	leadingBonus = 0.5
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type document struct {
+	product product.Product
+	tokens  []token
+}
+
+// Index is an inverted index over product names.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]int // term -> sku -> term frequency
+	terms    []string                  // sorted keys of postings
+	tokens   int                       // total tokens of all documents
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Put adds p or replaces the previous version of it.
+func (idx *Index) Put(p product.Product) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(p.SKU)
+	idx.put(p)
+}
+
+func (idx *Index) Remove(sku string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(sku)
+}
+
+// Reset replaces the whole content of the index with products.
+func (idx *Index) Reset(products []product.Product) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = make(map[string]*document, len(products))
+	idx.postings = make(map[string]map[string]int)
+	idx.terms = nil
+	idx.tokens = 0
+	for _, p := range products {
+		idx.put(p)
+	}
+}
+
+func (idx *Index) put(p product.Product) {
+	doc := &document{product: p, tokens: tokenize(p.Name)}
+	idx.docs[p.SKU] = doc
+	idx.tokens += len(doc.tokens)
+
+	for _, t := range doc.tokens {
+		skus, ok := idx.postings[t.term]
+		if !ok {
+			skus = make(map[string]int)
+			idx.postings[t.term] = skus
+
+			i := sort.SearchStrings(idx.terms, t.term)
+			idx.terms = append(idx.terms, "")
+			copy(idx.terms[i+1:], idx.terms[i:])
+			idx.terms[i] = t.term
+		}
+		skus[p.SKU]++
+	}
+}
+
+func (idx *Index) remove(sku string) {
+	doc, ok := idx.docs[sku]
+	if !ok {
+		return
+	}
+	delete(idx.docs, sku)
+	idx.tokens -= len(doc.tokens)
+
+	for _, t := range doc.tokens {
+		skus := idx.postings[t.term]
+		delete(skus, sku)
+		if len(skus) == 0 {
+			delete(idx.postings, t.term)
+			if i := sort.SearchStrings(idx.terms, t.term); i < len(idx.terms) && idx.terms[i] == t.term {
+				idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+			}
+		}
+	}
+}
+
+// Query is a search request. With Prefix the last word of Text also matches
+// longer words, as needed for typeahead.
+type Query struct {
+	Text   string
+	Prefix bool
+	Limit  int
+	// IncludeDeleted also returns the tombstones of deleted products.
+	IncludeDeleted bool
+}
+
+// Hit is a matching product. Matches are the byte ranges of the name that
+// matched, Highlight is the HTML escaped name with those ranges in <em>.
+type Hit struct {
+	Product   product.Product
+	Score     float64
+	Matches   [][2]int
+	Highlight string
+}
+
+type queryTerm struct {
+	term   string
+	prefix bool
+}
+
+// matchLen returns how many runes of a document term t matches, 0 if none.
+func (q queryTerm) matchLen(t string) int {
+	if t == q.term || (q.prefix && strings.HasPrefix(t, q.term)) {
+		return utf8.RuneCountInString(q.term)
+	}
+	return 0
+}
+
+// Search returns the products whose name contains every word of q, the best
+// first. Ties are ordered by SKU.
+func (idx *Index) Search(q Query) []Hit {
+	tokens := tokenize(q.Text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	terms := make([]queryTerm, len(tokens))
+	for i, t := range tokens {
+		terms[i] = queryTerm{term: t.term, prefix: q.Prefix && i == len(tokens)-1}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 {
+		return nil
+	}
+	avgLen := float64(idx.tokens) / float64(len(idx.docs))
+
+	// scores[sku] accumulates, matched[sku] counts the query terms found.
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+	for i, qt := range terms {
+		best := make(map[string]float64)
+		idx.expand(qt, func(term string, weight float64) {
+			skus := idx.postings[term]
+			idf := math.Log(1 + (float64(len(idx.docs))-float64(len(skus))+0.5)/(float64(len(skus))+0.5))
+			for sku, tf := range skus {
+				docLen := float64(len(idx.docs[sku].tokens))
+				norm := float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+				if s := weight * idf * norm; s > best[sku] {
+					best[sku] = s
+				}
+			}
+		})
+		for sku, s := range best {
+			if matched[sku] == i {
+				scores[sku] += s
+				matched[sku]++
+			}
+		}
+	}
+
+	var hits []Hit
+	for sku, score := range scores {
+		if matched[sku] != len(terms) {
+			continue
+		}
+		doc := idx.docs[sku]
+		if doc.product.Deleted() && !q.IncludeDeleted {
+			continue
+		}
+		if len(doc.tokens) > 0 && terms[0].matchLen(doc.tokens[0].term) > 0 {
+			score += leadingBonus
+		}
+		hits = append(hits, Hit{Product: doc.product, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Product.SKU < hits[j].Product.SKU
+	})
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	for i := range hits {
+		hits[i].Matches, hits[i].Highlight = highlight(idx.docs[hits[i].Product.SKU], terms)
+	}
+	return hits
+}
+
+// expand calls fn with every indexed term matched by qt and its weight.
+func (idx *Index) expand(qt queryTerm, fn func(term string, weight float64)) {
+	if !qt.prefix {
+		if _, ok := idx.postings[qt.term]; ok {
+			fn(qt.term, 1)
+		}
+		return
+	}
+	for i := sort.SearchStrings(idx.terms, qt.term); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], qt.term); i++ {
+		weight := prefixWeight
+		if idx.terms[i] == qt.term {
+			weight = 1
+		}
+		fn(idx.terms[i], weight)
+	}
+}
+
+func highlight(doc *document, terms []queryTerm) ([][2]int, string) {
+	var (
+		matches [][2]int
+		b       strings.Builder
+		last    int
+		name    = doc.product.Name
+	)
+	for _, t := range doc.tokens {
+		n := 0
+		for _, qt := range terms {
+			if m := qt.matchLen(t.term); m > n {
+				n = m
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		end := t.start + prefixBytes(name[t.start:t.end], n)
+		matches = append(matches, [2]int{t.start, end})
+
+		b.WriteString(html.EscapeString(name[last:t.start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(name[t.start:end]))
+		b.WriteString("</em>")
+		last = end
+	}
+	b.WriteString(html.EscapeString(name[last:]))
+
+	return matches, b.String()
+}
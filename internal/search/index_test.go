@@ -0,0 +1,123 @@
+package search_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	. "sampleBackend/internal/search"
+	"sampleBackend/internal/storage/memory"
+)
+
+func skus(hits []Hit) []string {
+	ret := make([]string, len(hits))
+	for i, h := range hits {
+		ret[i] = h.Product.SKU
+	}
+	return ret
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex()
+	idx.Reset([]product.Product{
+		{SKU: "VN-001", Name: "Cà phê sữa đá"},
+		{SKU: "VN-002", Name: "Phở bò tái"},
+		{SKU: "FR-001", Name: "Crème brûlée"},
+		{SKU: "EN-001", Name: "Coffee beans, dark roast"},
+		{SKU: "EN-002", Name: "Dark chocolate coffee"},
+		{SKU: "EN-003", Name: "<Coffee> & tea"},
+	})
+
+	tests := map[string]struct {
+		query Query
+		want  []string
+	}{
+		"accent insensitive":   {query: Query{Text: "ca phe sua"}, want: []string{"VN-001"}},
+		"case insensitive":     {query: Query{Text: "PHO"}, want: []string{"VN-002"}},
+		"accented query":       {query: Query{Text: "creme brulée"}, want: []string{"FR-001"}},
+		"every word required":  {query: Query{Text: "coffee tea"}, want: []string{"EN-003"}},
+		"no prefix by default": {query: Query{Text: "cof"}, want: []string{}},
+		"prefix on last word":  {query: Query{Text: "dark cof", Prefix: true}, want: []string{"EN-002", "EN-001"}},
+		"limit":                {query: Query{Text: "coffee", Limit: 2}, want: []string{"EN-003", "EN-001"}},
+		"empty":                {query: Query{Text: " ,."}, want: []string{}},
+	}
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			got := skus(idx.Search(test.query))
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	t.Run("highlight", func(t *testing.T) {
+		hits := idx.Search(Query{Text: "sua da"})
+		require.Len(t, hits, 1)
+		assert.Equal(t, "Cà phê <em>sữa</em> <em>đá</em>", hits[0].Highlight)
+		assert.Equal(t, [][2]int{{9, 14}, {15, 19}}, hits[0].Matches)
+
+		hits = idx.Search(Query{Text: "cof", Prefix: true, Limit: 1})
+		require.Len(t, hits, 1)
+		assert.Equal(t, "EN-003", hits[0].Product.SKU)
+		assert.Equal(t, "&lt;<em>Cof</em>fee&gt; &amp; tea", hits[0].Highlight)
+	})
+
+	t.Run("put and remove", func(t *testing.T) {
+		idx := NewIndex()
+		idx.Put(product.Product{SKU: "P-1", Name: "Green tea"})
+		idx.Put(product.Product{SKU: "P-1", Name: "Black tea"})
+		assert.Empty(t, idx.Search(Query{Text: "green"}))
+		assert.Equal(t, []string{"P-1"}, skus(idx.Search(Query{Text: "black"})))
+
+		idx.Remove("P-1")
+		assert.Empty(t, idx.Search(Query{Text: "tea"}))
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		idx := NewIndex()
+		idx.Put(product.Product{SKU: "D-1", Name: "Green tea", DeletedAt: time.Now()})
+		idx.Put(product.Product{SKU: "D-2", Name: "Black tea"})
+		assert.Equal(t, []string{"D-2"}, skus(idx.Search(Query{Text: "tea"})))
+		assert.Equal(t, []string{"D-1", "D-2"}, skus(idx.Search(Query{Text: "tea", IncludeDeleted: true})))
+	})
+}
+
+func TestIndexerFollowsCatalog(t *testing.T) {
+	ctx := context.Background()
+	svc := product.NewService(memory.NewProductStorage(), product.WithChangeRetention(2, 0))
+	_, err := svc.AddProduct(ctx, product.Product{SKU: "IX-001", Name: "Jasmine tea", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Piece"})
+	require.NoError(t, err)
+
+	ix := NewIndexer(svc)
+	hits, err := ix.Search(ctx, Query{Text: "tea"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"IX-001"}, skus(hits))
+
+	_, err = svc.AddProduct(ctx, product.Product{SKU: "IX-002", Name: "Oolong tea", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Piece"})
+	require.NoError(t, err)
+	_, err = svc.UpdateProduct(ctx, product.Product{SKU: "IX-001", Name: "Jasmine rice", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Piece"})
+	require.NoError(t, err)
+	hits, err = ix.Search(ctx, Query{Text: "tea"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"IX-002"}, skus(hits))
+
+	// Falling out of the retention window reloads the catalog.
+	for _, sku := range []string{"IX-003", "IX-004", "IX-005"} {
+		_, err = svc.AddProduct(ctx, product.Product{SKU: sku, Name: "Green tea", Price: money.Money{Amount: 1, Currency: "VND"}, Unit: "Piece"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, svc.DeleteProduct(ctx, "IX-002", 0, ""))
+	hits, err = ix.Search(ctx, Query{Text: "tea"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"IX-003", "IX-004", "IX-005"}, skus(hits))
+
+	require.NoError(t, svc.Restore(ctx, []product.Product{{SKU: "IX-100", Name: "Restored tea"}}))
+	hits, err = ix.Search(ctx, Query{Text: "tea"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"IX-100"}, skus(hits))
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"sampleBackend/internal/product"
+)
+
+const changeBatch = 1000
+
+// Catalog is what the indexer needs from the product service.
+type Catalog interface {
+	Snapshot(ctx context.Context) ([]product.Product, error)
+	Changes() product.ChangeStream
+}
+
+// Indexer keeps an Index in sync with the catalog by following its change
+// stream. Searches first apply the pending changes, so they always see the
+// writes that completed before them.
+type Indexer struct {
+	catalog Catalog
+	index   *Index
+
+	mu     sync.Mutex
+	next   uint64
+	loaded bool
+}
+
+func NewIndexer(catalog Catalog) *Indexer {
+	return &Indexer{
+		catalog: catalog,
+		index:   NewIndex(),
+	}
+}
+
+// Run keeps the index warm in the background until ctx is done.
+func (ix *Indexer) Run(ctx context.Context) error {
+	for {
+		if err := ix.catchUp(ctx); err != nil {
+			return err
+		}
+
+		ix.mu.Lock()
+		next := ix.next
+		ix.mu.Unlock()
+
+		_, err := ix.catalog.Changes().WaitChanges(ctx, next, 1)
+		if err != nil && !product.IsErrChangeExpired(err) {
+			return err
+		}
+	}
+}
+
+func (ix *Indexer) Search(ctx context.Context, q Query) ([]Hit, error) {
+	if err := ix.catchUp(ctx); err != nil {
+		return nil, err
+	}
+	return ix.index.Search(q), nil
+}
+
+// catchUp applies every change published so far, reloading the whole
+// catalog when the stream cannot be followed.
+func (ix *Indexer) catchUp(ctx context.Context) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	stream := ix.catalog.Changes()
+	for {
+		if !ix.loaded {
+			if err := ix.reload(ctx); err != nil {
+				return err
+			}
+		}
+
+		changes, err := stream.ReadChanges(ix.next, changeBatch)
+		if product.IsErrChangeExpired(err) {
+			ix.loaded = false
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read changes: %w", err)
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		for _, c := range changes {
+			ix.next = c.Seq + 1
+			switch c.Op {
+			// Tombstones stay indexed for searches including deleted
+			// products.
+			case product.ChangeCreate, product.ChangeUpdate, product.ChangeDelete, product.ChangeRestore:
+				ix.index.Put(*c.After)
+			case product.ChangePurge:
+				ix.index.Remove(c.SKU)
+			case product.ChangeReset:
+				ix.loaded = false
+			}
+			if !ix.loaded {
+				break
+			}
+		}
+	}
+}
+
+// reload must be called with mu held.
+func (ix *Indexer) reload(ctx context.Context) error {
+	// Read the head before the snapshot: changes in between are replayed,
+	// which is idempotent.
+	head := ix.catalog.Changes().Head()
+	products, err := ix.catalog.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("snapshot products: %w", err)
+	}
+
+	ix.index.Reset(products)
+	ix.next = head
+	ix.loaded = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// foldTable lists accented letters by the ASCII letter they fold to. It
+// covers Latin-1, Latin Extended-A and the Vietnamese letters of Latin
+// Extended Additional.
+var foldTable = map[rune]string{
+	'a': "àáâãäåāăąǎạảấầẩẫậắằẳẵặ",
+	'c': "çćĉċč",
+	'd': "ďđ",
+	'e': "èéêëēĕėęěẹẻẽếềểễệ",
+	'g': "ĝğġģ",
+	'h': "ĥħ",
+	'i': "ìíîïĩīĭįıǐỉị",
+	'j': "ĵ",
+	'k': "ķ",
+	'l': "ĺļľŀł",
+	'n': "ñńņňŉ",
+	'o': "òóôõöøōŏőǒơọỏốồổỗộớờởỡợ",
+	'r': "ŕŗř",
+	's': "śŝşš",
+	't': "ţťŧ",
+	'u': "ùúûüũūŭůűųǔưụủứừửữự",
+	'w': "ŵ",
+	'y': "ýÿŷỳỵỷỹ",
+	'z': "źżž",
+}
+
+var folds = func() map[rune]rune {
+	m := make(map[rune]rune)
+	for base, accented := range foldTable {
+		for _, r := range accented {
+			m[r] = base
+		}
+	}
+	return m
+}()
+
+// fold lower-cases r and strips its accent. It always maps one rune to one
+// rune, so offsets in folded text match offsets in the original.
+func fold(r rune) rune {
+	r = unicode.ToLower(r)
+	if f, ok := folds[r]; ok {
+		return f
+	}
+	return r
+}
+
+// token is a normalized word and its byte range in the original text.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits s into words of letters and digits.
+func tokenize(s string) []token {
+	var (
+		tokens []token
+		term   strings.Builder
+		start  = -1
+	)
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, token{term: term.String(), start: start, end: end})
+			term.Reset()
+			start = -1
+		}
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush(i)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		term.WriteRune(fold(r))
+	}
+	flush(len(s))
+
+	return tokens
+}
+
+// prefixBytes returns the length in bytes of the first n runes of s.
+func prefixBytes(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
@@ -0,0 +1,172 @@
+// Package sheet reads and writes rows of text cells as CSV or as the first
+// worksheet of an XLSX workbook, one row at a time.
+package sheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+const (
+	CSVContentType  = "text/csv"
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown sheet format")
+	ErrInvalidSheet  = errors.New("invalid sheet")
+)
+
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return XLSXContentType
+	}
+	return CSVContentType
+}
+
+// Writer writes rows. Close must be called to complete the sheet, it does
+// not close the underlying writer.
+type Writer interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+// Reader reads rows until io.EOF. Rows may be shorter than the header.
+type Reader interface {
+	ReadRow() ([]string, error)
+	// Row returns the number of the last row read as shown by spreadsheet
+	// applications, from 1. Blank rows are skipped but counted.
+	Row() int
+}
+
+type writerOptions struct {
+	text map[int]bool
+}
+
+type Option func(o *writerOptions)
+
+// WithTextColumns writes the cells of the columns at the given indexes as
+// text, even when they hold numbers, e.g. identifiers.
+func WithTextColumns(columns ...int) Option {
+	return func(o *writerOptions) {
+		for _, i := range columns {
+			o.text[i] = true
+		}
+	}
+}
+
+// NewWriter returns a writer of rows to w. Cells which spreadsheet
+// applications would run as formulas are written as text: with a leading
+// quote in CSV, which readers of this package drop.
+func NewWriter(f Format, w io.Writer, opts ...Option) (Writer, error) {
+	o := writerOptions{text: make(map[int]bool)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch f {
+	case CSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case XLSX:
+		return newXLSXWriter(w, o)
+	}
+	return nil, fmt.Errorf("%q: %w", f, ErrUnknownFormat)
+}
+
+// formulaLike reports whether spreadsheet applications would read v as a
+// formula. A quote before such a cell is escaped too, so that escaping can
+// be reversed.
+func formulaLike(v string) bool {
+	if v == "" {
+		return false
+	}
+	switch v[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	case '\'':
+		return formulaLike(v[1:])
+	}
+	return false
+}
+
+// NewReader returns a reader of the sheet held by the size bytes of r.
+func NewReader(f Format, r io.ReaderAt, size int64) (Reader, error) {
+	switch f {
+	case CSV:
+		cr := csv.NewReader(io.NewSectionReader(r, 0, size))
+		cr.FieldsPerRecord = -1
+		return &csvReader{r: cr}, nil
+	case XLSX:
+		return newXLSXReader(r, size)
+	}
+	return nil, fmt.Errorf("%q: %w", f, ErrUnknownFormat)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvWriter) WriteRow(cells []string) error {
+	var escaped []string
+	for i, v := range cells {
+		if !formulaLike(v) {
+			continue
+		}
+		if escaped == nil {
+			escaped = append([]string(nil), cells...)
+		}
+		escaped[i] = "'" + v
+	}
+	if escaped != nil {
+		cells = escaped
+	}
+	return w.w.Write(cells)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type csvReader struct {
+	r   *csv.Reader
+	row int
+}
+
+func (r *csvReader) ReadRow() ([]string, error) {
+	row, err := r.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read csv: %v - %w", err, ErrInvalidSheet)
+	}
+	r.row, _ = r.r.FieldPos(0)
+	for i, v := range row {
+		if strings.HasPrefix(v, "'") && formulaLike(v[1:]) {
+			row[i] = v[1:]
+		}
+	}
+	return row, nil
+}
+
+func (r *csvReader) Row() int {
+	return r.row
+}
+
+func IsErrUnknownFormat(err error) bool {
+	return errors.Is(err, ErrUnknownFormat)
+}
+
+func IsErrInvalidSheet(err error) bool {
+	return errors.Is(err, ErrInvalidSheet)
+}
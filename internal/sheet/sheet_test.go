@@ -0,0 +1,167 @@
+package sheet_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "sampleBackend/internal/sheet"
+)
+
+func readAll(t *testing.T, r Reader) ([][]string, []int) {
+	t.Helper()
+
+	var (
+		rows    [][]string
+		numbers []int
+	)
+	for {
+		row, err := r.ReadRow()
+		if err == io.EOF {
+			return rows, numbers
+		}
+		require.NoError(t, err)
+		rows = append(rows, append([]string(nil), row...))
+		numbers = append(numbers, r.Row())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"sku", "name", "qty", "price"},
+		{"ABC-1", `Tea "green", <loose> & fine`, "10", "18446744073709551615"},
+		{"007", "multi\nline", "0", ""},
+	}
+
+	for _, f := range []Format{CSV, XLSX} {
+		var buf bytes.Buffer
+		w, err := NewWriter(f, &buf)
+		require.NoError(t, err)
+		for _, row := range rows {
+			require.NoError(t, w.WriteRow(row))
+		}
+		require.NoError(t, w.Close())
+
+		r, err := NewReader(f, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		got, _ := readAll(t, r)
+		assert.Equal(t, rows, got, f)
+	}
+
+	_, err := NewWriter("ods", io.Discard)
+	assert.True(t, IsErrUnknownFormat(err))
+}
+
+func TestFormulaCells(t *testing.T) {
+	row := []string{"=HYPERLINK(\"http://x\")", "+1", "-2", "@SUM(A1)", "'=quoted", "'plain", "plain"}
+
+	for _, f := range []Format{CSV, XLSX} {
+		var buf bytes.Buffer
+		w, err := NewWriter(f, &buf)
+		require.NoError(t, err)
+		require.NoError(t, w.WriteRow(row))
+		require.NoError(t, w.Close())
+
+		if f == CSV {
+			assert.Equal(t, "\"'=HYPERLINK(\"\"http://x\"\")\",'+1,'-2,'@SUM(A1),''=quoted,'plain,plain\n", buf.String())
+		} else {
+			assert.Equal(t, 5, strings.Count(worksheet(t, buf.Bytes()), `s="1"`))
+		}
+
+		r, err := NewReader(f, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		got, _ := readAll(t, r)
+		assert.Equal(t, [][]string{row}, got, f)
+	}
+}
+
+func TestXLSXTextColumns(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(XLSX, &buf, WithTextColumns(0))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow([]string{"8934567890123", "42", "1234567890123456789"}))
+	require.NoError(t, w.Close())
+
+	data := worksheet(t, buf.Bytes())
+	assert.Contains(t, data, `<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">8934567890123</t></is></c>`)
+	assert.Contains(t, data, `<c r="B1"><v>42</v></c>`)
+	// Too long to be kept exactly as a number.
+	assert.Contains(t, data, `<c r="C1" t="inlineStr"><is><t xml:space="preserve">1234567890123456789</t></is></c>`)
+}
+
+// worksheet returns the worksheet of the workbook data.
+func worksheet(t *testing.T, data []byte) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCSVRowNumbers(t *testing.T) {
+	data := "sku,name\nA,\"two\nlines\"\n\nB,b\n"
+	r, err := NewReader(CSV, bytes.NewReader([]byte(data)), int64(len(data)))
+	require.NoError(t, err)
+	rows, numbers := readAll(t, r)
+	assert.Equal(t, [][]string{{"sku", "name"}, {"A", "two\nlines"}, {"B", "b"}}, rows)
+	assert.Equal(t, []int{1, 2, 5}, numbers)
+
+	data = "sku\n\"unterminated\n"
+	r, err = NewReader(CSV, bytes.NewReader([]byte(data)), int64(len(data)))
+	require.NoError(t, err)
+	_, err = r.ReadRow()
+	require.NoError(t, err)
+	_, err = r.ReadRow()
+	assert.True(t, IsErrInvalidSheet(err))
+}
+
+// TestXLSXWorkbook reads a workbook laid out as spreadsheet applications
+// save it: shared strings, sparse cells and rows, numbers as floats.
+func TestXLSXWorkbook(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="3" r:id="rId7"/><sheet name="Other" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId7" Target="/xl/worksheets/products.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>SKU</t></si><si><t>Price</t></si><si><r><t>Green </t></r><r><t>tea</t></r></si></sst>`,
+		"xl/worksheets/products.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="4"><c r="A4" t="s"><v>2</v></c><c r="B4" t="b"><v>1</v></c><c r="C4"><v>1.2E3</v></c></row>
+<row r="5"><c r="AA5" t="str"><v>x</v></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	r, err := NewReader(XLSX, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	rows, numbers := readAll(t, r)
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"SKU", "", "Price"}, rows[0])
+	assert.Equal(t, []string{"Green tea", "TRUE", "1200"}, rows[1])
+	assert.Len(t, rows[2], 27)
+	assert.Equal(t, "x", rows[2][26])
+	assert.Equal(t, []int{1, 4, 5}, numbers)
+
+	_, err = NewReader(XLSX, bytes.NewReader([]byte("sku,name")), 8)
+	assert.True(t, IsErrInvalidSheet(err))
+}
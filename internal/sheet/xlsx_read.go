@@ -0,0 +1,267 @@
+package sheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxColumns is the number of columns of a worksheet.
+const maxColumns = 16384
+
+// xlsxReader streams the rows of the first worksheet. Only the shared string
+// table is loaded upfront.
+type xlsxReader struct {
+	dec     *xml.Decoder
+	closer  io.Closer
+	strings []string
+	row     int
+}
+
+func newXLSXReader(r io.ReaderAt, size int64) (*xlsxReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx: %v - %w", err, ErrInvalidSheet)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	name, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	sheet, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing worksheet %s - %w", name, ErrInvalidSheet)
+	}
+
+	xr := &xlsxReader{}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if xr.strings, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open worksheet: %v - %w", err, ErrInvalidSheet)
+	}
+	xr.dec, xr.closer = xml.NewDecoder(rc), rc
+	return xr, nil
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %v - %w", f.Name, err, ErrInvalidSheet)
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %v - %w", f.Name, err, ErrInvalidSheet)
+	}
+	return nil
+}
+
+// firstSheet returns the name of the part holding the first worksheet of
+// the workbook.
+func firstSheet(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var (
+		workbook struct {
+			Sheets []struct {
+				ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+			} `xml:"sheets>sheet"`
+		}
+		rels struct {
+			Relationships []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+	)
+	wf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("missing workbook - %w", ErrInvalidSheet)
+	}
+	if err := decodePart(wf, &workbook); err != nil {
+		return "", err
+	}
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok || len(workbook.Sheets) == 0 {
+		return fallback, nil
+	}
+	if err := decodePart(rf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodePart(f, &sst); err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		// Rich text splits the string in runs.
+		text := si.Text
+		for _, r := range si.Runs {
+			text += r.Text
+		}
+		ret[i] = text
+	}
+	return ret, nil
+}
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+func (r *xlsxReader) ReadRow() ([]string, error) {
+	for {
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			r.closer.Close()
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read worksheet: %v - %w", err, ErrInvalidSheet)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		r.row++
+		for _, a := range start.Attr {
+			if a.Name.Local == "r" {
+				if n, err := strconv.Atoi(a.Value); err == nil {
+					r.row = n
+				}
+			}
+		}
+		return r.readCells()
+	}
+}
+
+func (r *xlsxReader) readCells() ([]string, error) {
+	var row []string
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("read worksheet row %d: %v - %w", r.row, err, ErrInvalidSheet)
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return row, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			var c xlsxCell
+			if err := r.dec.DecodeElement(&c, &t); err != nil {
+				return nil, fmt.Errorf("read worksheet row %d: %v - %w", r.row, err, ErrInvalidSheet)
+			}
+			// Empty cells are left out of the sheet, the reference tells
+			// the column.
+			col := len(row)
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			if col < 0 || col >= maxColumns {
+				return nil, fmt.Errorf("cell reference %q - %w", c.Ref, ErrInvalidSheet)
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			if row[col], err = r.cellText(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (r *xlsxReader) cellText(c xlsxCell) (string, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(r.strings) {
+			return "", fmt.Errorf("cell %s: shared string %q - %w", c.Ref, c.Value, ErrInvalidSheet)
+		}
+		return r.strings[i], nil
+	case "inlineStr":
+		text := c.Inline.Text
+		for _, run := range c.Inline.Runs {
+			text += run.Text
+		}
+		return text, nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "", "n":
+		// Spreadsheets may store whole numbers as 1000.0 or 1E3.
+		if strings.ContainsAny(c.Value, ".eE") {
+			if f, err := strconv.ParseFloat(c.Value, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				return strconv.FormatFloat(f, 'f', -1, 64), nil
+			}
+		}
+	}
+	return c.Value, nil
+}
+
+func (r *xlsxReader) Row() int {
+	return r.row
+}
+
+// columnIndex returns the index of the column of a cell reference, 0 for A1.
+func columnIndex(ref string) int {
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		n = n*26 + int(ch-'A') + 1
+		if n > maxColumns {
+			break
+		}
+	}
+	return n - 1
+}
@@ -0,0 +1,135 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	nsMain = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRel  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// xlsxParts are the fixed parts of a workbook with a single worksheet.
+var xlsxParts = []struct {
+	name, content string
+}{
+	{"[Content_Types].xml", xml.Header +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + nsRel + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header +
+		`<workbook xmlns="` + nsMain + `" xmlns:r="` + nsRel + `">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + nsRel + `/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="` + nsRel + `/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	// The cell style 1 is text, quote prefixed, so that spreadsheet
+	// applications neither run the cell as a formula nor turn it into a
+	// number once edited.
+	{"xl/styles.xml", xml.Header +
+		`<styleSheet xmlns="` + nsMain + `">` +
+		`<fonts count="1"><font/></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border/></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="49" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" quotePrefix="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// maxNumberDigits is the number of digits spreadsheet applications keep of
+// a number.
+const maxNumberDigits = 15
+
+// xlsxWriter streams the worksheet into the archive as rows come. Strings
+// are inlined so no shared string table has to be held until the end.
+type xlsxWriter struct {
+	zw   *zip.Writer
+	buf  *bufio.Writer
+	text map[int]bool
+	row  int
+}
+
+func newXLSXWriter(w io.Writer, o writerOptions) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, buf: bufio.NewWriter(f), text: o.text}
+	xw.buf.WriteString(xml.Header)
+	xw.buf.WriteString(`<worksheet xmlns="` + nsMain + `"><sheetData>`)
+	return xw, nil
+}
+
+func (w *xlsxWriter) WriteRow(cells []string) error {
+	w.row++
+	fmt.Fprintf(w.buf, `<row r="%d">`, w.row)
+	for i, v := range cells {
+		ref := columnName(i) + strconv.Itoa(w.row)
+		// Canonical integers are written as numbers, so spreadsheets can
+		// compute with quantities and prices, unless they are too long to
+		// be kept exactly or their column is text.
+		text := w.text[i]
+		if !text && len(v) <= maxNumberDigits {
+			if n, err := strconv.ParseUint(v, 10, 64); err == nil && strconv.FormatUint(n, 10) == v {
+				fmt.Fprintf(w.buf, `<c r="%s"><v>%s</v></c>`, ref, v)
+				continue
+			}
+		}
+		style := ""
+		if text || formulaLike(v) {
+			style = ` s="1"`
+		}
+		fmt.Fprintf(w.buf, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+		if err := xml.EscapeText(w.buf, []byte(v)); err != nil {
+			return err
+		}
+		w.buf.WriteString(`</t></is></c>`)
+	}
+	_, err := w.buf.WriteString(`</row>`)
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	w.buf.WriteString(`</sheetData></worksheet>`)
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// columnName returns the letters of the column at index i, A for 0.
+func columnName(i int) string {
+	var name []byte
+	for n := i + 1; n > 0; n = (n - 1) / 26 {
+		name = append([]byte{byte('A' + (n-1)%26)}, name...)
+	}
+	return string(name)
+}
@@ -0,0 +1,222 @@
+// Package file stores records as files in a directory, so they survive
+// restarts.
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/storage"
+)
+
+const jobRecord = "job.json"
+
+// validID keeps job ids from escaping the directory.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// JobStorage keeps each job in a directory named after its id, holding the
+// record as JSON and the blobs as files. Files are replaced through a rename,
+// so a crash leaves either the old or the new content.
+type JobStorage struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewJobStorage returns a storage of the jobs in dir, created if missing.
+func NewJobStorage(dir string) (*JobStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create job directory: %w", err)
+	}
+	return &JobStorage{dir: dir}, nil
+}
+
+func (js *JobStorage) path(id string, name string) (string, error) {
+	if !validID.MatchString(id) || !validID.MatchString(name) && name != jobRecord {
+		return "", fmt.Errorf("%q: %w", id, storage.ErrNotFound)
+	}
+	return filepath.Join(js.dir, id, name), nil
+}
+
+// writeFile replaces the file at path with the content written to the
+// returned writer, once closed.
+func writeFile(path string) (*atomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func (f *atomicFile) Close() error {
+	err := f.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (js *JobStorage) write(j job.Job) error {
+	path, err := js.path(j.ID, jobRecord)
+	if err != nil {
+		return err
+	}
+	f, err := writeFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(j); err != nil {
+		f.File.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return f.Close()
+}
+
+func (js *JobStorage) read(id string) (*job.Job, error) {
+	path, err := js.path(id, jobRecord)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", id, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var j job.Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &j, nil
+}
+
+func (js *JobStorage) Create(_ context.Context, j job.Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, err := js.read(j.ID); err == nil {
+		return storage.ErrAlreadyExist
+	} else if !storage.IsErrNotFound(err) {
+		return err
+	}
+	return js.write(j)
+}
+
+func (js *JobStorage) Get(_ context.Context, id string) (*job.Job, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	return js.read(id)
+}
+
+func (js *JobStorage) Update(_ context.Context, j job.Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, err := js.read(j.ID); err != nil {
+		return err
+	}
+	return js.write(j)
+}
+
+// List returns the jobs ordered by creation. Directories without a record,
+// e.g. left by a crash while submitting, are skipped.
+func (js *JobStorage) List(_ context.Context) ([]job.Job, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	entries, err := os.ReadDir(js.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []job.Job
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		j, err := js.read(e.Name())
+		if storage.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *j)
+	}
+	sort.SliceStable(ret, func(a, b int) bool {
+		return ret[a].CreatedAt.Before(ret[b].CreatedAt)
+	})
+	return ret, nil
+}
+
+// Delete removes the directory of job id.
+func (js *JobStorage) Delete(_ context.Context, id string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, err := js.read(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(js.dir, id))
+}
+
+func (js *JobStorage) CreateBlob(_ context.Context, id, name string) (io.WriteCloser, error) {
+	path, err := js.path(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return writeFile(path)
+}
+
+type blob struct {
+	*os.File
+	size int64
+}
+
+func (b blob) Size() int64 {
+	return b.size
+}
+
+func (js *JobStorage) OpenBlob(_ context.Context, id, name string) (job.Blob, error) {
+	path, err := js.path(id, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s/%s: %w", id, name, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return blob{File: f, size: fi.Size()}, nil
+}
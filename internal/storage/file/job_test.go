@@ -0,0 +1,80 @@
+package file_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/storage"
+	. "sampleBackend/internal/storage/file"
+)
+
+func TestJobStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	js, err := NewJobStorage(dir)
+	require.NoError(t, err)
+
+	created := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	second := job.Job{ID: "second", Kind: "export", Status: job.StatusQueued, CreatedAt: created.Add(time.Second)}
+	first := job.Job{ID: "first", Kind: "import", Status: job.StatusQueued, Params: []byte(`{"mode":"create"}`), CreatedAt: created}
+	require.NoError(t, js.Create(ctx, second))
+	require.NoError(t, js.Create(ctx, first))
+	assert.True(t, storage.IsErrAlreadyExist(js.Create(ctx, first)))
+
+	first.Status, first.Progress = job.StatusRunning, job.Progress{Done: 1, Total: 2}
+	require.NoError(t, js.Update(ctx, first))
+	assert.True(t, storage.IsErrNotFound(js.Update(ctx, job.Job{ID: "missing"})))
+
+	w, err := js.CreateBlob(ctx, first.ID, "output")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "sku\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// A directory left without a record is skipped.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "orphan"), 0o755))
+
+	// Records survive a new storage over the same directory.
+	js, err = NewJobStorage(dir)
+	require.NoError(t, err)
+
+	got, err := js.Get(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job.StatusRunning, got.Status)
+	assert.Equal(t, first.Progress, got.Progress)
+	assert.JSONEq(t, `{"mode":"create"}`, string(got.Params))
+
+	jobs, err := js.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, []string{"first", "second"}, []string{jobs[0].ID, jobs[1].ID})
+
+	b, err := js.OpenBlob(ctx, first.ID, "output")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), b.Size())
+	data, err := io.ReadAll(b)
+	require.NoError(t, err)
+	assert.Equal(t, "sku\n", string(data))
+	require.NoError(t, b.Close())
+
+	_, err = js.OpenBlob(ctx, second.ID, "output")
+	assert.True(t, storage.IsErrNotFound(err))
+	_, err = js.Get(ctx, "../first")
+	assert.True(t, storage.IsErrNotFound(err))
+
+	require.NoError(t, js.Delete(ctx, first.ID))
+	assert.NoDirExists(t, filepath.Join(dir, first.ID))
+	_, err = js.Get(ctx, first.ID)
+	assert.True(t, storage.IsErrNotFound(err))
+	assert.True(t, storage.IsErrNotFound(js.Delete(ctx, first.ID)))
+	assert.True(t, storage.IsErrNotFound(js.Delete(ctx, "..")))
+}
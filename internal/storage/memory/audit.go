@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"sampleBackend/internal/audit"
+)
+
+// AuditStorage keeps audit entries in memory, they are lost on restart.
+type AuditStorage struct {
+	mu    sync.Mutex
+	bySKU map[string][]audit.Entry
+}
+
+func NewAuditStorage() *AuditStorage {
+	return &AuditStorage{
+		bySKU: make(map[string][]audit.Entry),
+	}
+}
+
+func (as *AuditStorage) Append(_ context.Context, entries []audit.Entry) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	for _, e := range entries {
+		as.bySKU[e.SKU] = append(as.bySKU[e.SKU], e)
+	}
+	return nil
+}
+
+func (as *AuditStorage) History(_ context.Context, sku string, before uint64, limit int) ([]audit.Entry, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	entries := as.bySKU[sku]
+	ret := make([]audit.Entry, 0, limit)
+	for i := len(entries) - 1; i >= 0 && len(ret) < limit; i-- {
+		if before != 0 && entries[i].Seq >= before {
+			continue
+		}
+		ret = append(ret, entries[i])
+	}
+	return ret, nil
+}
@@ -0,0 +1,298 @@
+package memory
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+)
+
+// hashIndex maps an exact key to the set of SKUs carrying it.
+type hashIndex map[string]map[string]struct{}
+
+func (hi hashIndex) add(key, sku string) {
+	set, ok := hi[key]
+	if !ok {
+		set = make(map[string]struct{})
+		hi[key] = set
+	}
+	set[sku] = struct{}{}
+}
+
+func (hi hashIndex) remove(key, sku string) {
+	set := hi[key]
+	delete(set, sku)
+	if len(set) == 0 {
+		delete(hi, key)
+	}
+}
+
+func (hi hashIndex) skus(key string) []string {
+	set := hi[key]
+	ret := make([]string, 0, len(set))
+	for sku := range set {
+		ret = append(ret, sku)
+	}
+	return ret
+}
+
+type indexEntry struct {
+	key string
+	sku string
+}
+
+func (e indexEntry) less(key, sku string) bool {
+	return e.key < key || (e.key == key && e.sku < sku)
+}
+
+// maxBlockSize bounds the entries shifted by a single insert or removal.
+const maxBlockSize = 512
+
+// sortedIndex keeps entries ordered by key then SKU in a list of bounded
+// blocks, answering prefix and range lookups with binary search while keeping
+// writes cheap for large catalogs.
+type sortedIndex struct {
+	blocks [][]indexEntry
+}
+
+// indexPos addresses an entry by block and offset within the block.
+type indexPos struct {
+	block, offset int
+}
+
+// search returns the position of the first entry not less than (key, sku).
+func (si *sortedIndex) search(key, sku string) indexPos {
+	b := sort.Search(len(si.blocks), func(i int) bool {
+		block := si.blocks[i]
+		return !block[len(block)-1].less(key, sku)
+	})
+	if b == len(si.blocks) {
+		return indexPos{block: b}
+	}
+	block := si.blocks[b]
+	return indexPos{
+		block: b,
+		offset: sort.Search(len(block), func(i int) bool {
+			return !block[i].less(key, sku)
+		}),
+	}
+}
+
+func (si *sortedIndex) add(key, sku string) {
+	e := indexEntry{key: key, sku: sku}
+	if len(si.blocks) == 0 {
+		si.blocks = append(si.blocks, []indexEntry{e})
+		return
+	}
+
+	pos := si.search(key, sku)
+	if pos.block == len(si.blocks) {
+		pos = indexPos{block: pos.block - 1, offset: len(si.blocks[pos.block-1])}
+	}
+
+	block := append(si.blocks[pos.block], indexEntry{})
+	copy(block[pos.offset+1:], block[pos.offset:])
+	block[pos.offset] = e
+	si.blocks[pos.block] = block
+
+	if len(block) > maxBlockSize {
+		half := len(block) / 2
+		tail := append([]indexEntry(nil), block[half:]...)
+		si.blocks[pos.block] = block[:half:half]
+		si.blocks = append(si.blocks, nil)
+		copy(si.blocks[pos.block+2:], si.blocks[pos.block+1:])
+		si.blocks[pos.block+1] = tail
+	}
+}
+
+func (si *sortedIndex) remove(key, sku string) {
+	pos := si.search(key, sku)
+	if pos.block == len(si.blocks) {
+		return
+	}
+	block := si.blocks[pos.block]
+	if pos.offset == len(block) || block[pos.offset] != (indexEntry{key: key, sku: sku}) {
+		return
+	}
+
+	block = append(block[:pos.offset], block[pos.offset+1:]...)
+	if len(block) == 0 {
+		si.blocks = append(si.blocks[:pos.block], si.blocks[pos.block+1:]...)
+		return
+	}
+	si.blocks[pos.block] = block
+}
+
+// indexRange is the half-open run of entries between two positions.
+type indexRange struct {
+	si       *sortedIndex
+	from, to indexPos
+}
+
+func (r indexRange) len() int {
+	if r.from.block == r.to.block {
+		return r.to.offset - r.from.offset
+	}
+	n := len(r.si.blocks[r.from.block]) - r.from.offset
+	for b := r.from.block + 1; b < r.to.block; b++ {
+		n += len(r.si.blocks[b])
+	}
+	if r.to.block < len(r.si.blocks) {
+		n += r.to.offset
+	}
+	return n
+}
+
+func (r indexRange) skus() []string {
+	ret := make([]string, 0, r.len())
+	for b := r.from.block; b <= r.to.block && b < len(r.si.blocks); b++ {
+		block := r.si.blocks[b]
+		lo, hi := 0, len(block)
+		if b == r.from.block {
+			lo = r.from.offset
+		}
+		if b == r.to.block {
+			hi = r.to.offset
+		}
+		for _, e := range block[lo:hi] {
+			ret = append(ret, e.sku)
+		}
+	}
+	return ret
+}
+
+// between returns the entries with from <= key < to. An empty to means no
+// upper bound.
+func (si *sortedIndex) between(from, to string) indexRange {
+	r := indexRange{
+		si:   si,
+		from: si.search(from, ""),
+		to:   indexPos{block: len(si.blocks)},
+	}
+	if to != "" {
+		r.to = si.search(to, "")
+	}
+	if r.to.block < r.from.block || (r.to.block == r.from.block && r.to.offset < r.from.offset) {
+		r.to = r.from
+	}
+	return r
+}
+
+func (si *sortedIndex) prefix(p string) indexRange {
+	return si.between(p, prefixEnd(p))
+}
+
+// prefixEnd returns the smallest string greater than every string with
+// prefix p, or "" when there is none.
+func prefixEnd(p string) string {
+	b := []byte(p)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// priceKey encodes a price so that byte order matches numeric order.
+func priceKey(price uint64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], price)
+	return string(b[:])
+}
+
+// amountKey is the priceKey of a stored price, which is never negative.
+func amountKey(price money.Money) string {
+	if price.Amount < 0 {
+		return priceKey(0)
+	}
+	return priceKey(uint64(price.Amount))
+}
+
+func statusKey(status product.Status) string {
+	return string([]byte{byte(status)})
+}
+
+// productIndexes holds the secondary indexes of ProductStorage.
+type productIndexes struct {
+	status   hashIndex
+	unit     hashIndex
+	currency hashIndex
+	name     sortedIndex
+	price    sortedIndex
+}
+
+func newProductIndexes() *productIndexes {
+	return &productIndexes{
+		status:   make(hashIndex),
+		unit:     make(hashIndex),
+		currency: make(hashIndex),
+	}
+}
+
+func (pi *productIndexes) add(p product.Product) {
+	pi.status.add(statusKey(p.Status), p.SKU)
+	pi.unit.add(strings.ToLower(p.Unit), p.SKU)
+	pi.currency.add(strings.ToLower(p.Price.Currency), p.SKU)
+	pi.name.add(strings.ToLower(p.Name), p.SKU)
+	pi.price.add(amountKey(p.Price), p.SKU)
+}
+
+func (pi *productIndexes) remove(p product.Product) {
+	pi.status.remove(statusKey(p.Status), p.SKU)
+	pi.unit.remove(strings.ToLower(p.Unit), p.SKU)
+	pi.currency.remove(strings.ToLower(p.Price.Currency), p.SKU)
+	pi.name.remove(strings.ToLower(p.Name), p.SKU)
+	pi.price.remove(amountKey(p.Price), p.SKU)
+}
+
+// candidates returns the SKUs of the most selective index matching f, or
+// false when f uses no indexed field. Callers still have to check every
+// candidate against the full filter.
+func (pi *productIndexes) candidates(f product.Filter) ([]string, bool) {
+	var (
+		bestSize int
+		best     func() []string
+	)
+	consider := func(size int, skus func() []string) {
+		if best == nil || size < bestSize {
+			bestSize, best = size, skus
+		}
+	}
+
+	if f.Status != nil {
+		key := statusKey(*f.Status)
+		consider(len(pi.status[key]), func() []string { return pi.status.skus(key) })
+	}
+	if f.Unit != "" {
+		key := strings.ToLower(f.Unit)
+		consider(len(pi.unit[key]), func() []string { return pi.unit.skus(key) })
+	}
+	if f.Currency != "" {
+		key := strings.ToLower(f.Currency)
+		consider(len(pi.currency[key]), func() []string { return pi.currency.skus(key) })
+	}
+	if f.NamePrefix != "" {
+		r := pi.name.prefix(strings.ToLower(f.NamePrefix))
+		consider(r.len(), r.skus)
+	}
+	if f.MinPrice != nil || f.MaxPrice != nil {
+		from, to := "", ""
+		if f.MinPrice != nil {
+			from = priceKey(*f.MinPrice)
+		}
+		if f.MaxPrice != nil && *f.MaxPrice < ^uint64(0) {
+			to = priceKey(*f.MaxPrice + 1)
+		}
+		r := pi.price.between(from, to)
+		consider(r.len(), r.skus)
+	}
+
+	if best == nil {
+		return nil, false
+	}
+	return best(), true
+}
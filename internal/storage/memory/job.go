@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"sampleBackend/internal/job"
+	"sampleBackend/internal/storage"
+)
+
+// JobStorage keeps job records in memory, they are lost on restart.
+type JobStorage struct {
+	mu    sync.Mutex
+	jobs  map[string]job.Job
+	order []string
+	blobs map[string][]byte
+}
+
+func NewJobStorage() *JobStorage {
+	return &JobStorage{
+		jobs:  make(map[string]job.Job),
+		blobs: make(map[string][]byte),
+	}
+}
+
+func (js *JobStorage) Create(_ context.Context, j job.Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, exist := js.jobs[j.ID]; exist {
+		return storage.ErrAlreadyExist
+	}
+	js.jobs[j.ID] = j
+	js.order = append(js.order, j.ID)
+	return nil
+}
+
+func (js *JobStorage) Get(_ context.Context, id string) (*job.Job, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	j, exist := js.jobs[id]
+	if !exist {
+		return nil, storage.ErrNotFound
+	}
+	return &j, nil
+}
+
+func (js *JobStorage) Update(_ context.Context, j job.Job) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, exist := js.jobs[j.ID]; !exist {
+		return storage.ErrNotFound
+	}
+	js.jobs[j.ID] = j
+	return nil
+}
+
+func (js *JobStorage) List(_ context.Context) ([]job.Job, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	ret := make([]job.Job, len(js.order))
+	for i, id := range js.order {
+		ret[i] = js.jobs[id]
+	}
+	return ret, nil
+}
+
+type blobWriter struct {
+	bytes.Buffer
+	close func([]byte)
+}
+
+func (w *blobWriter) Close() error {
+	w.close(w.Bytes())
+	return nil
+}
+
+func (js *JobStorage) CreateBlob(_ context.Context, id, name string) (io.WriteCloser, error) {
+	return &blobWriter{close: func(b []byte) {
+		js.mu.Lock()
+		js.blobs[id+"/"+name] = b
+		js.mu.Unlock()
+	}}, nil
+}
+
+type blob struct {
+	*bytes.Reader
+}
+
+func (blob) Close() error {
+	return nil
+}
+
+func (js *JobStorage) OpenBlob(_ context.Context, id, name string) (job.Blob, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	b, exist := js.blobs[id+"/"+name]
+	if !exist {
+		return nil, storage.ErrNotFound
+	}
+	return blob{bytes.NewReader(b)}, nil
+}
+
+func (js *JobStorage) Delete(_ context.Context, id string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, exist := js.jobs[id]; !exist {
+		return storage.ErrNotFound
+	}
+	delete(js.jobs, id)
+	for i, oid := range js.order {
+		if oid == id {
+			js.order = append(js.order[:i], js.order[i+1:]...)
+			break
+		}
+	}
+	for name := range js.blobs {
+		if strings.HasPrefix(name, id+"/") {
+			delete(js.blobs, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"sampleBackend/internal/inventory"
+)
+
+// LedgerStorage keeps stock movements in memory, they are lost on restart.
+type LedgerStorage struct {
+	mu    sync.Mutex
+	bySKU map[string][]inventory.Entry
+}
+
+func NewLedgerStorage() *LedgerStorage {
+	return &LedgerStorage{
+		bySKU: make(map[string][]inventory.Entry),
+	}
+}
+
+func (ls *LedgerStorage) Append(_ context.Context, entries []inventory.Entry) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, e := range entries {
+		ls.bySKU[e.SKU] = append(ls.bySKU[e.SKU], e)
+	}
+	return nil
+}
+
+func (ls *LedgerStorage) Movements(_ context.Context, sku string, before uint64, limit int) ([]inventory.Entry, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	entries := ls.bySKU[sku]
+	ret := make([]inventory.Entry, 0, limit)
+	for i := len(entries) - 1; i >= 0 && len(ret) < limit; i-- {
+		if before != 0 && entries[i].Seq >= before {
+			continue
+		}
+		ret = append(ret, entries[i])
+	}
+	return ret, nil
+}
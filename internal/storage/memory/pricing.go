@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"sampleBackend/internal/pricing"
+	"sampleBackend/internal/storage"
+)
+
+// PriceStorage keeps price lists, their prices and the promotions in
+// memory, they are lost on restart.
+type PriceStorage struct {
+	mu         sync.Mutex
+	lists      map[string]pricing.List
+	entries    map[uint64]pricing.Entry
+	lastID     uint64
+	promotions map[string]pricing.Promotion
+}
+
+func NewPriceStorage() *PriceStorage {
+	return &PriceStorage{
+		lists:      make(map[string]pricing.List),
+		entries:    make(map[uint64]pricing.Entry),
+		promotions: make(map[string]pricing.Promotion),
+	}
+}
+
+func (ps *PriceStorage) CreateList(_ context.Context, l pricing.List) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.lists[l.Code]; ok {
+		return fmt.Errorf("%s: %w", l.Code, storage.ErrAlreadyExist)
+	}
+	ps.lists[l.Code] = l
+	return nil
+}
+
+func (ps *PriceStorage) GetList(_ context.Context, code string) (*pricing.List, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	l, ok := ps.lists[code]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", code, storage.ErrNotFound)
+	}
+	return &l, nil
+}
+
+func (ps *PriceStorage) Lists(_ context.Context) ([]pricing.List, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ret := make([]pricing.List, 0, len(ps.lists))
+	for _, l := range ps.lists {
+		ret = append(ret, l)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Code < ret[j].Code })
+	return ret, nil
+}
+
+func (ps *PriceStorage) AddEntry(_ context.Context, e pricing.Entry) (uint64, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.lastID++
+	e.ID = ps.lastID
+	ps.entries[e.ID] = e
+	return e.ID, nil
+}
+
+func (ps *PriceStorage) GetEntry(_ context.Context, id uint64) (*pricing.Entry, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	e, ok := ps.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("%d: %w", id, storage.ErrNotFound)
+	}
+	return &e, nil
+}
+
+func (ps *PriceStorage) Entries(_ context.Context, list, sku string) ([]pricing.Entry, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ret := []pricing.Entry{}
+	for _, e := range ps.entries {
+		if (list == "" || e.List == list) && (sku == "" || e.SKU == sku) {
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret, nil
+}
+
+func (ps *PriceStorage) DeleteEntry(_ context.Context, id uint64) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.entries[id]; !ok {
+		return fmt.Errorf("%d: %w", id, storage.ErrNotFound)
+	}
+	delete(ps.entries, id)
+	return nil
+}
+
+func (ps *PriceStorage) CreatePromotion(_ context.Context, p pricing.Promotion) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.promotions[p.Code]; ok {
+		return fmt.Errorf("%s: %w", p.Code, storage.ErrAlreadyExist)
+	}
+	ps.promotions[p.Code] = clonePromotion(p)
+	return nil
+}
+
+func (ps *PriceStorage) GetPromotion(_ context.Context, code string) (*pricing.Promotion, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p, ok := ps.promotions[code]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", code, storage.ErrNotFound)
+	}
+	p = clonePromotion(p)
+	return &p, nil
+}
+
+func (ps *PriceStorage) Promotions(_ context.Context) ([]pricing.Promotion, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ret := make([]pricing.Promotion, 0, len(ps.promotions))
+	for _, p := range ps.promotions {
+		ret = append(ret, clonePromotion(p))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Code < ret[j].Code })
+	return ret, nil
+}
+
+func (ps *PriceStorage) DeletePromotion(_ context.Context, code string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.promotions[code]; !ok {
+		return fmt.Errorf("%s: %w", code, storage.ErrNotFound)
+	}
+	delete(ps.promotions, code)
+	return nil
+}
+
+// clonePromotion copies the slices of p, which callers may modify.
+func clonePromotion(p pricing.Promotion) pricing.Promotion {
+	p.SKUs = append([]string(nil), p.SKUs...)
+	p.Categories = append([]string(nil), p.Categories...)
+	p.Tags = append([]string(nil), p.Tags...)
+	p.Tiers = append([]pricing.Tier(nil), p.Tiers...)
+	return p
+}
@@ -2,41 +2,236 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"sampleBackend/internal/product"
 	"sampleBackend/internal/storage"
 )
 
-type ProductStorage struct {
-	mu sync.Mutex
+// shardCount is the number of lock stripes the product map is split into.
+// It must be a power of two.
+const shardCount = 32
 
+// productShard holds the products whose SKU hashes to it together with
+// their secondary indexes, all guarded by mu.
+type productShard struct {
+	mu       sync.RWMutex
 	products map[string]product.Product
+	indexes  *productIndexes
+	// purged is the version reached by purging each SKU, which a product
+	// created again with the SKU goes on from so its versions never repeat.
+	purged map[string]uint64
+}
+
+const (
+	// sparseRatio is how much rarer than one product in sparseRatio the
+	// matches of a filter are for List to page a sorted copy of them
+	// rather than walk the snapshot in the order of the listing.
+	sparseRatio = 16
+	// maxListings bounds the listings a snapshot keeps.
+	maxListings = 64
+)
+
+// productSnapshot is an immutable copy of every product ordered by SKU,
+// shared by List callers until the next write bumps the generation. live
+// leaves out the deleted products.
+type productSnapshot struct {
+	gen      uint64
+	products []product.Product
+	live     []product.Product
+
+	// mu guards the orders and listings built lazily for List.
+	mu       sync.Mutex
+	orders   map[product.SortField][]product.Product
+	listings map[listingKey]*listing
+}
+
+type listingKey struct {
+	filter string
+	sort   product.SortField
+}
+
+// listing is what List keeps of a filter and sort order between pages.
+type listing struct {
+	total int
+	// matches are the products matching the filter in the order of the
+	// listing when they are sparse, nil when List walks the snapshot.
+	matches []product.Product
+}
+
+// ordered returns every product of snap sorted by field in ascending order.
+func (snap *productSnapshot) ordered(field product.SortField) []product.Product {
+	if field == "" || field == product.SortBySKU {
+		return snap.products
+	}
+
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if products, ok := snap.orders[field]; ok {
+		return products
+	}
+	products := append([]product.Product(nil), snap.products...)
+	product.ListOptions{Sort: field}.SortProducts(products)
+	if snap.orders == nil {
+		snap.orders = make(map[product.SortField][]product.Product)
+	}
+	snap.orders[field] = products
+	return products
+}
+
+// listing counts the products of snap matching f, and keeps a copy of them
+// sorted by field when they are sparse.
+func (snap *productSnapshot) listing(f product.Filter, field product.SortField) *listing {
+	k := listingKey{filter: filterKey(f), sort: field}
+	snap.mu.Lock()
+	l, ok := snap.listings[k]
+	snap.mu.Unlock()
+	if ok {
+		return l
+	}
+
+	products := snap.ordered(field)
+	l = &listing{}
+	for _, p := range products {
+		if f.Match(p) {
+			l.total++
+		}
+	}
+	if l.total*sparseRatio < len(products) {
+		l.matches = make([]product.Product, 0, l.total)
+		for _, p := range products {
+			if f.Match(p) {
+				l.matches = append(l.matches, p)
+			}
+		}
+	}
+
+	snap.mu.Lock()
+	if snap.listings == nil {
+		snap.listings = make(map[listingKey]*listing)
+	}
+	if len(snap.listings) < maxListings {
+		snap.listings[k] = l
+	}
+	snap.mu.Unlock()
+	return l
+}
+
+// filterKey tells the filters selecting different products apart.
+func filterKey(f product.Filter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q %q %q %q %t", f.Unit, f.NamePrefix, f.Currency, f.Location, f.IncludeDeleted)
+	if f.Status != nil {
+		fmt.Fprintf(&b, " status=%d", *f.Status)
+	}
+	if f.MinPrice != nil {
+		fmt.Fprintf(&b, " min_price=%d", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		fmt.Fprintf(&b, " max_price=%d", *f.MaxPrice)
+	}
+	if f.MinQuantity != nil {
+		fmt.Fprintf(&b, " min_qty=%d", *f.MinQuantity)
+	}
+	if f.MaxQuantity != nil {
+		fmt.Fprintf(&b, " max_qty=%d", *f.MaxQuantity)
+	}
+	return b.String()
+}
+
+// snapshotted returns the products of snap selected by f when f has no
+// other criterion than IncludeDeleted.
+func (snap *productSnapshot) snapshotted(f product.Filter) ([]product.Product, bool) {
+	switch f {
+	case product.Filter{}:
+		return snap.live, true
+	case product.Filter{IncludeDeleted: true}:
+		return snap.products, true
+	}
+	return nil, false
+}
+
+// ProductStorage keeps products in lock-striped maps so reads and writes
+// only contend with writes to the same shard. List is served from a
+// copy-on-write snapshot which is rebuilt lazily after a write, Query from
+// the secondary indexes of every shard.
+//
+// Lock order is shards in index order.
+type ProductStorage struct {
+	shards [shardCount]*productShard
+
+	// gen is bumped on every write while the shard lock is still held.
+	gen      uint64
+	snapshot atomic.Value // *productSnapshot
 }
 
 func NewProductStorage() *ProductStorage {
-	return &ProductStorage{
-		products: make(map[string]product.Product),
+	ps := &ProductStorage{}
+	for i := range ps.shards {
+		ps.shards[i] = &productShard{
+			products: make(map[string]product.Product),
+			indexes:  newProductIndexes(),
+			purged:   make(map[string]uint64),
+		}
 	}
+	return ps
+}
+
+func (ps *ProductStorage) shard(sku string) *productShard {
+	return ps.shards[shardIndex(sku)]
 }
 
+func shardIndex(sku string) uint32 {
+	// Inlined FNV-1a, hash/fnv would allocate on every lookup.
+	h := uint32(2166136261)
+	for i := 0; i < len(sku); i++ {
+		h ^= uint32(sku[i])
+		h *= 16777619
+	}
+	return h & (shardCount - 1)
+}
+
+// written must be called with the write lock of s held, so a concurrent
+// snapshot build either sees the write or is discarded and the indexes
+// change together with the products.
+func (ps *ProductStorage) written(s *productShard, prev, next *product.Product) {
+	if prev != nil {
+		s.indexes.remove(*prev)
+	}
+	if next != nil {
+		s.indexes.add(*next)
+	}
+	atomic.AddUint64(&ps.gen, 1)
+}
+
+// Create stores p at version 1, or after the version its SKU reached when
+// purged.
 func (ps *ProductStorage) Create(_ context.Context, p product.Product) error {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	s := ps.shard(p.SKU)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exist := ps.products[p.SKU]; exist {
+	if _, exist := s.products[p.SKU]; exist {
 		return storage.ErrAlreadyExist
 	}
 
-	ps.products[p.SKU] = p
+	p.Version = s.purged[p.SKU] + 1
+	delete(s.purged, p.SKU)
+	s.products[p.SKU] = p
+	ps.written(s, nil, &p)
 	return nil
 }
 
 func (ps *ProductStorage) Get(_ context.Context, sku string) (*product.Product, error) {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	s := ps.shard(sku)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if item, exist := ps.products[sku]; exist {
+	if item, exist := s.products[sku]; exist {
 		item := item
 		return &item, nil
 	} else {
@@ -44,40 +239,299 @@ func (ps *ProductStorage) Get(_ context.Context, sku string) (*product.Product,
 	}
 }
 
+// Update replaces the product with the SKU of p if its version is
+// p.Version, or unconditionally when p.Version is 0. The stored version is
+// incremented.
 func (ps *ProductStorage) Update(_ context.Context, p product.Product) error {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	s := ps.shard(p.SKU)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exist := ps.products[p.SKU]; !exist {
+	old, exist := s.products[p.SKU]
+	if !exist {
 		return storage.ErrNotFound
 	}
+	if p.Version != 0 && p.Version != old.Version {
+		return storage.ErrConflict
+	}
 
-	ps.products[p.SKU] = p
+	p.Version = old.Version + 1
+	s.products[p.SKU] = p
+	ps.written(s, &old, &p)
 	return nil
 }
 
-func (ps *ProductStorage) Delete(_ context.Context, sku string) error {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+// Delete removes sku if it is at version, or unconditionally when version
+// is 0.
+func (ps *ProductStorage) Delete(_ context.Context, sku string, version uint64) error {
+	s := ps.shard(sku)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exist := ps.products[sku]; !exist {
+	old, exist := s.products[sku]
+	if !exist {
 		return storage.ErrNotFound
 	}
+	if version != 0 && version != old.Version {
+		return storage.ErrConflict
+	}
 
-	delete(ps.products, sku)
+	delete(s.products, sku)
+	s.purged[sku] = old.Version + 1
+	ps.written(s, &old, nil)
 
 	return nil
 }
 
-func (ps *ProductStorage) List(_ context.Context) ([]*product.Product, error) {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+// Apply performs writes atomically: every shard is locked while they are
+// checked and then applied, so readers see all of them or none.
+func (ps *ProductStorage) Apply(_ context.Context, writes []product.Write) error {
+	ps.lockAll()
+	defer ps.unlockAll()
 
-	var retList []*product.Product
-	for _, p := range ps.products {
-		pTemp := p
-		retList = append(retList, &pTemp)
+	pending := make(map[string]*product.Product, len(writes))
+	current := func(sku string) (*product.Product, bool) {
+		if p, ok := pending[sku]; ok {
+			return p, p != nil
+		}
+		p, exist := ps.shard(sku).products[sku]
+		return &p, exist
+	}
+	for i, w := range writes {
+		old, exist := current(w.Product.SKU)
+		switch {
+		case w.Create && exist:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, storage.ErrAlreadyExist)
+		case !w.Create && !exist:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, storage.ErrNotFound)
+		case !w.Create && w.Product.Version != 0 && w.Product.Version != old.Version:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, storage.ErrConflict)
+		}
+		p := w.Product
+		p.Version = ps.shard(p.SKU).purged[p.SKU] + 1
+		if !w.Create {
+			p.Version = old.Version + 1
+		}
+		pending[p.SKU] = &p
 	}
 
+	for _, w := range writes {
+		sku := w.Product.SKU
+		p, ok := pending[sku]
+		if !ok {
+			continue
+		}
+		s := ps.shard(sku)
+		var prev *product.Product
+		if old, exist := s.products[sku]; exist {
+			prev = &old
+		}
+		s.products[sku] = *p
+		delete(s.purged, sku)
+		ps.written(s, prev, p)
+		delete(pending, sku)
+	}
+	return nil
+}
+
+// List serves unfiltered listings by SKU straight from the snapshot. Other
+// listings walk the snapshot sorted in their order from the cursor, or page
+// a sorted copy of their matches when they are sparse. Both are kept by the
+// snapshot until the next write.
+func (ps *ProductStorage) List(_ context.Context, opts product.ListOptions) (*product.Page, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	snap := ps.currentSnapshot()
+	if (opts.Sort == "" || opts.Sort == product.SortBySKU) && !opts.Desc {
+		if products, ok := snap.snapshotted(opts.Filter); ok {
+			return product.Paginate(products, opts)
+		}
+	}
+
+	l := snap.listing(opts.Filter, opts.Sort)
+	if l.matches != nil {
+		return product.Scan(l.matches, l.total, opts)
+	}
+	return product.Scan(snap.ordered(opts.Sort), l.total, opts)
+}
+
+func (ps *ProductStorage) Query(_ context.Context, f product.Filter) ([]*product.Product, error) {
+	products := ps.query(f)
+
+	retList := make([]*product.Product, len(products))
+	for i := range products {
+		retList[i] = &products[i]
+	}
 	return retList, nil
 }
+
+// query returns a copy of the products matching f ordered by SKU.
+func (ps *ProductStorage) query(f product.Filter) []product.Product {
+	if products, ok := ps.currentSnapshot().snapshotted(f); ok {
+		return append([]product.Product(nil), products...)
+	}
+
+	ps.rlockAll()
+	defer ps.runlockAll()
+
+	var ret []product.Product
+	for _, s := range ps.shards {
+		skus, indexed := s.indexes.candidates(f)
+		if !indexed {
+			for _, p := range s.products {
+				if f.Match(p) {
+					ret = append(ret, p)
+				}
+			}
+			continue
+		}
+		for _, sku := range skus {
+			if p, exist := s.products[sku]; exist && f.Match(p) {
+				ret = append(ret, p)
+			}
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].SKU < ret[j].SKU
+	})
+	return ret
+}
+
+// Snapshot returns a point-in-time copy of every product ordered by SKU.
+func (ps *ProductStorage) Snapshot(_ context.Context) ([]product.Product, error) {
+	snap := ps.currentSnapshot()
+	return append([]product.Product(nil), snap.products...), nil
+}
+
+// Restore atomically replaces every product with products. Their versions
+// are kept when higher than any the SKU had, otherwise they go on from it.
+// The products left out count as purged.
+func (ps *ProductStorage) Restore(_ context.Context, products []product.Product) error {
+	return ps.restore(products, false)
+}
+
+// restore is Restore, keeping the versions of products as they are with
+// keepVersions.
+func (ps *ProductStorage) restore(products []product.Product, keepVersions bool) error {
+	var (
+		maps    [shardCount]map[string]product.Product
+		indexes [shardCount]*productIndexes
+	)
+	for i := range maps {
+		maps[i] = make(map[string]product.Product)
+		indexes[i] = newProductIndexes()
+	}
+	for _, p := range products {
+		i := shardIndex(p.SKU)
+		if _, exist := maps[i][p.SKU]; exist {
+			return fmt.Errorf("restore %q: %w", p.SKU, storage.ErrAlreadyExist)
+		}
+		if p.Version == 0 {
+			p.Version = 1
+		}
+		maps[i][p.SKU] = p
+		indexes[i].add(p)
+	}
+
+	ps.lockAll()
+	defer ps.unlockAll()
+
+	for i, s := range ps.shards {
+		for sku, p := range maps[i] {
+			last := s.purged[sku]
+			if old, exist := s.products[sku]; exist {
+				last = old.Version
+			}
+			if !keepVersions && p.Version <= last {
+				p.Version = last + 1
+				maps[i][sku] = p
+			}
+		}
+		purged := make(map[string]uint64)
+		for sku, version := range s.purged {
+			if _, exist := maps[i][sku]; !exist {
+				purged[sku] = version
+			}
+		}
+		for sku, p := range s.products {
+			if _, exist := maps[i][sku]; !exist {
+				purged[sku] = p.Version + 1
+			}
+		}
+		s.products, s.indexes, s.purged = maps[i], indexes[i], purged
+	}
+	atomic.AddUint64(&ps.gen, 1)
+
+	return nil
+}
+
+// currentSnapshot returns the cached snapshot when no write happened since it
+// was taken, otherwise it builds a new point-in-time copy of all shards.
+func (ps *ProductStorage) currentSnapshot() *productSnapshot {
+	gen := atomic.LoadUint64(&ps.gen)
+	if snap, ok := ps.snapshot.Load().(*productSnapshot); ok && snap.gen == gen {
+		return snap
+	}
+
+	ps.rlockAll()
+	// Writers bump gen under their shard lock, so it is stable while we hold
+	// every shard for reading.
+	snap := &productSnapshot{gen: atomic.LoadUint64(&ps.gen)}
+	for _, s := range ps.shards {
+		for _, p := range s.products {
+			snap.products = append(snap.products, p)
+		}
+	}
+	ps.runlockAll()
+
+	sort.Slice(snap.products, func(i, j int) bool {
+		return snap.products[i].SKU < snap.products[j].SKU
+	})
+	snap.live = snap.products
+	for _, p := range snap.products {
+		if p.Deleted() {
+			snap.live = liveProducts(snap.products)
+			break
+		}
+	}
+	ps.snapshot.Store(snap)
+
+	return snap
+}
+
+func liveProducts(products []product.Product) []product.Product {
+	live := make([]product.Product, 0, len(products))
+	for _, p := range products {
+		if !p.Deleted() {
+			live = append(live, p)
+		}
+	}
+	return live
+}
+
+func (ps *ProductStorage) lockAll() {
+	for _, s := range ps.shards {
+		s.mu.Lock()
+	}
+}
+
+func (ps *ProductStorage) unlockAll() {
+	for i := len(ps.shards) - 1; i >= 0; i-- {
+		ps.shards[i].mu.Unlock()
+	}
+}
+
+func (ps *ProductStorage) rlockAll() {
+	for _, s := range ps.shards {
+		s.mu.RLock()
+	}
+}
+
+func (ps *ProductStorage) runlockAll() {
+	for i := len(ps.shards) - 1; i >= 0; i-- {
+		ps.shards[i].mu.RUnlock()
+	}
+}
@@ -0,0 +1,292 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+)
+
+// DefaultMaxProductEvents is the number of events kept per product by the
+// server.
+const DefaultMaxProductEvents = 1000
+
+// ProductEventStorage is an event-sourced product storage. Every write is
+// turned into product.Event appended to the stream of its SKU, and the
+// current state projection serving all reads is the fold of the stream.
+// Restores append to the streams too, so the history survives them.
+//
+// A stream growing past its limit is compacted: its oldest events are folded
+// into a snapshot, the state the remaining events start from.
+type ProductEventStorage struct {
+	*ProductStorage
+
+	// mu serializes writers so that the streams and the projection change
+	// in the same order.
+	mu        sync.Mutex
+	seq       uint64
+	streams   map[string]*productStream
+	maxEvents int
+}
+
+// productStream is the history of a SKU: events applied to base, which is
+// the product as it was at since, nil when it did not exist. head is the
+// state they reach, the projection, folded as events are appended.
+// productVersion is the Product.Version reached by the last event, a
+// product created again after a purge goes on from it.
+type productStream struct {
+	base           *product.Product
+	since          time.Time
+	version        uint64
+	productVersion uint64
+	events         []product.Event
+	head           *product.Product
+}
+
+// NewProductEventStorage returns a storage keeping at most maxEvents events
+// per product. Zero keeps them all.
+func NewProductEventStorage(maxEvents int) *ProductEventStorage {
+	return &ProductEventStorage{
+		ProductStorage: NewProductStorage(),
+		streams:        make(map[string]*productStream),
+		maxEvents:      maxEvents,
+	}
+}
+
+// appendEvents records events written to reach productVersion and returns
+// the state of the product after them. It must be called with mu held.
+//
+// The versions were checked with mu held, so the returned state is written
+// to the projection unconditionally, at version 0.
+func (es *ProductEventStorage) appendEvents(sku string, events []product.Event, productVersion uint64, t time.Time) *product.Product {
+	st, exist := es.streams[sku]
+	if !exist {
+		st = &productStream{}
+		es.streams[sku] = st
+	}
+	n := len(st.events)
+	for _, e := range events {
+		es.seq++
+		e.Seq = es.seq
+		e.Version = st.version + uint64(len(st.events)) + 1
+		e.ProductVersion = productVersion
+		e.Time = t
+		st.events = append(st.events, e)
+	}
+	if len(events) > 0 {
+		st.productVersion = productVersion
+		st.head = product.Fold(st.head, st.events[n:])
+	}
+	es.compact(st)
+	if st.head == nil {
+		return nil
+	}
+	p := *st.head
+	p.Version = 0
+	return &p
+}
+
+// created returns the version sku is created at.
+func (es *ProductEventStorage) created(sku string) uint64 {
+	if st, exist := es.streams[sku]; exist {
+		return st.productVersion + 1
+	}
+	return 1
+}
+
+// compact folds the oldest events of st into its snapshot once there are
+// more than maxEvents, keeping half of them so compactions stay rare.
+func (es *ProductEventStorage) compact(st *productStream) {
+	if es.maxEvents == 0 || len(st.events) <= es.maxEvents {
+		return
+	}
+	n := len(st.events) - es.maxEvents/2
+	st.base = product.Fold(st.base, st.events[:n])
+	st.since = st.events[n-1].Time
+	st.version += uint64(n)
+	st.events = append([]product.Event(nil), st.events[n:]...)
+}
+
+func (es *ProductEventStorage) Create(ctx context.Context, p product.Product) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if _, err := es.ProductStorage.Get(ctx, p.SKU); err == nil {
+		return storage.ErrAlreadyExist
+	}
+	return es.ProductStorage.Create(ctx, *es.appendEvents(p.SKU, product.Diff(nil, &p), es.created(p.SKU), time.Now()))
+}
+
+func (es *ProductEventStorage) Update(ctx context.Context, p product.Product) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	before, err := es.ProductStorage.Get(ctx, p.SKU)
+	if err != nil {
+		return err
+	}
+	if p.Version != 0 && p.Version != before.Version {
+		return storage.ErrConflict
+	}
+	// A write changing nothing is not an event, the version stays.
+	events := product.Diff(before, &p)
+	if len(events) == 0 {
+		return nil
+	}
+	return es.ProductStorage.Update(ctx, *es.appendEvents(p.SKU, events, before.Version+1, time.Now()))
+}
+
+func (es *ProductEventStorage) Delete(ctx context.Context, sku string, version uint64) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	before, err := es.ProductStorage.Get(ctx, sku)
+	if err != nil {
+		return err
+	}
+	if version != 0 && version != before.Version {
+		return storage.ErrConflict
+	}
+	es.appendEvents(sku, product.Diff(before, nil), before.Version+1, time.Now())
+	return es.ProductStorage.Delete(ctx, sku, version)
+}
+
+// Apply performs writes atomically and logs their events. Updates changing
+// nothing are dropped, as in Update.
+func (es *ProductEventStorage) Apply(ctx context.Context, writes []product.Write) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	type logged struct {
+		events  []product.Event
+		version uint64
+	}
+	var (
+		applied = make([]product.Write, 0, len(writes))
+		logs    = make([]logged, 0, len(writes))
+		seen    = make(map[string]bool, len(writes))
+	)
+	for i, w := range writes {
+		// A SKU written twice would need the first write applied before
+		// diffing the second.
+		if seen[w.Product.SKU] {
+			return fmt.Errorf("write %d %q: written twice - %w", i, w.Product.SKU, storage.ErrConflict)
+		}
+		seen[w.Product.SKU] = true
+
+		before, err := es.ProductStorage.Get(ctx, w.Product.SKU)
+		switch {
+		case err != nil && !storage.IsErrNotFound(err):
+			return err
+		case w.Create && err == nil:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, storage.ErrAlreadyExist)
+		case w.Create:
+			p := w.Product
+			applied = append(applied, w)
+			logs = append(logs, logged{product.Diff(nil, &p), es.created(p.SKU)})
+		case err != nil:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, err)
+		case w.Product.Version != 0 && w.Product.Version != before.Version:
+			return fmt.Errorf("write %d %q: %w", i, w.Product.SKU, storage.ErrConflict)
+		default:
+			p := w.Product
+			if events := product.Diff(before, &p); len(events) > 0 {
+				applied = append(applied, w)
+				logs = append(logs, logged{events, before.Version + 1})
+			}
+		}
+	}
+
+	t := time.Now()
+	for i, l := range logs {
+		applied[i].Product = *es.appendEvents(applied[i].Product.SKU, l.events, l.version, t)
+	}
+	return es.ProductStorage.Apply(ctx, applied)
+}
+
+// Restore appends the events turning the current products into products:
+// products not among them are purged, the others are created or changed.
+// As in ProductStorage.Restore, versions never go back, but unchanged
+// products keep theirs.
+func (es *ProductEventStorage) Restore(ctx context.Context, products []product.Product) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	current, err := es.ProductStorage.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	before := make(map[string]*product.Product, len(current))
+	for i := range current {
+		before[current[i].SKU] = &current[i]
+	}
+	restored := make(map[string]bool, len(products))
+	for _, p := range products {
+		if restored[p.SKU] {
+			return fmt.Errorf("restore %q: %w", p.SKU, storage.ErrAlreadyExist)
+		}
+		restored[p.SKU] = true
+	}
+
+	t := time.Now()
+	projection := make([]product.Product, 0, len(products))
+	for i := range products {
+		p := products[i]
+		version := es.created(p.SKU)
+		if p.Version > version {
+			version = p.Version
+		}
+		events := product.Diff(before[p.SKU], &p)
+		if len(events) == 0 {
+			projection = append(projection, *before[p.SKU])
+			continue
+		}
+		p = *es.appendEvents(p.SKU, events, version, t)
+		p.Version = version
+		projection = append(projection, p)
+	}
+	for _, p := range current {
+		if !restored[p.SKU] {
+			es.appendEvents(p.SKU, product.Diff(&p, nil), p.Version+1, t)
+		}
+	}
+
+	return es.ProductStorage.restore(projection, true)
+}
+
+func (es *ProductEventStorage) Events(_ context.Context, sku string) ([]product.Event, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	st, exist := es.streams[sku]
+	if !exist {
+		return nil, storage.ErrNotFound
+	}
+	return append([]product.Event(nil), st.events...), nil
+}
+
+func (es *ProductEventStorage) GetAt(_ context.Context, sku string, t time.Time) (*product.Product, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	st, exist := es.streams[sku]
+	if !exist {
+		return nil, storage.ErrNotFound
+	}
+	if st.version > 0 && t.Before(st.since) {
+		return nil, product.ErrHistoryCompacted
+	}
+
+	n := 0
+	for n < len(st.events) && !st.events[n].Time.After(t) {
+		n++
+	}
+	p := product.Fold(st.base, st.events[:n])
+	if p == nil {
+		return nil, storage.ErrNotFound
+	}
+	return p, nil
+}
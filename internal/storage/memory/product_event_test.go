@@ -0,0 +1,174 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+	. "sampleBackend/internal/storage/memory"
+)
+
+func TestProductEventStorage(t *testing.T) {
+	ctx := context.Background()
+	es := NewProductEventStorage(0)
+
+	p := product.Product{SKU: "ES-001", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Quantity: 5}
+	require.NoError(t, es.Create(ctx, p))
+	for i := 0; i < 10; i++ {
+		p.Quantity += uint32(i)
+		p.Price.Amount += 5
+		if i%3 == 0 {
+			p.Status = product.Status(i % 2)
+		}
+		if i == 5 {
+			p.Category, p.Tags = "tea", []string{"green", "organic"}
+		}
+		require.NoError(t, es.Update(ctx, p))
+	}
+
+	// The current state projection is what replaying the log yields.
+	events, err := es.Events(ctx, p.SKU)
+	require.NoError(t, err)
+	for i, e := range events {
+		assert.Equal(t, uint64(i+1), e.Version, fmt.Sprintf("event %d", i))
+	}
+	got, err := es.Get(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, got, product.Replay(events))
+	p.Version = 11
+	assert.Equal(t, p, *got)
+
+	// Writes changing nothing are not recorded, stale ones are rejected.
+	require.NoError(t, es.Update(ctx, p))
+	assert.True(t, storage.IsErrConflict(es.Update(ctx, product.Product{SKU: p.SKU, Version: 3})))
+	assert.True(t, storage.IsErrConflict(es.Delete(ctx, p.SKU, 3)))
+	got, err = es.Get(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(11), got.Version)
+	after, err := es.Events(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, events, after)
+
+	list, err := es.Query(ctx, product.Filter{Unit: "box"})
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	require.NoError(t, es.Delete(ctx, p.SKU, 0))
+	events, err = es.Events(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, product.EventProductPurged, events[len(events)-1].Type)
+	assert.Nil(t, product.Replay(events))
+
+	// Created again, the product goes on from the version of the purge.
+	require.NoError(t, es.Create(ctx, p))
+	got, err = es.Get(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(13), got.Version)
+	events, err = es.Events(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, got, product.Replay(events))
+}
+
+func TestProductEventStorageRestore(t *testing.T) {
+	ctx := context.Background()
+	es := NewProductEventStorage(0)
+
+	kept := product.Product{SKU: "ES-001", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Quantity: 5}
+	gone := product.Product{SKU: "ES-002", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	require.NoError(t, es.Create(ctx, kept))
+	require.NoError(t, es.Create(ctx, gone))
+	kept.Quantity = 7
+	require.NoError(t, es.Update(ctx, kept))
+
+	// The tombstone is deleted when it says, not when it was written.
+	deletedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	kept.DeletedAt, kept.DeletedBy = deletedAt, "ops@example.com"
+	require.NoError(t, es.Update(ctx, kept))
+	got, err := es.Get(ctx, kept.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, deletedAt, got.DeletedAt)
+	before, err := es.Events(ctx, kept.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, deletedAt, product.Replay(before).DeletedAt)
+
+	// A restore adds to the history instead of replacing it.
+	archived := product.Product{SKU: kept.SKU, Name: "es", Price: money.Money{Amount: 20, Currency: "VND"}, Unit: "Box", Quantity: 5, Version: 1}
+	added := product.Product{SKU: "ES-003", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Version: 4}
+	require.NoError(t, es.Restore(ctx, []product.Product{archived, added}))
+
+	events, err := es.Events(ctx, kept.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, before, events[:len(before)])
+	types := make([]product.EventType, 0, len(events)-len(before))
+	for _, e := range events[len(before):] {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []product.EventType{product.EventProductRestored, product.EventPriceChanged, product.EventQuantityAdjusted}, types)
+	got, err = es.Get(ctx, kept.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, got, product.Replay(events))
+	assert.Equal(t, uint64(4), got.Version)
+
+	got, err = es.Get(ctx, added.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), got.Version)
+
+	events, err = es.Events(ctx, gone.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, product.EventProductPurged, events[len(events)-1].Type)
+	_, err = es.Get(ctx, gone.SKU)
+	assert.True(t, storage.IsErrNotFound(err))
+}
+
+func TestProductEventStorageCompaction(t *testing.T) {
+	ctx := context.Background()
+	es := NewProductEventStorage(4)
+
+	p := product.Product{SKU: "ES-001", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box", Quantity: 5}
+	require.NoError(t, es.Create(ctx, p))
+	created := time.Now()
+	for i := 0; i < 10; i++ {
+		p.Quantity++
+		require.NoError(t, es.Update(ctx, p))
+	}
+
+	// Only the newest events are kept, numbered as if none was dropped.
+	events, err := es.Events(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(events), 4)
+	assert.Equal(t, uint64(11), events[len(events)-1].Version)
+	got, err := es.Get(ctx, p.SKU)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(15), got.Quantity)
+	assert.Equal(t, uint64(11), got.Version)
+
+	at, err := es.GetAt(ctx, p.SKU, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, got, at)
+	_, err = es.GetAt(ctx, p.SKU, created.Add(-time.Hour))
+	assert.True(t, product.IsErrHistoryCompacted(err))
+}
+
+// BenchmarkProductEventStorageUpdate writes to a product whose stream is
+// kept full, so that each write appends to DefaultMaxProductEvents events.
+func BenchmarkProductEventStorageUpdate(b *testing.B) {
+	ctx := context.Background()
+	es := NewProductEventStorage(DefaultMaxProductEvents)
+	p := product.Product{SKU: "ES-001", Name: "es", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+	require.NoError(b, es.Create(ctx, p))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Quantity++
+		if err := es.Update(ctx, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
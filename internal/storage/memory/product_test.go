@@ -0,0 +1,576 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+	. "sampleBackend/internal/storage/memory"
+)
+
+func TestProductStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("crud", func(t *testing.T) {
+		t.Parallel()
+
+		ps := NewProductStorage()
+		p := product.Product{SKU: "CRUD-001", Name: "Crud", Price: money.Money{Amount: 100, Currency: "VND"}, Unit: "Carton"}
+
+		require.NoError(t, ps.Create(ctx, p))
+		assert.True(t, storage.IsErrAlreadyExist(ps.Create(ctx, p)))
+
+		got, err := ps.Get(ctx, p.SKU)
+		require.NoError(t, err)
+		p.Version = 1
+		assert.Equal(t, p, *got)
+
+		p.Quantity = 10
+		require.NoError(t, ps.Update(ctx, p))
+		got, err = ps.Get(ctx, p.SKU)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(10), got.Quantity)
+		assert.Equal(t, uint64(2), got.Version)
+
+		// Compare-and-swap on the version, 0 is unconditional.
+		assert.True(t, storage.IsErrConflict(ps.Update(ctx, p)))
+		assert.True(t, storage.IsErrConflict(ps.Delete(ctx, p.SKU, 1)))
+		p.Version = 0
+		require.NoError(t, ps.Update(ctx, p))
+
+		require.NoError(t, ps.Delete(ctx, p.SKU, 3))
+		_, err = ps.Get(ctx, p.SKU)
+		assert.True(t, storage.IsErrNotFound(err))
+		assert.True(t, storage.IsErrNotFound(ps.Update(ctx, p)))
+		assert.True(t, storage.IsErrNotFound(ps.Delete(ctx, p.SKU, 0)))
+
+		// Versions go on after a purge, so they never repeat.
+		require.NoError(t, ps.Create(ctx, p))
+		got, err = ps.Get(ctx, p.SKU)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), got.Version)
+		require.NoError(t, ps.Restore(ctx, nil))
+		require.NoError(t, ps.Restore(ctx, []product.Product{{SKU: p.SKU, Unit: "Box", Version: 2}}))
+		got, err = ps.Get(ctx, p.SKU)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(7), got.Version)
+	})
+
+	t.Run("apply is all or nothing", func(t *testing.T) {
+		t.Parallel()
+
+		ps := NewProductStorage()
+		require.NoError(t, ps.Create(ctx, product.Product{SKU: "APL-001", Unit: "Box"}))
+
+		writes := []product.Write{
+			{Create: true, Product: product.Product{SKU: "APL-002"}},
+			{Product: product.Product{SKU: "APL-001", Unit: "Bag", Version: 2}},
+		}
+		assert.True(t, storage.IsErrConflict(ps.Apply(ctx, writes)))
+		_, err := ps.Get(ctx, "APL-002")
+		assert.True(t, storage.IsErrNotFound(err))
+		page, err := ps.List(ctx, product.ListOptions{Filter: product.Filter{Unit: "Bag"}})
+		require.NoError(t, err)
+		assert.Empty(t, page.Items)
+
+		writes[1].Product.Version = 1
+		require.NoError(t, ps.Apply(ctx, writes))
+		got, err := ps.Get(ctx, "APL-001")
+		require.NoError(t, err)
+		assert.Equal(t, product.Product{SKU: "APL-001", Unit: "Bag", Version: 2}, *got)
+		page, err = ps.List(ctx, product.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 2)
+
+		assert.True(t, storage.IsErrAlreadyExist(ps.Apply(ctx, writes[:1])))
+	})
+
+	t.Run("list reflects writes", func(t *testing.T) {
+		t.Parallel()
+
+		ps := NewProductStorage()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, ps.Create(ctx, product.Product{SKU: fmt.Sprintf("LST-%03d", i)}))
+		}
+
+		page, err := ps.List(ctx, product.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 10)
+
+		// Mutating the returned items must not leak into the cached snapshot.
+		page.Items[0].Name = "changed"
+		page, err = ps.List(ctx, product.ListOptions{})
+		require.NoError(t, err)
+		for _, p := range page.Items {
+			assert.Empty(t, p.Name)
+		}
+
+		require.NoError(t, ps.Delete(ctx, "LST-000", 0))
+		page, err = ps.List(ctx, product.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 9)
+	})
+
+	t.Run("concurrent readers and writers", func(t *testing.T) {
+		t.Parallel()
+
+		ps := NewProductStorage()
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					sku := fmt.Sprintf("CON-%d-%d", w, i)
+					assert.NoError(t, ps.Create(ctx, product.Product{SKU: sku}))
+					assert.NoError(t, ps.Update(ctx, product.Product{SKU: sku, Quantity: uint32(i), Unit: "Box"}))
+					_, err := ps.Get(ctx, sku)
+					assert.NoError(t, err)
+					_, err = ps.List(ctx, product.ListOptions{})
+					assert.NoError(t, err)
+					_, err = ps.Query(ctx, product.Filter{Unit: "box"})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		page, err := ps.List(ctx, product.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 800)
+		boxes, err := ps.Query(ctx, product.Filter{Unit: "box"})
+		require.NoError(t, err)
+		assert.Len(t, boxes, 800)
+	})
+}
+
+func TestProductStorageRestoreTombstones(t *testing.T) {
+	ctx := context.Background()
+	deletedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for name, ps := range map[string]product.Storage{
+		"memory":       NewProductStorage(),
+		"eventsourced": NewProductEventStorage(0),
+	} {
+		ps := ps
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			live := product.Product{SKU: "TMB-001", Name: "Tea", Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"}
+			require.NoError(t, ps.Create(ctx, live))
+
+			// Tombstones stay deleted, whether their SKU exists or not.
+			archived := []product.Product{live, live}
+			archived[1].SKU = "TMB-002"
+			for i := range archived {
+				archived[i].DeletedAt, archived[i].DeletedBy = deletedAt, "ops@example.com"
+			}
+			require.NoError(t, ps.Restore(ctx, archived))
+			for _, p := range archived {
+				got, err := ps.Get(ctx, p.SKU)
+				require.NoError(t, err)
+				assert.True(t, got.Deleted(), p.SKU)
+				assert.Equal(t, deletedAt, got.DeletedAt, p.SKU)
+				assert.Equal(t, "ops@example.com", got.DeletedBy, p.SKU)
+			}
+		})
+	}
+}
+
+func TestProductStorageList(t *testing.T) {
+	ctx := context.Background()
+
+	ps := NewProductStorage()
+	for i := 0; i < 95; i++ {
+		require.NoError(t, ps.Create(ctx, product.Product{
+			SKU:      fmt.Sprintf("PAG-%03d", i),
+			Name:     fmt.Sprintf("Name %03d", 94-i),
+			Price:    money.Money{Amount: int64(i % 10), Currency: "VND"},
+			Quantity: uint32(i % 7),
+			Unit:     "Box",
+		}))
+	}
+
+	for _, sort := range []product.SortField{"", product.SortBySKU, product.SortByName, product.SortByPrice, product.SortByQuantity} {
+		for _, desc := range []bool{false, true} {
+			opts := product.ListOptions{Sort: sort, Desc: desc, Limit: 10}
+
+			t.Run(fmt.Sprintf("%s desc %v", sort, desc), func(t *testing.T) {
+				// Walk forward to the end, then back to the start.
+				var (
+					forward []string
+					pages   []*product.Page
+				)
+				for {
+					page, err := ps.List(ctx, opts)
+					require.NoError(t, err)
+					assert.Equal(t, 95, page.Total)
+					pages = append(pages, page)
+					for i, p := range page.Items {
+						if len(forward) > 0 && i == 0 {
+							prev, _ := ps.Get(ctx, forward[len(forward)-1])
+							assert.True(t, opts.Less(prev, p))
+						}
+						if i > 0 {
+							assert.True(t, opts.Less(page.Items[i-1], p))
+						}
+						forward = append(forward, p.SKU)
+					}
+					if page.Next == "" {
+						break
+					}
+					opts.Cursor = page.Next
+				}
+				require.Len(t, forward, 95)
+				require.Len(t, pages, 10)
+				assert.Empty(t, pages[0].Prev)
+
+				opts.Cursor = pages[len(pages)-1].Prev
+				for i := len(pages) - 2; i >= 0; i-- {
+					page, err := ps.List(ctx, opts)
+					require.NoError(t, err)
+					assert.Equal(t, pages[i].Items, page.Items)
+					opts.Cursor = page.Prev
+				}
+				assert.Empty(t, opts.Cursor)
+			})
+		}
+	}
+
+	t.Run("filter", func(t *testing.T) {
+		minQty, maxPrice := uint32(3), uint64(4)
+		page, err := ps.List(ctx, product.ListOptions{
+			Filter: product.Filter{MinQuantity: &minQty, MaxPrice: &maxPrice},
+			Sort:   product.SortByPrice,
+			Limit:  5,
+		})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 5)
+		assert.NotEmpty(t, page.Next)
+		for _, p := range page.Items {
+			assert.GreaterOrEqual(t, p.Quantity, minQty)
+			assert.LessOrEqual(t, uint64(p.Price.Amount), maxPrice)
+		}
+	})
+
+	t.Run("filtered pages", func(t *testing.T) {
+		minQty := uint32(3)
+		filters := map[string]product.Filter{
+			"dense":  {MinQuantity: &minQty},
+			"sparse": {NamePrefix: "name 000"},
+			"none":   {Unit: "Crate"},
+		}
+		for name, f := range filters {
+			for _, sort := range []product.SortField{product.SortBySKU, product.SortByName, product.SortByPrice} {
+				for _, desc := range []bool{false, true} {
+					opts := product.ListOptions{Filter: f, Sort: sort, Desc: desc, Limit: 4}
+					all, err := ps.Query(ctx, f)
+					require.NoError(t, err)
+					var want []string
+					matches := make([]product.Product, 0, len(all))
+					for _, p := range all {
+						matches = append(matches, *p)
+					}
+					opts.SortProducts(matches)
+					for _, p := range matches {
+						want = append(want, p.SKU)
+					}
+
+					var (
+						got   []string
+						pages []*product.Page
+					)
+					for {
+						page, err := ps.List(ctx, opts)
+						require.NoError(t, err)
+						assert.Equal(t, len(want), page.Total, "%s by %s", name, sort)
+						pages = append(pages, page)
+						for _, p := range page.Items {
+							got = append(got, p.SKU)
+						}
+						if page.Next == "" {
+							break
+						}
+						opts.Cursor = page.Next
+					}
+					assert.Equal(t, want, got, "%s by %s desc %v", name, sort, desc)
+					assert.Empty(t, pages[0].Prev)
+
+					opts.Cursor = pages[len(pages)-1].Prev
+					for i := len(pages) - 2; i >= 0; i-- {
+						page, err := ps.List(ctx, opts)
+						require.NoError(t, err)
+						assert.Equal(t, pages[i].Items, page.Items)
+						opts.Cursor = page.Prev
+					}
+					assert.Empty(t, opts.Cursor)
+				}
+			}
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := ps.List(ctx, product.ListOptions{Sort: "color"})
+		assert.True(t, product.IsErrInvalidListOptions(err))
+
+		_, err = ps.List(ctx, product.ListOptions{Cursor: "not a cursor"})
+		assert.True(t, product.IsErrInvalidListOptions(err))
+
+		page, err := ps.List(ctx, product.ListOptions{Sort: product.SortByPrice, Limit: 1})
+		require.NoError(t, err)
+		_, err = ps.List(ctx, product.ListOptions{Sort: product.SortByName, Cursor: page.Next})
+		assert.True(t, product.IsErrInvalidListOptions(err))
+	})
+}
+
+// mutexProductStorage is the previous single-mutex design, kept here as the
+// baseline the striped storage is benchmarked against.
+type mutexProductStorage struct {
+	mu       sync.Mutex
+	products map[string]product.Product
+}
+
+func (ms *mutexProductStorage) Create(_ context.Context, p product.Product) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.products[p.SKU] = p
+	return nil
+}
+
+func (ms *mutexProductStorage) Get(_ context.Context, sku string) (*product.Product, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	p, ok := ms.products[sku]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &p, nil
+}
+
+func (ms *mutexProductStorage) Update(ctx context.Context, p product.Product) error {
+	return ms.Create(ctx, p)
+}
+
+func (ms *mutexProductStorage) List(_ context.Context, _ product.ListOptions) (*product.Page, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var ret []*product.Product
+	for _, p := range ms.products {
+		p := p
+		ret = append(ret, &p)
+	}
+	return &product.Page{Items: ret, Total: len(ret)}, nil
+}
+
+type benchStorage interface {
+	Create(ctx context.Context, p product.Product) error
+	Get(ctx context.Context, sku string) (*product.Product, error)
+	Update(ctx context.Context, p product.Product) error
+	List(ctx context.Context, opts product.ListOptions) (*product.Page, error)
+}
+
+const benchProducts = 1000
+
+func seedBench(b *testing.B, s benchStorage) []string {
+	b.Helper()
+
+	skus := make([]string, benchProducts)
+	for i := range skus {
+		skus[i] = fmt.Sprintf("BEN-%05d", i)
+		require.NoError(b, s.Create(context.Background(), product.Product{SKU: skus[i], Price: money.Money{Amount: int64(i), Currency: "VND"}}))
+	}
+	return skus
+}
+
+func benchmarkStorages() map[string]func() benchStorage {
+	return map[string]func() benchStorage{
+		"mutex": func() benchStorage {
+			return &mutexProductStorage{products: make(map[string]product.Product)}
+		},
+		"striped": func() benchStorage {
+			return NewProductStorage()
+		},
+	}
+}
+
+func BenchmarkProductStorageParallelGet(b *testing.B) {
+	for name, newStorage := range benchmarkStorages() {
+		b.Run(name, func(b *testing.B) {
+			s := newStorage()
+			skus := seedBench(b, s)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_, _ = s.Get(ctx, skus[i%len(skus)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkProductStorageParallelMixed runs 1 write per 16 Gets.
+func BenchmarkProductStorageParallelMixed(b *testing.B) {
+	for name, newStorage := range benchmarkStorages() {
+		b.Run(name, func(b *testing.B) {
+			s := newStorage()
+			skus := seedBench(b, s)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					sku := skus[i%len(skus)]
+					if i%16 == 0 {
+						_ = s.Update(ctx, product.Product{SKU: sku, Quantity: uint32(i)})
+					} else {
+						_, _ = s.Get(ctx, sku)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkProductStorageParallelList(b *testing.B) {
+	for name, newStorage := range benchmarkStorages() {
+		b.Run(name, func(b *testing.B) {
+			s := newStorage()
+			seedBench(b, s)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, _ = s.List(ctx, product.ListOptions{})
+				}
+			})
+		})
+	}
+}
+
+func TestProductStorageQuery(t *testing.T) {
+	ctx := context.Background()
+	status := func(v product.Status) *product.Status { return &v }
+	u64 := func(v uint64) *uint64 { return &v }
+
+	ps := NewProductStorage()
+	for i := 0; i < 2000; i++ {
+		unit := "Carton"
+		if i%2 == 0 {
+			unit = "Box"
+		}
+		require.NoError(t, ps.Create(ctx, product.Product{
+			SKU:    fmt.Sprintf("QRY-%04d", i),
+			Name:   fmt.Sprintf("Item %04d", i),
+			Price:  money.Money{Amount: int64(i), Currency: "VND"},
+			Unit:   unit,
+			Status: product.Status(i % 3),
+		}))
+	}
+
+	tests := map[string]struct {
+		filter product.Filter
+		want   int
+	}{
+		"no filter":        {filter: product.Filter{}, want: 2000},
+		"status":           {filter: product.Filter{Status: status(product.StatusActive)}, want: 667},
+		"unit ignore case": {filter: product.Filter{Unit: "box"}, want: 1000},
+		"name prefix":      {filter: product.Filter{NamePrefix: "item 01"}, want: 100},
+		"price range":      {filter: product.Filter{MinPrice: u64(10), MaxPrice: u64(19)}, want: 10},
+		"min price only":   {filter: product.Filter{MinPrice: u64(1990)}, want: 10},
+		"combined": {
+			filter: product.Filter{Unit: "Box", NamePrefix: "Item 00", MaxPrice: u64(49)},
+			want:   25,
+		},
+		"no match": {filter: product.Filter{NamePrefix: "nothing"}, want: 0},
+	}
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			got, err := ps.Query(ctx, test.filter)
+			require.NoError(t, err)
+			require.Len(t, got, test.want)
+			for i, p := range got {
+				assert.True(t, test.filter.Match(*p))
+				if i > 0 {
+					assert.Less(t, got[i-1].SKU, p.SKU)
+				}
+			}
+		})
+	}
+
+	t.Run("indexes follow writes", func(t *testing.T) {
+		p, err := ps.Get(ctx, "QRY-0001")
+		require.NoError(t, err)
+		p.Unit = "Piece"
+		p.Name = "Renamed"
+		require.NoError(t, ps.Update(ctx, *p))
+		require.NoError(t, ps.Delete(ctx, "QRY-0003", 0))
+
+		got, err := ps.Query(ctx, product.Filter{Unit: "piece"})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "QRY-0001", got[0].SKU)
+
+		got, err = ps.Query(ctx, product.Filter{NamePrefix: "item 000"})
+		require.NoError(t, err)
+		assert.Len(t, got, 8)
+
+		got, err = ps.Query(ctx, product.Filter{Unit: "Carton"})
+		require.NoError(t, err)
+		assert.Len(t, got, 998)
+	})
+}
+
+// BenchmarkProductStorageQuery filters a large catalog through the indexes,
+// compared with scanning List.
+func BenchmarkProductStorageQuery(b *testing.B) {
+	const size = 200000
+
+	ctx := context.Background()
+	ps := NewProductStorage()
+	for i := 0; i < size; i++ {
+		require.NoError(b, ps.Create(ctx, product.Product{
+			SKU:    fmt.Sprintf("BQ-%06d", (i*7919)%size),
+			Name:   fmt.Sprintf("Name %06d", (i*104729)%size),
+			Price:  money.Money{Amount: int64(i), Currency: "VND"},
+			Unit:   "Carton",
+			Status: product.Status(i % 4),
+		}))
+	}
+	minPrice, maxPrice := uint64(1000), uint64(1999)
+	f := product.Filter{NamePrefix: "name 0001", MinPrice: &minPrice, MaxPrice: &maxPrice}
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ps.Query(ctx, f)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			page, _ := ps.List(ctx, product.ListOptions{})
+			var ret []*product.Product
+			for _, p := range page.Items {
+				if f.Match(*p) {
+					ret = append(ret, p)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/reservation"
+	"sampleBackend/internal/storage"
+)
+
+// ReservationStorage keeps reservations in memory, they are lost on
+// restart.
+type ReservationStorage struct {
+	mu           sync.Mutex
+	reservations map[string]reservation.Reservation
+}
+
+func NewReservationStorage() *ReservationStorage {
+	return &ReservationStorage{reservations: make(map[string]reservation.Reservation)}
+}
+
+func (rs *ReservationStorage) Create(_ context.Context, r reservation.Reservation) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.reservations[r.ID]; ok {
+		return fmt.Errorf("%s: %w", r.ID, storage.ErrAlreadyExist)
+	}
+	rs.reservations[r.ID] = cloneReservation(r)
+	return nil
+}
+
+func (rs *ReservationStorage) Get(_ context.Context, id string) (*reservation.Reservation, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	r, ok := rs.reservations[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, storage.ErrNotFound)
+	}
+	r = cloneReservation(r)
+	return &r, nil
+}
+
+func (rs *ReservationStorage) Update(_ context.Context, r reservation.Reservation) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.reservations[r.ID]; !ok {
+		return fmt.Errorf("%s: %w", r.ID, storage.ErrNotFound)
+	}
+	rs.reservations[r.ID] = cloneReservation(r)
+	return nil
+}
+
+func (rs *ReservationStorage) Expired(_ context.Context, t time.Time) ([]reservation.Reservation, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var ret []reservation.Reservation
+	for _, r := range rs.reservations {
+		if r.Expired(t) {
+			ret = append(ret, cloneReservation(r))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ExpiresAt.Before(ret[j].ExpiresAt) })
+	return ret, nil
+}
+
+func (rs *ReservationStorage) Prune(_ context.Context, t time.Time) (int, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	n := 0
+	for id, r := range rs.reservations {
+		if r.Status.Finished() && r.FinishedAt.Before(t) {
+			delete(rs.reservations, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (rs *ReservationStorage) Snapshot(_ context.Context) ([]reservation.Reservation, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ret := make([]reservation.Reservation, 0, len(rs.reservations))
+	for _, r := range rs.reservations {
+		ret = append(ret, cloneReservation(r))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].CreatedAt.Equal(ret[j].CreatedAt) {
+			return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func (rs *ReservationStorage) Restore(_ context.Context, reservations []reservation.Reservation) error {
+	restored := make(map[string]reservation.Reservation, len(reservations))
+	for _, r := range reservations {
+		if _, ok := restored[r.ID]; ok {
+			return fmt.Errorf("%s: %w", r.ID, storage.ErrAlreadyExist)
+		}
+		restored[r.ID] = cloneReservation(r)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.reservations = restored
+	return nil
+}
+
+// cloneReservation copies the items of r, which callers may modify.
+func cloneReservation(r reservation.Reservation) reservation.Reservation {
+	r.Items = append([]product.StockItem(nil), r.Items...)
+	return r
+}
@@ -2,6 +2,8 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
 
 	"sampleBackend/internal/storage"
@@ -31,16 +33,45 @@ func (us *UserStorage) Create(_ context.Context, u user.User) error {
 	return nil
 }
 
-func (us *UserStorage) Verify(_ context.Context, u user.User) error {
+func (us *UserStorage) Get(_ context.Context, email string) (*user.User, error) {
 	us.mu.Lock()
 	defer us.mu.Unlock()
 
-	if item, exist := us.users[u.Email]; exist {
-		if item.Password == u.Password {
-			return nil
+	u, exist := us.users[email]
+	if !exist {
+		return nil, fmt.Errorf("%s: %w", email, storage.ErrNotFound)
+	}
+	return &u, nil
+}
+
+// Snapshot returns a copy of every user ordered by email.
+func (us *UserStorage) Snapshot(_ context.Context) ([]user.User, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	ret := make([]user.User, 0, len(us.users))
+	for _, u := range us.users {
+		ret = append(ret, u)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Email < ret[j].Email
+	})
+	return ret, nil
+}
+
+// Restore atomically replaces every user with users.
+func (us *UserStorage) Restore(_ context.Context, users []user.User) error {
+	m := make(map[string]user.User, len(users))
+	for _, u := range users {
+		if _, exist := m[u.Email]; exist {
+			return fmt.Errorf("restore %q: %w", u.Email, storage.ErrAlreadyExist)
 		}
-		return storage.ErrInvalidInfo
-	} else {
-		return storage.ErrInvalidInfo
+		m[u.Email] = u
 	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.users = m
+	return nil
 }
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+	"sampleBackend/internal/warehouse"
+)
+
+// WarehouseStorage keeps warehouses and transfers in memory, they are lost
+// on restart.
+type WarehouseStorage struct {
+	mu         sync.Mutex
+	warehouses map[string]warehouse.Warehouse
+	transfers  map[string]warehouse.Transfer
+	order      []string
+}
+
+func NewWarehouseStorage() *WarehouseStorage {
+	return &WarehouseStorage{
+		warehouses: make(map[string]warehouse.Warehouse),
+		transfers:  make(map[string]warehouse.Transfer),
+	}
+}
+
+func (ws *WarehouseStorage) CreateWarehouse(_ context.Context, w warehouse.Warehouse) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.warehouses[w.Code]; ok {
+		return fmt.Errorf("%s: %w", w.Code, storage.ErrAlreadyExist)
+	}
+	ws.warehouses[w.Code] = w
+	return nil
+}
+
+func (ws *WarehouseStorage) GetWarehouse(_ context.Context, code string) (*warehouse.Warehouse, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w, ok := ws.warehouses[code]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", code, storage.ErrNotFound)
+	}
+	return &w, nil
+}
+
+func (ws *WarehouseStorage) Warehouses(_ context.Context) ([]warehouse.Warehouse, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ret := make([]warehouse.Warehouse, 0, len(ws.warehouses))
+	for _, w := range ws.warehouses {
+		ret = append(ret, w)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Code < ret[j].Code })
+	return ret, nil
+}
+
+func (ws *WarehouseStorage) CreateTransfer(_ context.Context, t warehouse.Transfer) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.transfers[t.ID]; ok {
+		return fmt.Errorf("%s: %w", t.ID, storage.ErrAlreadyExist)
+	}
+	ws.transfers[t.ID] = cloneTransfer(t)
+	ws.order = append(ws.order, t.ID)
+	return nil
+}
+
+func (ws *WarehouseStorage) GetTransfer(_ context.Context, id string) (*warehouse.Transfer, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	t, ok := ws.transfers[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, storage.ErrNotFound)
+	}
+	t = cloneTransfer(t)
+	return &t, nil
+}
+
+func (ws *WarehouseStorage) UpdateTransfer(_ context.Context, t warehouse.Transfer) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.transfers[t.ID]; !ok {
+		return fmt.Errorf("%s: %w", t.ID, storage.ErrNotFound)
+	}
+	ws.transfers[t.ID] = cloneTransfer(t)
+	return nil
+}
+
+func (ws *WarehouseStorage) Transfers(_ context.Context) ([]warehouse.Transfer, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ret := make([]warehouse.Transfer, 0, len(ws.order))
+	for _, id := range ws.order {
+		ret = append(ret, cloneTransfer(ws.transfers[id]))
+	}
+	return ret, nil
+}
+
+func (ws *WarehouseStorage) Restore(_ context.Context, warehouses []warehouse.Warehouse, transfers []warehouse.Transfer) error {
+	restored := make(map[string]warehouse.Warehouse, len(warehouses))
+	for _, w := range warehouses {
+		if _, ok := restored[w.Code]; ok {
+			return fmt.Errorf("%s: %w", w.Code, storage.ErrAlreadyExist)
+		}
+		restored[w.Code] = w
+	}
+	byID := make(map[string]warehouse.Transfer, len(transfers))
+	order := make([]string, 0, len(transfers))
+	for _, t := range transfers {
+		if _, ok := byID[t.ID]; ok {
+			return fmt.Errorf("%s: %w", t.ID, storage.ErrAlreadyExist)
+		}
+		byID[t.ID] = cloneTransfer(t)
+		order = append(order, t.ID)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.warehouses, ws.transfers, ws.order = restored, byID, order
+	return nil
+}
+
+// cloneTransfer copies the items of t, which callers may modify.
+func cloneTransfer(t warehouse.Transfer) warehouse.Transfer {
+	t.Items = append([]product.StockItem(nil), t.Items...)
+	return t
+}
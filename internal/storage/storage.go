@@ -6,6 +6,7 @@ var (
 	ErrAlreadyExist = errors.New("already exist")
 	ErrInvalidInfo  = errors.New("invalid info")
 	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("version conflict")
 )
 
 func IsErrAlreadyExist(err error) bool {
@@ -19,3 +20,7 @@ func IsErrInvalidInfo(err error) bool {
 func IsErrNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
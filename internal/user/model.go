@@ -1,5 +1,7 @@
 package user
 
+// User is an account. Password is the bcrypt hash of its password once
+// stored, the password itself only on its way to CreateUser and Login.
 type User struct {
 	Email    string
 	Password string
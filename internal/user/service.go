@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
 
 	"sampleBackend/internal/storage"
 )
@@ -18,21 +20,123 @@ var (
 	secretKey = []byte("G+KbPeSh")
 )
 
+// DefaultTokenTTL is how long the tokens of Login are valid.
+const DefaultTokenTTL = 24 * time.Hour
+
 type Storage interface {
 	Create(ctx context.Context, u User) error
-	Verify(ctx context.Context, u User) error
+	Get(ctx context.Context, email string) (*User, error)
+	Snapshot(ctx context.Context) ([]User, error)
+	Restore(ctx context.Context, users []User) error
+}
+
+type Option func(s *Service)
+
+// WithAdmins makes the users of emails administrators, who may back up and
+// restore every user and product. Their accounts are not registered but
+// provisioned with ProvisionAdmins.
+func WithAdmins(emails ...string) Option {
+	return func(s *Service) {
+		for _, e := range emails {
+			s.admins[e] = true
+		}
+	}
+}
+
+// WithHashCost replaces bcrypt.DefaultCost as the cost of the password
+// hashes, e.g. to speed up tests.
+func WithHashCost(cost int) Option {
+	return func(s *Service) {
+		s.cost = cost
+	}
+}
+
+// WithTokenTTL replaces DefaultTokenTTL.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		s.tokenTTL = ttl
+	}
 }
 
 type Service struct {
-	storage Storage
+	storage  Storage
+	admins   map[string]bool
+	cost     int
+	tokenTTL time.Duration
+
+	// mu is held for reading by the writes of users and for writing by
+	// Freeze.
+	mu sync.RWMutex
 }
 
-func NewService(s Storage) *Service {
-	return &Service{storage: s}
+func NewService(s Storage, opts ...Option) *Service {
+	svc := &Service{
+		storage:  s,
+		admins:   make(map[string]bool),
+		cost:     bcrypt.DefaultCost,
+		tokenTTL: DefaultTokenTTL,
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
 }
 
+// HashPassword returns the hash of password stored for users.
+func (s *Service) HashPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(h), nil
+}
+
+// IsHash reports whether hash is a password hash as made by HashPassword.
+func IsHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// IsAdmin reports whether the user of email is an administrator.
+func (s *Service) IsAdmin(email string) bool {
+	return s.admins[email]
+}
+
+// CreateUser registers u. The emails of administrators are refused, their
+// accounts are provisioned.
 func (s *Service) CreateUser(ctx context.Context, u User) error {
-	err := s.storage.Create(ctx, u)
+	if s.IsAdmin(u.Email) {
+		return fmt.Errorf("create user %s: administrator - %w", u.Email, ErrUserExist)
+	}
+	return s.create(ctx, u)
+}
+
+// ProvisionAdmins creates the accounts of the administrators missing from
+// the storage with password.
+func (s *Service) ProvisionAdmins(ctx context.Context, password string) error {
+	if password == "" {
+		return fmt.Errorf("provision admins: no password - %w", ErrUserInvalid)
+	}
+	for email := range s.admins {
+		err := s.create(ctx, User{Email: email, Password: password})
+		if err != nil && !IsErrUserExist(err) {
+			return fmt.Errorf("provision admin %s: %w", email, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) create(ctx context.Context, u User) error {
+	hash, err := s.HashPassword(u.Password)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err = s.storage.Create(ctx, u)
 	if err != nil {
 		if storage.IsErrAlreadyExist(err) {
 			return fmt.Errorf("create user: %v - %w", err, ErrUserExist)
@@ -44,13 +148,16 @@ func (s *Service) CreateUser(ctx context.Context, u User) error {
 
 func (s *Service) Login(ctx context.Context, u User) (*Login, error) {
 	// Check user
-	err := s.storage.Verify(ctx, u)
+	stored, err := s.storage.Get(ctx, u.Email)
 	if err != nil {
-		if storage.IsErrInvalidInfo(err) {
+		if storage.IsErrNotFound(err) {
 			return nil, fmt.Errorf("verify user: %v - %w", err, ErrUserInvalid)
 		}
 		return nil, fmt.Errorf("verify user: %w", err)
 	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(u.Password)); err != nil {
+		return nil, fmt.Errorf("verify user: %v - %w", err, ErrUserInvalid)
+	}
 
 	// Generate token
 	t := time.Now()
@@ -59,6 +166,9 @@ func (s *Service) Login(ctx context.Context, u User) (*Login, error) {
 		IssuedAt: &jwt.NumericDate{
 			Time: t,
 		},
+		ExpiresAt: &jwt.NumericDate{
+			Time: t.Add(s.tokenTTL),
+		},
 	})
 
 	// Sign and get the complete encoded token as a string using the secret
@@ -72,14 +182,72 @@ func (s *Service) Login(ctx context.Context, u User) (*Login, error) {
 	}, nil
 }
 
-func (s *Service) ValidateToken(_ context.Context, tokenString string) error {
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+func (s *Service) ValidateToken(ctx context.Context, tokenString string) error {
+	_, err := s.Authenticate(ctx, tokenString)
+	return err
+}
+
+// Authenticate validates a token, which must not have expired, and returns
+// the email of its user, who must still exist.
+func (s *Service) Authenticate(ctx context.Context, tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return secretKey, nil
 	})
 	if err != nil {
-		return fmt.Errorf("parse token: %w", err)
+		return "", fmt.Errorf("parse token: %v - %w", err, ErrUserInvalid)
+	}
+	if len(claims.Audience) == 0 {
+		return "", fmt.Errorf("parse token: no audience - %w", ErrUserInvalid)
+	}
+	if claims.ExpiresAt == nil {
+		return "", fmt.Errorf("parse token: no expiry - %w", ErrUserInvalid)
+	}
+
+	email := claims.Audience[0]
+	if _, err := s.storage.Get(ctx, email); err != nil {
+		if storage.IsErrNotFound(err) {
+			return "", fmt.Errorf("verify user: %v - %w", err, ErrUserInvalid)
+		}
+		return "", fmt.Errorf("verify user: %w", err)
 	}
+	return email, nil
+}
+
+// Frozen blocks the writes of the users of a Service until thawed, so that
+// backups snapshot or replace them together with other stores.
+type Frozen struct {
+	s    *Service
+	once sync.Once
+}
+
+// Freeze waits for the writes of users in progress and blocks the next
+// ones until Thaw.
+func (s *Service) Freeze() *Frozen {
+	s.mu.Lock()
+	return &Frozen{s: s}
+}
 
+func (f *Frozen) Thaw() {
+	f.once.Do(f.s.mu.Unlock)
+}
+
+// Snapshot returns a copy of every user, used by backups.
+func (f *Frozen) Snapshot(ctx context.Context) ([]User, error) {
+	return f.s.storage.Snapshot(ctx)
+}
+
+// Restore replaces every user, used by backups. Their passwords must be
+// hashed.
+func (f *Frozen) Restore(ctx context.Context, users []User) error {
+	for _, u := range users {
+		if !IsHash(u.Password) {
+			return fmt.Errorf("restore users: %s: password not hashed - %w", u.Email, ErrUserInvalid)
+		}
+	}
+	if err := f.s.storage.Restore(ctx, users); err != nil {
+		return fmt.Errorf("restore users: %w", err)
+	}
 	return nil
 }
 
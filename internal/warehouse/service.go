@@ -0,0 +1,278 @@
+package warehouse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage"
+)
+
+// DefaultName is the name of the warehouse of product.DefaultLocation.
+const DefaultName = "Main warehouse"
+
+// MaxReferenceLength bounds the reference of a transfer.
+const MaxReferenceLength = 120
+
+type Service struct {
+	storage  Storage
+	products *product.Service
+
+	// mu serializes the status changes of the transfers.
+	mu sync.Mutex
+	// writes is held for reading by every write and for writing by Freeze.
+	writes sync.RWMutex
+}
+
+// NewService returns a service of the warehouses of s, which always has
+// the warehouse of product.DefaultLocation.
+func NewService(s Storage, products *product.Service) *Service {
+	err := s.CreateWarehouse(context.Background(), Warehouse{Code: product.DefaultLocation, Name: DefaultName, CreatedAt: time.Now().UTC()})
+	if err != nil && !storage.IsErrAlreadyExist(err) {
+		fmt.Println("warehouse: create default warehouse failed:", err)
+	}
+	return &Service{storage: s, products: products}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("transfer id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *Service) CreateWarehouse(ctx context.Context, w Warehouse) (*Warehouse, error) {
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	w.CreatedAt = time.Now().UTC()
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	if err := s.storage.CreateWarehouse(ctx, w); err != nil {
+		if storage.IsErrAlreadyExist(err) {
+			return nil, ErrExist
+		}
+		return nil, fmt.Errorf("create warehouse: %w", err)
+	}
+	return &w, nil
+}
+
+func (s *Service) GetWarehouse(ctx context.Context, code string) (*Warehouse, error) {
+	w, err := s.storage.GetWarehouse(ctx, code)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get warehouse: %w", err)
+	}
+	return w, nil
+}
+
+func (s *Service) Warehouses(ctx context.Context) ([]Warehouse, error) {
+	ws, err := s.storage.Warehouses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list warehouses: %w", err)
+	}
+	return ws, nil
+}
+
+// CreateTransfer orders the move of items from the warehouse from to to.
+// The stock only moves once the transfer is shipped.
+func (s *Service) CreateTransfer(ctx context.Context, from, to string, items []product.StockItem, reference string) (*Transfer, error) {
+	var fields []product.FieldError
+	if err := product.ValidateStockItems(items); err != nil {
+		var verr *product.ValidationError
+		if !errors.As(err, &verr) {
+			return nil, err
+		}
+		fields = verr.Fields
+	}
+	switch {
+	case from == "":
+		fields = append(fields, product.FieldError{Field: "from", Code: product.CodeRequired, Message: "from is required"})
+	case to == "":
+		fields = append(fields, product.FieldError{Field: "to", Code: product.CodeRequired, Message: "to is required"})
+	case from == to:
+		fields = append(fields, product.FieldError{Field: "to", Code: product.CodeNotAllowed, Message: "to must differ from from"})
+	}
+	if len(reference) > MaxReferenceLength {
+		fields = append(fields, product.FieldError{Field: "reference", Code: product.CodeTooLong, Message: fmt.Sprintf("reference must be at most %d characters", MaxReferenceLength)})
+	}
+	if len(fields) > 0 {
+		return nil, &product.ValidationError{Fields: fields}
+	}
+	for _, code := range []string{from, to} {
+		if _, err := s.GetWarehouse(ctx, code); err != nil {
+			return nil, fmt.Errorf("%s: %w", code, err)
+		}
+	}
+	for _, it := range items {
+		if _, err := s.products.GetProduct(ctx, it.SKU, false); err != nil {
+			return nil, fmt.Errorf("%s: %w", it.SKU, err)
+		}
+	}
+
+	t := Transfer{
+		ID:        newID(),
+		From:      from,
+		To:        to,
+		Items:     append([]product.StockItem(nil), items...),
+		Reference: reference,
+		Status:    TransferPending,
+		CreatedBy: product.ActorFrom(ctx).User,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	if err := s.storage.CreateTransfer(ctx, t); err != nil {
+		return nil, fmt.Errorf("create transfer: %w", err)
+	}
+	return &t, nil
+}
+
+func (s *Service) GetTransfer(ctx context.Context, id string) (*Transfer, error) {
+	t, err := s.storage.GetTransfer(ctx, id)
+	if err != nil {
+		if storage.IsErrNotFound(err) {
+			return nil, ErrTransferNotFound
+		}
+		return nil, fmt.Errorf("get transfer: %w", err)
+	}
+	return t, nil
+}
+
+// Transfers returns the transfers in status, every one when empty, by
+// creation.
+func (s *Service) Transfers(ctx context.Context, status TransferStatus) ([]Transfer, error) {
+	all, err := s.storage.Transfers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list transfers: %w", err)
+	}
+	ret := []Transfer{}
+	for _, t := range all {
+		if status == "" || t.Status == status {
+			ret = append(ret, t)
+		}
+	}
+	return ret, nil
+}
+
+// Ship takes the items of the pending transfer id out of the stock of its
+// source, every one or, when one is short there, none, and puts them in
+// transit.
+func (s *Service) Ship(ctx context.Context, id string) (*Transfer, error) {
+	return s.transition(ctx, id, TransferInTransit, func(t *Transfer) error {
+		if t.Status != TransferPending {
+			return fmt.Errorf("%s is %s: %w", id, t.Status, ErrTransferState)
+		}
+		t.ShippedAt = time.Now().UTC()
+		return s.products.ShipStock(ctx, t.Items, t.From, t.ID)
+	})
+}
+
+// Receive adds the items of the transfer id in transit to the stock of its
+// destination.
+func (s *Service) Receive(ctx context.Context, id string) (*Transfer, error) {
+	return s.transition(ctx, id, TransferReceived, func(t *Transfer) error {
+		if t.Status != TransferInTransit {
+			return fmt.Errorf("%s is %s: %w", id, t.Status, ErrTransferState)
+		}
+		t.ReceivedAt = time.Now().UTC()
+		return s.products.ReceiveStock(ctx, t.Items, t.To, t.ID)
+	})
+}
+
+// Cancel cancels the transfer id. The items of a transfer in transit go
+// back to the stock of its source.
+func (s *Service) Cancel(ctx context.Context, id string) (*Transfer, error) {
+	return s.transition(ctx, id, TransferCancelled, func(t *Transfer) error {
+		t.CancelledAt = time.Now().UTC()
+		switch t.Status {
+		case TransferPending:
+			return nil
+		case TransferInTransit:
+			return s.products.ReceiveStock(ctx, t.Items, t.From, t.ID)
+		}
+		return fmt.Errorf("%s is %s: %w", id, t.Status, ErrTransferState)
+	})
+}
+
+// transition moves the transfer id to status once apply succeeded.
+func (s *Service) transition(ctx context.Context, id string, status TransferStatus, apply func(t *Transfer) error) (*Transfer, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.GetTransfer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(t); err != nil {
+		return nil, err
+	}
+	t.Status = status
+	if err := s.storage.UpdateTransfer(ctx, *t); err != nil {
+		return nil, fmt.Errorf("update transfer: %w", err)
+	}
+	return t, nil
+}
+
+// Frozen blocks the writes of the warehouses and transfers of a Service
+// until thawed, so that backups snapshot or replace them together with the
+// stock in transit.
+type Frozen struct {
+	s    *Service
+	once sync.Once
+}
+
+// Freeze waits for the writes in progress and blocks the next ones until
+// Thaw. It must be called before product.Service.Freeze, as transfers
+// write products.
+func (s *Service) Freeze() *Frozen {
+	s.writes.Lock()
+	return &Frozen{s: s}
+}
+
+func (f *Frozen) Thaw() {
+	f.once.Do(f.s.writes.Unlock)
+}
+
+// Snapshot returns a copy of every warehouse and transfer, used by backups.
+func (f *Frozen) Snapshot(ctx context.Context) ([]Warehouse, []Transfer, error) {
+	ws, err := f.s.storage.Warehouses(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot warehouses: %w", err)
+	}
+	ts, err := f.s.storage.Transfers(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot transfers: %w", err)
+	}
+	return ws, ts, nil
+}
+
+// Restore replaces every warehouse and transfer, used by backups. The
+// warehouse of product.DefaultLocation is kept when warehouses lacks it.
+func (f *Frozen) Restore(ctx context.Context, warehouses []Warehouse, transfers []Transfer) error {
+	found := false
+	for _, w := range warehouses {
+		found = found || w.Code == product.DefaultLocation
+	}
+	if !found {
+		main, err := f.s.storage.GetWarehouse(ctx, product.DefaultLocation)
+		if err != nil {
+			return fmt.Errorf("restore warehouses: %w", err)
+		}
+		warehouses = append([]Warehouse{*main}, warehouses...)
+	}
+	if err := f.s.storage.Restore(ctx, warehouses, transfers); err != nil {
+		return fmt.Errorf("restore warehouses: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package warehouse_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sampleBackend/internal/money"
+	"sampleBackend/internal/product"
+	"sampleBackend/internal/storage/memory"
+	. "sampleBackend/internal/warehouse"
+)
+
+func TestServiceWarehouses(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewWarehouseStorage()
+	svc := NewService(s, product.NewService(memory.NewProductStorage()))
+
+	ws, err := svc.Warehouses(ctx)
+	require.NoError(t, err)
+	require.Len(t, ws, 1)
+	assert.Equal(t, product.DefaultLocation, ws[0].Code)
+
+	w, err := svc.CreateWarehouse(ctx, Warehouse{Code: "north", Name: "North hub"})
+	require.NoError(t, err)
+	assert.False(t, w.CreatedAt.IsZero())
+	_, err = svc.CreateWarehouse(ctx, Warehouse{Code: "north", Name: "Again"})
+	assert.True(t, IsErrExist(err))
+	_, err = svc.CreateWarehouse(ctx, Warehouse{Code: "North Hub"})
+	var verr *product.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 2)
+	assert.Equal(t, "code", verr.Fields[0].Field)
+	assert.Equal(t, "name", verr.Fields[1].Field)
+
+	_, err = svc.GetWarehouse(ctx, "south")
+	assert.True(t, IsErrNotFound(err))
+
+	// A second service on the same storage keeps the warehouses.
+	svc = NewService(s, product.NewService(memory.NewProductStorage()))
+	ws, err = svc.Warehouses(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ws, 2)
+}
+
+func TestServiceTransfers(t *testing.T) {
+	ctx := product.WithActor(context.Background(), product.Actor{User: "ops@example.com"})
+	products := product.NewService(memory.NewProductStorage())
+	svc := NewService(memory.NewWarehouseStorage(), products)
+	_, err := svc.CreateWarehouse(ctx, Warehouse{Code: "north", Name: "North hub"})
+	require.NoError(t, err)
+	_, err = products.AddProduct(ctx, product.Product{SKU: "TR-1", Name: "Tea", Quantity: 10, Price: money.Money{Amount: 10, Currency: "VND"}, Unit: "Box"})
+	require.NoError(t, err)
+	get := func() *product.Product {
+		p, err := products.GetProduct(ctx, "TR-1", false)
+		require.NoError(t, err)
+		return p
+	}
+	items := []product.StockItem{{SKU: "TR-1", Quantity: 4}}
+
+	_, err = svc.CreateTransfer(ctx, "north", "north", items, "")
+	assert.True(t, product.IsErrInvalid(err))
+	_, err = svc.CreateTransfer(ctx, product.DefaultLocation, "south", items, "")
+	assert.True(t, IsErrNotFound(err))
+	_, err = svc.CreateTransfer(ctx, product.DefaultLocation, "north", []product.StockItem{{SKU: "TR-404", Quantity: 1}}, "")
+	assert.True(t, product.IsErrNotFound(err))
+
+	tr, err := svc.CreateTransfer(ctx, product.DefaultLocation, "north", items, "restock")
+	require.NoError(t, err)
+	assert.Equal(t, TransferPending, tr.Status)
+	assert.Equal(t, "ops@example.com", tr.CreatedBy)
+	assert.Equal(t, uint32(10), get().StockAt(product.DefaultLocation))
+	_, err = svc.Receive(ctx, tr.ID)
+	assert.True(t, IsErrTransferState(err))
+
+	tr, err = svc.Ship(ctx, tr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferInTransit, tr.Status)
+	assert.False(t, tr.ShippedAt.IsZero())
+	p := get()
+	assert.Equal(t, uint32(6), p.Quantity)
+	assert.Equal(t, uint32(4), p.InTransit)
+	_, err = svc.Ship(ctx, tr.ID)
+	assert.True(t, IsErrTransferState(err))
+
+	tr, err = svc.Receive(ctx, tr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferReceived, tr.Status)
+	p = get()
+	assert.Equal(t, uint32(10), p.Quantity)
+	assert.Equal(t, uint32(0), p.InTransit)
+	assert.Equal(t, uint32(4), p.StockAt("north"))
+	_, err = svc.Cancel(ctx, tr.ID)
+	assert.True(t, IsErrTransferState(err))
+
+	// A short source fails the shipment and leaves the transfer pending.
+	short, err := svc.CreateTransfer(ctx, "north", product.DefaultLocation, []product.StockItem{{SKU: "TR-1", Quantity: 5}}, "")
+	require.NoError(t, err)
+	_, err = svc.Ship(ctx, short.ID)
+	assert.True(t, product.IsErrInsufficientStock(err))
+	short, err = svc.GetTransfer(ctx, short.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferPending, short.Status)
+	short, err = svc.Cancel(ctx, short.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferCancelled, short.Status)
+
+	// Cancelling a shipped transfer returns the stock to its source.
+	back, err := svc.CreateTransfer(ctx, "north", product.DefaultLocation, []product.StockItem{{SKU: "TR-1", Quantity: 3}}, "")
+	require.NoError(t, err)
+	_, err = svc.Ship(ctx, back.ID)
+	require.NoError(t, err)
+	_, err = svc.Cancel(ctx, back.ID)
+	require.NoError(t, err)
+	p = get()
+	assert.Equal(t, uint32(0), p.InTransit)
+	assert.Equal(t, uint32(4), p.StockAt("north"))
+
+	all, err := svc.Transfers(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	cancelled, err := svc.Transfers(ctx, TransferCancelled)
+	require.NoError(t, err)
+	assert.Len(t, cancelled, 2)
+	_, err = svc.GetTransfer(ctx, "missing")
+	assert.True(t, IsErrTransferNotFound(err))
+}
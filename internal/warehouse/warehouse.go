@@ -0,0 +1,114 @@
+// Package warehouse keeps the locations stock is held at and the transfer
+// orders moving stock between them. The stock itself is tracked per
+// location by the products, see product.StockLevel.
+package warehouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sampleBackend/internal/product"
+)
+
+var (
+	ErrNotFound         = errors.New("warehouse not found")
+	ErrExist            = errors.New("warehouse exist")
+	ErrTransferNotFound = errors.New("transfer not found")
+	// ErrTransferState is returned when a transfer cannot go to a status
+	// from its current one, e.g. receiving a transfer not shipped.
+	ErrTransferState = errors.New("invalid transfer state")
+)
+
+const MaxNameLength = 120
+
+// Warehouse is a location holding stock. Its Code is the location of the
+// stock levels and movements.
+type Warehouse struct {
+	Code      string
+	Name      string
+	CreatedAt time.Time
+}
+
+func (w Warehouse) Validate() error {
+	var fields []product.FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		fields = append(fields, product.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case w.Code == "":
+		add("code", product.CodeRequired, "code is required")
+	case !product.ValidLocation(w.Code):
+		add("code", product.CodeInvalidFormat, "code must be lower case letters and digits separated by single hyphens, at most %d characters", product.MaxLocationLength)
+	}
+	switch {
+	case strings.TrimSpace(w.Name) == "":
+		add("name", product.CodeRequired, "name is required")
+	case utf8.RuneCountInString(w.Name) > MaxNameLength:
+		add("name", product.CodeTooLong, "name must be at most %d characters", MaxNameLength)
+	}
+
+	if len(fields) > 0 {
+		return &product.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+type TransferStatus string
+
+const (
+	TransferPending   TransferStatus = "pending"
+	TransferInTransit TransferStatus = "in_transit"
+	TransferReceived  TransferStatus = "received"
+	TransferCancelled TransferStatus = "cancelled"
+)
+
+// Transfer is an order to move Items from the warehouse From to To. It is
+// pending until shipped, then in transit until received at To.
+type Transfer struct {
+	ID          string
+	From        string
+	To          string
+	Items       []product.StockItem
+	Reference   string
+	Status      TransferStatus
+	CreatedBy   string
+	CreatedAt   time.Time
+	ShippedAt   time.Time
+	ReceivedAt  time.Time
+	CancelledAt time.Time
+}
+
+type Storage interface {
+	CreateWarehouse(ctx context.Context, w Warehouse) error
+	GetWarehouse(ctx context.Context, code string) (*Warehouse, error)
+	// Warehouses returns every warehouse ordered by code.
+	Warehouses(ctx context.Context) ([]Warehouse, error)
+	CreateTransfer(ctx context.Context, t Transfer) error
+	GetTransfer(ctx context.Context, id string) (*Transfer, error)
+	UpdateTransfer(ctx context.Context, t Transfer) error
+	// Transfers returns every transfer ordered by creation.
+	Transfers(ctx context.Context) ([]Transfer, error)
+	// Restore replaces every warehouse and transfer, transfers in order.
+	Restore(ctx context.Context, warehouses []Warehouse, transfers []Transfer) error
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrExist(err error) bool {
+	return errors.Is(err, ErrExist)
+}
+
+func IsErrTransferNotFound(err error) bool {
+	return errors.Is(err, ErrTransferNotFound)
+}
+
+func IsErrTransferState(err error) bool {
+	return errors.Is(err, ErrTransferState)
+}
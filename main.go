@@ -1,7 +1,21 @@
 package main
 
-import "sampleBackend/cmd/server"
+import (
+	"fmt"
+	"os"
+
+	"sampleBackend/cmd/admin"
+	"sampleBackend/cmd/server"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		if err := admin.Run(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	server.New().Start()
 }